@@ -2,85 +2,674 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
 	"time"
-	"strconv"
 
 	"github.com/Puneet-Pal-Singh/dns-server-go/server"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/config"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
 )
 
 func main() {
-	addr := ":5354"
-	upstreamDNS := getUpstreamDNS()
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	check := flag.Bool("healthcheck", false, "exit 0 if the server running with this configuration is ready, 1 otherwise")
+	flag.Parse()
 
-	conn := setupUDP(addr)
-	defer conn.Close()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	if *check {
+		os.Exit(healthcheck(cfg.Admin))
+	}
+	logOutput := setupLogging(cfg.Logging)
+
+	// SIGTERM and interrupts start the shutdown
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	certs := loadCertificate(cfg.TLS)
+	activated := loadActivated()
+	var loops []func(*server.Server) error
+	for _, l := range cfg.Listeners() {
+		loops = append(loops, setupListener(l, cfg.Server.UDPSockets, certs, activated)...)
+	}
+	for _, addr := range activated.Close() {
+		log.Printf("Closed activated socket %s: no listen address matches it", addr)
+	}
+	dropPrivileges(cfg.Server)
+
+	keyring := loadKeyring(cfg.TSIG.KeyFile)
+	zones, fileZones := setupZones(cfg.Zones)
+	secondaries := setupSecondaries(ctx, zones, keyring, cfg.Zones)
+	setupNotify(zones, cfg.Zones.Notify)
+
+	// The query handler is rebuilt by reloads that change its sections
+	build := func(cfg *config.Config) (server.Handler, error) {
+		return newQueryHandler(cfg, zones, keyring, secondaries)
+	}
+	queries, err := build(cfg)
+	if err != nil {
+		log.Fatalf("Config error: %v", err)
+	}
+	handler := server.NewReloadableHandler(queries)
+
+	setupReload(ctx, *configPath, cfg, fileZones, handler, build)
+	metricsServer := setupMetrics(cfg.Metrics)
+
+	srv := server.NewServer(handler, setupTransfers(zones, keyring, cfg.Transfer))
+	setupWorkers(srv, cfg.Server)
+	for _, loop := range loops {
+		go serve(srv, loop)
+	}
+	adminServer := setupAdmin(cfg.Admin, srv, zoneOrigins(fileZones, secondaries))
 
-	log.Printf("DNS server started on %s", addr)
+	<-ctx.Done()
+	stop() // a second signal exits at once
+	shutdown(srv, time.Duration(cfg.Server.ShutdownTimeout), metricsServer, adminServer)
+	log.Printf("Final counters: %s", server.MetricsSnapshot())
+	logOutput.Sync()
+}
 
-	resolver := server.NewDNSResolver(upstreamDNS)
-	baseHandler := server.NewDNSHandler(resolver)
+// shutdown stops taking requests and waits up to timeout for the ones in
+// flight, as rolling deploys expect of a terminated instance. The HTTP
+// servers stop last, so probes see the server draining.
+func shutdown(srv *server.Server, timeout time.Duration, httpServers ...*http.Server) {
+	log.Printf("Shutting down; draining requests for up to %v", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	// Initialize rate limiting
-	ratelimiter := createRateLimiter()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Shutdown: requests still in flight were dropped: %v", err)
+	}
+	for _, hs := range httpServers {
+		if hs != nil {
+			hs.Shutdown(ctx)
+		}
+	}
+	log.Printf("DNS server stopped")
+}
+
+// setupWorkers bounds the goroutines answering UDP requests to
+// server.workers, shedding requests by server.overload when the queue of
+// server.queue_size fills up
+func setupWorkers(srv *server.Server, cfg config.ServerConfig) {
+	if cfg.Workers == 0 {
+		return
+	}
+	overload, err := server.ParseOverloadPolicy(cfg.Overload)
+	if err != nil {
+		log.Fatalf("Config error: server.overload: %v", err)
+	}
+	srv.LimitWorkers(cfg.Workers, cfg.QueueSize, overload)
+	log.Printf("Answering UDP with %d workers, queue of %d (overload: %s)", cfg.Workers, cfg.QueueSize, cfg.Overload)
+}
 
-	// Wrap handler with rate limiting
-	rateLimitedHandler := server.NewRateLimitedHandler(baseHandler, ratelimiter)
+// setupLogging sends the log to stderr, stdout or the file named by
+// output, returning the file so it can be synced at exit
+func setupLogging(cfg config.LoggingConfig) *os.File {
+	server.SetQueryLogging(cfg.Queries)
+	switch cfg.Output {
+	case "stderr":
+		return os.Stderr
+	case "stdout":
+		log.SetOutput(os.Stdout)
+		return os.Stdout
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatalf("Logging error: %v", err)
+		}
+		log.SetOutput(f)
+		return f
+	}
+}
 
-	serveDNS(conn, rateLimitedHandler)
+// loadKeyring reads the TSIG keys of the tsig.key_file key file, if set.
+// The tsig_key settings name keys from it or give them inline.
+func loadKeyring(path string) tsig.Keyring {
+	if path == "" {
+		return tsig.Keyring{}
+	}
+	keys, err := tsig.LoadKeyring(path)
+	if err != nil {
+		log.Fatalf("TSIG key file error: %v", err)
+	}
+	log.Printf("Loaded %d TSIG keys from %s", len(keys), path)
+	return keys
 }
 
-// getUpstreamDNS handles environment configuration
-func getUpstreamDNS() string {
-	if up := os.Getenv("UPSTREAM_DNS"); up != "" {
-		return up
+// tsigKey returns the key named spec in keyring, or parses spec as an
+// inline "[algorithm:]name:base64" key
+func tsigKey(keyring tsig.Keyring, spec string) (tsig.Key, error) {
+	spec = strings.TrimSpace(spec)
+	if !strings.Contains(spec, ":") {
+		key, ok := keyring.Get(spec)
+		if !ok {
+			return tsig.Key{}, fmt.Errorf("unknown TSIG key %q", spec)
+		}
+		return key, nil
 	}
-	return "8.8.8.8:53" // Default to Google DNS
+	return tsig.ParseKey(spec)
 }
 
-// setupUDP handles network configuration
-func setupUDP(addr string) *net.UDPConn {
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+// newQueryHandler builds what answers queries from the sections of cfg a
+// reload can change: the upstream, rate limiting and the plugin chains,
+// with NOTIFY and dynamic updates answered in front of the chains
+func newQueryHandler(cfg *config.Config, zones *server.ZoneStore, keyring tsig.Keyring, secondaries []*server.Secondary) (server.Handler, error) {
+	resolver := server.NewDNSResolver(cfg.Upstream.Address)
+	if err := setupUpstreamTSIG(resolver, keyring, cfg.Upstream.TSIGKey); err != nil {
+		return nil, err
+	}
+	if err := setupDNSSEC(resolver, cfg.Upstream); err != nil {
+		return nil, err
+	}
+
+	env := &server.PluginEnv{Resolver: resolver, Zones: zones, RateLimiter: createRateLimiter(cfg.RateLimit)}
+	chains, err := setupChains(env, cfg.Chains)
 	if err != nil {
-		log.Fatalf("Resolve error: %v", err)
+		return nil, err
+	}
+	return setupUpdates(server.NewNotifyHandler(chains, secondaries...), zones, keyring, cfg.Update)
+}
+
+// setupUpstreamTSIG signs queries to the upstream with upstream.tsig_key
+func setupUpstreamTSIG(resolver *server.DNSResolver, keyring tsig.Keyring, spec string) error {
+	if spec == "" {
+		return nil
 	}
-	conn, err := net.ListenUDP("udp", udpAddr)
+	key, err := tsigKey(keyring, spec)
 	if err != nil {
-		log.Fatalf("Listen error: %v", err)
+		return fmt.Errorf("upstream TSIG: %w", err)
+	}
+	resolver.SignUpstream(&key)
+	log.Printf("Signing upstream queries with TSIG key %s (%s)", key.Name, key.Algorithm)
+	return nil
+}
+
+// setupDNSSEC enables validation when upstream.dnssec_validation is set,
+// trusting the root KSK or the anchors listed in the upstream.trust_anchors
+// file
+func setupDNSSEC(resolver *server.DNSResolver, cfg config.UpstreamConfig) error {
+	if !cfg.DNSSECValidation {
+		return nil
+	}
+
+	var source io.Reader = strings.NewReader(server.DefaultTrustAnchors)
+	if path := cfg.TrustAnchors; path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("trust anchors: %w", err)
+		}
+		defer f.Close()
+		source = f
+	}
+
+	anchors, err := server.ParseTrustAnchors(source)
+	if err != nil {
+		return fmt.Errorf("trust anchors: %w", err)
+	}
+	if err := resolver.EnableDNSSEC(anchors); err != nil {
+		return fmt.Errorf("DNSSEC: %w", err)
+	}
+	log.Printf("DNSSEC validation enabled with %d trust anchors", len(anchors))
+	return nil
+}
+
+// setupZones serves the zones of zones.files authoritatively.
+// zones.signing (nsec, nsec3 or compact) signs them online with ECDSA P-256
+// keys kept in zones.key_dir. The store is created even without zones so
+// a reload can add some.
+func setupZones(cfg config.ZonesConfig) (*server.ZoneStore, *server.FileZones) {
+	store := server.NewZoneStore()
+	fileZones := server.NewFileZones(store, nil)
+	if err := fileZones.LoadFiles(zoneFiles(cfg)); err != nil {
+		log.Fatalf("Zone error: %v", err)
+	}
+	return store, fileZones
+}
+
+// setupChains builds the plugin chain of each configured zone. Without
+// chains every name goes through server.DefaultChain.
+func setupChains(env *server.PluginEnv, chains []config.ChainConfig) (*server.ZoneChains, error) {
+	if len(chains) == 0 {
+		chains = []config.ChainConfig{{Zones: []string{"."}, Plugins: server.DefaultChain}}
+	}
+
+	zoneChains := server.NewZoneChains()
+	for i, chain := range chains {
+		handler, err := server.NewChain(env, chain.Plugins)
+		if err != nil {
+			return nil, fmt.Errorf("chains[%d]: %w", i, err)
+		}
+		for _, name := range chain.Zones {
+			if err := zoneChains.Add(name, handler); err != nil {
+				return nil, fmt.Errorf("chains[%d]: %w", i, err)
+			}
+		}
+		log.Printf("Plugin chain for %s: %s", strings.Join(chain.Zones, ", "), strings.Join(chain.Plugins, " -> "))
+	}
+	return zoneChains, nil
+}
+
+// signers keeps the signer of each zone across reloads, so signatures stay
+// cached and keys are read once
+var signers = map[string]*zone.Signer{}
+
+// zoneFiles lists the zone files of cfg with their signers
+func zoneFiles(cfg config.ZonesConfig) []server.ZoneFile {
+	var denial zone.DenialMode
+	if cfg.Signing != "" {
+		mode, err := zone.ParseDenialMode(cfg.Signing)
+		if err != nil {
+			log.Fatalf("DNSSEC signing error: %v", err)
+		}
+		denial = mode
+	}
+
+	var files []server.ZoneFile
+	for _, entry := range cfg.Files {
+		file := server.ZoneFile{Origin: entry.Origin, Path: entry.Path}
+		if cfg.Signing != "" {
+			origin := dnssec.CanonicalName(entry.Origin)
+			if signers[origin] == nil {
+				signers[origin] = loadSigner(cfg.KeyDir, origin, denial)
+			}
+			file.Signer = signers[origin]
+		}
+		files = append(files, file)
 	}
-	return conn
+	return files
 }
 
-// serveDNS handles the request loop
-func serveDNS(conn *net.UDPConn, handler server.DNSHandler) {
-	buf := make([]byte, 512)
-	for {
-		n, clientAddr, err := conn.ReadFromUDP(buf)
+// setupReload re-reads the configuration and the zone files on SIGHUP and,
+// when zones.reload_interval is set (e.g. "10s"), whenever one of them
+// changes. Changed upstream, rate_limit, chains or update sections get a
+// new query handler built and swapped in, and logging.queries is applied;
+// the sections only a restart applies are reported. Nothing changes when
+// any part of the new configuration fails.
+func setupReload(ctx context.Context, configPath string, running *config.Config, fileZones *server.FileZones, handler *server.ReloadableHandler, build func(*config.Config) (server.Handler, error)) {
+	applied := *running
+	reload := func() error {
+		cfg, err := config.Load(configPath)
 		if err != nil {
-			log.Printf("Read error: %v", err)
-			continue
+			return err
+		}
+		if cfg.Zones.Signing != applied.Zones.Signing || cfg.Zones.KeyDir != applied.Zones.KeyDir {
+			return fmt.Errorf("zones.signing and zones.key_dir cannot change without a restart")
+		}
+		changed := querySections(&applied, cfg)
+		var queries server.Handler
+		if len(changed) > 0 {
+			if queries, err = build(cfg); err != nil {
+				return err
+			}
+		}
+		if err := fileZones.LoadFiles(zoneFiles(cfg.Zones)); err != nil {
+			return err
+		}
+
+		if queries != nil {
+			handler.Swap(queries)
+			log.Printf("[RELOAD] Applied the new %s", strings.Join(changed, ", "))
+		}
+		server.SetQueryLogging(cfg.Logging.Queries)
+		applied.Upstream, applied.RateLimit, applied.Chains, applied.Update = cfg.Upstream, cfg.RateLimit, cfg.Chains, cfg.Update
+		applied.Logging.Queries = cfg.Logging.Queries
+		for _, section := range restartSections(&applied, cfg) {
+			log.Printf("[RELOAD] %s changed; restart to apply it", section)
 		}
-		go server.HandleDNSRequest(conn, clientAddr, buf[:n], handler)
+		return nil
 	}
+	watched := func() []string {
+		paths := fileZones.Paths()
+		if configPath != "" {
+			paths = append(paths, configPath)
+		}
+		return paths
+	}
+
+	reloader := server.NewReloader(reload, watched)
+	go reloader.Run(ctx, time.Duration(running.Zones.ReloadInterval))
 }
 
-func createRateLimiter() server.RateLimiter {
-	capacity := getIntEnv("RATE_LIMIT_CAPACITY", 100)
-	refillSec := getIntEnv("RATE_LIMIT_REFILL", 1)
+// configSection pairs a running section with its value in a new
+// configuration
+type configSection struct {
+	name           string
+	running, value interface{}
+}
+
+// querySections names the sections of next that differ from running and
+// are applied by swapping in a new query handler
+func querySections(running, next *config.Config) []string {
+	return changedSections([]configSection{
+		{"upstream", running.Upstream, next.Upstream},
+		{"rate_limit", running.RateLimit, next.RateLimit},
+		{"chains", running.Chains, next.Chains},
+		{"update", running.Update, next.Update},
+	})
+}
 
-	return server.NewTokenBucketRateLimiter(
-		capacity,
-		time.Duration(refillSec)*time.Second,
-	)
+// restartSections names the sections of next that differ from running and
+// only take effect after a restart: the listeners and sockets, and what
+// runs beside the query handler
+func restartSections(running, next *config.Config) []string {
+	return changedSections([]configSection{
+		{"listen", running.Listen, next.Listen},
+		{"server", running.Server, next.Server},
+		{"tls", running.TLS, next.TLS},
+		{"tsig", running.TSIG, next.TSIG},
+		{"zones.secondaries", running.Zones.Secondaries, next.Zones.Secondaries},
+		{"zones.notify", running.Zones.Notify, next.Zones.Notify},
+		{"transfer", running.Transfer, next.Transfer},
+		{"logging.output", running.Logging.Output, next.Logging.Output},
+		{"metrics", running.Metrics, next.Metrics},
+		{"admin", running.Admin, next.Admin},
+	})
 }
 
-func getIntEnv(name string, defaultValue int) int {
-	if value := os.Getenv(name); value != "" {
-		if intVal, err := strconv.Atoi(value); err == nil {
-			return intVal
+func changedSections(sections []configSection) []string {
+	var changed []string
+	for _, section := range sections {
+		if !reflect.DeepEqual(section.running, section.value) {
+			changed = append(changed, section.name)
 		}
 	}
-	return defaultValue
+	return changed
+}
+
+// setupMetrics serves the query counters at /debug/vars on metrics.listen
+func setupMetrics(cfg config.MetricsConfig) *http.Server {
+	if cfg.Listen == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", server.MetricsHandler())
+	srv := &http.Server{Addr: cfg.Listen, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Metrics server error: %v", err)
+		}
+	}()
+	log.Printf("Metrics served on http://%s/debug/vars", cfg.Listen)
+	return srv
+}
+
+// setupAdmin serves the health probes on admin.listen: /healthz and
+// /livez while the process runs, /readyz once queries are answered
+func setupAdmin(cfg config.AdminConfig, srv *server.Server, origins func() []string) *http.Server {
+	if cfg.Listen == "" {
+		return nil
+	}
+	hs := &http.Server{Addr: cfg.Listen, Handler: server.NewHealthCheck(srv, origins, cfg.ReadyProbe), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Admin server error: %v", err)
+		}
+	}()
+	log.Printf("Health probes served on http://%s/readyz", cfg.Listen)
+	return hs
+}
+
+// zoneOrigins lists the zones readiness requires: the zone files of the
+// running configuration and the secondary zones
+func zoneOrigins(fileZones *server.FileZones, secondaries []*server.Secondary) func() []string {
+	return func() []string {
+		origins := fileZones.Origins()
+		for _, secondary := range secondaries {
+			origins = append(origins, secondary.Origin)
+		}
+		return origins
+	}
+}
+
+// healthcheck asks the admin listener of a running server whether it is
+// ready and returns the exit status, for container health checks in
+// images without an HTTP client
+func healthcheck(cfg config.AdminConfig) int {
+	if cfg.Listen == "" {
+		log.Printf("Health check: admin.listen is not set")
+		return 1
+	}
+	host, port, _ := net.SplitHostPort(cfg.Listen)
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "127.0.0.1"
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get("http://" + net.JoinHostPort(host, port) + "/readyz")
+	if err != nil {
+		log.Printf("Health check: %v", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Health check: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	return 0
+}
+
+// setupSecondaries pulls the zones of zones.secondaries from their
+// primaries, signing transfer requests with zones.secondary_tsig_key when
+// set
+func setupSecondaries(ctx context.Context, zones *server.ZoneStore, keyring tsig.Keyring, cfg config.ZonesConfig) []*server.Secondary {
+	if len(cfg.Secondaries) == 0 {
+		return nil
+	}
+
+	var key *tsig.Key
+	if keySpec := cfg.SecondaryTSIGKey; keySpec != "" {
+		parsed, err := tsigKey(keyring, keySpec)
+		if err != nil {
+			log.Fatalf("Secondary zone error: %v", err)
+		}
+		key = &parsed
+	}
+
+	var secondaries []*server.Secondary
+	for _, entry := range cfg.Secondaries {
+		secondary := server.NewSecondary(entry.Origin, entry.Primaries, key, zones)
+		log.Printf("Secondary for zone %s from %s", secondary.Origin, strings.Join(entry.Primaries, ", "))
+		go secondary.Run(ctx)
+		secondaries = append(secondaries, secondary)
+	}
+	return secondaries
+}
+
+// setupNotify sends NOTIFY to the secondaries of zones.notify whenever a
+// zone's serial changes
+func setupNotify(zones *server.ZoneStore, targets config.NotifyTargets) {
+	if len(targets) == 0 {
+		return
+	}
+
+	notifier := server.NewNotifier()
+	for _, entry := range targets {
+		notifier.SetTargets(entry.Origin, entry.Targets)
+	}
+	zones.OnSerialChange(notifier.ZoneChanged)
+}
+
+// setupTransfers allows AXFR/IXFR of the local zones to the addresses in
+// transfer.allow, additionally requiring transfer.tsig_key signatures when
+// set
+func setupTransfers(zones *server.ZoneStore, keyring tsig.Keyring, cfg config.TransferConfig) *server.TransferServer {
+	if len(cfg.Allow) == 0 {
+		return nil
+	}
+
+	var acl server.TransferACL
+	var err error
+	if acl.Allow, err = server.ParseNetworks(strings.Join(cfg.Allow, ",")); err != nil {
+		log.Fatalf("Transfer ACL error: %v", err)
+	}
+	if spec := cfg.TSIGKey; spec != "" {
+		key, err := tsigKey(keyring, spec)
+		if err != nil {
+			log.Fatalf("Transfer ACL error: %v", err)
+		}
+		acl.Keys = tsig.Keyring{}
+		acl.Keys.Add(key)
+	}
+	log.Printf("Zone transfers allowed to %s (TSIG required: %v)", strings.Join(cfg.Allow, ", "), len(acl.Keys) > 0)
+	return server.NewTransferServer(zones, acl)
+}
+
+// setupUpdates accepts dynamic updates to the local zones signed with one
+// of update.tsig_keys, optionally only from the networks in update.allow
+func setupUpdates(handler server.Handler, zones *server.ZoneStore, keyring tsig.Keyring, cfg config.UpdateConfig) (server.Handler, error) {
+	if len(cfg.TSIGKeys) == 0 {
+		return handler, nil
+	}
+
+	acl := server.UpdateACL{Keys: tsig.Keyring{}}
+	for _, entry := range cfg.TSIGKeys {
+		key, err := tsigKey(keyring, entry)
+		if err != nil {
+			return nil, fmt.Errorf("update ACL: %w", err)
+		}
+		acl.Keys.Add(key)
+	}
+	var err error
+	if acl.Allow, err = server.ParseNetworks(strings.Join(cfg.Allow, ",")); err != nil {
+		return nil, fmt.Errorf("update ACL: %w", err)
+	}
+	log.Printf("Dynamic updates enabled with %d TSIG keys", len(acl.Keys))
+	return server.NewUpdateHandler(handler, zones, acl), nil
+}
+
+// loadSigner loads the zone's KSK and ZSK from dir, generating them on
+// first use
+func loadSigner(dir, origin string, denial zone.DenialMode) *zone.Signer {
+	base := filepath.Join(dir, strings.TrimSuffix(origin, "."))
+
+	ksk, err := dnssec.LoadOrGenerateKey(base+".ksk.pem", dnssec.AlgECDSAP256SHA256, records.DNSKEYFlagZone|records.DNSKEYFlagSEP)
+	if err != nil {
+		log.Fatalf("DNSSEC key error: %v", err)
+	}
+	zsk, err := dnssec.LoadOrGenerateKey(base+".zsk.pem", dnssec.AlgECDSAP256SHA256, records.DNSKEYFlagZone)
+	if err != nil {
+		log.Fatalf("DNSSEC key error: %v", err)
+	}
+	return zone.NewSigner(ksk, zsk, denial)
+}
+
+// loadActivated takes the sockets passed by systemd socket activation
+func loadActivated() *server.ActivatedSockets {
+	activated, err := server.Activated()
+	if err != nil {
+		log.Fatalf("Socket activation error: %v", err)
+	}
+	return activated
+}
+
+// dropPrivileges switches to server.user and server.group once the
+// sockets are open, so binding privileged ports is the only thing done
+// as root
+func dropPrivileges(cfg config.ServerConfig) {
+	if cfg.User == "" {
+		if os.Geteuid() == 0 {
+			log.Printf("Running as root; set server.user to drop privileges after binding")
+		}
+		return
+	}
+	if err := server.DropPrivileges(cfg.User, cfg.Group); err != nil {
+		log.Fatalf("Privilege error: %v", err)
+	}
+	log.Printf("Running as uid %d, gid %d", os.Getuid(), os.Getgid())
+}
+
+// setupUDP uses the activated UDP sockets of addr, or opens the
+// server.udp_sockets UDP sockets of addr
+func setupUDP(addr string, sockets int, activated *server.ActivatedSockets) []*net.UDPConn {
+	if conns := activated.UDP(addr); len(conns) > 0 {
+		return conns
+	}
+	conns, err := server.ListenUDP(addr, sockets)
+	if err != nil {
+		log.Fatalf("Listen error: %v", err)
+	}
+	return conns
+}
+
+// setupTCP listens for DNS over TCP, TLS or HTTPS on addr, with the
+// activated listener of addr if there is one
+func setupTCP(addr string, activated *server.ActivatedSockets) net.Listener {
+	if ln := activated.TCP(addr); ln != nil {
+		return ln
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("Listen error: %v", err)
+	}
+	return ln
+}
+
+// setupListener opens the sockets of one listen entry. Binding happens
+// here, before the server exists and privileges are dropped; the returned loops serve the sockets
+// once it does.
+func setupListener(l config.Listener, sockets int, certs *tls.Config, activated *server.ActivatedSockets) []func(*server.Server) error {
+	var loops []func(*server.Server) error
+	if l.Serves("udp") {
+		conns := setupUDP(l.Addr, sockets, activated)
+		for _, conn := range conns {
+			loops = append(loops, func(srv *server.Server) error { return srv.ServeUDP(conn) })
+		}
+	}
+	switch {
+	case l.Serves("tcp"):
+		ln := setupTCP(l.Addr, activated)
+		loops = append(loops, func(srv *server.Server) error { return srv.ServeTCP(ln) })
+	case l.Serves("dot"):
+		ln := setupTCP(l.Addr, activated)
+		loops = append(loops, func(srv *server.Server) error { return srv.ServeDoT(ln, certs) })
+	case l.Serves("doh"):
+		ln := setupTCP(l.Addr, activated)
+		loops = append(loops, func(srv *server.Server) error { return srv.ServeDoH(ln, certs) })
+	}
+	log.Printf("DNS server started on %s (%s)", l.Addr, strings.Join(l.Protocols, ", "))
+	return loops
+}
+
+// serve runs one read or accept loop until shutdown
+func serve(srv *server.Server, loop func(*server.Server) error) {
+	if err := loop(srv); err != nil {
+		log.Printf("Server error: %v", err)
+	}
+}
+
+// loadCertificate reads the certificate of the DoT and DoH listeners, if
+// configured
+func loadCertificate(cfg config.TLSConfig) *tls.Config {
+	if cfg.CertFile == "" {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		log.Fatalf("TLS error: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+}
+
+func createRateLimiter(cfg config.RateLimitConfig) server.RateLimiter {
+	return server.NewTokenBucketRateLimiter(cfg.Capacity, time.Duration(cfg.Refill))
 }
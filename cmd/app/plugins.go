@@ -0,0 +1,7 @@
+// cmd/app/plugins.go
+package main
+
+// Plugins outside this module are compiled in by importing their package
+// here for its init function, which calls server.RegisterPlugin:
+//
+//	import _ "example.com/dns-plugins/geoip"
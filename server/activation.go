@@ -0,0 +1,154 @@
+// server/activation.go
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first descriptor passed by socket activation
+const listenFDsStart = 3
+
+// ActivatedSockets are the sockets systemd opened for the process (socket
+// activation, LISTEN_FDS). Listen addresses take the ones bound to them
+// instead of binding again; the rest are closed by Close.
+type ActivatedSockets struct {
+	udp []*net.UDPConn
+	tcp []net.Listener
+}
+
+// Activated takes the sockets passed to this process by systemd, if any.
+// The LISTEN_* variables are cleared so child processes don't take them
+// as well.
+func Activated() (*ActivatedSockets, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid == "" || pid != strconv.Itoa(os.Getpid()) {
+		return &ActivatedSockets{}, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+
+	nameList := strings.Split(names, ":")
+	files := make([]*os.File, n)
+	for i := range files {
+		name := fmt.Sprintf("LISTEN_FD_%d", listenFDsStart+i)
+		if i < len(nameList) && nameList[i] != "" {
+			name = nameList[i]
+		}
+		files[i] = os.NewFile(uintptr(listenFDsStart+i), name)
+	}
+	return activatedFromFiles(files)
+}
+
+// activatedFromFiles sorts files into TCP listeners and UDP sockets,
+// closing the files
+func activatedFromFiles(files []*os.File) (*ActivatedSockets, error) {
+	a := &ActivatedSockets{}
+	var err error
+	for _, f := range files {
+		if err == nil {
+			err = a.add(f)
+		}
+		f.Close()
+	}
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *ActivatedSockets) add(f *os.File) error {
+	if ln, err := net.FileListener(f); err == nil {
+		a.tcp = append(a.tcp, ln)
+		return nil
+	}
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return fmt.Errorf("activated socket %s: %w", f.Name(), err)
+	}
+	conn, ok := pc.(*net.UDPConn)
+	if !ok {
+		pc.Close()
+		return fmt.Errorf("activated socket %s is not a TCP or UDP socket", f.Name())
+	}
+	a.udp = append(a.udp, conn)
+	return nil
+}
+
+// UDP takes the activated UDP sockets bound to addr
+func (a *ActivatedSockets) UDP(addr string) []*net.UDPConn {
+	var taken []*net.UDPConn
+	kept := a.udp[:0]
+	for _, conn := range a.udp {
+		if boundTo(conn.LocalAddr(), addr) {
+			taken = append(taken, conn)
+		} else {
+			kept = append(kept, conn)
+		}
+	}
+	a.udp = kept
+	return taken
+}
+
+// TCP takes the activated TCP listener bound to addr, or returns nil
+func (a *ActivatedSockets) TCP(addr string) net.Listener {
+	for i, ln := range a.tcp {
+		if boundTo(ln.Addr(), addr) {
+			a.tcp = append(a.tcp[:i], a.tcp[i+1:]...)
+			return ln
+		}
+	}
+	return nil
+}
+
+// Close closes the sockets no listen address took and returns their
+// addresses
+func (a *ActivatedSockets) Close() []net.Addr {
+	var unused []net.Addr
+	for _, conn := range a.udp {
+		unused = append(unused, conn.LocalAddr())
+		conn.Close()
+	}
+	for _, ln := range a.tcp {
+		unused = append(unused, ln.Addr())
+		ln.Close()
+	}
+	a.udp, a.tcp = nil, nil
+	return unused
+}
+
+// boundTo reports whether a socket bound to local serves the listen
+// address addr. Wildcard addresses of either family match each other, as
+// systemd binds "53" to [::]:53.
+func boundTo(local net.Addr, addr string) bool {
+	want, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil || want.Port == 0 {
+		return false
+	}
+	var ip net.IP
+	var port int
+	switch local := local.(type) {
+	case *net.UDPAddr:
+		ip, port = local.IP, local.Port
+	case *net.TCPAddr:
+		ip, port = local.IP, local.Port
+	default:
+		return false
+	}
+	if port != want.Port {
+		return false
+	}
+	if want.IP == nil || want.IP.IsUnspecified() {
+		return ip == nil || ip.IsUnspecified()
+	}
+	return want.IP.Equal(ip)
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"testing"
+)
+
+func TestActivatedSockets(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket: %v", err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	udpAddr, tcpAddr := pc.LocalAddr().String(), ln.Addr().String()
+	udpFile, err := pc.(*net.UDPConn).File()
+	if err != nil {
+		t.Skipf("File: %v", err)
+	}
+	tcpFile, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File: %v", err)
+	}
+	pc.Close()
+	ln.Close()
+
+	activated, err := activatedFromFiles([]*os.File{udpFile, tcpFile})
+	if err != nil {
+		t.Fatalf("activatedFromFiles: %v", err)
+	}
+	if conns := activated.UDP(tcpAddr); len(conns) != 0 {
+		t.Errorf("UDP(%s) = %v, want none", tcpAddr, conns)
+	}
+	conns := activated.UDP(udpAddr)
+	if len(conns) != 1 {
+		t.Fatalf("UDP(%s) = %v, want the activated socket", udpAddr, conns)
+	}
+	defer conns[0].Close()
+	tcp := activated.TCP(tcpAddr)
+	if tcp == nil {
+		t.Fatalf("TCP(%s) = nil, want the activated listener", tcpAddr)
+	}
+	defer tcp.Close()
+	if unused := activated.Close(); len(unused) != 0 {
+		t.Errorf("unused = %v, want none", unused)
+	}
+
+	// The socket still receives what is sent to its address
+	client, err := net.Dial("udp", udpAddr)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	client.Write([]byte("ping"))
+	buf := make([]byte, 16)
+	n, _, err := conns[0].ReadFromUDP(buf)
+	if err != nil || string(buf[:n]) != "ping" {
+		t.Errorf("read %q, %v; want ping", buf[:n], err)
+	}
+}
+
+func TestBoundTo(t *testing.T) {
+	tests := []struct {
+		local net.Addr
+		addr  string
+		want  bool
+	}{
+		{&net.UDPAddr{IP: net.IPv6unspecified, Port: 53}, ":53", true},
+		{&net.UDPAddr{IP: net.IPv6unspecified, Port: 53}, "0.0.0.0:53", true},
+		{&net.TCPAddr{IP: net.IPv4zero, Port: 53}, "[::]:53", true},
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}, "127.0.0.1:53", true},
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}, ":53", false},
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}, "127.0.0.2:53", false},
+		{&net.UDPAddr{IP: net.IPv6unspecified, Port: 53}, ":5353", false},
+		{&net.UDPAddr{IP: net.IPv6unspecified, Port: 53}, ":0", false},
+	}
+	for _, tt := range tests {
+		if got := boundTo(tt.local, tt.addr); got != tt.want {
+			t.Errorf("boundTo(%v, %q) = %v, want %v", tt.local, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestLookupIDs(t *testing.T) {
+	uid, gid, err := lookupIDs("65532", "65533")
+	if err != nil || uid != 65532 || gid != 65533 {
+		t.Errorf("lookupIDs(65532, 65533) = %d, %d, %v", uid, gid, err)
+	}
+
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("user.Current: %v", err)
+	}
+	if _, err := strconv.Atoi(current.Uid); err != nil {
+		t.Skipf("uid %s is not numeric", current.Uid)
+	}
+	uid, gid, err = lookupIDs(current.Username, "")
+	if err != nil {
+		t.Fatalf("lookupIDs(%s): %v", current.Username, err)
+	}
+	if got, want := fmt.Sprintf("%d:%d", uid, gid), current.Uid+":"+current.Gid; got != want {
+		t.Errorf("lookupIDs(%s) = %s, want %s", current.Username, got, want)
+	}
+	if _, _, err := lookupIDs("no-such-user-here", ""); err == nil {
+		t.Error("lookupIDs of an unknown user succeeded")
+	}
+}
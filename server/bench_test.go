@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// discardSender drops the responses written to it
+type discardSender struct{}
+
+func (discardSender) WriteMsgUDP(b, oob []byte, addr *net.UDPAddr) (int, int, error) {
+	return len(b), len(oob), nil
+}
+
+func benchQuery(tb testing.TB, name string, qtype uint16) []byte {
+	tb.Helper()
+	req := queryMsg(name, qtype)
+	req.EDNS = &EDNS{UDPSize: 1232}
+	query, err := req.Pack()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return query
+}
+
+func BenchmarkDomainParser(b *testing.B) {
+	query := benchQuery(b, "www.example.test", records.TypeA)
+	parser := NewDomainParser()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := parser.Parse(query[12:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnpackMsg(b *testing.B) {
+	query := benchQuery(b, "www.example.test", records.TypeA)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnpackMsg(query); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPack(b *testing.B) {
+	reply := queryMsg("www.example.test", records.TypeMX).Reply()
+	reply.Answer = []records.ResourceRecord{
+		{Name: "www.example.test", Type: records.TypeMX, Class: records.ClassIN, TTL: 300, Data: records.MXData{Preference: 10, Exchange: "mail.example.test"}},
+		{Name: "www.example.test", Type: records.TypeMX, Class: records.ClassIN, TTL: 300, Data: records.MXData{Preference: 20, Exchange: "mail2.example.test"}},
+	}
+	reply.Additional = []records.ResourceRecord{
+		{Name: "mail.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 300, Data: "192.0.2.25"},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := reply.Pack(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkCacheHit measures a UDP query answered from the cache, from the
+// datagram to the packed response
+func BenchmarkCacheHit(b *testing.B) {
+	logQueries.Store(false)
+	defer logQueries.Store(true)
+
+	cache := NewCachedHandler(&countingHandler{}, defaultCacheTTL, defaultCacheSize)
+	query := benchQuery(b, "www.example.test", records.TypeA)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53000}
+	handleUDPRequest(discardSender{}, addr, nil, query, cache)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handleUDPRequest(discardSender{}, addr, nil, query, cache)
+	}
+	b.StopTimer()
+	if hits := cache.entries; len(hits) != 1 {
+		b.Fatalf("cache holds %d entries, want 1", len(hits))
+	}
+}
+
+// BenchmarkCacheMiss measures a UDP query the cache does not hold,
+// forwarded to an upstream on the loopback interface. Two names take
+// turns in a cache of one entry, so every query misses.
+func BenchmarkCacheMiss(b *testing.B) {
+	logQueries.Store(false)
+	defer logQueries.Store(true)
+
+	var forwarded atomic.Int64
+	upstream := startFakeUpstream(b, func(query []byte, _ bool) []byte {
+		forwarded.Add(1)
+		return answerWith(query, records.TypeA, 0x8180, []byte{192, 0, 2, 80})
+	})
+	cache := NewCachedHandler(ForwardHandler(NewDNSResolver(upstream)), defaultCacheTTL, 1)
+	queries := [][]byte{benchQuery(b, "www.example.test", records.TypeA), benchQuery(b, "mail.example.test", records.TypeA)}
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53000}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		handleUDPRequest(discardSender{}, addr, nil, queries[i%2], cache)
+	}
+	b.StopTimer()
+	if n := forwarded.Load(); n != int64(b.N) {
+		b.Fatalf("%d queries forwarded, want %d", n, b.N)
+	}
+}
+
+func TestCacheHit_NoAllocations(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector makes sync.Pool drop items")
+	}
+	logQueries.Store(false)
+	defer logQueries.Store(true)
+
+	cache := NewCachedHandler(&countingHandler{}, defaultCacheTTL, defaultCacheSize)
+	query := benchQuery(t, "www.example.test", records.TypeA)
+	addr := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 53000}
+	handleUDPRequest(discardSender{}, addr, nil, query, cache)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		handleUDPRequest(discardSender{}, addr, nil, query, cache)
+	})
+	if allocs != 0 {
+		t.Errorf("a cache hit makes %v allocations, want 0", allocs)
+	}
+}
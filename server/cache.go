@@ -0,0 +1,226 @@
+// server/cache.go
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Cache defaults for "cache" lines without arguments
+const (
+	defaultCacheTTL  = 60 * time.Second
+	defaultCacheSize = 10000
+)
+
+// CachedHandler remembers the responses of the handler it wraps, for the
+// smallest TTL of their answers but no longer than a fixed time. Cached
+// records are served with the TTL they have left. Once full, the least
+// recently used response makes room for a new one. Authoritative
+// answers, failures and messages other than queries are not cached.
+type CachedHandler struct {
+	next Handler
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	// recent orders the *cacheEntry values, most recently used first
+	recent *list.List
+}
+
+type cacheKey struct {
+	name     string
+	qtype    uint16
+	dnssecOK bool
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	msg     *Msg
+	stored  time.Time
+	expires time.Time
+}
+
+// NewCachedHandler caches up to size responses of next for at most ttl each
+func NewCachedHandler(next Handler, ttl time.Duration, size int) *CachedHandler {
+	return &CachedHandler{next: next, ttl: ttl, size: size, now: time.Now, entries: make(map[cacheKey]*list.Element), recent: list.New()}
+}
+
+func (h *CachedHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	if req.Opcode != opcodeQuery {
+		h.next.ServeDNS(ctx, w, req)
+		return
+	}
+
+	q := req.Question[0]
+	key := cacheKey{name: dnssec.CanonicalName(q.Name), qtype: q.Type, dnssecOK: req.DNSSECOK()}
+	now := h.now()
+	if entry := h.lookup(key, now); entry != nil {
+		metrics.Add(metricCacheHits, 1)
+		storage := cacheReplies.Get().(*cacheReplyStorage)
+		if err := w.WriteMsg(storage.reply(req, entry, now)); err != nil {
+			writeError(w, req, "Response building", err)
+		}
+		storage.reset()
+		cacheReplies.Put(storage)
+		return
+	}
+	metrics.Add(metricCacheMisses, 1)
+	h.next.ServeDNS(ctx, &cachingWriter{ResponseWriter: w, cache: h, key: key}, req)
+}
+
+// lookup returns the entry for key, marked as just used, or nil. An
+// expired entry is dropped.
+func (h *CachedHandler) lookup(key cacheKey, now time.Time) *cacheEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	elem, ok := h.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		h.recent.Remove(elem)
+		delete(h.entries, key)
+		return nil
+	}
+	h.recent.MoveToFront(elem)
+	return entry
+}
+
+// cacheReplies recycles the storage of replies answered from the cache,
+// which writers do not keep
+var cacheReplies = sync.Pool{
+	New: func() interface{} { return new(cacheReplyStorage) },
+}
+
+// cacheReplyStorage backs a reply from the cache. The record sections are
+// copies, so their TTLs can count down without touching the entry.
+type cacheReplyStorage struct {
+	msgStorage
+	answer, authority, additional []records.ResourceRecord
+}
+
+// reply answers req with the cached response, as req.Reply would start
+// it, its TTLs lowered by the time spent in the cache
+func (s *cacheReplyStorage) reply(req *Msg, entry *cacheEntry, now time.Time) *Msg {
+	cached := entry.msg
+	reply := &s.Msg
+	*reply = *cached
+	reply.ID = req.ID
+	reply.RecursionDesired, reply.CheckingDisabled = req.RecursionDesired, req.CheckingDisabled
+	reply.Question = append(s.question[:0], req.Question...)
+	reply.EDNS = nil
+	if req.EDNS != nil {
+		s.edns = EDNS{UDPSize: ednsPayloadSize, DO: req.EDNS.DO}
+		reply.EDNS = &s.edns
+	}
+
+	elapsed := uint32(now.Sub(entry.stored) / time.Second)
+	s.answer = agedRecords(s.answer, cached.Answer, elapsed)
+	s.authority = agedRecords(s.authority, cached.Authority, elapsed)
+	s.additional = agedRecords(s.additional, cached.Additional, elapsed)
+	reply.Answer, reply.Authority, reply.Additional = s.answer, s.authority, s.additional
+	return reply
+}
+
+// reset forgets the reply but keeps the section buffers
+func (s *cacheReplyStorage) reset() {
+	clear(s.answer)
+	clear(s.authority)
+	clear(s.additional)
+	s.msgStorage = msgStorage{}
+	s.answer, s.authority, s.additional = s.answer[:0], s.authority[:0], s.additional[:0]
+}
+
+// agedRecords copies rrs into dst with elapsed seconds taken off each TTL
+func agedRecords(dst, rrs []records.ResourceRecord, elapsed uint32) []records.ResourceRecord {
+	if len(rrs) == 0 {
+		return nil
+	}
+	dst = append(dst[:0], rrs...)
+	for i := range dst {
+		if dst[i].TTL > elapsed {
+			dst[i].TTL -= elapsed
+		} else {
+			dst[i].TTL = 0
+		}
+	}
+	return dst
+}
+
+// store remembers a successful response with answers
+func (h *CachedHandler) store(key cacheKey, m *Msg) {
+	if m.Rcode != 0 || m.Authoritative || m.Truncated || len(m.Answer) == 0 {
+		return
+	}
+	ttl := h.ttl
+	for _, rr := range m.Answer {
+		if d := time.Duration(rr.TTL) * time.Second; rr.TTL != 0 && d < ttl {
+			ttl = d
+		}
+	}
+
+	now := h.now()
+	entry := &cacheEntry{key: key, msg: m.Copy(), stored: now, expires: now.Add(ttl)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if elem, ok := h.entries[key]; ok {
+		elem.Value = entry
+		h.recent.MoveToFront(elem)
+		return
+	}
+	if h.recent.Len() >= h.size {
+		oldest := h.recent.Back()
+		h.recent.Remove(oldest)
+		delete(h.entries, oldest.Value.(*cacheEntry).key)
+	}
+	h.entries[key] = h.recent.PushFront(entry)
+}
+
+// cachingWriter stores the response it passes on
+type cachingWriter struct {
+	ResponseWriter
+	cache *CachedHandler
+	key   cacheKey
+}
+
+func (w *cachingWriter) WriteMsg(m *Msg) error {
+	w.cache.store(w.key, m)
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// setupCache handles "cache [TTL [SIZE]]", TTL being a duration like "5m"
+func setupCache(env *PluginEnv, args []string) (Plugin, error) {
+	ttl, size := defaultCacheTTL, defaultCacheSize
+	if len(args) > 2 {
+		return nil, errors.New("usage: cache [TTL [SIZE]]")
+	}
+	if len(args) > 0 {
+		parsed, err := time.ParseDuration(args[0])
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid TTL %q", args[0])
+		}
+		ttl = parsed
+	}
+	if len(args) > 1 {
+		parsed, err := strconv.Atoi(args[1])
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid size %q", args[1])
+		}
+		size = parsed
+	}
+
+	return func(next Handler) Handler {
+		return NewCachedHandler(next, ttl, size)
+	}, nil
+}
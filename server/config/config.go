@@ -0,0 +1,449 @@
+// Package config reads the server configuration from a YAML file, applies
+// environment variable overrides and validates the result.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the whole server configuration. Every field can be overridden
+// by the environment variable named in its env tag.
+type Config struct {
+	Listen    []string        `yaml:"listen" env:"LISTEN_ADDR"`
+	Server    ServerConfig    `yaml:"server"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Upstream  UpstreamConfig  `yaml:"upstream"`
+	TSIG      TSIGConfig      `yaml:"tsig"`
+	Zones     ZonesConfig     `yaml:"zones"`
+	Transfer  TransferConfig  `yaml:"transfer"`
+	Update    UpdateConfig    `yaml:"update"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Admin     AdminConfig     `yaml:"admin"`
+	Chains    []ChainConfig   `yaml:"chains"`
+}
+
+// ServerConfig controls how the listeners run
+type ServerConfig struct {
+	// ShutdownTimeout bounds how long requests in flight are waited for
+	// after SIGTERM
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// Workers answer UDP requests, which wait in a queue of QueueSize for
+	// them; 0 workers starts a goroutine per request instead
+	Workers   int `yaml:"workers" env:"UDP_WORKERS"`
+	QueueSize int `yaml:"queue_size" env:"UDP_QUEUE_SIZE"`
+	// Overload is drop or refuse, for requests arriving to a full queue
+	Overload string `yaml:"overload" env:"UDP_OVERLOAD"`
+	// UDPSockets opens this many sockets per listen address with
+	// SO_REUSEPORT, each with its own read loop
+	UDPSockets int `yaml:"udp_sockets" env:"UDP_SOCKETS"`
+	// User and Group, names or numeric ids, are switched to once the
+	// listen sockets are open; Group defaults to the user's group
+	User  string `yaml:"user" env:"SERVER_USER"`
+	Group string `yaml:"group" env:"SERVER_GROUP"`
+}
+
+// Listener is a listen entry parsed: an address and the protocols served
+// on it, udp, tcp, dot (DNS over TLS) and doh (DNS over HTTPS). Entries
+// are written "udp+tcp://127.0.0.1:53" or "dot://[::1]:853"; a bare
+// address serves UDP and TCP.
+type Listener struct {
+	Addr      string
+	Protocols []string
+}
+
+// ParseListen parses one listen entry. TCP, DoT and DoH each take the TCP
+// port, so an address serves at most one of them.
+func ParseListen(entry string) (Listener, error) {
+	entry = strings.TrimSpace(entry)
+	scheme, addr, ok := strings.Cut(entry, "://")
+	if !ok {
+		scheme, addr = "udp+tcp", entry
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return Listener{}, err
+	}
+
+	l := Listener{Addr: addr}
+	streams := 0
+	for _, protocol := range strings.Split(strings.ToLower(scheme), "+") {
+		switch protocol {
+		case "udp":
+		case "tcp", "dot", "doh":
+			streams++
+		default:
+			return Listener{}, fmt.Errorf("unknown protocol %q, want udp, tcp, dot or doh", protocol)
+		}
+		if l.Serves(protocol) {
+			return Listener{}, fmt.Errorf("protocol %s listed twice", protocol)
+		}
+		l.Protocols = append(l.Protocols, protocol)
+	}
+	if streams > 1 {
+		return Listener{}, errors.New("tcp, dot and doh each need the TCP port; give them separate addresses")
+	}
+	return l, nil
+}
+
+// Serves reports whether the listener serves protocol
+func (l Listener) Serves(protocol string) bool {
+	for _, p := range l.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// Listeners parses the listen entries, which Validate has checked
+func (c *Config) Listeners() []Listener {
+	var listeners []Listener
+	for _, entry := range c.Listen {
+		if l, err := ParseListen(entry); err == nil {
+			listeners = append(listeners, l)
+		}
+	}
+	return listeners
+}
+
+// TLSConfig is the certificate DoT and DoH listeners present
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" env:"TLS_KEY_FILE"`
+}
+
+// UpstreamConfig is the resolver queries are forwarded to
+type UpstreamConfig struct {
+	Address          string `yaml:"address" env:"UPSTREAM_DNS"`
+	TSIGKey          string `yaml:"tsig_key" env:"UPSTREAM_TSIG_KEY"`
+	DNSSECValidation bool   `yaml:"dnssec_validation" env:"DNSSEC_VALIDATION"`
+	TrustAnchors     string `yaml:"trust_anchors" env:"DNSSEC_TRUST_ANCHORS"`
+}
+
+// TSIGConfig names the key file TSIG keys elsewhere may refer to by name
+type TSIGConfig struct {
+	KeyFile string `yaml:"key_file" env:"TSIG_KEY_FILE"`
+}
+
+// ZonesConfig lists the zones served authoritatively
+type ZonesConfig struct {
+	Files            ZoneFiles      `yaml:"files" env:"ZONE_FILES"`
+	Signing          string         `yaml:"signing" env:"DNSSEC_SIGNING"`
+	KeyDir           string         `yaml:"key_dir" env:"DNSSEC_KEY_DIR"`
+	ReloadInterval   Duration       `yaml:"reload_interval" env:"RELOAD_INTERVAL"`
+	Secondaries      SecondaryZones `yaml:"secondaries" env:"SECONDARY_ZONES"`
+	SecondaryTSIGKey string         `yaml:"secondary_tsig_key" env:"SECONDARY_TSIG_KEY"`
+	Notify           NotifyTargets  `yaml:"notify" env:"NOTIFY_TARGETS"`
+}
+
+// ZoneFile is a zone served from a master file
+type ZoneFile struct {
+	Origin string `yaml:"origin"`
+	Path   string `yaml:"path"`
+}
+
+// SecondaryZone is a zone pulled from its primaries
+type SecondaryZone struct {
+	Origin    string   `yaml:"origin"`
+	Primaries []string `yaml:"primaries"`
+}
+
+// NotifyTarget lists the secondaries notified when a zone changes
+type NotifyTarget struct {
+	Origin  string   `yaml:"origin"`
+	Targets []string `yaml:"targets"`
+}
+
+// TransferConfig controls outgoing zone transfers
+type TransferConfig struct {
+	Allow   []string `yaml:"allow" env:"TRANSFER_ALLOW"`
+	TSIGKey string   `yaml:"tsig_key" env:"TRANSFER_TSIG_KEY"`
+}
+
+// UpdateConfig controls dynamic updates
+type UpdateConfig struct {
+	TSIGKeys []string `yaml:"tsig_keys" env:"UPDATE_TSIG_KEYS"`
+	Allow    []string `yaml:"allow" env:"UPDATE_ALLOW"`
+}
+
+// RateLimitConfig is the per-client token bucket
+type RateLimitConfig struct {
+	Capacity int      `yaml:"capacity" env:"RATE_LIMIT_CAPACITY"`
+	Refill   Duration `yaml:"refill" env:"RATE_LIMIT_REFILL"`
+}
+
+// LoggingConfig says where the log goes: stderr, stdout or a file path,
+// and whether every query received is logged
+type LoggingConfig struct {
+	Output  string `yaml:"output" env:"LOG_OUTPUT"`
+	Queries bool   `yaml:"queries" env:"LOG_QUERIES"`
+}
+
+// MetricsConfig exposes counters over HTTP when Listen is set
+type MetricsConfig struct {
+	Listen string `yaml:"listen" env:"METRICS_LISTEN"`
+}
+
+// AdminConfig serves the health probes over HTTP when Listen is set.
+// ReadyProbe is the name whose NS query, forwarded through the chains,
+// must be answered for the server to be ready; "" skips that check.
+type AdminConfig struct {
+	Listen     string `yaml:"listen" env:"ADMIN_LISTEN"`
+	ReadyProbe string `yaml:"ready_probe" env:"ADMIN_READY_PROBE"`
+}
+
+// ChainConfig is the plugin chain for queries inside zones, written one
+// plugin per line with its arguments, e.g. "cache 5m". The first plugin
+// sees queries first.
+type ChainConfig struct {
+	Zones   []string `yaml:"zones"`
+	Plugins []string `yaml:"plugins"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Listen:    []string{":5354"},
+		Server:    ServerConfig{ShutdownTimeout: Duration(10e9), Workers: 1024, QueueSize: 4096, Overload: "drop", UDPSockets: 1},
+		Upstream:  UpstreamConfig{Address: "8.8.8.8:53"},
+		Zones:     ZonesConfig{KeyDir: "."},
+		RateLimit: RateLimitConfig{Capacity: 100, Refill: Duration(1e9)},
+		Logging:   LoggingConfig{Output: "stderr", Queries: true},
+		Admin:     AdminConfig{ReadyProbe: "."},
+	}
+}
+
+// Load reads the file at path over the defaults, applies the environment
+// overrides and validates the result. With an empty path only the
+// defaults and the environment are used.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if err := cfg.decode(f); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := ApplyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse reads a YAML configuration over the defaults and validates it,
+// without looking at the environment
+func Parse(r io.Reader) (*Config, error) {
+	cfg := Default()
+	if err := cfg.decode(r); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decode rejects unknown keys so misspelled settings are not ignored
+func (c *Config) decode(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// ValidationError lists every problem found in a configuration, each
+// prefixed with the path of the offending field
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// Validate checks the configuration as a whole, reporting every problem
+// rather than the first
+func (c *Config) Validate() error {
+	var errs ValidationError
+	fail := func(field, format string, args ...interface{}) {
+		errs = append(errs, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Listen) == 0 {
+		fail("listen", "at least one address is required")
+	}
+	encrypted := false
+	for i, entry := range c.Listen {
+		l, err := ParseListen(entry)
+		if err != nil {
+			fail(fmt.Sprintf("listen[%d]", i), "%v", err)
+			continue
+		}
+		encrypted = encrypted || l.Serves("dot") || l.Serves("doh")
+	}
+	if encrypted && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		fail("tls", "cert_file and key_file are required by dot and doh listeners")
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		fail("server.shutdown_timeout", "must not be negative")
+	}
+	if c.Server.Workers < 0 {
+		fail("server.workers", "must not be negative, got %d", c.Server.Workers)
+	}
+	if c.Server.QueueSize < 0 {
+		fail("server.queue_size", "must not be negative, got %d", c.Server.QueueSize)
+	}
+	switch strings.ToLower(c.Server.Overload) {
+	case "drop", "refuse":
+	default:
+		fail("server.overload", "must be drop or refuse, got %q", c.Server.Overload)
+	}
+	if c.Server.UDPSockets < 1 {
+		fail("server.udp_sockets", "must be at least 1, got %d", c.Server.UDPSockets)
+	}
+	if c.Server.Group != "" && c.Server.User == "" {
+		fail("server.group", "requires server.user")
+	}
+	if _, _, err := net.SplitHostPort(c.Upstream.Address); err != nil {
+		fail("upstream.address", "%v", err)
+	}
+
+	origins := make(map[string]bool)
+	for i, file := range c.Zones.Files {
+		field := fmt.Sprintf("zones.files[%d]", i)
+		if file.Origin == "" || file.Path == "" {
+			fail(field, "origin and path are required")
+		}
+		if origin := canonical(file.Origin); origins[origin] {
+			fail(field, "zone %s is listed twice", origin)
+		} else {
+			origins[origin] = true
+		}
+	}
+	switch strings.ToLower(c.Zones.Signing) {
+	case "", "nsec", "nsec3", "compact":
+	default:
+		fail("zones.signing", "must be nsec, nsec3 or compact, got %q", c.Zones.Signing)
+	}
+	if c.Zones.ReloadInterval < 0 {
+		fail("zones.reload_interval", "must not be negative")
+	}
+	for i, secondary := range c.Zones.Secondaries {
+		field := fmt.Sprintf("zones.secondaries[%d]", i)
+		if secondary.Origin == "" || len(secondary.Primaries) == 0 {
+			fail(field, "origin and at least one primary are required")
+		}
+		if origin := canonical(secondary.Origin); origins[origin] {
+			fail(field, "zone %s is already served", origin)
+		} else {
+			origins[origin] = true
+		}
+		for j, primary := range secondary.Primaries {
+			if _, _, err := net.SplitHostPort(primary); err != nil {
+				fail(fmt.Sprintf("%s.primaries[%d]", field, j), "%v", err)
+			}
+		}
+	}
+	for i, notify := range c.Zones.Notify {
+		field := fmt.Sprintf("zones.notify[%d]", i)
+		if notify.Origin == "" || len(notify.Targets) == 0 {
+			fail(field, "origin and at least one target are required")
+		}
+		for j, target := range notify.Targets {
+			if _, _, err := net.SplitHostPort(target); err != nil {
+				fail(fmt.Sprintf("%s.targets[%d]", field, j), "%v", err)
+			}
+		}
+	}
+
+	validateNetworks(fail, "transfer.allow", c.Transfer.Allow)
+	validateNetworks(fail, "update.allow", c.Update.Allow)
+	if c.RateLimit.Capacity <= 0 {
+		fail("rate_limit.capacity", "must be positive, got %d", c.RateLimit.Capacity)
+	}
+	if c.RateLimit.Refill <= 0 {
+		fail("rate_limit.refill", "must be positive")
+	}
+	if c.Logging.Output == "" {
+		fail("logging.output", "must be stderr, stdout or a file path")
+	}
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			fail("metrics.listen", "%v", err)
+		}
+	}
+	if c.Admin.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Listen); err != nil {
+			fail("admin.listen", "%v", err)
+		}
+	}
+
+	chainZones := make(map[string]bool)
+	for i, chain := range c.Chains {
+		field := fmt.Sprintf("chains[%d]", i)
+		if len(chain.Zones) == 0 {
+			fail(field+".zones", "at least one zone is required")
+		}
+		for _, z := range chain.Zones {
+			if z := canonical(z); chainZones[z] {
+				fail(field+".zones", "zone %s already has a chain", z)
+			} else {
+				chainZones[z] = true
+			}
+		}
+		if len(chain.Plugins) == 0 {
+			fail(field+".plugins", "at least one plugin is required")
+		}
+		for j, plugin := range chain.Plugins {
+			if strings.TrimSpace(plugin) == "" {
+				fail(fmt.Sprintf("%s.plugins[%d]", field, j), "empty plugin line")
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateNetworks(fail func(field, format string, args ...interface{}), field string, networks []string) {
+	for i, network := range networks {
+		if strings.Contains(network, "/") {
+			if _, _, err := net.ParseCIDR(network); err != nil {
+				fail(fmt.Sprintf("%s[%d]", field, i), "invalid network %q", network)
+			}
+		} else if net.ParseIP(network) == nil {
+			fail(fmt.Sprintf("%s[%d]", field, i), "invalid IP address %q", network)
+		}
+	}
+}
+
+// canonical lower-cases a zone origin and drops the trailing dot
+func canonical(origin string) string {
+	origin = strings.ToLower(strings.TrimSpace(origin))
+	if origin == "." {
+		return origin
+	}
+	return strings.TrimSuffix(origin, ".")
+}
@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const exampleConfig = `
+listen: ["127.0.0.1:53", "[::1]:53", "dot://[::1]:853"]
+tls:
+  cert_file: /etc/dns/tls.crt
+  key_file: /etc/dns/tls.key
+server:
+  shutdown_timeout: 25s
+  workers: 64
+  overload: refuse
+  udp_sockets: 8
+  user: dns
+upstream:
+  address: 1.1.1.1:53
+  dnssec_validation: true
+tsig:
+  key_file: /etc/dns/keys.conf
+zones:
+  files:
+    - origin: example.com.
+      path: /etc/dns/example.com.zone
+  signing: nsec3
+  reload_interval: 30s
+  secondaries:
+    - origin: example.net
+      primaries: ["192.0.2.1:53"]
+  notify:
+    - origin: example.com
+      targets: ["192.0.2.2:53", "192.0.2.3:53"]
+transfer:
+  allow: [192.0.2.0/24]
+  tsig_key: xfr-key
+update:
+  tsig_keys: [update-key]
+rate_limit:
+  capacity: 50
+  refill: 500ms
+logging:
+  output: stdout
+metrics:
+  listen: 127.0.0.1:9153
+admin:
+  listen: 127.0.0.1:8080
+chains:
+  - zones: [example.com]
+    plugins: [file]
+  - zones: [.]
+    plugins:
+      - acl allow 192.0.2.0/24
+      - cache 5m
+      - forward
+`
+
+func TestParse_Example(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(exampleConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(cfg.Listen) != 3 || cfg.Listen[1] != "[::1]:53" {
+		t.Errorf("listen = %v", cfg.Listen)
+	}
+	if listeners := cfg.Listeners(); len(listeners) != 3 || !listeners[2].Serves("dot") || listeners[2].Addr != "[::1]:853" {
+		t.Errorf("listeners = %+v", listeners)
+	}
+	if cfg.TLS.CertFile != "/etc/dns/tls.crt" {
+		t.Errorf("tls = %+v", cfg.TLS)
+	}
+	if time.Duration(cfg.Server.ShutdownTimeout) != 25*time.Second || cfg.Server.Workers != 64 || cfg.Server.Overload != "refuse" || cfg.Server.UDPSockets != 8 || cfg.Server.User != "dns" {
+		t.Errorf("server = %+v", cfg.Server)
+	}
+	if cfg.Upstream.Address != "1.1.1.1:53" || !cfg.Upstream.DNSSECValidation {
+		t.Errorf("upstream = %+v", cfg.Upstream)
+	}
+	if len(cfg.Zones.Files) != 1 || cfg.Zones.Files[0].Path != "/etc/dns/example.com.zone" {
+		t.Errorf("zones.files = %+v", cfg.Zones.Files)
+	}
+	if time.Duration(cfg.Zones.ReloadInterval) != 30*time.Second {
+		t.Errorf("zones.reload_interval = %v", cfg.Zones.ReloadInterval)
+	}
+	if len(cfg.Zones.Notify) != 1 || len(cfg.Zones.Notify[0].Targets) != 2 {
+		t.Errorf("zones.notify = %+v", cfg.Zones.Notify)
+	}
+	if cfg.RateLimit.Capacity != 50 || time.Duration(cfg.RateLimit.Refill) != 500*time.Millisecond {
+		t.Errorf("rate_limit = %+v", cfg.RateLimit)
+	}
+	if len(cfg.Chains) != 2 || cfg.Chains[1].Plugins[1] != "cache 5m" {
+		t.Errorf("chains = %+v", cfg.Chains)
+	}
+	// Unset settings keep their defaults
+	if cfg.Zones.KeyDir != "." {
+		t.Errorf("zones.key_dir = %q, want the default", cfg.Zones.KeyDir)
+	}
+	if cfg.Admin != (AdminConfig{Listen: "127.0.0.1:8080", ReadyProbe: "."}) {
+		t.Errorf("admin = %+v", cfg.Admin)
+	}
+}
+
+func TestParseListen(t *testing.T) {
+	tests := []struct {
+		entry     string
+		addr      string
+		protocols string
+	}{
+		{"127.0.0.1:53", "127.0.0.1:53", "udp+tcp"},
+		{"UDP://[::1]:53", "[::1]:53", "udp"},
+		{"udp+dot://192.0.2.1:853", "192.0.2.1:853", "udp+dot"},
+		{"doh://:443", ":443", "doh"},
+	}
+	for _, tt := range tests {
+		l, err := ParseListen(tt.entry)
+		if err != nil {
+			t.Errorf("ParseListen(%q): %v", tt.entry, err)
+			continue
+		}
+		if l.Addr != tt.addr || strings.Join(l.Protocols, "+") != tt.protocols {
+			t.Errorf("ParseListen(%q) = %+v", tt.entry, l)
+		}
+	}
+
+	for _, entry := range []string{"localhost", "quic://:853", "udp+udp://:53", "tcp+dot://:853"} {
+		if _, err := ParseListen(entry); err == nil {
+			t.Errorf("ParseListen(%q) succeeded, want an error", entry)
+		}
+	}
+}
+
+func TestValidate_TLSRequired(t *testing.T) {
+	_, err := Parse(strings.NewReader(`listen: ["doh://:443"]`))
+	if err == nil || !strings.Contains(err.Error(), "tls:") {
+		t.Errorf("err = %v, want tls reported", err)
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(cfg.Listen) != 1 || cfg.Listen[0] != ":5354" {
+		t.Errorf("listen = %v, want the default", cfg.Listen)
+	}
+}
+
+func TestParse_UnknownKey(t *testing.T) {
+	_, err := Parse(strings.NewReader("rate_limit:\n  capacty: 10\n"))
+	if err == nil || !strings.Contains(err.Error(), "capacty") {
+		t.Errorf("err = %v, want the unknown key named", err)
+	}
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	_, err := Parse(strings.NewReader(`
+listen: ["localhost"]
+zones:
+  files:
+    - origin: example.com
+      path: a.zone
+    - origin: Example.COM.
+      path: b.zone
+  signing: nsec5
+transfer:
+  allow: [192.0.2.0/33]
+rate_limit:
+  capacity: 0
+server:
+  group: dns
+chains:
+  - zones: [.]
+`))
+	var verr ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v, want a ValidationError", err)
+	}
+	want := []string{
+		"listen[0]:",
+		"server.group: requires server.user",
+		"zones.files[1]: zone example.com is listed twice",
+		"zones.signing:",
+		"transfer.allow[0]:",
+		"rate_limit.capacity:",
+		"chains[0].plugins:",
+	}
+	if len(verr) != len(want) {
+		t.Fatalf("errors = %q, want %d", verr, len(want))
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(verr[i], prefix) {
+			t.Errorf("error %d = %q, want prefix %q", i, verr[i], prefix)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	cfg, err := Parse(strings.NewReader(exampleConfig))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	env := map[string]string{
+		"LISTEN_ADDR":       "0.0.0.0:53, 0.0.0.0:5353",
+		"UPSTREAM_DNS":      "9.9.9.9:53",
+		"DNSSEC_VALIDATION": "false",
+		"ZONE_FILES":        "example.org=org.zone,example.net=net.zone",
+		"SECONDARY_ZONES":   "example.edu=192.0.2.1:53|192.0.2.2:53",
+		"RATE_LIMIT_REFILL": "2",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	if err := ApplyEnv(cfg, lookup); err != nil {
+		t.Fatalf("ApplyEnv: %v", err)
+	}
+
+	if len(cfg.Listen) != 2 || cfg.Listen[1] != "0.0.0.0:5353" {
+		t.Errorf("listen = %v", cfg.Listen)
+	}
+	if cfg.Upstream.Address != "9.9.9.9:53" || cfg.Upstream.DNSSECValidation {
+		t.Errorf("upstream = %+v", cfg.Upstream)
+	}
+	if len(cfg.Zones.Files) != 2 || cfg.Zones.Files[1] != (ZoneFile{Origin: "example.net", Path: "net.zone"}) {
+		t.Errorf("zones.files = %+v", cfg.Zones.Files)
+	}
+	if len(cfg.Zones.Secondaries) != 1 || len(cfg.Zones.Secondaries[0].Primaries) != 2 {
+		t.Errorf("zones.secondaries = %+v", cfg.Zones.Secondaries)
+	}
+	if time.Duration(cfg.RateLimit.Refill) != 2*time.Second {
+		t.Errorf("rate_limit.refill = %v, want 2s", cfg.RateLimit.Refill)
+	}
+	// Settings without a variable keep the file's value
+	if cfg.RateLimit.Capacity != 50 {
+		t.Errorf("rate_limit.capacity = %d, want 50", cfg.RateLimit.Capacity)
+	}
+
+	env = map[string]string{"RATE_LIMIT_CAPACITY": "many"}
+	if err := ApplyEnv(cfg, lookup); err == nil || !strings.Contains(err.Error(), "RATE_LIMIT_CAPACITY") {
+		t.Errorf("err = %v, want the variable named", err)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApplyEnv overrides the fields of cfg whose env tag names a variable
+// that lookup finds. Lists are comma separated; the zone lists use the
+// "origin=value|value" form of the historical variables.
+func ApplyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(cfg).Elem(), lookup)
+}
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+func applyEnv(v reflect.Value, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		name := field.Tag.Get("env")
+		if name == "" {
+			if field.Type.Kind() == reflect.Struct {
+				if err := applyEnv(value, lookup); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		text, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setField(value, strings.TrimSpace(text)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(v reflect.Value, text string) error {
+	if reflect.PointerTo(v.Type()).Implements(textUnmarshaler) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", text)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", text)
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(splitList(text, ",")))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList splits text at sep, dropping blank entries
+func splitList(text, sep string) []string {
+	var out []string
+	for _, entry := range strings.Split(text, sep) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
+
+// Duration is a time.Duration written as "10s" or "1m30s". A plain
+// number is a count of seconds, as RATE_LIMIT_REFILL always was.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	if n, err := strconv.Atoi(s); err == nil {
+		*d = Duration(time.Duration(n) * time.Second)
+		return nil
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// ZoneFiles is written "origin=path,..." in ZONE_FILES
+type ZoneFiles []ZoneFile
+
+func (z *ZoneFiles) UnmarshalText(text []byte) error {
+	*z = nil
+	for _, entry := range splitList(string(text), ",") {
+		origin, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("expected origin=path, got %q", entry)
+		}
+		*z = append(*z, ZoneFile{Origin: origin, Path: path})
+	}
+	return nil
+}
+
+// SecondaryZones is written "origin=primary|primary,..." in SECONDARY_ZONES
+type SecondaryZones []SecondaryZone
+
+func (s *SecondaryZones) UnmarshalText(text []byte) error {
+	*s = nil
+	for _, entry := range splitList(string(text), ",") {
+		origin, primaries, ok := strings.Cut(entry, "=")
+		if !ok || primaries == "" {
+			return fmt.Errorf("expected origin=primary, got %q", entry)
+		}
+		*s = append(*s, SecondaryZone{Origin: origin, Primaries: splitList(primaries, "|")})
+	}
+	return nil
+}
+
+// NotifyTargets is written "origin=host:port|host:port,..." in NOTIFY_TARGETS
+type NotifyTargets []NotifyTarget
+
+func (n *NotifyTargets) UnmarshalText(text []byte) error {
+	*n = nil
+	for _, entry := range splitList(string(text), ",") {
+		origin, targets, ok := strings.Cut(entry, "=")
+		if !ok || targets == "" {
+			return fmt.Errorf("expected origin=secondary, got %q", entry)
+		}
+		*n = append(*n, NotifyTarget{Origin: origin, Targets: splitList(targets, "|")})
+	}
+	return nil
+}
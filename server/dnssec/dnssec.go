@@ -0,0 +1,279 @@
+// Package dnssec implements the DNSSEC primitives shared by the validating
+// resolver and the online signer: canonical RRset encoding, key tags, DS
+// digests, and RRSIG creation and verification (RFC 4034, RFC 4035).
+package dnssec
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Signing algorithms (RFC 8624 recommends these for validation)
+const (
+	AlgRSASHA256       uint8 = 8
+	AlgRSASHA512       uint8 = 10
+	AlgECDSAP256SHA256 uint8 = 13
+	AlgECDSAP384SHA384 uint8 = 14
+	AlgED25519         uint8 = 15
+)
+
+// DS digest types
+const (
+	DigestSHA1   uint8 = 1
+	DigestSHA256 uint8 = 2
+	DigestSHA384 uint8 = 4
+)
+
+// KeyTag computes the RFC 4034 appendix B tag of a DNSKEY
+func KeyTag(key records.DNSKEYData) uint16 {
+	rdata, _ := (&records.DNSKEYRecord{}).BuildRecordData(key)
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			ac += uint32(b) << 8
+		} else {
+			ac += uint32(b)
+		}
+	}
+	ac += ac >> 16 & 0xFFFF
+	return uint16(ac & 0xFFFF)
+}
+
+// ComputeDS returns the DS record that delegates to key at owner
+func ComputeDS(owner string, key records.DNSKEYData, digestType uint8) (records.DSData, error) {
+	var h hash.Hash
+	switch digestType {
+	case DigestSHA1:
+		h = sha1.New()
+	case DigestSHA256:
+		h = sha256.New()
+	case DigestSHA384:
+		h = sha512.New384()
+	default:
+		return records.DSData{}, fmt.Errorf("unsupported DS digest type %d", digestType)
+	}
+
+	name, err := canonicalNameWire(owner)
+	if err != nil {
+		return records.DSData{}, err
+	}
+	rdata, err := (&records.DNSKEYRecord{}).BuildRecordData(key)
+	if err != nil {
+		return records.DSData{}, err
+	}
+	h.Write(name)
+	h.Write(rdata)
+
+	return records.DSData{
+		KeyTag:     KeyTag(key),
+		Algorithm:  key.Algorithm,
+		DigestType: digestType,
+		Digest:     h.Sum(nil),
+	}, nil
+}
+
+// MatchesDS reports whether ds delegates to key at owner
+func MatchesDS(owner string, key records.DNSKEYData, ds records.DSData) bool {
+	if ds.KeyTag != KeyTag(key) || ds.Algorithm != key.Algorithm {
+		return false
+	}
+	computed, err := ComputeDS(owner, key, ds.DigestType)
+	return err == nil && bytes.Equal(computed.Digest, ds.Digest)
+}
+
+// LabelCount counts the labels of name as used in the RRSIG labels field:
+// the root has none and a leading wildcard label is not counted
+func LabelCount(name string) uint8 {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return 0
+	}
+	labels := strings.Split(name, ".")
+	if labels[0] == "*" {
+		return uint8(len(labels) - 1)
+	}
+	return uint8(len(labels))
+}
+
+// Parent returns the zone cut candidate directly above name
+func Parent(name string) string {
+	name = CanonicalName(name)
+	if i := strings.IndexByte(name, '.'); i >= 0 && name != "." {
+		return name[i+1:]
+	}
+	return "."
+}
+
+// IsSubdomain reports whether child equals parent or lies below it
+func IsSubdomain(child, parent string) bool {
+	child = strings.ToLower(strings.TrimSuffix(child, "."))
+	parent = strings.ToLower(strings.TrimSuffix(parent, "."))
+	return parent == "" || child == parent || strings.HasSuffix(child, "."+parent)
+}
+
+// CompareNames orders names canonically (RFC 4034 section 6.1): label by
+// label from the root, case-insensitively, comparing label octets
+func CompareNames(a, b string) int {
+	la, lb := reverseLabels(a), reverseLabels(b)
+	for i := 0; i < len(la) && i < len(lb); i++ {
+		if c := strings.Compare(la[i], lb[i]); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+func reverseLabels(name string) []string {
+	name = CanonicalName(name)
+	if name == "." {
+		return nil
+	}
+	labels := strings.Split(name, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels
+}
+
+// HashName computes the NSEC3 hash of name (RFC 5155 section 5); SHA-1 is
+// the only defined algorithm
+func HashName(name string, alg uint8, iterations uint16, salt []byte) ([]byte, error) {
+	if alg != records.NSEC3HashSHA1 {
+		return nil, fmt.Errorf("unsupported NSEC3 hash algorithm %d", alg)
+	}
+	wire, err := canonicalNameWire(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	h.Write(wire)
+	h.Write(salt)
+	digest := h.Sum(nil)
+	for i := uint16(0); i < iterations; i++ {
+		h.Reset()
+		h.Write(digest)
+		h.Write(salt)
+		digest = h.Sum(nil)
+	}
+	return digest, nil
+}
+
+func canonicalNameWire(name string) ([]byte, error) {
+	var buf bytes.Buffer
+	var names records.BaseHandler
+	if err := names.WriteDomainName(&buf, CanonicalName(name)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CanonicalName lowercases name and strips the trailing dot, keeping "." for the root
+func CanonicalName(name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// canonicalData lowercases the names embedded in RDATA for the types listed
+// in RFC 4034 section 6.2
+func canonicalData(rrtype uint16, data interface{}) interface{} {
+	switch d := data.(type) {
+	case string:
+		if rrtype == records.TypeNS || rrtype == records.TypeCNAME {
+			return CanonicalName(d)
+		}
+	case records.MXData:
+		d.Exchange = CanonicalName(d.Exchange)
+		return d
+	case records.SRVData:
+		d.Target = CanonicalName(d.Target)
+		return d
+	case records.RRSIGData:
+		d.SignerName = CanonicalName(d.SignerName)
+		return d
+	case records.SOAData:
+		d.MName = CanonicalName(d.MName)
+		d.RName = CanonicalName(d.RName)
+		return d
+	}
+	return data
+}
+
+// SignedData builds the octets an RRSIG signs: the RRSIG RDATA without the
+// signature followed by the RRset in canonical form and order
+func SignedData(sig records.RRSIGData, rrset []records.ResourceRecord) ([]byte, error) {
+	if len(rrset) == 0 {
+		return nil, errors.New("empty RRset")
+	}
+
+	signer, err := canonicalNameWire(sig.SignerName)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(records.BuildRRSIGHeader(sig))
+	buf.Write(signer)
+
+	owner, err := signedOwner(rrset[0].Name, sig.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	var rdatas [][]byte
+	for _, rr := range rrset {
+		handler, ok := records.HandlerFor(rr.Type)
+		if !ok {
+			return nil, fmt.Errorf("cannot encode type %d", rr.Type)
+		}
+		rdata, err := handler.BuildRecordData(canonicalData(rr.Type, rr.Data))
+		if err != nil {
+			return nil, err
+		}
+		rdatas = append(rdatas, rdata)
+	}
+	sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+
+	for i, rdata := range rdatas {
+		// Duplicate records are not part of an RRset
+		if i > 0 && bytes.Equal(rdata, rdatas[i-1]) {
+			continue
+		}
+		buf.Write(owner)
+		binary.Write(buf, binary.BigEndian, rrset[0].Type)
+		binary.Write(buf, binary.BigEndian, rrset[0].Class)
+		binary.Write(buf, binary.BigEndian, sig.OriginalTTL)
+		binary.Write(buf, binary.BigEndian, uint16(len(rdata)))
+		buf.Write(rdata)
+	}
+	return buf.Bytes(), nil
+}
+
+// signedOwner returns the canonical owner, reduced to "*.<closest labels>"
+// when the RRset was synthesised from a wildcard
+func signedOwner(name string, labels uint8) ([]byte, error) {
+	name = CanonicalName(name)
+	count := LabelCount(name)
+	if labels > count {
+		return nil, fmt.Errorf("RRSIG labels %d exceed owner %q", labels, name)
+	}
+	if labels < count {
+		parts := strings.Split(name, ".")
+		name = "*." + strings.Join(parts[len(parts)-int(labels):], ".")
+		if labels == 0 {
+			name = "*"
+		}
+	}
+	return canonicalNameWire(name)
+}
@@ -0,0 +1,204 @@
+package dnssec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func testRRset() []records.ResourceRecord {
+	return []records.ResourceRecord{
+		{Name: "www.example.net", Type: records.TypeA, Class: records.ClassIN, TTL: 3600, Data: "192.0.2.2"},
+		{Name: "WWW.example.net", Type: records.TypeA, Class: records.ClassIN, TTL: 3600, Data: "192.0.2.1"},
+	}
+}
+
+func TestSignVerify_Algorithms(t *testing.T) {
+	now := time.Now()
+	for _, alg := range []uint8{AlgRSASHA256, AlgRSASHA512, AlgECDSAP256SHA256, AlgECDSAP384SHA384, AlgED25519} {
+		key, err := GenerateKey(alg, records.DNSKEYFlagZone)
+		if err != nil {
+			t.Fatalf("GenerateKey(%d): %v", alg, err)
+		}
+
+		sig, err := Sign(testRRset(), key, "example.net.", now.Add(-time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("Sign(%d): %v", alg, err)
+		}
+		if sig.Labels != 3 || sig.SignerName != "example.net" || sig.KeyTag != KeyTag(key.DNSKEY) {
+			t.Errorf("alg %d: unexpected RRSIG fields %+v", alg, sig)
+		}
+
+		// Record order and owner case must not matter
+		rrset := testRRset()
+		rrset[0], rrset[1] = rrset[1], rrset[0]
+		if err := Verify(sig, key.DNSKEY, rrset, now); err != nil {
+			t.Errorf("alg %d: Verify failed: %v", alg, err)
+		}
+
+		rrset[0].Data = "192.0.2.3"
+		if err := Verify(sig, key.DNSKEY, rrset, now); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("alg %d: tampered RRset: got %v, want ErrBadSignature", alg, err)
+		}
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	now := time.Now()
+	key, err := GenerateKey(AlgED25519, records.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey(AlgED25519, records.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(testRRset(), key, "example.net", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(sig, key.DNSKEY, testRRset(), now.Add(2*time.Hour)); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("expired: got %v", err)
+	}
+	if err := Verify(sig, key.DNSKEY, testRRset(), now.Add(-2*time.Hour)); !errors.Is(err, ErrSignatureExpired) {
+		t.Errorf("not yet valid: got %v", err)
+	}
+	if err := Verify(sig, other.DNSKEY, testRRset(), now); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("wrong key: got %v", err)
+	}
+
+	nonZone := key.DNSKEY
+	nonZone.Flags = 0
+	if err := Verify(sig, nonZone, testRRset(), now); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("non-zone key: got %v", err)
+	}
+
+	mixed := append(testRRset(), records.ResourceRecord{Name: "www.example.net", Type: records.TypeAAAA, Class: records.ClassIN, Data: "2001:db8::1"})
+	if err := Verify(sig, key.DNSKEY, mixed, now); err == nil {
+		t.Error("expected error for a record outside the RRset")
+	}
+
+	if _, err := Sign(testRRset(), key, "example.org", now, now.Add(time.Hour)); err == nil {
+		t.Error("expected error signing for a zone that does not contain the owner")
+	}
+}
+
+func TestSignVerify_Wildcard(t *testing.T) {
+	now := time.Now()
+	key, err := GenerateKey(AlgECDSAP256SHA256, records.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wildcard := []records.ResourceRecord{{Name: "*.example.net", Type: records.TypeTXT, Class: records.ClassIN, TTL: 60, Data: []string{"hi"}}}
+	sig, err := Sign(wildcard, key, "example.net", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Labels != 2 {
+		t.Fatalf("wildcard labels = %d, want 2", sig.Labels)
+	}
+
+	expanded := []records.ResourceRecord{{Name: "a.b.example.net", Type: records.TypeTXT, Class: records.ClassIN, TTL: 60, Data: []string{"hi"}}}
+	if err := Verify(sig, key.DNSKEY, expanded, now); err != nil {
+		t.Errorf("expanded wildcard failed to verify: %v", err)
+	}
+}
+
+// DNSKEY and DS of example.net from RFC 6605 section 6.1
+func TestComputeDS_RFC6605(t *testing.T) {
+	pub, _ := base64.StdEncoding.DecodeString("GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==")
+	key := records.DNSKEYData{Flags: 257, Protocol: 3, Algorithm: AlgECDSAP256SHA256, PublicKey: pub}
+	digest, _ := hex.DecodeString("b4c8c1fe2e7477127b27115656ad6256f424625bf5c1e2770ce6d6e37df61d17")
+
+	if tag := KeyTag(key); tag != 55648 {
+		t.Errorf("KeyTag = %d, want 55648", tag)
+	}
+	ds, err := ComputeDS("example.net.", key, DigestSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(ds.Digest) != hex.EncodeToString(digest) {
+		t.Errorf("digest = %x, want %x", ds.Digest, digest)
+	}
+	if !MatchesDS("EXAMPLE.net", key, records.DSData{KeyTag: 55648, Algorithm: 13, DigestType: 2, Digest: digest}) {
+		t.Error("MatchesDS should ignore owner case")
+	}
+	if MatchesDS("example.org", key, ds) {
+		t.Error("DS must not match a different owner")
+	}
+}
+
+func TestNames(t *testing.T) {
+	if got := LabelCount("*.example.net"); got != 2 {
+		t.Errorf("LabelCount wildcard = %d", got)
+	}
+	if got := LabelCount("."); got != 0 {
+		t.Errorf("LabelCount root = %d", got)
+	}
+	if got := Parent("www.Example.net."); got != "example.net" {
+		t.Errorf("Parent = %q", got)
+	}
+	if got := Parent("net"); got != "." {
+		t.Errorf("Parent of TLD = %q", got)
+	}
+	if !IsSubdomain("a.example.net", ".") || !IsSubdomain("example.net", "EXAMPLE.NET.") || IsSubdomain("badexample.net", "example.net") {
+		t.Error("IsSubdomain mismatch")
+	}
+}
+
+func TestCompareNames(t *testing.T) {
+	// Canonical order example from RFC 4034 section 6.1
+	ordered := []string{"example", "a.example", "yljkjljk.a.example", "Z.a.example", "zABC.a.EXAMPLE", "z.example", "\x01.z.example", "*.z.example", "È.z.example"}
+	for i := 0; i+1 < len(ordered); i++ {
+		if CompareNames(ordered[i], ordered[i+1]) >= 0 {
+			t.Errorf("%q should sort before %q", ordered[i], ordered[i+1])
+		}
+	}
+	if CompareNames("Example.", "example") != 0 {
+		t.Error("names differing in case and trailing dot should be equal")
+	}
+}
+
+func TestHashName_RFC5155(t *testing.T) {
+	salt, _ := hex.DecodeString("aabbccdd")
+	for name, want := range map[string]string{
+		"example":     "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom",
+		"a.example":   "35mthgpgcu1qg68fab165klnsnk3dpvl",
+		"ns1.example": "2t7b4g4vsa5smi47k61mv5bv1a22bojr",
+	} {
+		digest, err := HashName(name, records.NSEC3HashSHA1, 12, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.ToLower(records.Base32Hex.EncodeToString(digest)); got != want {
+			t.Errorf("HashName(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestLoadOrGenerateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.ksk.pem")
+
+	created, err := LoadOrGenerateKey(path, AlgECDSAP256SHA256, records.DNSKEYFlagZone|records.DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	loaded, err := LoadOrGenerateKey(path, AlgECDSAP256SHA256, records.DNSKEYFlagZone|records.DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if KeyTag(created.DNSKEY) != KeyTag(loaded.DNSKEY) {
+		t.Error("Reloaded key differs from the generated one")
+	}
+
+	if _, err := LoadOrGenerateKey(path, AlgED25519, records.DNSKEYFlagZone); err == nil {
+		t.Error("Expected an error for a key of the wrong algorithm")
+	}
+}
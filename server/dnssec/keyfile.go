@@ -0,0 +1,60 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+const pemTypePrivateKey = "PRIVATE KEY"
+
+// LoadOrGenerateKey reads a PKCS#8 PEM private key from path. When the
+// file does not exist a new key is generated and saved there, so a zone
+// keeps its keys, and its DS in the parent, across restarts.
+func LoadOrGenerateKey(path string, algorithm uint8, flags uint16) (*SigningKey, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return generateKeyFile(path, algorithm, flags)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != pemTypePrivateKey {
+		return nil, fmt.Errorf("%s: no %s PEM block", path, pemTypePrivateKey)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%s: key cannot sign", path)
+	}
+	key, err := NewSigningKey(signer, algorithm, flags)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+func generateKeyFile(path string, algorithm uint8, flags uint16) (*SigningKey, error) {
+	key, err := GenerateKey(algorithm, flags)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.Signer)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,146 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// SigningKey pairs a private key with its published DNSKEY
+type SigningKey struct {
+	Signer crypto.Signer
+	DNSKEY records.DNSKEYData
+}
+
+// GenerateKey creates a new key pair; flags are typically DNSKEYFlagZone
+// for a ZSK and DNSKEYFlagZone|DNSKEYFlagSEP for a KSK
+func GenerateKey(algorithm uint8, flags uint16) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+	switch algorithm {
+	case AlgRSASHA256, AlgRSASHA512:
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgECDSAP256SHA256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgECDSAP384SHA384:
+		signer, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case AlgED25519:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %d", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewSigningKey(signer, algorithm, flags)
+}
+
+// NewSigningKey wraps an existing private key
+func NewSigningKey(signer crypto.Signer, algorithm uint8, flags uint16) (*SigningKey, error) {
+	raw, err := encodePublicKey(signer.Public(), algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{
+		Signer: signer,
+		DNSKEY: records.DNSKEYData{Flags: flags, Protocol: 3, Algorithm: algorithm, PublicKey: raw},
+	}, nil
+}
+
+func encodePublicKey(pub crypto.PublicKey, algorithm uint8) ([]byte, error) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if algorithm != AlgRSASHA256 && algorithm != AlgRSASHA512 {
+			break
+		}
+		exponent := big.NewInt(int64(key.E)).Bytes()
+		raw := []byte{byte(len(exponent))}
+		return append(append(raw, exponent...), key.N.Bytes()...), nil
+	case *ecdsa.PublicKey:
+		size := map[uint8]int{AlgECDSAP256SHA256: 32, AlgECDSAP384SHA384: 48}[algorithm]
+		if size == 0 || key.Curve.Params().BitSize != size*8 {
+			break
+		}
+		raw := make([]byte, 2*size)
+		key.X.FillBytes(raw[:size])
+		key.Y.FillBytes(raw[size:])
+		return raw, nil
+	case ed25519.PublicKey:
+		if algorithm == AlgED25519 {
+			return append([]byte(nil), key...), nil
+		}
+	}
+	return nil, fmt.Errorf("key type %T does not match algorithm %d", pub, algorithm)
+}
+
+// Sign creates the RRSIG for rrset, signed by key on behalf of the zone signerName
+func Sign(rrset []records.ResourceRecord, key *SigningKey, signerName string, inception, expiration time.Time) (records.RRSIGData, error) {
+	if len(rrset) == 0 {
+		return records.RRSIGData{}, errors.New("empty RRset")
+	}
+
+	sig := records.RRSIGData{
+		TypeCovered: rrset[0].Type,
+		Algorithm:   key.DNSKEY.Algorithm,
+		Labels:      LabelCount(rrset[0].Name),
+		OriginalTTL: rrset[0].TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      KeyTag(key.DNSKEY),
+		SignerName:  CanonicalName(signerName),
+	}
+	if err := checkRRset(sig, rrset); err != nil {
+		return records.RRSIGData{}, err
+	}
+
+	data, err := SignedData(sig, rrset)
+	if err != nil {
+		return records.RRSIGData{}, err
+	}
+	sig.Signature, err = key.sign(data)
+	if err != nil {
+		return records.RRSIGData{}, err
+	}
+	return sig, nil
+}
+
+func (k *SigningKey) sign(data []byte) ([]byte, error) {
+	switch k.DNSKEY.Algorithm {
+	case AlgRSASHA256:
+		return k.Signer.Sign(rand.Reader, sha256Sum(data), crypto.SHA256)
+	case AlgRSASHA512:
+		return k.Signer.Sign(rand.Reader, sha512Sum(data), crypto.SHA512)
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		digest, hashAlg, size := sha256Sum(data), crypto.SHA256, 32
+		if k.DNSKEY.Algorithm == AlgECDSAP384SHA384 {
+			digest, hashAlg, size = sha384Sum(data), crypto.SHA384, 48
+		}
+		der, err := k.Signer.Sign(rand.Reader, digest, hashAlg)
+		if err != nil {
+			return nil, err
+		}
+		// DNSSEC carries r and s as fixed-size big-endian integers
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(der, &rs); err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 2*size)
+		rs.R.FillBytes(sig[:size])
+		rs.S.FillBytes(sig[size:])
+		return sig, nil
+	case AlgED25519:
+		return k.Signer.Sign(rand.Reader, data, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %d", k.DNSKEY.Algorithm)
+	}
+}
@@ -0,0 +1,175 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Verification failures; callers treat all of them as bogus
+var (
+	ErrSignatureExpired = errors.New("signature outside its validity period")
+	ErrKeyMismatch      = errors.New("signature does not match key")
+	ErrBadSignature     = errors.New("signature verification failed")
+)
+
+// ValidAt reports whether now lies in the inception/expiration window,
+// using serial number arithmetic as RFC 4034 section 3.1.5 requires
+func ValidAt(sig records.RRSIGData, now time.Time) bool {
+	t := uint32(now.Unix())
+	return int32(t-sig.Inception) >= 0 && int32(sig.Expiration-t) >= 0
+}
+
+// Verify checks sig over rrset with key at time now
+func Verify(sig records.RRSIGData, key records.DNSKEYData, rrset []records.ResourceRecord, now time.Time) error {
+	if len(rrset) == 0 {
+		return errors.New("empty RRset")
+	}
+	if err := checkRRset(sig, rrset); err != nil {
+		return err
+	}
+	if key.Protocol != 3 || key.Flags&records.DNSKEYFlagZone == 0 {
+		return fmt.Errorf("%w: not a zone key", ErrKeyMismatch)
+	}
+	if key.Algorithm != sig.Algorithm || KeyTag(key) != sig.KeyTag {
+		return ErrKeyMismatch
+	}
+	if !ValidAt(sig, now) {
+		return ErrSignatureExpired
+	}
+
+	data, err := SignedData(sig, rrset)
+	if err != nil {
+		return err
+	}
+	pub, err := PublicKey(key)
+	if err != nil {
+		return err
+	}
+	return verifySignature(sig.Algorithm, pub, data, sig.Signature)
+}
+
+// checkRRset ensures every record belongs to the RRset the signature covers
+func checkRRset(sig records.RRSIGData, rrset []records.ResourceRecord) error {
+	owner := rrset[0].Name
+	for _, rr := range rrset {
+		if !strings.EqualFold(rr.Name, owner) || rr.Type != sig.TypeCovered || rr.Class != rrset[0].Class {
+			return fmt.Errorf("record %s/%d is not part of the signed %s RRset", rr.Name, rr.Type, records.TypeName(sig.TypeCovered))
+		}
+	}
+	if !IsSubdomain(owner, sig.SignerName) {
+		return fmt.Errorf("signer %q is not authoritative for %q", sig.SignerName, owner)
+	}
+	if sig.Labels > LabelCount(owner) {
+		return fmt.Errorf("RRSIG labels %d exceed owner %q", sig.Labels, owner)
+	}
+	return nil
+}
+
+func verifySignature(algorithm uint8, pub crypto.PublicKey, data, signature []byte) error {
+	switch algorithm {
+	case AlgRSASHA256, AlgRSASHA512:
+		hashAlg, digest := crypto.SHA256, sha256Sum(data)
+		if algorithm == AlgRSASHA512 {
+			hashAlg, digest = crypto.SHA512, sha512Sum(data)
+		}
+		if rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), hashAlg, digest, signature) != nil {
+			return ErrBadSignature
+		}
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		digest := sha256Sum(data)
+		if algorithm == AlgECDSAP384SHA384 {
+			digest = sha384Sum(data)
+		}
+		if len(signature)%2 != 0 {
+			return ErrBadSignature
+		}
+		half := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:half])
+		s := new(big.Int).SetBytes(signature[half:])
+		if !ecdsa.Verify(pub.(*ecdsa.PublicKey), digest, r, s) {
+			return ErrBadSignature
+		}
+	case AlgED25519:
+		if !ed25519.Verify(pub.(ed25519.PublicKey), data, signature) {
+			return ErrBadSignature
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %d", algorithm)
+	}
+	return nil
+}
+
+// PublicKey decodes the DNSKEY public key field for the supported algorithms
+func PublicKey(key records.DNSKEYData) (crypto.PublicKey, error) {
+	raw := key.PublicKey
+	switch key.Algorithm {
+	case AlgRSASHA256, AlgRSASHA512:
+		// RFC 3110: exponent length (1 or 3 octets), exponent, modulus
+		if len(raw) < 3 {
+			return nil, errors.New("RSA key too short")
+		}
+		expLen, offset := int(raw[0]), 1
+		if expLen == 0 {
+			expLen, offset = int(raw[1])<<8|int(raw[2]), 3
+		}
+		if expLen == 0 || expLen > 4 || offset+expLen >= len(raw) {
+			return nil, errors.New("malformed RSA key")
+		}
+		exponent := new(big.Int).SetBytes(raw[offset : offset+expLen])
+		return &rsa.PublicKey{
+			E: int(exponent.Int64()),
+			N: new(big.Int).SetBytes(raw[offset+expLen:]),
+		}, nil
+	case AlgECDSAP256SHA256, AlgECDSAP384SHA384:
+		curve, size := elliptic.P256(), 32
+		if key.Algorithm == AlgECDSAP384SHA384 {
+			curve, size = elliptic.P384(), 48
+		}
+		if len(raw) != 2*size {
+			return nil, errors.New("malformed ECDSA key")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(raw[:size]),
+			Y:     new(big.Int).SetBytes(raw[size:]),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("ECDSA key not on curve")
+		}
+		return pub, nil
+	case AlgED25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, errors.New("malformed Ed25519 key")
+		}
+		return ed25519.PublicKey(raw), nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %d", key.Algorithm)
+	}
+}
+
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+func sha384Sum(data []byte) []byte {
+	sum := sha512.Sum384(data)
+	return sum[:]
+}
+
+func sha512Sum(data []byte) []byte {
+	sum := sha512.Sum512(data)
+	return sum[:]
+}
@@ -0,0 +1,137 @@
+// server/doh.go
+package server
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// DNS over HTTPS (RFC 8484) serves messages at one path in this media type
+const (
+	dohPath      = "/dns-query"
+	dohMediaType = "application/dns-message"
+)
+
+// ServeDoH answers DNS over HTTPS (RFC 8484) at /dns-query on ln, with the
+// certificates of config, until Shutdown. Queries come base64url encoded
+// in the dns parameter of a GET or as the body of a POST. Zone transfers
+// are refused; they need a stream of messages.
+func (s *Server) ServeDoH(ln net.Listener, config *tls.Config) error {
+	hs := &http.Server{
+		Handler:           &dohHandler{srv: s},
+		TLSConfig:         config.Clone(),
+		ReadHeaderTimeout: tcpIdleTimeout,
+		IdleTimeout:       tcpIdleTimeout,
+	}
+	if !s.register(func() {
+		s.listeners[ln] = struct{}{}
+		s.https[hs] = struct{}{}
+	}) {
+		ln.Close()
+		return nil
+	}
+	err := hs.ServeTLS(ln, "", "")
+	if s.shuttingDown() || errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+type dohHandler struct {
+	srv *Server
+}
+
+func (h *dohHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != dohPath {
+		http.NotFound(w, r)
+		return
+	}
+	request, status := readDoHRequest(w, r)
+	if status != http.StatusOK {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if !h.srv.track() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer h.srv.inFlight.Done()
+
+	ctx := &requestContext{Context: r.Context()}
+	hw := &httpWriter{w: w}
+	if remote, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx.clientIP, hw.remote = remote.IP, remote
+	}
+	if txnID, _, _, qtype, err := parseRequest(request); err == nil && (qtype == records.TypeAXFR || qtype == records.TypeIXFR) {
+		sendErrorResponse(hw, txnID, responseRefused)
+		return
+	}
+	serveRequest(ctx, hw, new(msgStorage), request, h.srv.handler)
+	if !hw.written {
+		// Nothing to answer, such as a response sent as a request
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+	}
+}
+
+// readDoHRequest returns the DNS message of r, or the status to fail with
+func readDoHRequest(w http.ResponseWriter, r *http.Request) ([]byte, int) {
+	switch r.Method {
+	case http.MethodGet:
+		msg, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil || len(msg) == 0 {
+			return nil, http.StatusBadRequest
+		}
+		return msg, http.StatusOK
+	case http.MethodPost:
+		if r.Header.Get("Content-Type") != dohMediaType {
+			return nil, http.StatusUnsupportedMediaType
+		}
+		msg, err := io.ReadAll(io.LimitReader(r.Body, 0xFFFF+1))
+		switch {
+		case err != nil || len(msg) == 0:
+			return nil, http.StatusBadRequest
+		case len(msg) > 0xFFFF:
+			return nil, http.StatusRequestEntityTooLarge
+		}
+		return msg, http.StatusOK
+	}
+	w.Header().Set("Allow", "GET, POST")
+	return nil, http.StatusMethodNotAllowed
+}
+
+// httpWriter sends a single response as the body of an HTTP response
+type httpWriter struct {
+	w       http.ResponseWriter
+	remote  net.Addr
+	written bool
+}
+
+func (w *httpWriter) WriteMsg(m *Msg) error {
+	msg, err := packTruncated(m, w.MaxSize())
+	if err != nil {
+		return err
+	}
+	return w.WritePacked(msg)
+}
+
+func (w *httpWriter) WritePacked(msg []byte) error {
+	if w.written {
+		return errors.New("response already written")
+	}
+	w.written = true
+	w.w.Header().Set("Content-Type", dohMediaType)
+	_, err := w.w.Write(msg)
+	return err
+}
+
+func (w *httpWriter) RemoteAddr() net.Addr { return w.remote }
+
+func (w *httpWriter) MaxSize() int {
+	return 0xFFFF
+}
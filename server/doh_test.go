@@ -0,0 +1,146 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// testCertificate makes a self-signed certificate for 127.0.0.1, returning
+// the server config and a client config trusting it
+func testCertificate(t *testing.T) (*tls.Config, *tls.Config) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	server := &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	return server, &tls.Config{RootCAs: roots}
+}
+
+func TestServeDoT(t *testing.T) {
+	serverConfig, clientConfig := testCertificate(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(echoHandler, nil)
+	go srv.ServeDoT(ln, serverConfig)
+	defer srv.Shutdown(context.Background())
+
+	clientConfig.NextProtos = []string{"dot"}
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "dot" {
+		t.Errorf("ALPN protocol %q, want dot", proto)
+	}
+	query, err := queryMsg("example.test", records.TypeA).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(binary.BigEndian.AppendUint16(nil, uint16(len(query)))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(query); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, err := readTCPMessage(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := UnpackMsg(resp); err != nil || !msg.Response {
+		t.Errorf("response %x: %v", resp, err)
+	}
+}
+
+func TestServeDoH(t *testing.T) {
+	serverConfig, clientConfig := testCertificate(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(echoHandler, nil)
+	go srv.ServeDoH(ln, serverConfig)
+	defer srv.Shutdown(context.Background())
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}, Timeout: 2 * time.Second}
+	req := queryMsg("example.test", records.TypeA)
+	req.ID = 0 // RFC 8484 section 4.1, for HTTP caches
+	query, err := req.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://" + ln.Addr().String() + dohPath
+
+	get, err := client.Get(url + "?dns=" + base64.RawURLEncoding.EncodeToString(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := client.Post(url, dohMediaType, bytes.NewReader(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, resp := range []*http.Response{get, post} {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != dohMediaType {
+			t.Errorf("%s: status %d, type %q", resp.Request.Method, resp.StatusCode, resp.Header.Get("Content-Type"))
+			continue
+		}
+		if msg, err := UnpackMsg(body); err != nil || !msg.Response {
+			t.Errorf("%s: response %x: %v", resp.Request.Method, body, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		body        []byte
+		contentType string
+		status      int
+	}{
+		{query, "text/plain", http.StatusUnsupportedMediaType},
+		{nil, dohMediaType, http.StatusBadRequest},
+	} {
+		resp, err := client.Post(url, tt.contentType, bytes.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("POST %q as %s: status %d, want %d", tt.body, tt.contentType, resp.StatusCode, tt.status)
+		}
+	}
+}
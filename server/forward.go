@@ -0,0 +1,79 @@
+// server/forward.go
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// ForwardHandler answers queries with the upstream's response, passed on
+// as it came: response code, answer, authority and additional records,
+// each with its own TTL. Names inside the resolver's zones are answered
+// from them. Clients that did not set DO get no DNSSEC records they did
+// not ask for.
+func ForwardHandler(resolver *DNSResolver) Handler {
+	return &forwardHandler{resolver: resolver}
+}
+
+type forwardHandler struct {
+	resolver *DNSResolver
+}
+
+func (h *forwardHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	// Messages other than queries, such as NOTIFY, are handled by wrappers
+	if req.Opcode != opcodeQuery {
+		writeError(w, req, "Forwarding", fmt.Errorf("%w: opcode %d", ErrRefused, req.Opcode))
+		return
+	}
+	q := req.Question[0]
+	if zones := h.resolver.zones; zones != nil {
+		answer, ok, err := zones.Lookup(ctx, q.Name, q.Type)
+		if err != nil {
+			writeError(w, req, "Zone lookup", err)
+			return
+		}
+		if ok {
+			writeZoneAnswer(w, req, answer)
+			return
+		}
+	}
+
+	resp, err := h.resolver.Exchange(ctx, q.Name, q.Type, req.DNSSECOK(), req.CheckingDisabled)
+	if err != nil {
+		writeError(w, req, "Forwarding", err)
+		return
+	}
+	reply := req.Reply()
+	reply.Rcode = resp.Rcode
+	reply.AuthenticatedData = resp.AuthenticatedData
+	reply.Answer, reply.Authority, reply.Additional = resp.Answer, resp.Authority, resp.Additional
+	if !req.DNSSECOK() {
+		reply.Answer = withoutDNSSEC(reply.Answer, q.Type)
+		reply.Authority = withoutDNSSEC(reply.Authority, q.Type)
+		reply.Additional = withoutDNSSEC(reply.Additional, q.Type)
+	}
+	if reply.Rcode == rcodeServFail {
+		metrics.Add(metricServFail, 1)
+	}
+	if err := w.WriteMsg(reply); err != nil {
+		writeError(w, req, "Response building", err)
+	}
+}
+
+// withoutDNSSEC drops the signatures and denial records of a section,
+// except those of qtype, which the client asked for (RFC 4035, 3.2.1)
+func withoutDNSSEC(rrs []records.ResourceRecord, qtype uint16) []records.ResourceRecord {
+	kept := rrs[:0:0]
+	for _, rr := range rrs {
+		switch rr.Type {
+		case records.TypeRRSIG, records.TypeNSEC, records.TypeNSEC3:
+			if rr.Type != qtype {
+				continue
+			}
+		}
+		kept = append(kept, rr)
+	}
+	return kept
+}
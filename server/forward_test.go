@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func TestForwardHandler(t *testing.T) {
+	var sawDO atomic.Bool
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		req, err := UnpackMsg(query)
+		if err != nil {
+			t.Errorf("upstream got a bad query: %v", err)
+			return nil
+		}
+		sawDO.Store(req.DNSSECOK())
+		reply := req.Reply()
+		reply.AuthenticatedData = true
+		switch req.Question[0].Name {
+		case "www.example.test":
+			reply.Answer = []records.ResourceRecord{
+				{Name: "www.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 42, Data: "192.0.2.1"},
+				{Name: "www.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 17, Data: "192.0.2.2"},
+			}
+		default:
+			reply.Rcode = 3
+			reply.Authority = []records.ResourceRecord{
+				{Name: "example.test", Type: records.TypeSOA, Class: records.ClassIN, TTL: 900, Data: records.SOAData{
+					MName: "ns.example.test", RName: "hostmaster.example.test", Serial: 1, Refresh: 2, Retry: 3, Expire: 4, Minimum: 60,
+				}},
+				{Name: "example.test", Type: records.TypeNSEC, Class: records.ClassIN, TTL: 60, Data: records.NSECData{
+					NextDomain: "www.example.test", Types: []uint16{records.TypeSOA, records.TypeNSEC},
+				}},
+			}
+		}
+		packed, err := reply.Pack()
+		if err != nil {
+			t.Errorf("packing the upstream reply: %v", err)
+		}
+		return packed
+	})
+	handler := ForwardHandler(NewDNSResolver(upstream))
+	ctx := requestFrom("192.0.2.1")
+
+	resp := serve(t, ctx, handler, queryMsg("www.example.test", records.TypeA))
+	if resp.Rcode != 0 || len(resp.Answer) != 2 || resp.Answer[0].TTL != 42 || resp.Answer[1].TTL != 17 {
+		t.Errorf("answer = %+v, want both addresses with the upstream's TTLs", resp.Answer)
+	}
+	if resp.AuthenticatedData {
+		t.Error("AD passed on without validation")
+	}
+
+	// NXDOMAIN keeps its rcode and SOA; the NSEC only goes to DO clients
+	resp = serve(t, ctx, handler, queryMsg("missing.example.test", records.TypeA))
+	if resp.Rcode != 3 || len(resp.Authority) != 1 || resp.Authority[0].Type != records.TypeSOA || resp.Authority[0].TTL != 900 {
+		t.Errorf("NXDOMAIN = rcode %d, authority %+v; want 3 with the SOA", resp.Rcode, resp.Authority)
+	}
+	if sawDO.Load() {
+		t.Error("DO sent upstream for a client that did not set it")
+	}
+	secure := queryMsg("missing.example.test", records.TypeA)
+	secure.EDNS = &EDNS{UDPSize: 1232, DO: true}
+	if resp = serve(t, ctx, handler, secure); resp.Rcode != 3 || len(resp.Authority) != 2 || !sawDO.Load() {
+		t.Errorf("DO client got rcode %d, authority %+v", resp.Rcode, resp.Authority)
+	}
+}
+
+func TestForwardHandler_UpstreamDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(requestFrom("192.0.2.1"))
+	cancel()
+	resp := serve(t, ctx, ForwardHandler(NewDNSResolver("127.0.0.1:1")), queryMsg("www.example.test", records.TypeA))
+	if resp.Rcode != rcodeServFail {
+		t.Errorf("rcode %d, want SERVFAIL", resp.Rcode)
+	}
+}
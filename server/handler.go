@@ -75,8 +75,11 @@ func (h *dnsHandler) HandleQuery(ctx context.Context, domain string, qtype uint1
 	// 	return nil, fmt.Errorf("unsupported query type: %d", qtype)
 	// }
 
-	log.Printf("Resolving domain %s with query type %d", domain, qtype)
-    
+	// Messages other than queries, such as NOTIFY, are handled by wrappers
+	if opcode := opcodeFromContext(ctx); opcode != opcodeQuery {
+		return nil, fmt.Errorf("%w: opcode %d", ErrRefused, opcode)
+	}
+
     // Validate query type
     if !records.IsSupportedType(qtype) {
         return nil, fmt.Errorf("unsupported query type: %d", qtype)
@@ -93,7 +96,6 @@ func (h *dnsHandler) HandleQuery(ctx context.Context, domain string, qtype uint1
         return nil, err
     }
 
-    log.Printf("[%d] Resolved %s → %v", qtype, domain, result)
     return result, nil
 }
 
@@ -113,13 +115,11 @@ func (h *RateLimitedHandler) HandleQuery(ctx context.Context, domain string, qty
 		return nil, errors.New("client IP missing")
 	}
 
-	// Add debug logging
-	log.Printf("[RATE DEBUG] Checking rate limit for %s", ip)
-
 	if !h.limiter.AllowQuery(ip) {
 		h.mu.Lock()
 		log.Printf("[RATE LIMIT] Blocked request from %s for %s", ip, domain)
 		h.mu.Unlock()
+		metrics.Add(metricRateLimited, 1)
 		return nil, errors.New("rate limit exceeded")
 	}
 
@@ -131,7 +131,8 @@ func GetClientIPFromContext(ctx context.Context) (string, bool) {
 	if ip, ok := ctx.Value(clientIPKey).(string); ok {
 		return ip, true
 	}
-	if host, _, err := net.SplitHostPort(ctx.Value("peer").(string)); err == nil {
+	peer, _ := ctx.Value("peer").(string)
+	if host, _, err := net.SplitHostPort(peer); err == nil {
 		return host, true
 	}
 	return "unknown", false
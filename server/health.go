@@ -0,0 +1,145 @@
+// server/health.go
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// readyTimeout bounds the self-queries of one readiness check; a forwarded
+// query gives up on the upstream before this
+const readyTimeout = upstreamTimeout + time.Second
+
+// HealthCheck serves the probes of an admin HTTP listener:
+//
+//   - /healthz and /livez answer 200 while the process runs
+//   - /readyz answers 200 once queries are answered, 503 otherwise
+//
+// Readiness is checked with real queries, packed and parsed like a
+// client's and answered by the server's handler chain from the loopback
+// address: the SOA of every zone that should be served must be answered
+// authoritatively, and the probe name, forwarded to the upstream, must get
+// an answer. A server shutting down is not ready.
+type HealthCheck struct {
+	srv     *Server
+	origins func() []string
+	probe   string
+}
+
+// NewHealthCheck checks srv. origins lists the zones that must be served;
+// probe is the name whose NS query must be answered, "" for none.
+func NewHealthCheck(srv *Server, origins func() []string, probe string) *HealthCheck {
+	return &HealthCheck{srv: srv, origins: origins, probe: probe}
+}
+
+// Ready returns why the server cannot answer queries yet, or nil
+func (h *HealthCheck) Ready(ctx context.Context) error {
+	if h.srv.shuttingDown() {
+		return errors.New("shutting down")
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+
+	for _, origin := range h.origins() {
+		reply, err := h.query(ctx, origin, records.TypeSOA)
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", origin, err)
+		}
+		if reply.Rcode != 0 || !reply.Authoritative || len(reply.Answer) == 0 {
+			return fmt.Errorf("zone %s is not served (rcode %d, authoritative %v)", origin, reply.Rcode, reply.Authoritative)
+		}
+	}
+	if h.probe != "" {
+		reply, err := h.query(ctx, h.probe, records.TypeNS)
+		if err != nil {
+			return fmt.Errorf("upstream: %w", err)
+		}
+		if reply.Rcode != 0 {
+			return fmt.Errorf("upstream: %s NS answered with rcode %d", h.probe, reply.Rcode)
+		}
+	}
+	return nil
+}
+
+// query asks the handler chain name/qtype and returns the parsed reply
+func (h *HealthCheck) query(ctx context.Context, name string, qtype uint16) (*Msg, error) {
+	req := &Msg{
+		ID:               queryID(),
+		RecursionDesired: true,
+		Question:         []Question{{Name: name, Type: qtype, Class: records.ClassIN}},
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &probeWriter{done: make(chan []byte, 1)}
+	go serveRequest(&requestContext{Context: ctx, clientIP: net.IPv4(127, 0, 0, 1)}, w, new(msgStorage), packed, h.srv.handler)
+	select {
+	case resp := <-w.done:
+		reply, err := UnpackMsg(resp)
+		if err != nil {
+			return nil, err
+		}
+		if reply.ID != req.ID || !reply.Response {
+			return nil, errors.New("reply does not match the query")
+		}
+		return reply, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no answer for %s: %w", name, ctx.Err())
+	}
+}
+
+// probeWriter hands the packed reply of a self-query to the waiting check
+type probeWriter struct {
+	done chan []byte
+}
+
+func (w *probeWriter) WriteMsg(m *Msg) error {
+	msg, err := packTruncated(m, w.MaxSize())
+	if err != nil {
+		return err
+	}
+	return w.WritePacked(msg)
+}
+
+func (w *probeWriter) WritePacked(msg []byte) error {
+	select {
+	case w.done <- append([]byte(nil), msg...):
+		return nil
+	default:
+		return errors.New("response already written")
+	}
+}
+
+func (w *probeWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func (w *probeWriter) MaxSize() int {
+	return 0xFFFF
+}
+
+// ServeHTTP answers /healthz, /livez and /readyz with "ok" or the reason
+// the server is not ready
+func (h *HealthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz", "/livez":
+	case "/readyz":
+		if err := h.Ready(r.Context()); err != nil {
+			http.Error(w, "not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func TestHealthCheck(t *testing.T) {
+	var failing atomic.Bool
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		if failing.Load() {
+			return answerWith(query, records.TypeNS, 0x8182)
+		}
+		return answerWith(query, records.TypeNS, 0x8180, []byte("\x01a\x0croot-servers\x03net\x00"))
+	})
+	env := &PluginEnv{Zones: newTestStore(t, nil), Resolver: NewDNSResolver(upstream)}
+	chain, err := NewChain(env, []string{"file", "forward"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(chain, nil)
+	origins := []string{"example.test."}
+	check := NewHealthCheck(srv, func() []string { return origins }, ".")
+
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		check.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	for _, path := range []string{"/healthz", "/livez", "/readyz"} {
+		if code := probe(path); code != http.StatusOK {
+			t.Errorf("%s = %d, want 200", path, code)
+		}
+	}
+	if code := probe("/metrics"); code != http.StatusNotFound {
+		t.Errorf("/metrics = %d, want 404", code)
+	}
+
+	// A zone that is not loaded is forwarded, and the answer is not
+	// authoritative
+	origins = []string{"example.test.", "missing.test."}
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz with a zone missing = %d, want 503", code)
+	}
+	origins = []string{"example.test."}
+
+	failing.Store(true)
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz with the upstream failing = %d, want 503", code)
+	}
+	failing.Store(false)
+
+	// Draining is alive but not ready
+	srv.Shutdown(context.Background())
+	if code := probe("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz while shutting down = %d, want 503", code)
+	}
+	if code := probe("/livez"); code != http.StatusOK {
+		t.Errorf("/livez while shutting down = %d, want 200", code)
+	}
+}
@@ -0,0 +1,111 @@
+// server/hosts.go
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+const (
+	defaultHostsFile = "/etc/hosts"
+	hostsTTL         = 3600
+)
+
+// Hosts maps names to addresses as an /etc/hosts file does
+type Hosts struct {
+	v4 map[string][]string
+	v6 map[string][]string
+}
+
+// ParseHosts reads "address name [alias...]" lines; '#' starts a comment
+func ParseHosts(r io.Reader) (*Hosts, error) {
+	h := &Hosts{v4: make(map[string][]string), v6: make(map[string][]string)}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil {
+			continue
+		}
+		table := h.v6
+		if ip.To4() != nil {
+			table = h.v4
+		}
+		for _, name := range fields[1:] {
+			name = dnssec.CanonicalName(name)
+			table[name] = append(table[name], ip.String())
+		}
+	}
+	return h, scanner.Err()
+}
+
+// Lookup returns the address records of name for an A or AAAA query
+func (h *Hosts) Lookup(name string, qtype uint16) ([]records.ResourceRecord, bool) {
+	var table map[string][]string
+	switch qtype {
+	case records.TypeA:
+		table = h.v4
+	case records.TypeAAAA:
+		table = h.v6
+	default:
+		return nil, false
+	}
+	addrs := table[dnssec.CanonicalName(name)]
+	rrs := make([]records.ResourceRecord, len(addrs))
+	for i, addr := range addrs {
+		rrs[i] = records.ResourceRecord{Name: name, Type: qtype, Class: records.ClassIN, TTL: hostsTTL, Data: addr}
+	}
+	return rrs, len(rrs) > 0
+}
+
+// setupHosts handles "hosts [FILE]", reading /etc/hosts by default. Names
+// found are answered authoritatively; other names and query types go on
+// down the chain.
+func setupHosts(env *PluginEnv, args []string) (Plugin, error) {
+	path := defaultHostsFile
+	switch len(args) {
+	case 0:
+	case 1:
+		path = args[0]
+	default:
+		return nil, errors.New("usage: hosts [FILE]")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hosts, err := ParseHosts(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+			q := req.Question[0]
+			rrs, ok := hosts.Lookup(q.Name, q.Type)
+			if req.Opcode != opcodeQuery || !ok {
+				next.ServeDNS(ctx, w, req)
+				return
+			}
+			reply := req.Reply()
+			reply.Authoritative = true
+			reply.Answer = rrs
+			if err := w.WriteMsg(reply); err != nil {
+				writeError(w, req, "Response building", err)
+			}
+		})
+	}, nil
+}
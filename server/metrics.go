@@ -0,0 +1,35 @@
+// server/metrics.go
+package server
+
+import (
+	"expvar"
+	"net/http"
+)
+
+// Counters published with expvar under "dns"
+const (
+	metricQueries     = "queries"
+	metricZoneAnswers = "zone_answers"
+	metricRateLimited = "rate_limited"
+	metricServFail    = "servfail"
+	metricRefused     = "refused"
+	metricCacheHits   = "cache_hits"
+	metricCacheMisses = "cache_misses"
+
+	// UDP requests shed because every worker was busy
+	metricOverloadDropped = "overload_dropped"
+	metricOverloadRefused = "overload_refused"
+)
+
+var metrics = expvar.NewMap("dns")
+
+// MetricsHandler serves the counters, along with the runtime statistics
+// expvar publishes, as JSON
+func MetricsHandler() http.Handler {
+	return expvar.Handler()
+}
+
+// MetricsSnapshot returns the counters as JSON, e.g. to log them at exit
+func MetricsSnapshot() string {
+	return metrics.String()
+}
@@ -0,0 +1,371 @@
+// server/msg.go
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Msg is a whole DNS message: the header fields, the question and every
+// record section. The OPT pseudo-record is kept out of Additional and
+// described by EDNS instead.
+type Msg struct {
+	ID                 uint16
+	Response           bool
+	Opcode             uint8
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	AuthenticatedData  bool
+	CheckingDisabled   bool
+	Rcode              uint16
+
+	Question   []Question
+	Answer     []records.ResourceRecord
+	Authority  []records.ResourceRecord
+	Additional []records.ResourceRecord
+
+	// EDNS is nil when the message carries no OPT record
+	EDNS *EDNS
+
+	// raw is the wire form the message was unpacked from, for handlers
+	// that verify signatures over it
+	raw []byte
+}
+
+// Question is one entry of the question section
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// EDNS holds the EDNS(0) parameters of an OPT record (RFC 6891)
+type EDNS struct {
+	UDPSize uint16
+	DO      bool
+}
+
+// msgStorage backs a message with one question and EDNS, the shape of
+// nearly every request and response, so it takes a single allocation
+type msgStorage struct {
+	Msg
+	question [1]Question
+	edns     EDNS
+}
+
+// maxQuestionNames bounds the question names kept by questionNames
+const maxQuestionNames = 4096
+
+// questionNames holds the question names seen recently, so unpacking a
+// question for a name asked before allocates nothing
+var questionNames = nameTable{names: make(map[string]string)}
+
+type nameTable struct {
+	mu    sync.RWMutex
+	names map[string]string
+}
+
+// intern returns name as a string, shared with earlier calls for the
+// same name. The table is emptied when it fills up.
+func (t *nameTable) intern(name []byte) string {
+	t.mu.RLock()
+	s, ok := t.names[string(name)]
+	t.mu.RUnlock()
+	if ok {
+		return s
+	}
+	s = string(name)
+	t.mu.Lock()
+	if len(t.names) >= maxQuestionNames {
+		clear(t.names)
+	}
+	t.names[s] = s
+	t.mu.Unlock()
+	return s
+}
+
+// UnpackMsg decodes a DNS message. Names are returned without the
+// trailing dot.
+func UnpackMsg(b []byte) (*Msg, error) {
+	return new(msgStorage).unpack(b)
+}
+
+// unpack decodes b into s
+func (s *msgStorage) unpack(b []byte) (*Msg, error) {
+	if len(b) < 12 {
+		return nil, errors.New("message shorter than header size")
+	}
+	m := &s.Msg
+	*m = Msg{ID: binary.BigEndian.Uint16(b[0:2]), Question: s.question[:0], raw: b}
+	m.setFlags(binary.BigEndian.Uint16(b[2:4]))
+
+	var buf [255]byte
+	pos := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(b[4:6])); i++ {
+		name, next, err := records.DecodeDomainName(buf[:0], b, pos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid question: %w", err)
+		}
+		if next+4 > len(b) {
+			return nil, errors.New("question exceeds message")
+		}
+		m.Question = append(m.Question, Question{
+			Name:  questionNames.intern(name),
+			Type:  binary.BigEndian.Uint16(b[next:]),
+			Class: binary.BigEndian.Uint16(b[next+2:]),
+		})
+		pos = next + 4
+	}
+	if len(m.Question) == 0 {
+		m.Question = nil
+	}
+
+	var err error
+	if m.Answer, pos, err = unpackSection(b, pos, int(binary.BigEndian.Uint16(b[6:8]))); err != nil {
+		return nil, fmt.Errorf("answer section: %w", err)
+	}
+	if m.Authority, pos, err = unpackSection(b, pos, int(binary.BigEndian.Uint16(b[8:10]))); err != nil {
+		return nil, fmt.Errorf("authority section: %w", err)
+	}
+	for i := 0; i < int(binary.BigEndian.Uint16(b[10:12])); i++ {
+		// The OPT record of a request is read in place
+		if pos+11 <= len(b) && b[pos] == 0 && binary.BigEndian.Uint16(b[pos+1:]) == records.TypeOPT {
+			length := int(binary.BigEndian.Uint16(b[pos+9:]))
+			if pos+11+length > len(b) {
+				return nil, errors.New("additional section: OPT record exceeds message")
+			}
+			s.edns = EDNS{UDPSize: binary.BigEndian.Uint16(b[pos+3:]), DO: binary.BigEndian.Uint32(b[pos+5:])&ednsFlagDO != 0}
+			m.EDNS = &s.edns
+			pos += 11 + length
+			continue
+		}
+		rr, next, err := records.UnpackResourceRecord(b, pos)
+		if err != nil {
+			return nil, fmt.Errorf("additional section: %w", err)
+		}
+		pos = next
+		if rr.Type == records.TypeOPT {
+			s.edns = EDNS{UDPSize: rr.Class, DO: rr.TTL&ednsFlagDO != 0}
+			m.EDNS = &s.edns
+			continue
+		}
+		m.Additional = append(m.Additional, rr)
+	}
+	return m, nil
+}
+
+// Pack encodes the message, compressing names. Records are written with
+// class IN.
+func (m *Msg) Pack() ([]byte, error) {
+	return m.appendPack(make([]byte, 0, minUDPSize))
+}
+
+// compressors recycles the name offsets recorded while packing
+var compressors = sync.Pool{
+	New: func() interface{} { return new(records.DomainNameWriter) },
+}
+
+// appendPack encodes the message into buf, reusing its capacity. Names
+// are compressed by comparing them with the message in place, and A and
+// AAAA data is appended directly, so packing into a large enough buffer
+// allocates nothing for address answers.
+func (m *Msg) appendPack(buf []byte) ([]byte, error) {
+	if len(m.Question) > 1 {
+		return nil, errors.New("more than one question")
+	}
+	w := compressors.Get().(*records.DomainNameWriter)
+	defer func() {
+		w.Msg, w.Names = nil, w.Names[:0]
+		compressors.Put(w)
+	}()
+
+	msg := binary.BigEndian.AppendUint16(buf[:0], m.ID)
+	msg = binary.BigEndian.AppendUint16(msg, m.flags())
+	msg = append(msg, make([]byte, 8)...)
+	binary.BigEndian.PutUint16(msg[4:6], uint16(len(m.Question)))
+
+	var err error
+	for _, q := range m.Question {
+		if msg, err = w.AppendDomainName(msg, q.Name); err != nil {
+			return nil, fmt.Errorf("failed to add question: %w", err)
+		}
+		msg = binary.BigEndian.AppendUint16(msg, q.Type)
+		msg = binary.BigEndian.AppendUint16(msg, records.ClassIN)
+	}
+	for _, section := range []struct {
+		rrs   []records.ResourceRecord
+		count int
+		name  string
+	}{
+		{m.Answer, 6, "answer"},
+		{m.Authority, 8, "authority record"},
+		{m.Additional, 10, "additional record"},
+	} {
+		for _, rr := range section.rrs {
+			if msg, err = appendRecord(msg, w, rr); err != nil {
+				return nil, fmt.Errorf("failed to add %s: %w", section.name, err)
+			}
+		}
+		binary.BigEndian.PutUint16(msg[section.count:], uint16(len(section.rrs)))
+	}
+
+	if m.EDNS != nil {
+		var ednsFlags uint32
+		if m.EDNS.DO {
+			ednsFlags = ednsFlagDO
+		}
+		msg = append(msg, 0) // root owner
+		msg = binary.BigEndian.AppendUint16(msg, records.TypeOPT)
+		msg = binary.BigEndian.AppendUint16(msg, m.EDNS.UDPSize)
+		msg = binary.BigEndian.AppendUint32(msg, ednsFlags)
+		msg = binary.BigEndian.AppendUint16(msg, 0)
+		binary.BigEndian.PutUint16(msg[10:12], uint16(len(m.Additional)+1))
+	}
+	return msg, nil
+}
+
+// appendRecord appends one resource record, compressing its owner name
+// and, for compressible types, the names in its RDATA
+func appendRecord(msg []byte, w *records.DomainNameWriter, rr records.ResourceRecord) ([]byte, error) {
+	handler, err := zoneRecordHandler(rr)
+	if err != nil {
+		return nil, err
+	}
+	if err := handler.ValidateData(rr.Data); err != nil {
+		return nil, err
+	}
+	if msg, err = w.AppendDomainName(msg, rr.Name); err != nil {
+		return nil, fmt.Errorf("failed to write domain: %w", err)
+	}
+
+	// Use default TTL if not specified
+	ttl := rr.TTL
+	if ttl == 0 {
+		ttl = handler.DefaultTTL()
+	}
+	msg = binary.BigEndian.AppendUint16(msg, handler.Type())
+	msg = binary.BigEndian.AppendUint16(msg, handler.Class())
+	msg = binary.BigEndian.AppendUint32(msg, ttl)
+	msg = append(msg, 0, 0)
+	start := len(msg)
+
+	switch h := handler.(type) {
+	case records.RecordDataAppender:
+		msg, err = h.AppendRecordData(msg, rr.Data)
+	case records.CompressibleRecord:
+		w.Msg, w.Pos = msg, len(msg)
+		var rdata []byte
+		rdata, err = h.BuildCompressedRecordData(rr.Data, w)
+		w.Msg = nil
+		msg = append(msg, rdata...)
+	default:
+		var rdata []byte
+		rdata, err = handler.BuildRecordData(rr.Data)
+		msg = append(msg, rdata...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to build record data: %w", err)
+	}
+	if len(msg)-start > 0xFFFF {
+		return nil, errors.New("record data exceeds 65535 bytes")
+	}
+	binary.BigEndian.PutUint16(msg[start-2:], uint16(len(msg)-start))
+	return msg, nil
+}
+
+func (m *Msg) setFlags(flags uint16) {
+	m.Response = flags&flagQR != 0
+	m.Opcode = uint8(flags>>11) & 0x0F
+	m.Authoritative = flags&flagAA != 0
+	m.Truncated = flags&flagTC != 0
+	m.RecursionDesired = flags&flagRD != 0
+	m.RecursionAvailable = flags&flagRA != 0
+	m.AuthenticatedData = flags&flagAD != 0
+	m.CheckingDisabled = flags&flagCD != 0
+	m.Rcode = flags & 0x000F
+}
+
+func (m *Msg) flags() uint16 {
+	flags := uint16(m.Opcode&0x0F)<<11 | m.Rcode&0x000F
+	for _, f := range []struct {
+		set  bool
+		flag uint16
+	}{
+		{m.Response, flagQR},
+		{m.Authoritative, flagAA},
+		{m.Truncated, flagTC},
+		{m.RecursionDesired, flagRD},
+		{m.RecursionAvailable, flagRA},
+		{m.AuthenticatedData, flagAD},
+		{m.CheckingDisabled, flagCD},
+	} {
+		if f.set {
+			flags |= f.flag
+		}
+	}
+	return flags
+}
+
+// Reply starts the response to m: same ID, opcode, question and RD and CD
+// bits, with recursion available. EDNS clients get an OPT record back
+// advertising our payload size and echoing DO.
+func (m *Msg) Reply() *Msg {
+	s := new(msgStorage)
+	s.Msg = Msg{
+		ID:                 m.ID,
+		Response:           true,
+		Opcode:             m.Opcode,
+		RecursionDesired:   m.RecursionDesired,
+		RecursionAvailable: true,
+		CheckingDisabled:   m.CheckingDisabled,
+	}
+	if len(m.Question) > 0 {
+		s.Question = append(s.question[:0], m.Question...)
+	}
+	if m.EDNS != nil {
+		s.edns = EDNS{UDPSize: ednsPayloadSize, DO: m.EDNS.DO}
+		s.EDNS = &s.edns
+	}
+	return &s.Msg
+}
+
+// Copy returns a copy of m whose sections can be changed without touching m
+func (m *Msg) Copy() *Msg {
+	s := &msgStorage{Msg: *m}
+	s.Question = nil
+	if len(m.Question) > 0 {
+		s.Question = append(s.question[:0], m.Question...)
+	}
+	s.Answer = append([]records.ResourceRecord(nil), m.Answer...)
+	s.Authority = append([]records.ResourceRecord(nil), m.Authority...)
+	s.Additional = append([]records.ResourceRecord(nil), m.Additional...)
+	if m.EDNS != nil {
+		s.edns = *m.EDNS
+		s.EDNS = &s.edns
+	}
+	return &s.Msg
+}
+
+// Raw returns the wire form m was unpacked from, nil for built messages
+func (m *Msg) Raw() []byte {
+	return m.raw
+}
+
+// DNSSECOK reports whether the sender set the DO bit
+func (m *Msg) DNSSECOK() bool {
+	return m.EDNS != nil && m.EDNS.DO
+}
+
+// udpSize is the largest response the sender of m accepts over UDP
+func (m *Msg) udpSize() int {
+	if m == nil || m.EDNS == nil || m.EDNS.UDPSize < minUDPSize {
+		return minUDPSize
+	}
+	return min(int(m.EDNS.UDPSize), maxUDPSize)
+}
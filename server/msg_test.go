@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func TestMsg_PackUnpack(t *testing.T) {
+	m := &Msg{
+		ID:                 0xBEEF,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   true,
+		RecursionAvailable: true,
+		Rcode:              3,
+		Question:           []Question{{Name: "www.example.test", Type: records.TypeMX, Class: records.ClassIN}},
+		Answer: []records.ResourceRecord{
+			{Name: "www.example.test", Type: records.TypeMX, Class: records.ClassIN, TTL: 300, Data: records.MXData{Preference: 10, Exchange: "mail.example.test"}},
+		},
+		Authority: []records.ResourceRecord{
+			{Name: "example.test", Type: records.TypeNS, Class: records.ClassIN, TTL: 3600, Data: "ns1.example.test"},
+		},
+		Additional: []records.ResourceRecord{
+			{Name: "mail.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 300, Data: "192.0.2.25"},
+		},
+		EDNS: &EDNS{UDPSize: 1232, DO: true},
+	}
+	msg, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnpackMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.raw = nil
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", got, m)
+	}
+}
+
+func TestMsg_UnpackErrors(t *testing.T) {
+	query, err := queryMsg("example.test", records.TypeA).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingAnswer := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(missingAnswer[6:8], 1)
+
+	for _, msg := range [][]byte{query[:11], query[:len(query)-2], missingAnswer} {
+		if _, err := UnpackMsg(msg); err == nil {
+			t.Errorf("UnpackMsg(%x) succeeded, want an error", msg)
+		}
+	}
+}
+
+func TestMsg_Reply(t *testing.T) {
+	req := queryMsg("example.test", records.TypeA)
+	req.CheckingDisabled = true
+	req.EDNS = &EDNS{UDPSize: 4096, DO: true}
+
+	reply := req.Reply()
+	if !reply.Response || reply.ID != req.ID || !reply.RecursionDesired || !reply.RecursionAvailable || !reply.CheckingDisabled {
+		t.Errorf("reply header = %+v", reply)
+	}
+	if reply.EDNS == nil || reply.EDNS.UDPSize != ednsPayloadSize || !reply.EDNS.DO {
+		t.Errorf("reply EDNS = %+v, want our payload size and DO echoed", reply.EDNS)
+	}
+	reply.Question[0].Name = "other.test"
+	if req.Question[0].Name != "example.test" {
+		t.Error("changing the reply's question changed the request")
+	}
+
+	if plain := queryMsg("example.test", records.TypeA).Reply(); plain.EDNS != nil {
+		t.Error("reply to a plain DNS query carries an OPT record")
+	}
+}
+
+func TestPackTruncated(t *testing.T) {
+	reply := queryMsg("example.test", records.TypeTXT).Reply()
+	for i := 0; i < 10; i++ {
+		reply.Answer = append(reply.Answer, records.ResourceRecord{
+			Name: "example.test", Type: records.TypeTXT, Class: records.ClassIN, TTL: 60,
+			Data: []string{string(make([]byte, 100))},
+		})
+	}
+
+	msg, err := packTruncated(reply, minUDPSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnpackMsg(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Truncated || len(got.Answer) != 0 || len(got.Question) != 1 {
+		t.Errorf("truncated response = %+v, want TC, the question and no answers", got)
+	}
+
+	if msg, _ := packTruncated(reply, 0xFFFF); len(msg) <= minUDPSize {
+		t.Errorf("response of %d bytes was truncated without need", len(msg))
+	}
+}
@@ -0,0 +1,197 @@
+// server/notify.go
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+const (
+	notifyTimeout = 2 * time.Second
+	notifyRetries = 5
+)
+
+// NotifyHandler accepts NOTIFY messages (RFC 1996) for secondary zones
+// from their primaries and schedules an immediate refresh. Everything else
+// goes to the next handler.
+type NotifyHandler struct {
+	next        Handler
+	mu          sync.RWMutex
+	secondaries map[string]*Secondary
+}
+
+// NewNotifyHandler wraps next, accepting NOTIFY for the given secondaries
+func NewNotifyHandler(next Handler, secondaries ...*Secondary) *NotifyHandler {
+	h := &NotifyHandler{next: next, secondaries: make(map[string]*Secondary)}
+	for _, s := range secondaries {
+		h.AddSecondary(s)
+	}
+	return h
+}
+
+// AddSecondary accepts NOTIFY for s's zone from its primaries
+func (h *NotifyHandler) AddSecondary(s *Secondary) {
+	h.mu.Lock()
+	h.secondaries[s.Origin] = s
+	h.mu.Unlock()
+}
+
+func (h *NotifyHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	if req.Opcode != opcodeNotify {
+		h.next.ServeDNS(ctx, w, req)
+		return
+	}
+	domain, qtype := req.Question[0].Name, req.Question[0].Type
+
+	h.mu.RLock()
+	secondary, ok := h.secondaries[dnssec.CanonicalName(domain)]
+	h.mu.RUnlock()
+	if !ok || qtype != records.TypeSOA {
+		writeError(w, req, "NOTIFY", fmt.Errorf("%w: NOTIFY for %s (type %d) is not for a secondary zone", ErrRefused, domain, qtype))
+		return
+	}
+
+	ip, _ := GetClientIPFromContext(ctx)
+	if !secondary.IsPrimary(net.ParseIP(ip)) {
+		writeError(w, req, "NOTIFY", fmt.Errorf("%w: NOTIFY for %s from %s, which is not a primary", ErrRefused, domain, ip))
+		return
+	}
+
+	log.Printf("[NOTIFY] Received NOTIFY for %s from %s", secondary.Origin, ip)
+	secondary.Notify()
+
+	// The acknowledgement echoes the question with the NOTIFY opcode
+	ack := req.Reply()
+	ack.Authoritative = true
+	ack.RecursionDesired, ack.RecursionAvailable = false, false
+	ack.EDNS = nil
+	if err := w.WriteMsg(ack); err != nil {
+		log.Printf("[NOTIFY] Error acknowledging NOTIFY for %s: %v", secondary.Origin, err)
+	}
+}
+
+// Notifier announces new zone serials to secondaries with NOTIFY, retrying
+// until each one acknowledges
+type Notifier struct {
+	mu      sync.RWMutex
+	targets map[string][]string
+	timeout time.Duration
+	retries int
+}
+
+// NewNotifier creates a notifier with no targets
+func NewNotifier() *Notifier {
+	return &Notifier{
+		targets: make(map[string][]string),
+		timeout: notifyTimeout,
+		retries: notifyRetries,
+	}
+}
+
+// SetTargets sets the secondaries ("host:port") notified of changes to origin
+func (n *Notifier) SetTargets(origin string, secondaries []string) {
+	n.mu.Lock()
+	n.targets[dnssec.CanonicalName(origin)] = secondaries
+	n.mu.Unlock()
+}
+
+// ZoneChanged notifies the secondaries of the zone whose new SOA is soa.
+// It returns at once; the messages are sent in the background.
+func (n *Notifier) ZoneChanged(soa records.ResourceRecord) {
+	origin := dnssec.CanonicalName(soa.Name)
+	n.mu.RLock()
+	targets := n.targets[origin]
+	n.mu.RUnlock()
+
+	for _, target := range targets {
+		go func(target string) {
+			if err := n.Send(context.Background(), soa, target); err != nil {
+				log.Printf("[NOTIFY] Notifying %s of %s failed: %v", target, origin, err)
+				return
+			}
+			log.Printf("[NOTIFY] %s acknowledged serial %d of %s", target, soaSerial(soa), origin)
+		}(target)
+	}
+}
+
+// Send delivers one NOTIFY for soa's zone to target over UDP
+func (n *Notifier) Send(ctx context.Context, soa records.ResourceRecord, target string) error {
+	msg, err := buildNotify(queryID(), soa)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", target)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	timeout := n.timeout
+	for attempt := 0; attempt < n.retries; attempt++ {
+		if _, err := conn.Write(msg); err != nil {
+			return err
+		}
+		if err := awaitNotifyAck(conn, msg, timeout); err == nil {
+			return nil
+		} else if !isTimeout(err) {
+			return err
+		}
+		timeout *= 2
+	}
+	return fmt.Errorf("no answer after %d attempts", n.retries)
+}
+
+// buildNotify encodes a NOTIFY carrying the new SOA in its answer section
+func buildNotify(id uint16, soa records.ResourceRecord) ([]byte, error) {
+	msg, err := buildQuery(id, soa.Name, records.TypeSOA)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(msg[2:4], opcodeNotify<<11|flagAA)
+
+	rr, err := (&records.SOARecord{}).BuildAnswer(soa.Name, soa.Data, soa.TTL)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(msg[6:8], 1)
+	return append(msg, rr.Bytes()...), nil
+}
+
+func awaitNotifyAck(conn net.Conn, msg []byte, timeout time.Duration) error {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		if n < 12 || !bytes.Equal(buf[0:2], msg[0:2]) {
+			continue
+		}
+		flags := binary.BigEndian.Uint16(buf[2:4])
+		if flags&flagQR == 0 || (flags>>11)&0x0F != opcodeNotify {
+			continue
+		}
+		if rcode := flags & 0x000F; rcode != 0 {
+			return fmt.Errorf("NOTIFY rejected with rcode %d", rcode)
+		}
+		return nil
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
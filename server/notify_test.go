@@ -0,0 +1,160 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// recordingWriter collects the responses written to a client
+type recordingWriter struct {
+	msgs [][]byte
+	size int // zero accepts any size
+}
+
+func (w *recordingWriter) WriteMsg(m *Msg) error {
+	msg, err := packTruncated(m, w.MaxSize())
+	if err != nil {
+		return err
+	}
+	return w.WritePacked(msg)
+}
+
+func (w *recordingWriter) WritePacked(msg []byte) error {
+	w.msgs = append(w.msgs, append([]byte(nil), msg...))
+	return nil
+}
+
+func (w *recordingWriter) RemoteAddr() net.Addr { return nil }
+
+func (w *recordingWriter) MaxSize() int {
+	if w.size == 0 {
+		return 0xFFFF
+	}
+	return w.size
+}
+
+func requestFrom(ip string) context.Context {
+	return context.WithValue(context.Background(), clientIPKey, ip)
+}
+
+func notifyMessage(t *testing.T) []byte {
+	t.Helper()
+	msg, err := buildNotify(99, records.ResourceRecord{Name: "example.test", Type: records.TypeSOA, TTL: 300,
+		Data: records.SOAData{MName: "ns1.example.test", RName: "h.example.test", Serial: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestParseRequest_Opcode(t *testing.T) {
+	_, opcode, domain, qtype, err := parseRequest(notifyMessage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opcode != opcodeNotify || domain != "example.test" || qtype != records.TypeSOA {
+		t.Errorf("Unexpected parse: opcode %d, %s, type %d", opcode, domain, qtype)
+	}
+
+	response := notifyMessage(t)
+	response[2] |= 0x80
+	if _, _, _, _, err := parseRequest(response); err == nil {
+		t.Error("Responses must not be parsed as requests")
+	}
+}
+
+func TestHandleRequest_UnknownOpcode(t *testing.T) {
+	query, err := buildQuery(5, "example.test", records.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(query[2:4], 2<<11) // STATUS
+
+	w := &recordingWriter{}
+	handleRequest(requestFrom("192.0.2.1"), w, query, ForwardHandler(NewDNSResolver("127.0.0.1:1")))
+	if len(w.msgs) != 1 {
+		t.Fatalf("Expected one response, got %d", len(w.msgs))
+	}
+	flags := binary.BigEndian.Uint16(w.msgs[0][2:4])
+	if flags&0x000F != rcodeNotImp || (flags>>11)&0x0F != 2 {
+		t.Errorf("Expected NOTIMP echoing the opcode, got flags %#04x", flags)
+	}
+}
+
+func TestNotifyHandler(t *testing.T) {
+	secondary := NewSecondary("example.test", []string{"192.0.2.53:53"}, nil, NewZoneStore())
+	handler := NewNotifyHandler(ForwardHandler(NewDNSResolver("127.0.0.1:1")), secondary)
+
+	w := &recordingWriter{}
+	handleRequest(requestFrom("192.0.2.53"), w, notifyMessage(t), handler)
+	flags := binary.BigEndian.Uint16(w.msgs[0][2:4])
+	if flags&flagQR == 0 || (flags>>11)&0x0F != opcodeNotify || flags&0x000F != 0 {
+		t.Errorf("Expected a NOTIFY acknowledgement, got flags %#04x", flags)
+	}
+	select {
+	case <-secondary.notify:
+	default:
+		t.Error("NOTIFY did not schedule a refresh")
+	}
+
+	w = &recordingWriter{}
+	handleRequest(requestFrom("198.51.100.7"), w, notifyMessage(t), handler)
+	if rcode := binary.BigEndian.Uint16(w.msgs[0][2:4]) & 0x000F; rcode != 5 {
+		t.Errorf("Expected REFUSED for a NOTIFY from a non-primary, got rcode %d", rcode)
+	}
+	select {
+	case <-secondary.notify:
+		t.Error("NOTIFY from a non-primary scheduled a refresh")
+	default:
+	}
+}
+
+func TestNotify_PrimaryToSecondary(t *testing.T) {
+	primaryStore := newTestStore(t, nil)
+	primary := startPrimary(t, primaryStore)
+
+	store := NewZoneStore()
+	secondary := NewSecondary("example.test", []string{primary}, nil, store)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	handler := NewNotifyHandler(ForwardHandler(NewDNSResolver("127.0.0.1:1")), secondary)
+	go func() {
+		for {
+			buf := make([]byte, 512)
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			go HandleDNSRequest(conn, addr, buf[:n], handler)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := secondary.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	go secondary.Run(ctx)
+
+	notifier := NewNotifier()
+	notifier.SetTargets("example.test", []string{conn.LocalAddr().String()})
+	primaryStore.OnSerialChange(notifier.ZoneChanged)
+	updateTestZone(t, primaryStore, "2", "192.0.2.81")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if served, ok := store.zone("example.test"); ok && served.source.Serial() == 2 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Error("Secondary did not pick up the new serial after NOTIFY")
+}
@@ -0,0 +1,72 @@
+//go:build linux
+
+// server/pktinfo_linux.go
+package server
+
+import (
+	"encoding/binary"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// replySourceFor asks the kernel for the destination address of each
+// datagram read from a wildcard conn, with IP_PKTINFO or, on IPv6 and
+// dual-stack sockets, IPV6_RECVPKTINFO. It returns the function turning
+// the control message received into the one that sends the reply from
+// that address; otherwise the kernel picks the source by route, and a
+// client that queried another of the host's addresses drops the reply.
+// It returns nil for conns bound to one address.
+func replySourceFor(conn *net.UDPConn) func(oob []byte) []byte {
+	local, ok := conn.LocalAddr().(*net.UDPAddr)
+	if !ok || !local.IP.IsUnspecified() {
+		return nil
+	}
+	level, opt := unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO
+	if local.IP.To4() != nil {
+		level, opt = unix.IPPROTO_IP, unix.IP_PKTINFO
+	}
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), level, opt, 1)
+	})
+	if err != nil || sockErr != nil {
+		return nil
+	}
+	return replyPktinfo
+}
+
+// replyPktinfo builds the packet info sending from the destination
+// address in oob, or returns nil when oob has none
+func replyPktinfo(oob []byte) []byte {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_PKTINFO && len(m.Data) >= unix.SizeofInet4Pktinfo:
+			// struct in_pktinfo: ifindex, local address, header destination
+			var reply unix.Inet4Pktinfo
+			copy(reply.Spec_dst[:], m.Data[8:12])
+			return unix.PktInfo4(&reply)
+
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_PKTINFO && len(m.Data) >= unix.SizeofInet6Pktinfo:
+			// struct in6_pktinfo: destination, ifindex
+			var reply unix.Inet6Pktinfo
+			copy(reply.Addr[:], m.Data[:16])
+			// Link-local sources only mean something with their
+			// interface; IPv4 mapped ones route like any IPv4 reply
+			if ip := net.IP(reply.Addr[:]); ip.To4() == nil {
+				reply.Ifindex = binary.NativeEndian.Uint32(m.Data[16:20])
+			}
+			return unix.PktInfo6(&reply)
+		}
+	}
+	return nil
+}
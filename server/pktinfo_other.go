@@ -0,0 +1,12 @@
+//go:build !linux
+
+// server/pktinfo_other.go
+package server
+
+import "net"
+
+// replySourceFor leaves the source address of replies to the routing
+// table where IP_PKTINFO is not available
+func replySourceFor(conn *net.UDPConn) func(oob []byte) []byte {
+	return nil
+}
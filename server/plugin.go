@@ -0,0 +1,156 @@
+// server/plugin.go
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+)
+
+// Plugin is one stage of query handling. It wraps the rest of the chain,
+// answering itself or passing the request on to next.
+type Plugin func(next Handler) Handler
+
+// PluginSetup creates a plugin from the arguments following its name on a
+// chain line, e.g. ["300"] for "cache 300"
+type PluginSetup func(env *PluginEnv, args []string) (Plugin, error)
+
+// PluginEnv holds what plugins share with the rest of the server
+type PluginEnv struct {
+	// Resolver forwards to the configured upstream
+	Resolver *DNSResolver
+	// Zones are the zones served authoritatively
+	Zones *ZoneStore
+	// RateLimiter is used by ratelimit lines without arguments
+	RateLimiter RateLimiter
+}
+
+var (
+	pluginsMu sync.RWMutex
+	plugins   = make(map[string]PluginSetup)
+)
+
+// RegisterPlugin makes a plugin available to chains under name. It is
+// meant to be called from an init function, so a plugin is compiled in by
+// importing its package; registering a name twice panics.
+func RegisterPlugin(name string, setup PluginSetup) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	if _, dup := plugins[name]; dup {
+		panic("server: plugin " + name + " registered twice")
+	}
+	plugins[name] = setup
+}
+
+// Plugins lists the registered plugin names in order
+func Plugins() []string {
+	pluginsMu.RLock()
+	defer pluginsMu.RUnlock()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewChain builds a handler from plugin lines such as "cache 300", the
+// first line seeing queries first. Queries that reach the end of the
+// chain unanswered are refused.
+func NewChain(env *PluginEnv, lines []string) (Handler, error) {
+	stages := make([]Plugin, len(lines))
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("plugin %d: empty line", i+1)
+		}
+		pluginsMu.RLock()
+		setup, ok := plugins[fields[0]]
+		pluginsMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("plugin %q is not registered (have %s)", fields[0], strings.Join(Plugins(), ", "))
+		}
+		plugin, err := setup(env, fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %w", fields[0], err)
+		}
+		stages[i] = plugin
+	}
+
+	var handler Handler = endOfChain{}
+	for i := len(stages) - 1; i >= 0; i-- {
+		handler = stages[i](handler)
+	}
+	return handler, nil
+}
+
+// endOfChain refuses the queries no plugin answered
+type endOfChain struct{}
+
+func (endOfChain) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	writeError(w, req, "Plugin chain", fmt.Errorf("%w: no plugin answered %s", ErrRefused, req.Question[0].Name))
+}
+
+// ZoneChains sends each query to the chain of the longest zone containing
+// it, as a Corefile does with its server blocks. Names outside every zone
+// are refused; a chain for "." catches them all.
+type ZoneChains struct {
+	chains map[string]Handler
+}
+
+// NewZoneChains creates an empty set of chains
+func NewZoneChains() *ZoneChains {
+	return &ZoneChains{chains: make(map[string]Handler)}
+}
+
+// Add routes the names in zone to handler
+func (c *ZoneChains) Add(zone string, handler Handler) error {
+	zone = dnssec.CanonicalName(zone)
+	if _, dup := c.chains[zone]; dup {
+		return fmt.Errorf("zone %s has two chains", zone)
+	}
+	c.chains[zone] = handler
+	return nil
+}
+
+func (c *ZoneChains) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	domain := req.Question[0].Name
+	for name := dnssec.CanonicalName(domain); ; name = dnssec.Parent(name) {
+		if handler, ok := c.chains[name]; ok {
+			handler.ServeDNS(ctx, w, req)
+			return
+		}
+		if name == "." {
+			writeError(w, req, "Plugin chain", fmt.Errorf("%w: %s is outside the configured zones", ErrRefused, domain))
+			return
+		}
+	}
+}
+
+// ReloadableHandler passes queries to a handler a reload can replace while
+// the server runs. Queries in flight finish with the handler they started
+// with.
+type ReloadableHandler struct {
+	handler atomic.Pointer[Handler]
+}
+
+// NewReloadableHandler creates a ReloadableHandler serving with handler
+func NewReloadableHandler(handler Handler) *ReloadableHandler {
+	r := &ReloadableHandler{}
+	r.Swap(handler)
+	return r
+}
+
+// Swap makes handler answer the queries that arrive from now on
+func (r *ReloadableHandler) Swap(handler Handler) {
+	r.handler.Store(&handler)
+}
+
+func (r *ReloadableHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	(*r.handler.Load()).ServeDNS(ctx, w, req)
+}
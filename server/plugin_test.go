@@ -0,0 +1,286 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// countingHandler answers every query with a fixed address, counting calls
+type countingHandler struct {
+	calls   int
+	domains []string
+}
+
+func (h *countingHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	h.calls++
+	h.domains = append(h.domains, req.Question[0].Name)
+	reply := req.Reply()
+	reply.Answer = []records.ResourceRecord{
+		{Name: req.Question[0].Name, Type: records.TypeA, Class: records.ClassIN, TTL: 300, Data: "198.51.100.1"},
+	}
+	w.WriteMsg(reply)
+}
+
+func init() {
+	// "stub" ends test chains in place of forward
+	RegisterPlugin("stub", func(env *PluginEnv, args []string) (Plugin, error) {
+		return func(Handler) Handler { return stubHandler }, nil
+	})
+}
+
+var stubHandler = &countingHandler{}
+
+// queryMsg builds a query for name
+func queryMsg(name string, qtype uint16) *Msg {
+	return &Msg{ID: 1, RecursionDesired: true, Question: []Question{{Name: name, Type: qtype, Class: records.ClassIN}}}
+}
+
+// serve sends req through handler and returns the single response written
+func serve(t *testing.T, ctx context.Context, handler Handler, req *Msg) *Msg {
+	t.Helper()
+	w := &recordingWriter{}
+	handler.ServeDNS(ctx, w, req)
+	if len(w.msgs) != 1 {
+		t.Fatalf("%d responses written, want 1", len(w.msgs))
+	}
+	resp, err := UnpackMsg(w.msgs[0])
+	if err != nil {
+		t.Fatalf("unpacking response: %v", err)
+	}
+	return resp
+}
+
+// answerData lists the data of the answer records of resp
+func answerData(resp *Msg) []string {
+	var data []string
+	for _, rr := range resp.Answer {
+		data = append(data, fmt.Sprint(rr.Data))
+	}
+	return data
+}
+
+func TestNewChain_Errors(t *testing.T) {
+	env := &PluginEnv{}
+	for _, lines := range [][]string{
+		{"nosuch"},
+		{"cache soon"},
+		{"acl permit 192.0.2.0/24"},
+		{"rewrite name a.test"},
+		{"file"}, // no zones
+		{"forward not-an-address"},
+	} {
+		if _, err := NewChain(env, lines); err == nil {
+			t.Errorf("NewChain(%q) succeeded, want an error", lines)
+		}
+	}
+
+	_, err := NewChain(env, []string{"nosuch"})
+	if err == nil || !strings.Contains(err.Error(), "forward") {
+		t.Errorf("err = %v, want the registered plugins listed", err)
+	}
+}
+
+func TestZoneChains_Routing(t *testing.T) {
+	env := &PluginEnv{Zones: newTestStore(t, nil)}
+	local, err := NewChain(env, []string{"file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := NewZoneChains()
+	if err := chains.Add("example.test.", local); err != nil {
+		t.Fatal(err)
+	}
+	if err := chains.Add("Example.Test", local); err == nil {
+		t.Error("adding a zone twice succeeded")
+	}
+
+	resp := serve(t, requestFrom("192.0.2.1"), chains, queryMsg("www.example.test", records.TypeA))
+	if resp.Rcode != 0 || !resp.Authoritative || len(resp.Answer) != 1 {
+		t.Errorf("response = %+v, want an authoritative answer", resp)
+	}
+
+	// Names outside every zone, and names the chain does not answer, are refused
+	for _, name := range []string{"www.example.org", "example.test.example.org"} {
+		if resp := serve(t, requestFrom("192.0.2.1"), chains, queryMsg(name, records.TypeA)); resp.Rcode != rcodeRefused {
+			t.Errorf("%s: rcode = %d, want REFUSED", name, resp.Rcode)
+		}
+	}
+}
+
+func TestReloadableHandler(t *testing.T) {
+	refuse, err := NewChain(&PluginEnv{}, []string{"acl allow 198.51.100.0/24", "stub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := NewChain(&PluginEnv{}, []string{"acl allow 192.0.2.0/24", "stub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewReloadableHandler(refuse)
+	if resp := serve(t, requestFrom("192.0.2.1"), handler, queryMsg("www.example.test", records.TypeA)); resp.Rcode != rcodeRefused {
+		t.Fatalf("rcode = %d before the swap, want REFUSED", resp.Rcode)
+	}
+	handler.Swap(allow)
+	if resp := serve(t, requestFrom("192.0.2.1"), handler, queryMsg("www.example.test", records.TypeA)); resp.Rcode != 0 || len(resp.Answer) != 1 {
+		t.Errorf("response = %+v after the swap, want the stub's answer", resp)
+	}
+}
+
+func TestChain_ACLAndRewrite(t *testing.T) {
+	chain, err := NewChain(&PluginEnv{}, []string{
+		"acl allow 192.0.2.0/24",
+		"acl deny 192.0.2.66",
+		"rewrite suffix old.test new.test",
+		"stub",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubHandler.domains = nil
+
+	if resp := serve(t, requestFrom("203.0.113.1"), chain, queryMsg("a.old.test", records.TypeA)); resp.Rcode != rcodeRefused {
+		t.Errorf("client outside allow: rcode = %d, want REFUSED", resp.Rcode)
+	}
+	if resp := serve(t, requestFrom("192.0.2.66"), chain, queryMsg("a.old.test", records.TypeA)); resp.Rcode != rcodeRefused {
+		t.Errorf("denied client: rcode = %d, want REFUSED", resp.Rcode)
+	}
+
+	// The client sees its own question and owner names, the stub the rewritten ones
+	resp := serve(t, requestFrom("192.0.2.1"), chain, queryMsg("a.old.test", records.TypeA))
+	if resp.Question[0].Name != "a.old.test" || len(resp.Answer) != 1 || resp.Answer[0].Name != "a.old.test" {
+		t.Errorf("response = %+v, want the answer owned by a.old.test", resp)
+	}
+	serve(t, requestFrom("192.0.2.1"), chain, queryMsg("a.other.test", records.TypeA))
+	want := []string{"a.new.test", "a.other.test"}
+	if strings.Join(stubHandler.domains, " ") != strings.Join(want, " ") {
+		t.Errorf("stub saw %q, want %q", stubHandler.domains, want)
+	}
+}
+
+func TestChain_RewriteZoneAnswer(t *testing.T) {
+	chain, err := NewChain(&PluginEnv{Zones: newTestStore(t, nil)}, []string{"rewrite name web.example.test www.example.test", "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := serve(t, requestFrom("192.0.2.1"), chain, queryMsg("web.example.test", records.TypeA))
+	if len(resp.Answer) != 1 || resp.Answer[0].Name != "web.example.test" {
+		t.Errorf("answer = %+v, want one record owned by the question name", resp.Answer)
+	}
+}
+
+func TestChain_Hosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	hosts := "# local names\n192.0.2.10 printer printer.lan\n192.0.2.11 printer\n2001:db8::10 printer.lan\n"
+	if err := os.WriteFile(path, []byte(hosts), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := NewChain(&PluginEnv{}, []string{"hosts " + path, "stub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := requestFrom("192.0.2.1")
+
+	for _, tt := range []struct {
+		name  string
+		qtype uint16
+		want  string
+	}{
+		{"printer.lan", records.TypeA, "192.0.2.10"},
+		{"PRINTER.lan.", records.TypeAAAA, "2001:db8::10"},
+		{"printer", records.TypeA, "192.0.2.10 192.0.2.11"},
+		// Unknown names fall through to the rest of the chain
+		{"scanner.lan", records.TypeA, "198.51.100.1"},
+	} {
+		resp := serve(t, ctx, chain, queryMsg(tt.name, tt.qtype))
+		if got := strings.Join(answerData(resp), " "); got != tt.want {
+			t.Errorf("%s %s = %q, want %q", records.TypeName(tt.qtype), tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCachedHandler(t *testing.T) {
+	upstream := &countingHandler{}
+	cache := NewCachedHandler(upstream, time.Minute, 2)
+	ctx := requestFrom("192.0.2.1")
+
+	for i := 0; i < 3; i++ {
+		req := queryMsg("a.test", records.TypeA)
+		req.ID = uint16(i)
+		if resp := serve(t, ctx, cache, req); resp.ID != req.ID || len(resp.Answer) != 1 {
+			t.Errorf("response %d = %+v, want the answer under the query's ID", i, resp)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("upstream called %d times, want 1", upstream.calls)
+	}
+
+	// Case differs only: cached; DO bit set: a separate entry
+	serve(t, ctx, cache, queryMsg("A.TEST.", records.TypeA))
+	secure := queryMsg("a.test", records.TypeA)
+	secure.EDNS = &EDNS{UDPSize: 1232, DO: true}
+	serve(t, ctx, cache, secure)
+	if upstream.calls != 2 {
+		t.Errorf("upstream called %d times, want 2", upstream.calls)
+	}
+
+	// A full cache still takes new entries
+	serve(t, ctx, cache, queryMsg("b.test", records.TypeA))
+	if len(cache.entries) != 2 {
+		t.Errorf("cache holds %d entries, want 2", len(cache.entries))
+	}
+}
+
+func TestCachedHandler_TTLCountsDown(t *testing.T) {
+	upstream := &countingHandler{}
+	cache := NewCachedHandler(upstream, time.Hour, 10)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ctx := requestFrom("192.0.2.1")
+
+	for _, tt := range []struct {
+		elapsed time.Duration
+		want    uint32
+	}{{0, 300}, {100 * time.Second, 200}, {199*time.Second + 500*time.Millisecond, 1}} {
+		now = now.Add(tt.elapsed)
+		resp := serve(t, ctx, cache, queryMsg("a.test", records.TypeA))
+		if len(resp.Answer) != 1 || resp.Answer[0].TTL != tt.want {
+			t.Errorf("after %v: answer = %+v, want TTL %d", tt.elapsed, resp.Answer, tt.want)
+		}
+	}
+	if upstream.calls != 1 {
+		t.Errorf("upstream called %d times, want 1", upstream.calls)
+	}
+
+	// Expired: asked again, with the full TTL
+	now = now.Add(time.Second)
+	if resp := serve(t, ctx, cache, queryMsg("a.test", records.TypeA)); upstream.calls != 2 || resp.Answer[0].TTL != 300 {
+		t.Errorf("after expiry: %d upstream calls, TTL %d; want 2 and 300", upstream.calls, resp.Answer[0].TTL)
+	}
+}
+
+func TestCachedHandler_EvictsLeastRecentlyUsed(t *testing.T) {
+	upstream := &countingHandler{}
+	cache := NewCachedHandler(upstream, time.Minute, 2)
+	ctx := requestFrom("192.0.2.1")
+
+	serve(t, ctx, cache, queryMsg("a.test", records.TypeA))
+	serve(t, ctx, cache, queryMsg("b.test", records.TypeA))
+	serve(t, ctx, cache, queryMsg("a.test", records.TypeA))
+	// b.test was used last longest ago and makes room
+	serve(t, ctx, cache, queryMsg("c.test", records.TypeA))
+	upstream.domains = nil
+	for _, name := range []string{"a.test", "c.test", "b.test"} {
+		serve(t, ctx, cache, queryMsg(name, records.TypeA))
+	}
+	if got := strings.Join(upstream.domains, " "); got != "b.test" {
+		t.Errorf("forwarded %q, want only b.test", got)
+	}
+}
@@ -0,0 +1,222 @@
+// server/plugins.go
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+)
+
+// The built-in plugins. Answering plugins (hosts, file, forward) belong
+// last; filters (acl, ratelimit, rewrite, cache) go in front of them.
+func init() {
+	RegisterPlugin("acl", setupACL)
+	RegisterPlugin("ratelimit", setupRateLimit)
+	RegisterPlugin("cache", setupCache)
+	RegisterPlugin("rewrite", setupRewrite)
+	RegisterPlugin("hosts", setupHosts)
+	RegisterPlugin("file", setupFile)
+	RegisterPlugin("forward", setupForward)
+}
+
+// DefaultChain is used when no chain is configured: the historical
+// pipeline of rate limiting, local zones and forwarding
+var DefaultChain = []string{"ratelimit", "file", "forward"}
+
+// setupACL handles "acl allow|deny NETWORK...": queries from clients
+// outside the allowed networks, or inside the denied ones, are refused
+func setupACL(env *PluginEnv, args []string) (Plugin, error) {
+	if len(args) < 2 || (args[0] != "allow" && args[0] != "deny") {
+		return nil, errors.New("usage: acl allow|deny NETWORK...")
+	}
+	nets, err := ParseNetworks(strings.Join(args[1:], ","))
+	if err != nil {
+		return nil, err
+	}
+	allow := args[0] == "allow"
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+			ipText, _ := GetClientIPFromContext(ctx)
+			ip := net.ParseIP(ipText)
+			matched := false
+			for _, network := range nets {
+				if ip != nil && network.Contains(ip) {
+					matched = true
+					break
+				}
+			}
+			if matched != allow {
+				writeError(w, req, "ACL", fmt.Errorf("%w: %s may not query %s", ErrRefused, ipText, req.Question[0].Name))
+				return
+			}
+			next.ServeDNS(ctx, w, req)
+		})
+	}, nil
+}
+
+// setupRateLimit handles "ratelimit [CAPACITY REFILL]": clients over
+// their budget are refused. Without arguments the limiter from the
+// rate_limit settings is shared; REFILL is the time per token, e.g. "1s".
+func setupRateLimit(env *PluginEnv, args []string) (Plugin, error) {
+	limiter := env.RateLimiter
+	switch len(args) {
+	case 0:
+		if limiter == nil {
+			return nil, errors.New("no rate limiter configured")
+		}
+	case 2:
+		capacity, err := strconv.Atoi(args[0])
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("invalid capacity %q", args[0])
+		}
+		refill, err := time.ParseDuration(args[1])
+		if err != nil || refill <= 0 {
+			return nil, fmt.Errorf("invalid refill %q", args[1])
+		}
+		limiter = NewTokenBucketRateLimiter(capacity, refill)
+	default:
+		return nil, errors.New("usage: ratelimit [CAPACITY REFILL]")
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+			ip, _ := GetClientIPFromContext(ctx)
+			if !limiter.AllowQuery(ip) {
+				log.Printf("[RATE LIMIT] Blocked request from %s for %s", ip, req.Question[0].Name)
+				metrics.Add(metricRateLimited, 1)
+				writeRcode(w, req, rcodeRefused)
+				return
+			}
+			next.ServeDNS(ctx, w, req)
+		})
+	}, nil
+}
+
+// setupRewrite handles "rewrite name FROM TO" and "rewrite suffix FROM TO".
+// The rest of the chain answers the rewritten name; the response is
+// renamed back so it matches the question.
+func setupRewrite(env *PluginEnv, args []string) (Plugin, error) {
+	if len(args) != 3 || (args[0] != "name" && args[0] != "suffix") {
+		return nil, errors.New("usage: rewrite name|suffix FROM TO")
+	}
+	suffix := args[0] == "suffix"
+	from, to := dnssec.CanonicalName(args[1]), dnssec.CanonicalName(args[2])
+
+	rewrite := func(domain string) (string, bool) {
+		name := dnssec.CanonicalName(domain)
+		switch {
+		case name == from:
+			return to, true
+		case suffix && strings.HasSuffix(name, "."+from):
+			return strings.TrimSuffix(name, from) + to, true
+		}
+		return domain, false
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+			domain := req.Question[0].Name
+			target, ok := rewrite(domain)
+			if !ok {
+				next.ServeDNS(ctx, w, req)
+				return
+			}
+			rewritten := req.Copy()
+			rewritten.Question[0].Name = target
+			next.ServeDNS(ctx, &renamingWriter{ResponseWriter: w, question: req.Question, from: target, to: domain}, rewritten)
+		})
+	}, nil
+}
+
+// renamingWriter restores the original question of a rewritten request
+// and moves the answers owned by the rewritten name back to it
+type renamingWriter struct {
+	ResponseWriter
+	question []Question
+	from, to string
+}
+
+func (w *renamingWriter) WriteMsg(m *Msg) error {
+	renamed := m.Copy()
+	renamed.Question = w.question
+	for i, rr := range renamed.Answer {
+		if dnssec.CanonicalName(rr.Name) == w.from {
+			renamed.Answer[i].Name = w.to
+		}
+	}
+	return w.ResponseWriter.WriteMsg(renamed)
+}
+
+// setupFile handles "file [ORIGIN...]": names inside the served zones, or
+// only the listed ones, are answered authoritatively
+func setupFile(env *PluginEnv, args []string) (Plugin, error) {
+	if env.Zones == nil {
+		return nil, errors.New("no zones configured")
+	}
+	origins := args
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+			q := req.Question[0]
+			if req.Opcode != opcodeQuery || !inOrigins(q.Name, origins) {
+				next.ServeDNS(ctx, w, req)
+				return
+			}
+			answer, ok, err := env.Zones.Lookup(ctx, q.Name, q.Type)
+			if err != nil {
+				writeError(w, req, "Zone lookup", err)
+				return
+			}
+			if !ok {
+				next.ServeDNS(ctx, w, req)
+				return
+			}
+			writeZoneAnswer(w, req, answer)
+		})
+	}, nil
+}
+
+// inOrigins reports whether domain lies in one of origins; an empty list
+// matches every name
+func inOrigins(domain string, origins []string) bool {
+	if len(origins) == 0 {
+		return true
+	}
+	for _, origin := range origins {
+		if dnssec.IsSubdomain(domain, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupForward handles "forward [UPSTREAM]": queries are resolved by the
+// configured upstream, or by UPSTREAM (host:port) without DNSSEC
+// validation or TSIG. Nothing after forward is reached.
+func setupForward(env *PluginEnv, args []string) (Plugin, error) {
+	resolver := env.Resolver
+	switch len(args) {
+	case 0:
+		if resolver == nil {
+			return nil, errors.New("no upstream configured")
+		}
+	case 1:
+		if _, _, err := net.SplitHostPort(args[0]); err != nil {
+			return nil, fmt.Errorf("invalid upstream %q: %w", args[0], err)
+		}
+		resolver = NewDNSResolver(args[0])
+	default:
+		return nil, errors.New("usage: forward [UPSTREAM]")
+	}
+
+	handler := ForwardHandler(resolver)
+	return func(Handler) Handler { return handler }, nil
+}
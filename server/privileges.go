@@ -0,0 +1,57 @@
+// server/privileges.go
+package server
+
+import (
+	"fmt"
+	"os/user"
+	"strconv"
+)
+
+// DropPrivileges switches the process to userName and groupName, names or
+// numeric ids, for good. An empty groupName means the user's primary
+// group. Sockets opened before keep working.
+func DropPrivileges(userName, groupName string) error {
+	uid, gid, err := lookupIDs(userName, groupName)
+	if err != nil {
+		return err
+	}
+	return setIDs(uid, gid)
+}
+
+// lookupIDs resolves the user and group. Numeric ids need no passwd entry,
+// except a user without a group, whose primary group is looked up.
+func lookupIDs(userName, groupName string) (uid, gid int, err error) {
+	uid, err = strconv.Atoi(userName)
+	var u *user.User
+	if err != nil {
+		if u, err = user.Lookup(userName); err != nil {
+			return 0, 0, err
+		}
+		if uid, err = strconv.Atoi(u.Uid); err != nil {
+			return 0, 0, fmt.Errorf("user %s has no numeric uid", userName)
+		}
+	}
+
+	switch {
+	case groupName != "":
+		if gid, err = strconv.Atoi(groupName); err == nil {
+			return uid, gid, nil
+		}
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			return 0, 0, err
+		}
+		groupName = g.Gid
+	case u != nil:
+		groupName = u.Gid
+	default:
+		if u, err = user.LookupId(userName); err != nil {
+			return 0, 0, fmt.Errorf("user %s: %w; set the group", userName, err)
+		}
+		groupName = u.Gid
+	}
+	if gid, err = strconv.Atoi(groupName); err != nil {
+		return 0, 0, fmt.Errorf("group %s has no numeric gid", groupName)
+	}
+	return uid, gid, nil
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+// server/privileges_other.go
+package server
+
+import "errors"
+
+// setIDs fails where processes have no uid and gid to switch
+func setIDs(uid, gid int) error {
+	return errors.New("dropping privileges is not supported on this platform")
+}
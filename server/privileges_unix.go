@@ -0,0 +1,28 @@
+//go:build unix
+
+// server/privileges_unix.go
+package server
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// setIDs drops the supplementary groups, then sets the group and user of
+// every thread
+func setIDs(uid, gid int) error {
+	if err := syscall.Setgroups([]int{gid}); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid %d: %w", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid %d: %w", uid, err)
+	}
+	// Regaining root must fail now
+	if uid != 0 && syscall.Setuid(0) == nil {
+		return fmt.Errorf("root privileges could be regained after setuid %d", uid)
+	}
+	return nil
+}
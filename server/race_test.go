@@ -0,0 +1,6 @@
+//go:build race
+
+package server
+
+// raceEnabled is set when tests run with the race detector
+const raceEnabled = true
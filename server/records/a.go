@@ -4,7 +4,10 @@ package records
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net"
+	"net/netip"
+	"strings"
 )
 
 type ARecord struct {
@@ -20,11 +23,18 @@ func (r *ARecord) ValidateData(data interface{}) error {
 }
 
 func (r *ARecord) BuildRecordData(data interface{}) ([]byte, error) {
-	ip := net.ParseIP(data.(string)).To4()
-	if ip == nil {
+	return r.AppendRecordData(nil, data)
+}
+
+// AppendRecordData appends the four address bytes to b
+func (r *ARecord) AppendRecordData(b []byte, data interface{}) ([]byte, error) {
+	ip, _ := data.(string)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Unmap().Is4() {
 		return nil, errors.New("invalid IPv4 address")
 	}
-	return ip, nil
+	ip4 := addr.Unmap().As4()
+	return append(b, ip4[:]...), nil
 }
 
 func (r *ARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
@@ -34,3 +44,30 @@ func (r *ARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*byt
 
 	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
 }
+
+func (r *ARecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length != net.IPv4len {
+		return nil, fmt.Errorf("A RDATA must be %d bytes, got %d", net.IPv4len, length)
+	}
+	return net.IP(msg[offset:end]).String(), nil
+}
+
+// ParseZoneData reads "<IPv4 address>"
+func (r *ARecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 1 || net.ParseIP(fields[0]).To4() == nil || strings.Contains(fields[0], ":") {
+		return nil, fmt.Errorf("A record expects one IPv4 address, got %v", fields)
+	}
+	return fields[0], nil
+}
+
+func (r *ARecord) FormatZoneData(data interface{}) (string, error) {
+	ip, ok := data.(string)
+	if !ok {
+		return "", errors.New("invalid A data format")
+	}
+	return ip, nil
+}
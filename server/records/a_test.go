@@ -198,3 +198,25 @@ func validateARecord(t *testing.T, buf *bytes.Buffer, domain, ip string, ttl uin
 		t.Errorf("IP mismatch: expected %s, got %s", ip, parsedIP)
 	}
 }
+
+func TestARecord_ParseRecordData(t *testing.T) {
+	a := &ARecord{}
+	if got := roundTripRecordData(t, a, "192.0.2.10"); got != "192.0.2.10" {
+		t.Errorf("Expected 192.0.2.10, got %v", got)
+	}
+	if _, err := a.ParseRecordData([]byte{1, 2, 3}, 0, 3); err == nil {
+		t.Error("Expected error for short A RDATA")
+	}
+}
+
+func TestARecord_ParseZoneData(t *testing.T) {
+	a := &ARecord{}
+	if data, err := a.ParseZoneData([]string{"192.0.2.1"}, ""); err != nil || data != "192.0.2.1" {
+		t.Errorf("Unexpected result %v, %v", data, err)
+	}
+	for _, fields := range [][]string{{"2001:db8::1"}, {"bogus"}, {}} {
+		if _, err := a.ParseZoneData(fields, ""); err == nil {
+			t.Errorf("Expected error for %v", fields)
+		}
+	}
+}
@@ -4,7 +4,10 @@ package records
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"net"
+	"net/netip"
+	"strings"
 )
 
 type AAAARecord struct {
@@ -28,11 +31,18 @@ func (r *AAAARecord) ValidateData(data interface{}) error {
 }
 
 func (r *AAAARecord) BuildRecordData(data interface{}) ([]byte, error) {
-	ip := net.ParseIP(data.(string)).To16()
-	if ip == nil {
+	return r.AppendRecordData(nil, data)
+}
+
+// AppendRecordData appends the sixteen address bytes to b
+func (r *AAAARecord) AppendRecordData(b []byte, data interface{}) ([]byte, error) {
+	ip, _ := data.(string)
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Zone() != "" {
 		return nil, errors.New("invalid IPv6 address")
 	}
-	return ip, nil
+	ip16 := addr.As16()
+	return append(b, ip16[:]...), nil
 }
 
 func (r *AAAARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
@@ -44,3 +54,30 @@ func (r *AAAARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*
 	// Pass the original data to BaseHandler, not the processed bytes
 	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
 }
+
+func (r *AAAARecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length != net.IPv6len {
+		return nil, fmt.Errorf("AAAA RDATA must be %d bytes, got %d", net.IPv6len, length)
+	}
+	return net.IP(msg[offset:end]).String(), nil
+}
+
+// ParseZoneData reads "<IPv6 address>"
+func (r *AAAARecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 1 || net.ParseIP(fields[0]) == nil || !strings.Contains(fields[0], ":") {
+		return nil, fmt.Errorf("AAAA record expects one IPv6 address, got %v", fields)
+	}
+	return fields[0], nil
+}
+
+func (r *AAAARecord) FormatZoneData(data interface{}) (string, error) {
+	ip, ok := data.(string)
+	if !ok {
+		return "", errors.New("invalid AAAA data format")
+	}
+	return ip, nil
+}
@@ -106,3 +106,13 @@ func validateAAAARecord(t *testing.T, buf *bytes.Buffer, domain, ip string, ttl
 		t.Errorf("Expected IP %v, got %v", ip, ipData)
 	}
 }
+
+func TestAAAARecord_ParseRecordData(t *testing.T) {
+	aaaa := &AAAARecord{}
+	if got := roundTripRecordData(t, aaaa, "2001:db8::1"); got != "2001:db8::1" {
+		t.Errorf("Expected 2001:db8::1, got %v", got)
+	}
+	if _, err := aaaa.ParseRecordData(make([]byte, 4), 0, 4); err == nil {
+		t.Error("Expected error for short AAAA RDATA")
+	}
+}
@@ -7,21 +7,43 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net"
+	"net/netip"
+	"strconv"
 	"strings"
 )
 
 const (
-	ClassIN    = 1   // Internet class
-	QDCOUNT    = 1   // Questions count
-	ANCOUNT    = 1   // Answers count
-	TypeA      = 1   // A record type
-	TypeAAAA   = 28  // AAAA record type
-	TypeMX     = 15  // MX record type
-	TypeTXT    = 16  // TXT record type
-	TypeCNAME  = 5   // CNAME record type
-	TypeNS     = 2   // NS record type
-	DefaultTTL = 300 // Default TTL value
+	ClassIN        = 1   // Internet class
+	QDCOUNT        = 1   // Questions count
+	ANCOUNT        = 1   // Answers count
+	TypeA          = 1   // A record type
+	TypeAAAA       = 28  // AAAA record type
+	TypeMX         = 15  // MX record type
+	TypeTXT        = 16  // TXT record type
+	TypeCNAME      = 5   // CNAME record type
+	TypeNS         = 2   // NS record type
+	TypeSRV        = 33  // SRV record type
+	TypeTLSA       = 52  // TLSA record type
+	TypeSVCB       = 64  // SVCB record type
+	TypeHTTPS      = 65  // HTTPS record type
+	TypeCAA        = 257 // CAA record type
+	TypeOPT        = 41  // EDNS(0) pseudo-record type
+	TypeDS         = 43  // DS record type
+	TypeRRSIG      = 46  // RRSIG record type
+	TypeDNSKEY     = 48  // DNSKEY record type
+	TypeNSEC       = 47  // NSEC record type
+	TypeNSEC3      = 50  // NSEC3 record type
+	TypeCDS        = 59  // CDS record type
+	TypeSOA        = 6   // SOA record type
+	TypeCDNSKEY    = 60  // CDNSKEY record type
+	TypeNSEC3PARAM = 51  // NSEC3PARAM record type
+	TypeTSIG       = 250 // TSIG meta-record type
+	TypeIXFR       = 251 // Incremental zone transfer QTYPE
+	TypeAXFR       = 252 // Full zone transfer QTYPE
+	TypeANY        = 255 // Any type, used by UPDATE deletions
+	ClassNONE      = 254 // None class, used by UPDATE
+	ClassANY       = 255 // Any class, used by TSIG and UPDATE
+	DefaultTTL     = 300 // Default TTL value
 )
 
 // // Add unified registration
@@ -51,10 +73,25 @@ func init() {
 	RegisterHandler(&TXTRecord{})
 	RegisterHandler(&CNAMERecord{})
 	RegisterHandler(&NSRecord{})
+	RegisterHandler(&SRVRecord{})
+	RegisterHandler(&TLSARecord{})
+	RegisterHandler(&SVCBRecord{})
+	RegisterHandler(&HTTPSRecord{})
+	RegisterHandler(&CAARecord{})
+	RegisterHandler(&DSRecord{})
+	RegisterHandler(&RRSIGRecord{})
+	RegisterHandler(&DNSKEYRecord{})
+	RegisterHandler(&SOARecord{})
+	RegisterHandler(&NSECRecord{})
+	RegisterHandler(&NSEC3Record{})
+	RegisterHandler(&NSEC3PARAMRecord{})
+	RegisterHandler(&CDSRecord{})
+	RegisterHandler(&CDNSKEYRecord{})
 
 	// Verify registration
-	log.Printf("Registered handlers for types: A(%d), AAAA(%d), NS(%d), MX(%d), TXT(%d), CNAME(%d)",
-		TypeA, TypeAAAA, TypeNS, TypeMX, TypeTXT, TypeCNAME)
+	log.Printf("Registered handlers for types: A(%d), AAAA(%d), NS(%d), MX(%d), TXT(%d), CNAME(%d), SRV(%d), TLSA(%d), SVCB(%d), HTTPS(%d), CAA(%d), DS(%d), RRSIG(%d), DNSKEY(%d), SOA(%d), NSEC(%d), NSEC3(%d), NSEC3PARAM(%d), CDS(%d), CDNSKEY(%d)",
+		TypeA, TypeAAAA, TypeNS, TypeMX, TypeTXT, TypeCNAME, TypeSRV, TypeTLSA, TypeSVCB, TypeHTTPS, TypeCAA, TypeDS, TypeRRSIG, TypeDNSKEY,
+		TypeSOA, TypeNSEC, TypeNSEC3, TypeNSEC3PARAM, TypeCDS, TypeCDNSKEY)
 }
 
 // Add verification method
@@ -70,9 +107,6 @@ func RegisterHandler(h RecordHandler) {
 }
 
 func GetHandler(qtype uint16) (RecordHandler, bool) {
-	// Debug logging
-	log.Printf("Looking up handler for type %d", qtype)
-	log.Printf("Available handlers: %v", handlers)
 	h, ok := handlers[qtype]
 	return h, ok
 }
@@ -81,19 +115,70 @@ func GetHandler(qtype uint16) (RecordHandler, bool) {
 type RecordHandler interface {
 	ValidateData(data interface{}) error
 	BuildRecordData(data interface{}) ([]byte, error)
+	RecordDataParser
 	BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error)
 	Type() uint16
 	Class() uint16
 	DefaultTTL() uint32
 }
 
-// Change this
+// ZoneDataParser is implemented by handlers that can read the RDATA of a
+// record from its zone-file (presentation) form. Relative names in fields
+// are qualified against origin.
+type ZoneDataParser interface {
+	ParseZoneData(fields []string, origin string) (interface{}, error)
+}
+
+// ZoneDataFormatter is implemented by handlers that can write RDATA in its
+// zone-file form, the inverse of ZoneDataParser. Names are written fully
+// qualified so the output does not depend on an origin.
+type ZoneDataFormatter interface {
+	FormatZoneData(data interface{}) (string, error)
+}
+
+// RecordDataParser decodes wire-format RDATA back into the typed value
+// accepted by BuildRecordData. The RDATA starts at offset in msg and spans
+// length bytes; msg is the whole message so compression pointers can be
+// followed.
+type RecordDataParser interface {
+	ParseRecordData(msg []byte, offset, length int) (interface{}, error)
+}
+
+// RecordDataAppender is implemented by handlers that can append RDATA to
+// a message being built instead of returning it in a new slice
+type RecordDataAppender interface {
+	AppendRecordData(b []byte, data interface{}) ([]byte, error)
+}
+
+// CompressibleRecord is implemented by the well-known types whose RDATA
+// names may be compressed (RFC 3597 section 4: NS, CNAME, SOA, PTR, MX...).
+// Other types, including SRV and SVCB, always write names uncompressed.
+type CompressibleRecord interface {
+	BuildCompressedRecordData(data interface{}, w *DomainNameWriter) ([]byte, error)
+}
+
+// AdditionalNamer is implemented by handlers whose RDATA references hosts
+// whose addresses belong in the additional section of a response.
+type AdditionalNamer interface {
+	AdditionalNames(data interface{}) []string
+}
+
+// DomainNameWriter tracks where names were written in a message so later
+// names can point at them. Pos is the message offset of the buffer being
+// written; Offsets maps lower-cased names to their message offset.
+//
+// With Msg set, names are instead compared in place against the message:
+// Msg holds it up to Pos and Names the offsets of every name suffix
+// written into it, so no lower-cased keys are built.
 type DomainNameWriter struct {
 	Offsets map[string]int
 	Pos     int
+
+	Msg   []byte
+	Names []int
 }
 
-// To this
+// BaseHandler carries the helpers shared by every record handler
 type BaseHandler struct {
 	Writer *DomainNameWriter
 	Type   uint16
@@ -109,71 +194,34 @@ func (b *BaseHandler) SetWriter(w *DomainNameWriter) {
 	b.Writer = w
 }
 
-// WriteDomainName with compression support
-// func (b *BaseHandler) WriteDomainName(buf *bytes.Buffer, domain string) error {
-// 	if len(domain) == 0 {
-// 		return errors.New("empty domain name")
-// 	}
-
-// 	// Remove trailing dot if present
-// 	domain = strings.TrimSuffix(domain, ".")
-
-// 	// Initialize writer if needed
-// 	if b.Writer == nil {
-// 		b.Writer = &DomainNameWriter{
-// 			Offsets: make(map[string]int),
-// 		}
-// 	}
-
-// 	startPos := b.Writer.Pos
-
-// 	// Check if we've seen this domain before
-// 	if offset, exists := b.Writer.Offsets[domain]; exists {
-// 		// Use compression pointer (0xC0 | offset)
-// 		pointer := uint16(0xC000 | offset)
-// 		return binary.Write(buf, binary.BigEndian, pointer)
-// 	}
-
-// 	labels := strings.Split(domain, ".")
-// 	for i, label := range labels {
-// 		if len(label) == 0 {
-// 			return errors.New("empty label in domain name")
-// 		}
-// 		if len(label) > 63 {
-// 			return errors.New("label exceeds 63 characters")
-// 		}
-
-// 		// Store offset for this subdomain
-// 		remainingDomain := strings.Join(labels[i:], ".")
-// 		b.Writer.Offsets[remainingDomain] = b.Writer.Pos
-
-// 		// Write label length and data
-// 		if err := buf.WriteByte(byte(len(label))); err != nil {
-// 			return fmt.Errorf("failed to write label length: %w", err)
-// 		}
-// 		if _, err := buf.Write([]byte(label)); err != nil {
-// 			return fmt.Errorf("failed to write label: %w", err)
-// 		}
-
-// 		b.Writer.Pos += 1 + len(label)
-// 	}
-
-// 	// Write the terminating null byte
-// 	if err := buf.WriteByte(0); err != nil {
-// 		return fmt.Errorf("failed to write terminating byte: %w", err)
-// 	}
-// 	b.Writer.Pos++
-
-// 	// Store the complete domain name offset
-// 	b.Writer.Offsets[domain] = startPos
-
-// 	return nil
-// }
-
+// WriteDomainName writes domain in wire format. With a Writer attached the
+// name is compressed against every name the writer has seen.
 func (b *BaseHandler) WriteDomainName(buf *bytes.Buffer, domain string) error {
+	return b.Writer.WriteDomainName(buf, domain)
+}
+
+// WriteDomainName writes domain into buf, which starts at message offset
+// w.Pos. The longest suffix already present in the message is replaced by
+// a compression pointer and new suffixes are remembered for later names.
+// A nil writer writes the name uncompressed.
+func (w *DomainNameWriter) WriteDomainName(buf *bytes.Buffer, domain string) error {
 	if domain == "" {
 		return errors.New("empty domain name")
 	}
+	if w != nil && w.Msg != nil {
+		n := buf.Len()
+		out, err := w.appendName(w.Msg[:w.Pos], buf.Bytes(), domain)
+		if err != nil {
+			return err
+		}
+		buf.Write(out[n:])
+		return nil
+	}
+
+	// The root name is a single zero byte
+	if domain == "." {
+		return buf.WriteByte(0)
+	}
 
 	// Remove trailing dot if present
 	domain = strings.TrimSuffix(domain, ".")
@@ -186,6 +234,23 @@ func (b *BaseHandler) WriteDomainName(buf *bytes.Buffer, domain string) error {
 		if len(label) > 63 {
 			return errors.New("label exceeds 63 characters")
 		}
+	}
+
+	for i, label := range labels {
+		if w != nil {
+			// Names compare case-insensitively
+			suffix := strings.ToLower(strings.Join(labels[i:], "."))
+			if offset, ok := w.Offsets[suffix]; ok {
+				return binary.Write(buf, binary.BigEndian, uint16(0xC000|offset))
+			}
+			// Pointers only have 14 bits of offset
+			if pos := w.Pos + buf.Len(); pos <= 0x3FFF {
+				if w.Offsets == nil {
+					w.Offsets = make(map[string]int)
+				}
+				w.Offsets[suffix] = pos
+			}
+		}
 
 		// Write length byte
 		if err := buf.WriteByte(byte(len(label))); err != nil {
@@ -201,6 +266,213 @@ func (b *BaseHandler) WriteDomainName(buf *bytes.Buffer, domain string) error {
 	return buf.WriteByte(0)
 }
 
+// AppendDomainName appends domain to msg, the message written so far,
+// compressing it against the names recorded in w.Names. A nil writer
+// appends the name uncompressed.
+func (w *DomainNameWriter) AppendDomainName(msg []byte, domain string) ([]byte, error) {
+	if domain == "" {
+		return msg, errors.New("empty domain name")
+	}
+	if w == nil {
+		return appendLabels(msg, domain)
+	}
+	return w.appendName(nil, msg, domain)
+}
+
+// appendName appends domain to b, which follows prefix in the message
+func (w *DomainNameWriter) appendName(prefix, b []byte, domain string) ([]byte, error) {
+	if domain == "." {
+		return append(b, 0), nil
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if err := checkLabels(domain); err != nil {
+		return b, err
+	}
+
+	for suffix := domain; ; {
+		for _, offset := range w.Names {
+			if nameAt(prefix, b, offset, suffix) {
+				return binary.BigEndian.AppendUint16(b, uint16(0xC000|offset)), nil
+			}
+		}
+		// Pointers only have 14 bits of offset
+		if pos := len(prefix) + len(b); pos <= 0x3FFF {
+			w.Names = append(w.Names, pos)
+		}
+		dot := strings.IndexByte(suffix, '.')
+		if dot < 0 {
+			b = append(b, byte(len(suffix)))
+			b = append(b, suffix...)
+			return append(b, 0), nil
+		}
+		b = append(b, byte(dot))
+		b = append(b, suffix[:dot]...)
+		suffix = suffix[dot+1:]
+	}
+}
+
+// appendLabels appends domain uncompressed
+func appendLabels(b []byte, domain string) ([]byte, error) {
+	if domain == "." {
+		return append(b, 0), nil
+	}
+	domain = strings.TrimSuffix(domain, ".")
+	if err := checkLabels(domain); err != nil {
+		return b, err
+	}
+	for {
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			b = append(b, byte(len(domain)))
+			b = append(b, domain...)
+			return append(b, 0), nil
+		}
+		b = append(b, byte(dot))
+		b = append(b, domain[:dot]...)
+		domain = domain[dot+1:]
+	}
+}
+
+// checkLabels rejects empty labels and labels over 63 characters
+func checkLabels(domain string) error {
+	start := 0
+	for i := 0; i <= len(domain); i++ {
+		if i < len(domain) && domain[i] != '.' {
+			continue
+		}
+		switch {
+		case i == start:
+			return errors.New("empty label in domain name")
+		case i-start > 63:
+			return errors.New("label exceeds 63 characters")
+		}
+		start = i + 1
+	}
+	return nil
+}
+
+// nameAt reports whether the name at offset in the message formed by
+// prefix and b equals name, ignoring ASCII case
+func nameAt(prefix, b []byte, offset int, name string) bool {
+	at := func(i int) (byte, bool) {
+		if i < len(prefix) {
+			return prefix[i], true
+		}
+		if i -= len(prefix); i < len(b) {
+			return b[i], true
+		}
+		return 0, false
+	}
+
+	for jumps := 0; jumps <= 10; {
+		length, ok := at(offset)
+		if !ok {
+			return false
+		}
+		if length&0xC0 == 0xC0 {
+			low, ok := at(offset + 1)
+			if !ok {
+				return false
+			}
+			offset = int(length&0x3F)<<8 | int(low)
+			jumps++
+			continue
+		}
+		if length == 0 {
+			return name == ""
+		}
+
+		n := int(length)
+		if len(name) < n || (len(name) > n && name[n] != '.') {
+			return false
+		}
+		for i := 0; i < n; i++ {
+			c, ok := at(offset + 1 + i)
+			if !ok || lowerASCII(c) != lowerASCII(name[i]) {
+				return false
+			}
+		}
+		name = name[min(n+1, len(name)):]
+		offset += 1 + n
+	}
+	return false
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// ReadDomainName decodes the name starting at offset in msg, following
+// compression pointers. It returns the name without a trailing dot ("."
+// for the root) and the offset just past the name in the original stream.
+// The labels are gathered in a fixed buffer, so the name string is the
+// only allocation.
+func (b *BaseHandler) ReadDomainName(msg []byte, offset int) (string, int, error) {
+	var buf [255]byte
+	name, next, err := DecodeDomainName(buf[:0], msg, offset)
+	if err != nil {
+		return "", 0, err
+	}
+	return string(name), next, nil
+}
+
+// DecodeDomainName appends the name starting at offset in msg to dst, as
+// ReadDomainName returns it, and returns the offset just past the name. It
+// does not allocate when dst has room for 255 bytes.
+func DecodeDomainName(dst, msg []byte, offset int) ([]byte, int, error) {
+	start := len(dst)
+	next := -1
+	jumps := 0
+
+	for {
+		if offset >= len(msg) {
+			return nil, 0, errors.New("name exceeds message")
+		}
+		length := int(msg[offset])
+
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			if len(dst) == start {
+				return append(dst, '.'), next, nil
+			}
+			return dst[:len(dst)-1], next, nil
+
+		case length&0xC0 == 0xC0:
+			if offset+1 >= len(msg) {
+				return nil, 0, errors.New("truncated compression pointer")
+			}
+			if jumps++; jumps > 10 {
+				return nil, 0, errors.New("compression loop detected")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:offset+2]) & 0x3FFF)
+
+		case length > 63:
+			return nil, 0, fmt.Errorf("invalid label length %d", length)
+
+		default:
+			end := offset + 1 + length
+			if end > len(msg) {
+				return nil, 0, errors.New("label exceeds message")
+			}
+			if len(dst)-start+length+1 > 255 {
+				return nil, 0, errors.New("domain exceeds 255 characters")
+			}
+			dst = append(dst, msg[offset+1:end]...)
+			dst = append(dst, '.')
+			offset = end
+		}
+	}
+}
+
 // ValidateCommon checks base requirements
 func (b *BaseHandler) ValidateCommon(domain string, data interface{}) error {
 	if err := validateDomain(domain); err != nil {
@@ -267,16 +539,16 @@ func (b *BaseHandler) ValidateIP(data interface{}, ipv6 bool) error {
 		return errors.New("invalid data type, expected string")
 	}
 
-	parsed := net.ParseIP(ip)
-	if parsed == nil {
+	parsed, err := netip.ParseAddr(ip)
+	if err != nil || parsed.Zone() != "" {
 		return errors.New("invalid IP format")
 	}
 
-	if ipv6 && parsed.To4() != nil {
+	if ipv6 && parsed.Unmap().Is4() {
 		return errors.New("IPv4 address not allowed in AAAA record, expected IPv6 address")
 	}
 
-	if !ipv6 && parsed.To4() == nil {
+	if !ipv6 && !parsed.Unmap().Is4() {
 		return errors.New("IPv6 address not allowed in A record, expected IPv4 address")
 	}
 	return nil
@@ -330,14 +602,85 @@ func (b *BaseHandler) ValidateRecordType(data interface{}, expectedType string)
 	}
 }
 
-// Add helper method to check if a type is supported
+// IsSupportedType reports whether qtype can be answered: every data type
+// is, either by its dedicated handler or opaquely through RawRecord
 func IsSupportedType(qtype uint16) bool {
-	switch qtype {
-	case TypeA, TypeAAAA, TypeMX, TypeTXT, TypeCNAME, TypeNS:
-		return true
+	_, ok := HandlerFor(qtype)
+	return ok
+}
+
+// qualifyName turns a zone-file name into an absolute name without the
+// trailing dot. "@" stands for the origin and names not ending in a dot
+// are relative to it.
+func qualifyName(name, origin string) string {
+	origin = strings.TrimSuffix(origin, ".")
+	switch {
+	case name == "@":
+		if origin == "" {
+			return "."
+		}
+		return origin
+	case name == ".":
+		return name
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	case origin == "":
+		return name
 	default:
-		return false
+		return name + "." + origin
+	}
+}
+
+// fqdn writes a stored name in absolute zone-file form
+func fqdn(name string) string {
+	if name == "." || name == "" {
+		return "."
+	}
+	return name + "."
+}
+
+// parseUint16Field parses a numeric zone-file field into a uint16
+func parseUint16Field(field, name string) (uint16, error) {
+	v, err := strconv.ParseUint(field, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, field, err)
+	}
+	return uint16(v), nil
+}
+
+// parseNameRData decodes RDATA consisting of a single domain name, as used
+// by CNAME and NS, and checks that the name fills the RDATA exactly
+func (b *BaseHandler) parseNameRData(msg []byte, offset, length int) (string, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return "", err
+	}
+	name, next, err := b.ReadDomainName(msg, offset)
+	if err != nil {
+		return "", err
+	}
+	if next != end {
+		return "", fmt.Errorf("name ends at %d, RDATA ends at %d", next, end)
+	}
+	return name, nil
+}
+
+// rdataBounds checks that the RDATA window lies inside msg
+func rdataBounds(msg []byte, offset, length int) (int, error) {
+	end := offset + length
+	if offset < 0 || length < 0 || end > len(msg) {
+		return 0, fmt.Errorf("RDATA [%d:%d] exceeds message of %d bytes", offset, end, len(msg))
+	}
+	return end, nil
+}
+
+// parseUint8Field parses a numeric zone-file field into a uint8
+func parseUint8Field(field, name string) (uint8, error) {
+	v, err := strconv.ParseUint(field, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, field, err)
 	}
+	return uint8(v), nil
 }
 
 // Add this helper function
@@ -1,11 +1,14 @@
 package records
 
 import (
+	"bytes"
 	"testing"
 )
 
 func TestHandlerRegistration(t *testing.T) {
-	// Clear existing handlers
+	// Clear existing handlers, restoring them once the test is done
+	registered := handlers
+	t.Cleanup(func() { handlers = registered })
 	handlers = make(map[uint16]RecordHandler)
 
 	// Register handlers
@@ -35,3 +38,112 @@ func TestHandlerRegistration(t *testing.T) {
 		})
 	}
 }
+
+// roundTripRecordData builds the RDATA of data and decodes it again from
+// inside a larger message, as it would appear after a header and name
+func roundTripRecordData(t *testing.T, h RecordHandler, data interface{}) interface{} {
+	t.Helper()
+	rdata, err := h.BuildRecordData(data)
+	if err != nil {
+		t.Fatalf("BuildRecordData(%v) failed: %v", data, err)
+	}
+
+	msg := append(make([]byte, 12), rdata...)
+	parsed, err := h.ParseRecordData(msg, 12, len(rdata))
+	if err != nil {
+		t.Fatalf("ParseRecordData(%x) failed: %v", rdata, err)
+	}
+	return parsed
+}
+
+func TestReadDomainName(t *testing.T) {
+	var b BaseHandler
+	msg := []byte{
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		4, 'm', 'a', 'i', 'l', 0xC0, 0x00,
+		0,
+	}
+
+	name, next, err := b.ReadDomainName(msg, 13)
+	if err != nil || name != "mail.example.com" || next != 20 {
+		t.Errorf("Got %q, next %d, err %v", name, next, err)
+	}
+
+	name, next, err = b.ReadDomainName(msg, 20)
+	if err != nil || name != "." || next != 21 {
+		t.Errorf("Root: got %q, next %d, err %v", name, next, err)
+	}
+
+	loop := []byte{0xC0, 0x00}
+	if _, _, err := b.ReadDomainName(loop, 0); err == nil {
+		t.Error("Expected error for compression loop")
+	}
+	if _, _, err := b.ReadDomainName([]byte{5, 'a', 'b'}, 0); err == nil {
+		t.Error("Expected error for truncated label")
+	}
+}
+
+func TestDomainNameWriter_Compression(t *testing.T) {
+	w := &DomainNameWriter{Pos: 12}
+	var buf bytes.Buffer
+
+	if err := w.WriteDomainName(&buf, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteDomainName(&buf, "www.Example.com."); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteDomainName(&buf, "example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		3, 'w', 'w', 'w', 0xC0, 12,
+		0xC0, 12,
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("Expected:\n%x\nGot:\n%x", expected, buf.Bytes())
+	}
+
+	// A nil writer never compresses
+	var plain *DomainNameWriter
+	buf.Reset()
+	if err := plain.WriteDomainName(&buf, "example.com"); err != nil || buf.Len() != 13 {
+		t.Errorf("Expected uncompressed name, got %x (%v)", buf.Bytes(), err)
+	}
+}
+
+func TestDomainNameWriter_InPlace(t *testing.T) {
+	w := &DomainNameWriter{}
+	msg := make([]byte, 12)
+
+	var err error
+	for _, name := range []string{"example.com", "www.Example.com.", "example.com"} {
+		if msg, err = w.AppendDomainName(msg, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// RDATA names compare against the message written before the buffer
+	w.Msg, w.Pos = msg, len(msg)
+	var buf bytes.Buffer
+	if err := w.WriteDomainName(&buf, "mail.WWW.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		3, 'w', 'w', 'w', 0xC0, 12,
+		0xC0, 12,
+	}
+	if !bytes.Equal(msg[12:], expected) {
+		t.Errorf("Expected:\n%x\nGot:\n%x", expected, msg[12:])
+	}
+	if rdata := []byte{4, 'm', 'a', 'i', 'l', 0xC0, 25}; !bytes.Equal(buf.Bytes(), rdata) {
+		t.Errorf("Expected RDATA %x, got %x", rdata, buf.Bytes())
+	}
+	if _, err := w.AppendDomainName(msg, "bad..name"); err == nil {
+		t.Error("Expected error for empty label")
+	}
+}
@@ -0,0 +1,125 @@
+package records
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// CAARecord handles certification authority authorization records (RFC 8659)
+type CAARecord struct {
+	BaseHandler
+}
+
+func (r *CAARecord) Type() uint16       { return TypeCAA }
+func (r *CAARecord) Class() uint16      { return ClassIN }
+func (r *CAARecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// CAAFlagCritical is the issuer critical flag
+const CAAFlagCritical = 0x80
+
+// CAAData holds a single property, e.g. 0 issue "letsencrypt.org"
+type CAAData struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+func (r *CAARecord) ValidateData(data interface{}) error {
+	caa, ok := data.(CAAData)
+	if !ok {
+		return errors.New("invalid CAA data format")
+	}
+	return validateCAATag(caa.Tag)
+}
+
+// validateCAATag enforces the 1-15 ASCII letters and digits rule for tags
+func validateCAATag(tag string) error {
+	if len(tag) == 0 || len(tag) > 15 {
+		return fmt.Errorf("CAA tag %q must be 1-15 characters", tag)
+	}
+	for i := 0; i < len(tag); i++ {
+		c := tag[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return fmt.Errorf("CAA tag %q contains invalid character %q", tag, c)
+		}
+	}
+	return nil
+}
+
+func (r *CAARecord) BuildRecordData(data interface{}) ([]byte, error) {
+	caa, ok := data.(CAAData)
+	if !ok {
+		return nil, errors.New("invalid CAA data format")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(caa.Flags)
+	buf.WriteByte(byte(len(caa.Tag)))
+	buf.WriteString(caa.Tag)
+	// The value takes the remainder of the RDATA, without a length prefix
+	buf.WriteString(caa.Value)
+	return buf.Bytes(), nil
+}
+
+func (r *CAARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *CAARecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 2 {
+		return nil, errors.New("CAA RDATA too short")
+	}
+
+	tagLen := int(msg[offset+1])
+	tagEnd := offset + 2 + tagLen
+	if tagEnd > end {
+		return nil, errors.New("CAA tag exceeds RDATA")
+	}
+
+	caa := CAAData{
+		Flags: msg[offset],
+		Tag:   string(msg[offset+2 : tagEnd]),
+		Value: string(msg[tagEnd:end]),
+	}
+	if err := validateCAATag(caa.Tag); err != nil {
+		return nil, err
+	}
+	return caa, nil
+}
+
+// ParseZoneData reads "<flags> <tag> <value>"; a value split into several
+// fields is joined back with spaces
+func (r *CAARecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("CAA record expects 3 fields, got %d", len(fields))
+	}
+
+	flags, err := parseUint8Field(fields[0], "CAA flags")
+	if err != nil {
+		return nil, err
+	}
+
+	caa := CAAData{
+		Flags: flags,
+		Tag:   fields[1],
+		Value: strings.Join(fields[2:], " "),
+	}
+	if err := validateCAATag(caa.Tag); err != nil {
+		return nil, err
+	}
+	return caa, nil
+}
+
+func (r *CAARecord) FormatZoneData(data interface{}) (string, error) {
+	caa, ok := data.(CAAData)
+	if !ok {
+		return "", errors.New("invalid CAA data format")
+	}
+	return fmt.Sprintf("%d %s %s", caa.Flags, caa.Tag, quoteText(caa.Value)), nil
+}
@@ -0,0 +1,74 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCAARecord_BuildRecordData(t *testing.T) {
+	caa := &CAARecord{}
+	expected := append([]byte{0, 5, 'i', 's', 's', 'u', 'e'}, "letsencrypt.org"...)
+
+	data, err := caa.BuildRecordData(CAAData{Flags: 0, Tag: "issue", Value: "letsencrypt.org"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected:\n%x\nGot:\n%x", expected, data)
+	}
+}
+
+func TestCAARecord_RoundTrip(t *testing.T) {
+	caa := &CAARecord{}
+	want := CAAData{Flags: CAAFlagCritical, Tag: "iodef", Value: "mailto:security@example.com"}
+
+	rdata, err := caa.BuildRecordData(want)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Embed the RDATA at a non-zero offset as it would be inside a message
+	msg := append([]byte{0xde, 0xad}, rdata...)
+
+	got, err := caa.ParseRecordData(msg, 2, len(rdata))
+	if err != nil {
+		t.Fatalf("ParseRecordData failed: %v", err)
+	}
+	if got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCAARecord_Validation(t *testing.T) {
+	caa := &CAARecord{}
+	cases := []interface{}{
+		CAAData{Tag: ""},
+		CAAData{Tag: "issue-wild"},
+		CAAData{Tag: "averyveryverylongtag"},
+		"0 issue letsencrypt.org",
+	}
+	for _, c := range cases {
+		if err := caa.ValidateData(c); err == nil {
+			t.Errorf("Expected error for: %v", c)
+		}
+	}
+
+	if _, err := caa.ParseRecordData([]byte{0, 9, 'i', 's'}, 0, 4); err == nil {
+		t.Error("Expected error for tag length past RDATA")
+	}
+}
+
+func TestCAARecord_ParseZoneData(t *testing.T) {
+	caa := &CAARecord{}
+	data, err := caa.ParseZoneData([]string{"128", "issue", "ca.example.net; account=230123"}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := CAAData{Flags: 128, Tag: "issue", Value: "ca.example.net; account=230123"}
+	if data != want {
+		t.Errorf("Expected %+v, got %+v", want, data)
+	}
+
+	if _, err := caa.ParseZoneData([]string{"256", "issue", "ca"}, ""); err == nil {
+		t.Error("Expected error for out of range flags")
+	}
+}
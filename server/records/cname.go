@@ -3,6 +3,7 @@ package records
 import (
 	"bytes"
 	"errors"
+	"fmt"
 )
 
 type CNAMERecord struct {
@@ -22,36 +23,20 @@ func (r *CNAMERecord) ValidateData(data interface{}) error {
 }
 
 func (r *CNAMERecord) BuildRecordData(data interface{}) ([]byte, error) {
+	return r.BuildCompressedRecordData(data, r.Writer)
+}
+
+// BuildCompressedRecordData writes the target, compressed when w is set
+func (r *CNAMERecord) BuildCompressedRecordData(data interface{}, w *DomainNameWriter) ([]byte, error) {
 	target, ok := data.(string)
 	if !ok {
 		return nil, errors.New("invalid CNAME data type")
 	}
 
 	var buf bytes.Buffer
-	// Remove trailing dot if present
-	// target = strings.TrimSuffix(target, ".")
-
-	// // Write domain name in DNS wire format
-	// labels := strings.Split(target, ".")
-	// for _, label := range labels {
-	// 	if len(label) > 63 {
-	// 		return nil, errors.New("label exceeds 63 characters")
-	// 	}
-	// 	if err := buf.WriteByte(byte(len(label))); err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if _, err := buf.WriteString(label); err != nil {
-	// 		return nil, err
-	// 	}
-	// }
-	// // Terminate with zero byte
-	// if err := buf.WriteByte(0); err != nil {
-	// 	return nil, err
-	// }
-
-	if err := r.WriteDomainName(&buf, target); err != nil {
-        return nil, err
-    }
+	if err := w.WriteDomainName(&buf, target); err != nil {
+		return nil, err
+	}
 
 	return buf.Bytes(), nil
 }
@@ -59,3 +44,23 @@ func (r *CNAMERecord) BuildRecordData(data interface{}) ([]byte, error) {
 func (r *CNAMERecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
 	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
 }
+
+func (r *CNAMERecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	return r.parseNameRData(msg, offset, length)
+}
+
+// ParseZoneData reads "<target>"
+func (r *CNAMERecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("CNAME record expects 1 field, got %d", len(fields))
+	}
+	return qualifyName(fields[0], origin), nil
+}
+
+func (r *CNAMERecord) FormatZoneData(data interface{}) (string, error) {
+	target, ok := data.(string)
+	if !ok {
+		return "", errors.New("invalid CNAME data format")
+	}
+	return fqdn(target), nil
+}
@@ -69,3 +69,22 @@ func validateCNAMERecord(t *testing.T, buf *bytes.Buffer, domain, target string,
 		t.Errorf("Target mismatch: expected %q, got %q", target, parsedTarget)
 	}
 }
+
+func TestCNAMERecord_ParseRecordData(t *testing.T) {
+	cname := &CNAMERecord{}
+	if got := roundTripRecordData(t, cname, "target.example.com"); got != "target.example.com" {
+		t.Errorf("Expected target.example.com, got %v", got)
+	}
+
+	// Target compressed against the owner name at offset 0
+	msg := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0, 3, 'w', 'w', 'w', 0xC0, 0x00}
+	got, err := cname.ParseRecordData(msg, 9, 6)
+	if err != nil || got != "www.example" {
+		t.Errorf("Compressed target: got %v, err %v", got, err)
+	}
+
+	// A name running past RDLENGTH is malformed
+	if _, err := cname.ParseRecordData(msg, 9, 4); err == nil {
+		t.Error("Expected error for name exceeding RDATA")
+	}
+}
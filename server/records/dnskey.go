@@ -0,0 +1,133 @@
+package records
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DNSKEYRecord handles DNSSEC public keys (RFC 4034 section 2)
+type DNSKEYRecord struct {
+	BaseHandler
+}
+
+func (r *DNSKEYRecord) Type() uint16       { return TypeDNSKEY }
+func (r *DNSKEYRecord) Class() uint16      { return ClassIN }
+func (r *DNSKEYRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// DNSKEY flags
+const (
+	DNSKEYFlagZone = 0x0100 // Zone key, may sign RRsets
+	DNSKEYFlagSEP  = 0x0001 // Secure entry point (KSK)
+)
+
+// DNSKEYData holds a zone's public key; Protocol is always 3
+type DNSKEYData struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+}
+
+func (r *DNSKEYRecord) ValidateData(data interface{}) error {
+	key, ok := data.(DNSKEYData)
+	if !ok {
+		return errors.New("invalid DNSKEY data format")
+	}
+	if key.Protocol != 3 {
+		return fmt.Errorf("DNSKEY protocol must be 3, got %d", key.Protocol)
+	}
+	if len(key.PublicKey) == 0 {
+		return errors.New("empty DNSKEY public key")
+	}
+	return nil
+}
+
+func (r *DNSKEYRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	key, ok := data.(DNSKEYData)
+	if !ok {
+		return nil, errors.New("invalid DNSKEY data format")
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, key.Flags)
+	buf.WriteByte(key.Protocol)
+	buf.WriteByte(key.Algorithm)
+	buf.Write(key.PublicKey)
+	return buf.Bytes(), nil
+}
+
+func (r *DNSKEYRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *DNSKEYRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 5 {
+		return nil, errors.New("DNSKEY RDATA too short")
+	}
+	return DNSKEYData{
+		Flags:     binary.BigEndian.Uint16(msg[offset:]),
+		Protocol:  msg[offset+2],
+		Algorithm: msg[offset+3],
+		PublicKey: append([]byte(nil), msg[offset+4:end]...),
+	}, nil
+}
+
+// ParseZoneData reads "<flags> <protocol> <algorithm> <base64 key>"; the
+// key may be split over several fields
+func (r *DNSKEYRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("DNSKEY record expects 4 fields, got %d", len(fields))
+	}
+
+	flags, err := parseUint16Field(fields[0], "DNSKEY flags")
+	if err != nil {
+		return nil, err
+	}
+	protocol, err := parseUint8Field(fields[1], "DNSKEY protocol")
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := parseUint8Field(fields[2], "DNSKEY algorithm")
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSKEY public key: %w", err)
+	}
+
+	data := DNSKEYData{Flags: flags, Protocol: protocol, Algorithm: algorithm, PublicKey: key}
+	if err := r.ValidateData(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CDNSKEYRecord is the child's copy of the DNSKEY it wants the parent to
+// publish a DS for (RFC 7344); it shares the DNSKEY RDATA
+type CDNSKEYRecord struct {
+	DNSKEYRecord
+}
+
+func (r *CDNSKEYRecord) Type() uint16 { return TypeCDNSKEY }
+
+func (r *CDNSKEYRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *DNSKEYRecord) FormatZoneData(data interface{}) (string, error) {
+	key, ok := data.(DNSKEYData)
+	if !ok {
+		return "", errors.New("invalid DNSKEY data format")
+	}
+	return fmt.Sprintf("%d %d %d %s", key.Flags, key.Protocol, key.Algorithm,
+		base64.StdEncoding.EncodeToString(key.PublicKey)), nil
+}
@@ -0,0 +1,31 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDNSKEYRecord_ParseZoneData(t *testing.T) {
+	dnskey := &DNSKEYRecord{}
+	data, err := dnskey.ParseZoneData([]string{"257", "3", "13", "mdsswUyr3DPW132mOi8V9xESWE8jTo0d", "xCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ=="}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	key := data.(DNSKEYData)
+	if key.Flags != DNSKEYFlagZone|DNSKEYFlagSEP || key.Algorithm != 13 || len(key.PublicKey) != 64 {
+		t.Errorf("Unexpected key: %+v", key)
+	}
+
+	if _, err := dnskey.ParseZoneData([]string{"256", "2", "13", "AAAA"}, ""); err == nil {
+		t.Error("Expected error for protocol other than 3")
+	}
+}
+
+func TestDNSKEYRecord_RoundTrip(t *testing.T) {
+	dnskey := &DNSKEYRecord{}
+	want := DNSKEYData{Flags: 256, Protocol: 3, Algorithm: 15, PublicKey: bytes.Repeat([]byte{7}, 32)}
+	got := roundTripRecordData(t, dnskey, want).(DNSKEYData)
+	if got.Flags != want.Flags || got.Algorithm != want.Algorithm || !bytes.Equal(got.PublicKey, want.PublicKey) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,120 @@
+package records
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DSRecord handles delegation signer records (RFC 4034 section 5)
+type DSRecord struct {
+	BaseHandler
+}
+
+func (r *DSRecord) Type() uint16       { return TypeDS }
+func (r *DSRecord) Class() uint16      { return ClassIN }
+func (r *DSRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// DSData identifies a child zone's DNSKEY by tag, algorithm and digest
+type DSData struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+func (r *DSRecord) ValidateData(data interface{}) error {
+	ds, ok := data.(DSData)
+	if !ok {
+		return errors.New("invalid DS data format")
+	}
+	if len(ds.Digest) == 0 {
+		return errors.New("empty DS digest")
+	}
+	return nil
+}
+
+func (r *DSRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	ds, ok := data.(DSData)
+	if !ok {
+		return nil, errors.New("invalid DS data format")
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, ds.KeyTag)
+	buf.WriteByte(ds.Algorithm)
+	buf.WriteByte(ds.DigestType)
+	buf.Write(ds.Digest)
+	return buf.Bytes(), nil
+}
+
+func (r *DSRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *DSRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 5 {
+		return nil, errors.New("DS RDATA too short")
+	}
+	return DSData{
+		KeyTag:     binary.BigEndian.Uint16(msg[offset:]),
+		Algorithm:  msg[offset+2],
+		DigestType: msg[offset+3],
+		Digest:     append([]byte(nil), msg[offset+4:end]...),
+	}, nil
+}
+
+// ParseZoneData reads "<key tag> <algorithm> <digest type> <hex digest>";
+// the digest may be split over several fields
+func (r *DSRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("DS record expects 4 fields, got %d", len(fields))
+	}
+
+	keyTag, err := parseUint16Field(fields[0], "DS key tag")
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := parseUint8Field(fields[1], "DS algorithm")
+	if err != nil {
+		return nil, err
+	}
+	digestType, err := parseUint8Field(fields[2], "DS digest type")
+	if err != nil {
+		return nil, err
+	}
+	digest, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DS digest: %w", err)
+	}
+
+	return DSData{KeyTag: keyTag, Algorithm: algorithm, DigestType: digestType, Digest: digest}, nil
+}
+
+// CDSRecord is the child's copy of the DS it wants published by the parent
+// (RFC 7344); it shares the DS RDATA
+type CDSRecord struct {
+	DSRecord
+}
+
+func (r *CDSRecord) Type() uint16 { return TypeCDS }
+
+func (r *CDSRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *DSRecord) FormatZoneData(data interface{}) (string, error) {
+	ds, ok := data.(DSData)
+	if !ok {
+		return "", errors.New("invalid DS data format")
+	}
+	return fmt.Sprintf("%d %d %d %s", ds.KeyTag, ds.Algorithm, ds.DigestType,
+		strings.ToUpper(hex.EncodeToString(ds.Digest))), nil
+}
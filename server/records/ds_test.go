@@ -0,0 +1,45 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDSRecord_ParseZoneData(t *testing.T) {
+	ds := &DSRecord{}
+	data, err := ds.ParseZoneData([]string{"20326", "8", "2", "E06D44B80B8F1D39A95C0B0D7C65D084", "58E880409BBC683457104237C7F8EC8D"}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := data.(DSData)
+	if got.KeyTag != 20326 || got.Algorithm != 8 || got.DigestType != 2 || len(got.Digest) != 32 {
+		t.Errorf("Unexpected DS: %+v", got)
+	}
+
+	if _, err := ds.ParseZoneData([]string{"20326", "8", "2", "XYZ"}, ""); err == nil {
+		t.Error("Expected error for invalid digest")
+	}
+}
+
+func TestDSRecord_RoundTrip(t *testing.T) {
+	ds := &DSRecord{}
+	want := DSData{KeyTag: 60485, Algorithm: 5, DigestType: 1, Digest: bytes.Repeat([]byte{0xab}, 20)}
+	got := roundTripRecordData(t, ds, want).(DSData)
+	if got.KeyTag != want.KeyTag || got.DigestType != want.DigestType || !bytes.Equal(got.Digest, want.Digest) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestCDSRecord_SharesDSFormat(t *testing.T) {
+	handler, ok := GetHandler(TypeCDS)
+	if !ok {
+		t.Fatal("CDS handler not registered")
+	}
+	if handler.Type() != TypeCDS {
+		t.Errorf("Wrong type: got %d, want %d", handler.Type(), TypeCDS)
+	}
+	want := DSData{KeyTag: 1, Algorithm: 13, DigestType: 2, Digest: []byte{1, 2, 3}}
+	if got := roundTripRecordData(t, handler, want).(DSData); got.KeyTag != 1 || len(got.Digest) != 3 {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 )
 
 type MXRecord struct {
@@ -28,6 +29,12 @@ func (r *MXRecord) ValidateData(data interface{}) error {
 }
 
 func (r *MXRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	return r.BuildCompressedRecordData(data, r.Writer)
+}
+
+// BuildCompressedRecordData writes the preference and exchange, the
+// exchange compressed when w is set
+func (r *MXRecord) BuildCompressedRecordData(data interface{}, w *DomainNameWriter) ([]byte, error) {
 	mx, ok := data.(MXData)
 	if !ok {
 		return nil, errors.New("invalid MX data format")
@@ -39,26 +46,10 @@ func (r *MXRecord) BuildRecordData(data interface{}) ([]byte, error) {
 		return nil, err
 	}
 
-	// // Write exchange domain name
-	// exchange := strings.TrimSuffix(mx.Exchange, ".")
-	// labels := strings.Split(exchange, ".")
-	// for _, label := range labels {
-	// 	if err := buf.WriteByte(byte(len(label))); err != nil {
-	// 		return nil, err
-	// 	}
-	// 	if _, err := buf.WriteString(label); err != nil {
-	// 		return nil, err
-	// 	}
-	// }
-	// // Terminate with zero byte
-	// if err := buf.WriteByte(0); err != nil {
-	// 	return nil, err
-	// }
-
 	// Write exchange domain
-    if err := r.WriteDomainName(&buf, mx.Exchange); err != nil {
-        return nil, err
-    }
+	if err := w.WriteDomainName(&buf, mx.Exchange); err != nil {
+		return nil, err
+	}
 
 	return buf.Bytes(), nil
 }
@@ -67,3 +58,45 @@ func (r *MXRecord) BuildRecordData(data interface{}) ([]byte, error) {
 func (r *MXRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
 	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
 }
+
+func (r *MXRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 3 {
+		return nil, errors.New("MX RDATA too short")
+	}
+
+	exchange, next, err := r.ReadDomainName(msg, offset+2)
+	if err != nil {
+		return nil, err
+	}
+	if next != end {
+		return nil, errors.New("MX exchange does not fill RDATA")
+	}
+	return MXData{
+		Preference: binary.BigEndian.Uint16(msg[offset:]),
+		Exchange:   exchange,
+	}, nil
+}
+
+// ParseZoneData reads "<preference> <exchange>"
+func (r *MXRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("MX record expects 2 fields, got %d", len(fields))
+	}
+	preference, err := parseUint16Field(fields[0], "MX preference")
+	if err != nil {
+		return nil, err
+	}
+	return MXData{Preference: preference, Exchange: qualifyName(fields[1], origin)}, nil
+}
+
+func (r *MXRecord) FormatZoneData(data interface{}) (string, error) {
+	mx, ok := data.(MXData)
+	if !ok {
+		return "", errors.New("invalid MX data format")
+	}
+	return fmt.Sprintf("%d %s", mx.Preference, fqdn(mx.Exchange)), nil
+}
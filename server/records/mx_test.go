@@ -123,3 +123,35 @@ func TestMXHandler_Registration(t *testing.T) {
 		t.Errorf("Wrong type: got %d, want %d", handler.Type(), TypeMX)
 	}
 }
+
+func TestMXRecord_ParseRecordData(t *testing.T) {
+	mx := &MXRecord{}
+	want := MXData{Preference: 10, Exchange: "mail.example.com"}
+	if got := roundTripRecordData(t, mx, want); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// Exchange compressed against an earlier name
+	msg := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0, 0, 5, 4, 'm', 'a', 'i', 'l', 0xC0, 0x00}
+	got, err := mx.ParseRecordData(msg, 9, 9)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != (MXData{Preference: 5, Exchange: "mail.example"}) {
+		t.Errorf("Unexpected MX data: %+v", got)
+	}
+}
+
+func TestMXRecord_ParseZoneData(t *testing.T) {
+	mx := &MXRecord{}
+	data, err := mx.ParseZoneData([]string{"10", "mail"}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := (MXData{Preference: 10, Exchange: "mail.example.com"}); data != want {
+		t.Errorf("Expected %+v, got %+v", want, data)
+	}
+	if _, err := mx.ParseZoneData([]string{"mail"}, "example.com."); err == nil {
+		t.Error("Expected error for missing preference")
+	}
+}
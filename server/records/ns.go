@@ -24,8 +24,18 @@ func (n *NSRecord) ValidateData(data interface{}) error {
 }
 
 func (n *NSRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	return n.BuildCompressedRecordData(data, n.Writer)
+}
+
+// BuildCompressedRecordData writes the name server, compressed when w is set
+func (n *NSRecord) BuildCompressedRecordData(data interface{}, w *DomainNameWriter) ([]byte, error) {
+	ns, ok := data.(string)
+	if !ok {
+		return nil, errors.New("invalid NS data type, expected string")
+	}
+
 	var buf bytes.Buffer
-	if err := n.WriteDomainName(&buf, data.(string)); err != nil {
+	if err := w.WriteDomainName(&buf, ns); err != nil {
 		return nil, fmt.Errorf("failed to write NS record: %w", err)
 	}
 	return buf.Bytes(), nil
@@ -34,3 +44,23 @@ func (n *NSRecord) BuildRecordData(data interface{}) ([]byte, error) {
 func (n *NSRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
 	return n.BuildCommonAnswer(n, domain, data, ttl)
 }
+
+func (n *NSRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	return n.parseNameRData(msg, offset, length)
+}
+
+// ParseZoneData reads "<name server>"
+func (n *NSRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 1 {
+		return nil, fmt.Errorf("NS record expects 1 field, got %d", len(fields))
+	}
+	return qualifyName(fields[0], origin), nil
+}
+
+func (n *NSRecord) FormatZoneData(data interface{}) (string, error) {
+	host, ok := data.(string)
+	if !ok {
+		return "", errors.New("invalid NS data format")
+	}
+	return fqdn(host), nil
+}
@@ -46,4 +46,11 @@ func TestNSRecord_BuildRecordData(t *testing.T) {
 	if !bytes.Equal(data, expected) {
 		t.Errorf("Expected:\n%x\nGot:\n%x", expected, data)
 	}
-}
\ No newline at end of file
+}
+
+func TestNSRecord_ParseRecordData(t *testing.T) {
+	ns := &NSRecord{}
+	if got := roundTripRecordData(t, ns, "ns1.example.com"); got != "ns1.example.com" {
+		t.Errorf("Expected ns1.example.com, got %v", got)
+	}
+}
@@ -0,0 +1,165 @@
+package records
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// NSECRecord handles next secure records (RFC 4034 section 4)
+type NSECRecord struct {
+	BaseHandler
+}
+
+func (r *NSECRecord) Type() uint16       { return TypeNSEC }
+func (r *NSECRecord) Class() uint16      { return ClassIN }
+func (r *NSECRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// NSECData names the next owner in canonical order and lists the types
+// present at the NSEC owner
+type NSECData struct {
+	NextDomain string
+	Types      []uint16
+}
+
+func (r *NSECRecord) ValidateData(data interface{}) error {
+	nsec, ok := data.(NSECData)
+	if !ok {
+		return errors.New("invalid NSEC data format")
+	}
+	return validateDomain(nsec.NextDomain)
+}
+
+// BuildRecordData writes the next domain uncompressed, as RFC 3845 requires
+func (r *NSECRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	nsec, ok := data.(NSECData)
+	if !ok {
+		return nil, errors.New("invalid NSEC data format")
+	}
+
+	var buf bytes.Buffer
+	var names BaseHandler
+	if err := names.WriteDomainName(&buf, nsec.NextDomain); err != nil {
+		return nil, fmt.Errorf("failed to write NSEC next domain: %w", err)
+	}
+	buf.Write(EncodeTypeBitmap(nsec.Types))
+	return buf.Bytes(), nil
+}
+
+func (r *NSECRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *NSECRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	next, pos, err := r.ReadDomainName(msg, offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC next domain: %w", err)
+	}
+	if pos > end {
+		return nil, errors.New("NSEC next domain exceeds RDATA")
+	}
+	types, err := DecodeTypeBitmap(msg[pos:end])
+	if err != nil {
+		return nil, err
+	}
+	return NSECData{NextDomain: next, Types: types}, nil
+}
+
+// ParseZoneData reads "<next domain> <type> ..."
+func (r *NSECRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 1 {
+		return nil, errors.New("NSEC record expects a next domain")
+	}
+	types, err := parseTypeList(fields[1:])
+	if err != nil {
+		return nil, err
+	}
+	return NSECData{NextDomain: qualifyName(fields[0], origin), Types: types}, nil
+}
+
+// EncodeTypeBitmap encodes types in the windowed bitmap format shared by
+// NSEC and NSEC3 (RFC 4034 section 4.1.2)
+func EncodeTypeBitmap(types []uint16) []byte {
+	sorted := append([]uint16(nil), types...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var out []byte
+	for i := 0; i < len(sorted); {
+		window := sorted[i] >> 8
+		var bitmap [32]byte
+		length := 0
+		for ; i < len(sorted) && sorted[i]>>8 == window; i++ {
+			low := sorted[i] & 0xFF
+			bitmap[low/8] |= 0x80 >> (low % 8)
+			length = int(low/8) + 1
+		}
+		out = append(out, byte(window), byte(length))
+		out = append(out, bitmap[:length]...)
+	}
+	return out
+}
+
+// DecodeTypeBitmap decodes a windowed type bitmap into ascending types
+func DecodeTypeBitmap(data []byte) ([]uint16, error) {
+	var types []uint16
+	lastWindow := -1
+	for pos := 0; pos < len(data); {
+		if pos+2 > len(data) {
+			return nil, errors.New("truncated type bitmap window")
+		}
+		window, length := int(data[pos]), int(data[pos+1])
+		if window <= lastWindow {
+			return nil, errors.New("type bitmap windows out of order")
+		}
+		if length == 0 || length > 32 || pos+2+length > len(data) {
+			return nil, fmt.Errorf("invalid type bitmap length %d", length)
+		}
+		for i, b := range data[pos+2 : pos+2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if b&(0x80>>bit) != 0 {
+					types = append(types, uint16(window<<8|i*8+bit))
+				}
+			}
+		}
+		lastWindow = window
+		pos += 2 + length
+	}
+	return types, nil
+}
+
+// parseTypeList reads the type mnemonics of a bitmap in zone-file form
+func parseTypeList(fields []string) ([]uint16, error) {
+	types := make([]uint16, 0, len(fields))
+	for _, field := range fields {
+		rrtype, err := TypeByName(field)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, rrtype)
+	}
+	return types, nil
+}
+
+func (r *NSECRecord) FormatZoneData(data interface{}) (string, error) {
+	nsec, ok := data.(NSECData)
+	if !ok {
+		return "", errors.New("invalid NSEC data format")
+	}
+	return strings.TrimSpace(fqdn(nsec.NextDomain) + " " + formatTypeList(nsec.Types)), nil
+}
+
+// formatTypeList writes the type mnemonics of a bitmap in zone-file form
+func formatTypeList(types []uint16) string {
+	names := make([]string, len(types))
+	for i, rrtype := range types {
+		names[i] = TypeName(rrtype)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,274 @@
+package records
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NSEC3 hash algorithm and flags (RFC 5155)
+const (
+	NSEC3HashSHA1   = 1
+	NSEC3FlagOptOut = 0x01
+)
+
+// Base32Hex is the unpadded "Extended Hex" alphabet NSEC3 uses for hashed owner names
+var Base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// NSEC3Record handles hashed next secure records (RFC 5155 section 3)
+type NSEC3Record struct {
+	BaseHandler
+}
+
+func (r *NSEC3Record) Type() uint16       { return TypeNSEC3 }
+func (r *NSEC3Record) Class() uint16      { return ClassIN }
+func (r *NSEC3Record) DefaultTTL() uint32 { return DefaultTTL }
+
+// NSEC3Data links a hashed owner to the next hash in the chain and lists
+// the types present at the unhashed owner
+type NSEC3Data struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+	NextHashed    []byte
+	Types         []uint16
+}
+
+func (r *NSEC3Record) ValidateData(data interface{}) error {
+	nsec3, ok := data.(NSEC3Data)
+	if !ok {
+		return errors.New("invalid NSEC3 data format")
+	}
+	if len(nsec3.Salt) > 255 {
+		return errors.New("NSEC3 salt exceeds 255 bytes")
+	}
+	if len(nsec3.NextHashed) == 0 || len(nsec3.NextHashed) > 255 {
+		return errors.New("invalid NSEC3 next hashed owner length")
+	}
+	return nil
+}
+
+func (r *NSEC3Record) BuildRecordData(data interface{}) ([]byte, error) {
+	nsec3, ok := data.(NSEC3Data)
+	if !ok {
+		return nil, errors.New("invalid NSEC3 data format")
+	}
+	if err := r.ValidateData(data); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeNSEC3Params(&buf, nsec3.HashAlgorithm, nsec3.Flags, nsec3.Iterations, nsec3.Salt)
+	buf.WriteByte(byte(len(nsec3.NextHashed)))
+	buf.Write(nsec3.NextHashed)
+	buf.Write(EncodeTypeBitmap(nsec3.Types))
+	return buf.Bytes(), nil
+}
+
+func (r *NSEC3Record) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *NSEC3Record) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, flags, iterations, salt, pos, err := readNSEC3Params(msg[:end], offset)
+	if err != nil {
+		return nil, err
+	}
+	if pos >= end {
+		return nil, errors.New("NSEC3 RDATA too short")
+	}
+	hashLen := int(msg[pos])
+	if hashLen == 0 || pos+1+hashLen > end {
+		return nil, errors.New("invalid NSEC3 next hashed owner length")
+	}
+	types, err := DecodeTypeBitmap(msg[pos+1+hashLen : end])
+	if err != nil {
+		return nil, err
+	}
+
+	return NSEC3Data{
+		HashAlgorithm: alg,
+		Flags:         flags,
+		Iterations:    iterations,
+		Salt:          salt,
+		NextHashed:    append([]byte(nil), msg[pos+1:pos+1+hashLen]...),
+		Types:         types,
+	}, nil
+}
+
+// ParseZoneData reads "<alg> <flags> <iterations> <salt|-> <next hashed> <type> ..."
+func (r *NSEC3Record) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("NSEC3 record expects at least 5 fields, got %d", len(fields))
+	}
+
+	alg, flags, iterations, salt, err := parseNSEC3Params(fields[:4])
+	if err != nil {
+		return nil, err
+	}
+	next, err := Base32Hex.DecodeString(strings.ToUpper(fields[4]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC3 next hashed owner: %w", err)
+	}
+	types, err := parseTypeList(fields[5:])
+	if err != nil {
+		return nil, err
+	}
+
+	return NSEC3Data{HashAlgorithm: alg, Flags: flags, Iterations: iterations, Salt: salt, NextHashed: next, Types: types}, nil
+}
+
+// NSEC3PARAMRecord publishes the NSEC3 chain parameters at the zone apex
+// (RFC 5155 section 4)
+type NSEC3PARAMRecord struct {
+	BaseHandler
+}
+
+func (r *NSEC3PARAMRecord) Type() uint16       { return TypeNSEC3PARAM }
+func (r *NSEC3PARAMRecord) Class() uint16      { return ClassIN }
+func (r *NSEC3PARAMRecord) DefaultTTL() uint32 { return 0 }
+
+// NSEC3PARAMData holds the parameters used to hash owner names
+type NSEC3PARAMData struct {
+	HashAlgorithm uint8
+	Flags         uint8
+	Iterations    uint16
+	Salt          []byte
+}
+
+func (r *NSEC3PARAMRecord) ValidateData(data interface{}) error {
+	param, ok := data.(NSEC3PARAMData)
+	if !ok {
+		return errors.New("invalid NSEC3PARAM data format")
+	}
+	if len(param.Salt) > 255 {
+		return errors.New("NSEC3PARAM salt exceeds 255 bytes")
+	}
+	return nil
+}
+
+func (r *NSEC3PARAMRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	param, ok := data.(NSEC3PARAMData)
+	if !ok {
+		return nil, errors.New("invalid NSEC3PARAM data format")
+	}
+	if err := r.ValidateData(data); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeNSEC3Params(&buf, param.HashAlgorithm, param.Flags, param.Iterations, param.Salt)
+	return buf.Bytes(), nil
+}
+
+func (r *NSEC3PARAMRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *NSEC3PARAMRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	alg, flags, iterations, salt, pos, err := readNSEC3Params(msg[:end], offset)
+	if err != nil {
+		return nil, err
+	}
+	if pos != end {
+		return nil, errors.New("NSEC3PARAM salt does not fill RDATA")
+	}
+	return NSEC3PARAMData{HashAlgorithm: alg, Flags: flags, Iterations: iterations, Salt: salt}, nil
+}
+
+// ParseZoneData reads "<alg> <flags> <iterations> <salt|->"
+func (r *NSEC3PARAMRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("NSEC3PARAM record expects 4 fields, got %d", len(fields))
+	}
+	alg, flags, iterations, salt, err := parseNSEC3Params(fields)
+	if err != nil {
+		return nil, err
+	}
+	return NSEC3PARAMData{HashAlgorithm: alg, Flags: flags, Iterations: iterations, Salt: salt}, nil
+}
+
+func writeNSEC3Params(buf *bytes.Buffer, alg, flags uint8, iterations uint16, salt []byte) {
+	buf.WriteByte(alg)
+	buf.WriteByte(flags)
+	binary.Write(buf, binary.BigEndian, iterations)
+	buf.WriteByte(byte(len(salt)))
+	buf.Write(salt)
+}
+
+// readNSEC3Params decodes the fields NSEC3 and NSEC3PARAM share; msg must
+// end with the RDATA
+func readNSEC3Params(msg []byte, offset int) (alg, flags uint8, iterations uint16, salt []byte, next int, err error) {
+	if offset+5 > len(msg) {
+		return 0, 0, 0, nil, 0, errors.New("NSEC3 parameters too short")
+	}
+	saltLen := int(msg[offset+4])
+	next = offset + 5 + saltLen
+	if next > len(msg) {
+		return 0, 0, 0, nil, 0, errors.New("NSEC3 salt exceeds RDATA")
+	}
+	return msg[offset], msg[offset+1], binary.BigEndian.Uint16(msg[offset+2:]),
+		append([]byte{}, msg[offset+5:next]...), next, nil
+}
+
+// parseNSEC3Params reads "<alg> <flags> <iterations> <salt|->"
+func parseNSEC3Params(fields []string) (alg, flags uint8, iterations uint16, salt []byte, err error) {
+	if alg, err = parseUint8Field(fields[0], "NSEC3 hash algorithm"); err != nil {
+		return
+	}
+	if flags, err = parseUint8Field(fields[1], "NSEC3 flags"); err != nil {
+		return
+	}
+	if iterations, err = parseUint16Field(fields[2], "NSEC3 iterations"); err != nil {
+		return
+	}
+	salt = []byte{}
+	if fields[3] != "-" {
+		if salt, err = hex.DecodeString(fields[3]); err != nil {
+			err = fmt.Errorf("invalid NSEC3 salt: %w", err)
+		}
+	}
+	return
+}
+
+func (r *NSEC3Record) FormatZoneData(data interface{}) (string, error) {
+	nsec3, ok := data.(NSEC3Data)
+	if !ok {
+		return "", errors.New("invalid NSEC3 data format")
+	}
+	text := fmt.Sprintf("%s %s", formatNSEC3Params(nsec3.HashAlgorithm, nsec3.Flags, nsec3.Iterations, nsec3.Salt),
+		Base32Hex.EncodeToString(nsec3.NextHashed))
+	return strings.TrimSpace(text + " " + formatTypeList(nsec3.Types)), nil
+}
+
+func (r *NSEC3PARAMRecord) FormatZoneData(data interface{}) (string, error) {
+	param, ok := data.(NSEC3PARAMData)
+	if !ok {
+		return "", errors.New("invalid NSEC3PARAM data format")
+	}
+	return formatNSEC3Params(param.HashAlgorithm, param.Flags, param.Iterations, param.Salt), nil
+}
+
+// formatNSEC3Params writes the fields shared by NSEC3 and NSEC3PARAM; an
+// empty salt is written as "-"
+func formatNSEC3Params(alg, flags uint8, iterations uint16, salt []byte) string {
+	saltText := "-"
+	if len(salt) > 0 {
+		saltText = strings.ToUpper(hex.EncodeToString(salt))
+	}
+	return fmt.Sprintf("%d %d %d %s", alg, flags, iterations, saltText)
+}
@@ -0,0 +1,45 @@
+package records
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNSEC3Record_ParseZoneData(t *testing.T) {
+	nsec3 := &NSEC3Record{}
+	// From RFC 5155 appendix A
+	data, err := nsec3.ParseZoneData([]string{"1", "1", "12", "aabbccdd", "2t7b4g4vsa5smi47k61mv5bv1a22bojr", "MX", "DNSKEY", "NS", "SOA", "NSEC3PARAM", "RRSIG"}, "example.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := data.(NSEC3Data)
+	if got.HashAlgorithm != NSEC3HashSHA1 || got.Flags != NSEC3FlagOptOut || got.Iterations != 12 || len(got.Salt) != 4 || len(got.NextHashed) != 20 {
+		t.Errorf("Unexpected NSEC3 data %+v", got)
+	}
+	if Base32Hex.EncodeToString(got.NextHashed) != "2T7B4G4VSA5SMI47K61MV5BV1A22BOJR" {
+		t.Errorf("Next hashed owner did not survive decoding: %x", got.NextHashed)
+	}
+
+	if _, err := nsec3.ParseZoneData([]string{"1", "0", "0", "-", "not!base32"}, ""); err == nil {
+		t.Error("Expected error for invalid next hashed owner")
+	}
+}
+
+func TestNSEC3Record_RoundTrip(t *testing.T) {
+	nsec3 := &NSEC3Record{}
+	want := NSEC3Data{HashAlgorithm: 1, Iterations: 0, Salt: []byte{}, NextHashed: make([]byte, 20), Types: []uint16{TypeA, TypeRRSIG}}
+	if got := roundTripRecordData(t, nsec3, want); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestNSEC3PARAMRecord_RoundTrip(t *testing.T) {
+	param := &NSEC3PARAMRecord{}
+	data, err := param.ParseZoneData([]string{"1", "0", "0", "-"}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := roundTripRecordData(t, param, data); !reflect.DeepEqual(got, data) {
+		t.Errorf("Expected %+v, got %+v", data, got)
+	}
+}
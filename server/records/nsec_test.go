@@ -0,0 +1,61 @@
+package records
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTypeBitmap(t *testing.T) {
+	// Example from RFC 4034 section 4.3: A MX RRSIG NSEC TYPE1234
+	types := []uint16{TypeMX, TypeA, TypeRRSIG, TypeNSEC, 1234}
+	want := []byte{
+		0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03,
+		0x04, 0x1b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x20,
+	}
+	got := EncodeTypeBitmap(types)
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Expected:\n%x\nGot:\n%x", want, got)
+	}
+
+	decoded, err := DecodeTypeBitmap(got)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, []uint16{TypeA, TypeMX, TypeRRSIG, TypeNSEC, 1234}) {
+		t.Errorf("Unexpected types %v", decoded)
+	}
+
+	for _, bad := range [][]byte{{0x00}, {0x00, 0x00}, {0x00, 0x21}, {0x01, 0x01, 0x80, 0x00, 0x01, 0x80}} {
+		if _, err := DecodeTypeBitmap(bad); err == nil {
+			t.Errorf("Expected error for bitmap %x", bad)
+		}
+	}
+}
+
+func TestNSECRecord_ParseZoneData(t *testing.T) {
+	nsec := &NSECRecord{}
+	data, err := nsec.ParseZoneData([]string{"host", "A", "MX", "RRSIG", "NSEC", "TYPE1234"}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := data.(NSECData)
+	if got.NextDomain != "host.example.com" || len(got.Types) != 5 || got.Types[4] != 1234 {
+		t.Errorf("Unexpected NSEC data %+v", got)
+	}
+
+	if _, err := nsec.ParseZoneData([]string{"host", "BOGUS"}, "example.com."); err == nil {
+		t.Error("Expected error for unknown type mnemonic")
+	}
+}
+
+func TestNSECRecord_RoundTrip(t *testing.T) {
+	nsec := &NSECRecord{}
+	want := NSECData{NextDomain: "\x00.www.example.com", Types: []uint16{TypeRRSIG, TypeNSEC}}
+	if got := roundTripRecordData(t, nsec, want); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,145 @@
+package records
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RawRecord carries the RDATA of any record type as opaque bytes, as
+// described in RFC 3597. It lets types without a dedicated handler
+// (SSHFP, NAPTR, ...) be forwarded and served unchanged.
+type RawRecord struct {
+	BaseHandler
+	rrtype uint16
+}
+
+// RawData is the opaque RDATA handled by RawRecord
+type RawData []byte
+
+// NewRawRecord creates an opaque handler for the given record type
+func NewRawRecord(rrtype uint16) *RawRecord {
+	return &RawRecord{rrtype: rrtype}
+}
+
+func (r *RawRecord) Type() uint16       { return r.rrtype }
+func (r *RawRecord) Class() uint16      { return ClassIN }
+func (r *RawRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+func (r *RawRecord) ValidateData(data interface{}) error {
+	raw, ok := data.(RawData)
+	if !ok {
+		return errors.New("invalid raw data format")
+	}
+	if len(raw) > 0xFFFF {
+		return errors.New("raw RDATA exceeds 65535 bytes")
+	}
+	return nil
+}
+
+func (r *RawRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	raw, ok := data.(RawData)
+	if !ok {
+		return nil, errors.New("invalid raw data format")
+	}
+	return []byte(raw), nil
+}
+
+func (r *RawRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *RawRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return RawData(append([]byte(nil), msg[offset:end]...)), nil
+}
+
+// ParseZoneData reads the generic "\# <length> <hex data>" form; the hex
+// data may be split over several fields and is absent for empty RDATA
+func (r *RawRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	return parseGenericRData(fields)
+}
+
+func parseGenericRData(fields []string) (RawData, error) {
+	if len(fields) < 2 || fields[0] != `\#` {
+		return nil, errors.New(`generic RDATA must start with \# and a length`)
+	}
+
+	length, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generic RDATA length %q: %w", fields[1], err)
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid generic RDATA: %w", err)
+	}
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("generic RDATA length %d does not match %d bytes of data", length, len(data))
+	}
+	return RawData(data), nil
+}
+
+// IsDataType reports whether qtype can appear in a zone or answer, as
+// opposed to QTYPE-only and meta types such as OPT, AXFR or ANY
+func IsDataType(qtype uint16) bool {
+	switch {
+	case qtype == 0, qtype == TypeOPT:
+		return false
+	case qtype >= 128 && qtype <= 255:
+		return false
+	default:
+		return true
+	}
+}
+
+// HandlerFor returns the registered handler for qtype, falling back to an
+// opaque RawRecord for data types without one
+func HandlerFor(qtype uint16) (RecordHandler, bool) {
+	if h, ok := handlers[qtype]; ok {
+		return h, true
+	}
+	if IsDataType(qtype) {
+		return NewRawRecord(qtype), true
+	}
+	return nil, false
+}
+
+// FormatZoneData writes the generic RFC 3597 form "\# <len> <hex>"
+func (r *RawRecord) FormatZoneData(data interface{}) (string, error) {
+	raw, ok := data.(RawData)
+	if !ok {
+		return "", errors.New("invalid raw data format")
+	}
+	return formatGenericRData(raw), nil
+}
+
+func formatGenericRData(rdata []byte) string {
+	if len(rdata) == 0 {
+		return `\# 0`
+	}
+	return fmt.Sprintf(`\# %d %s`, len(rdata), strings.ToUpper(hex.EncodeToString(rdata)))
+}
+
+// FormatRData writes data of type rtype in zone-file form, using the
+// generic RFC 3597 form for types without a presentation format
+func FormatRData(rtype uint16, data interface{}) (string, error) {
+	handler, ok := HandlerFor(rtype)
+	if !ok {
+		return "", fmt.Errorf("type %s cannot appear in a zone", TypeName(rtype))
+	}
+	if formatter, ok := handler.(ZoneDataFormatter); ok {
+		return formatter.FormatZoneData(data)
+	}
+	rdata, err := handler.BuildRecordData(data)
+	if err != nil {
+		return "", err
+	}
+	return formatGenericRData(rdata), nil
+}
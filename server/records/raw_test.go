@@ -0,0 +1,129 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+const typeSSHFP = 44
+
+func TestRawRecord_ParseZoneData(t *testing.T) {
+	raw := NewRawRecord(typeSSHFP)
+
+	data, err := raw.ParseZoneData([]string{`\#`, "4", "0A00", "0001"}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(data.(RawData), []byte{0x0a, 0x00, 0x00, 0x01}) {
+		t.Errorf("Unexpected RDATA: %x", data)
+	}
+
+	empty, err := raw.ParseZoneData([]string{`\#`, "0"}, "")
+	if err != nil || len(empty.(RawData)) != 0 {
+		t.Errorf("Expected empty RDATA, got %x (%v)", empty, err)
+	}
+
+	for _, fields := range [][]string{
+		{"4", "0A000001"},
+		{`\#`, "3", "0A000001"},
+		{`\#`, "2", "0G00"},
+		{`\#`},
+	} {
+		if _, err := raw.ParseZoneData(fields, ""); err == nil {
+			t.Errorf("Expected error for fields %v", fields)
+		}
+	}
+}
+
+func TestRawRecord_BuildAnswer(t *testing.T) {
+	raw := NewRawRecord(typeSSHFP)
+	rdata := RawData{1, 1, 0xde, 0xad, 0xbe, 0xef}
+
+	answer, err := raw.BuildAnswer("host.example.com", rdata, 300)
+	if err != nil {
+		t.Fatalf("Failed to build answer: %v", err)
+	}
+	data := answer.Bytes()
+	if !bytes.HasSuffix(data, append([]byte{0, 6}, rdata...)) {
+		t.Errorf("Answer does not end with RDLENGTH and RDATA: %x", data)
+	}
+	if !bytes.Contains(data, []byte{0x00, typeSSHFP, 0x00, 0x01}) {
+		t.Error("Missing SSHFP type/class in answer")
+	}
+
+	if err := raw.ValidateData([]byte{1}); err == nil {
+		t.Error("Expected error for plain []byte data")
+	}
+}
+
+func TestHandlerFor(t *testing.T) {
+	if h, ok := HandlerFor(TypeMX); !ok || h.Type() != TypeMX {
+		t.Error("Expected registered MX handler")
+	}
+
+	h, ok := HandlerFor(typeSSHFP)
+	if !ok {
+		t.Fatal("Expected opaque handler for SSHFP")
+	}
+	if _, isRaw := h.(*RawRecord); !isRaw || h.Type() != typeSSHFP {
+		t.Errorf("Expected RawRecord of type %d, got %T/%d", typeSSHFP, h, h.Type())
+	}
+
+	for _, qtype := range []uint16{0, TypeOPT, 251, 252, 255} {
+		if _, ok := HandlerFor(qtype); ok {
+			t.Errorf("Meta type %d should not have a handler", qtype)
+		}
+	}
+}
+
+func TestUnpackResourceRecord(t *testing.T) {
+	// Owner name at offset 0, second record points back at it
+	msg := []byte{
+		4, 'h', 'o', 's', 't', 0,
+		0x00, typeSSHFP, 0x00, 0x01, 0, 0, 0x0e, 0x10, 0, 2, 0xab, 0xcd,
+		0xC0, 0x00,
+		0x00, 0x01, 0x00, 0x01, 0, 0, 0, 60, 0, 4, 192, 0, 2, 1,
+	}
+
+	rr, next, err := UnpackResourceRecord(msg, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rr.Name != "host" || rr.Type != typeSSHFP || rr.TTL != 3600 || !bytes.Equal(rr.Data.(RawData), []byte{0xab, 0xcd}) {
+		t.Errorf("Unexpected record: %+v", rr)
+	}
+
+	rr, next, err = UnpackResourceRecord(msg, next)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rr.Name != "host" || rr.Type != TypeA || rr.TTL != 60 || next != len(msg) {
+		t.Errorf("Unexpected record: %+v (next %d)", rr, next)
+	}
+
+	if _, _, err := UnpackResourceRecord(msg[:len(msg)-1], 18); err == nil {
+		t.Error("Expected error for truncated RDATA")
+	}
+}
+
+func TestFormatRData(t *testing.T) {
+	tests := []struct {
+		rtype uint16
+		data  interface{}
+		want  string
+	}{
+		{TypeMX, MXData{Preference: 10, Exchange: "mail.example.com"}, "10 mail.example.com."},
+		{TypeTXT, []string{`say "hi"`, "a\nb"}, `"say \"hi\"" "a\010b"`},
+		{TypeNSEC3PARAM, NSEC3PARAMData{HashAlgorithm: 1}, "1 0 0 -"},
+		{TypeRRSIG, RRSIGData{TypeCovered: TypeA, Algorithm: 13, Labels: 2, OriginalTTL: 300, Expiration: 1700000000, Inception: 1690000000, KeyTag: 1, SignerName: "example.com", Signature: []byte{1}},
+			"A 13 2 300 20231114221320 20230722042640 1 example.com. AQ=="},
+		{typeSSHFP, RawData{0x0a, 0x00}, `\# 2 0A00`},
+		{TypeSVCB, SVCBData{Priority: 0, Target: "svc.example.com"}, `\# 19 000003737663076578616D706C6503636F6D00`},
+	}
+	for _, tt := range tests {
+		got, err := FormatRData(tt.rtype, tt.data)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", TypeName(tt.rtype), got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package records
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ResourceRecord is a single decoded record of any section. Data holds
+// the same typed value the type's handler accepts in BuildRecordData.
+type ResourceRecord struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  interface{}
+}
+
+// UnpackResourceRecord decodes the record starting at offset in msg and
+// returns it with the offset of the next record
+func UnpackResourceRecord(msg []byte, offset int) (ResourceRecord, int, error) {
+	var names BaseHandler
+	name, pos, err := names.ReadDomainName(msg, offset)
+	if err != nil {
+		return ResourceRecord{}, 0, fmt.Errorf("invalid owner name: %w", err)
+	}
+	if pos+10 > len(msg) {
+		return ResourceRecord{}, 0, errors.New("truncated resource record header")
+	}
+
+	rr := ResourceRecord{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(msg[pos:]),
+		Class: binary.BigEndian.Uint16(msg[pos+2:]),
+		TTL:   binary.BigEndian.Uint32(msg[pos+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(msg[pos+8:]))
+	pos += 10
+
+	if _, err := rdataBounds(msg, pos, length); err != nil {
+		return ResourceRecord{}, 0, err
+	}
+
+	// UPDATE prerequisites and deletions (RFC 2136) carry no RDATA
+	if length == 0 && (rr.Class == ClassANY || rr.Class == ClassNONE) {
+		return rr, pos, nil
+	}
+
+	// Meta types such as OPT keep their RDATA opaque
+	handler, ok := HandlerFor(rr.Type)
+	if !ok {
+		handler = NewRawRecord(rr.Type)
+	}
+
+	rr.Data, err = handler.ParseRecordData(msg, pos, length)
+	if err != nil {
+		return ResourceRecord{}, 0, fmt.Errorf("invalid RDATA for type %d: %w", rr.Type, err)
+	}
+	return rr, pos + length, nil
+}
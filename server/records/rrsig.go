@@ -0,0 +1,186 @@
+package records
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RRSIGRecord handles DNSSEC signatures (RFC 4034 section 3)
+type RRSIGRecord struct {
+	BaseHandler
+}
+
+func (r *RRSIGRecord) Type() uint16       { return TypeRRSIG }
+func (r *RRSIGRecord) Class() uint16      { return ClassIN }
+func (r *RRSIGRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// RRSIGData holds a signature over one RRset. Expiration and Inception are
+// seconds since the epoch, compared with serial number arithmetic.
+type RRSIGData struct {
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OriginalTTL uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+func (r *RRSIGRecord) ValidateData(data interface{}) error {
+	sig, ok := data.(RRSIGData)
+	if !ok {
+		return errors.New("invalid RRSIG data format")
+	}
+	return validateDomain(sig.SignerName)
+}
+
+func (r *RRSIGRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	sig, ok := data.(RRSIGData)
+	if !ok {
+		return nil, errors.New("invalid RRSIG data format")
+	}
+
+	buf := bytes.NewBuffer(BuildRRSIGHeader(sig))
+	// The signer name is never compressed
+	if err := r.WriteDomainName(buf, sig.SignerName); err != nil {
+		return nil, fmt.Errorf("failed to write RRSIG signer: %w", err)
+	}
+	buf.Write(sig.Signature)
+	return buf.Bytes(), nil
+}
+
+// BuildRRSIGHeader encodes the fixed-size fields preceding the signer name
+func BuildRRSIGHeader(sig RRSIGData) []byte {
+	header := make([]byte, 18)
+	binary.BigEndian.PutUint16(header[0:], sig.TypeCovered)
+	header[2] = sig.Algorithm
+	header[3] = sig.Labels
+	binary.BigEndian.PutUint32(header[4:], sig.OriginalTTL)
+	binary.BigEndian.PutUint32(header[8:], sig.Expiration)
+	binary.BigEndian.PutUint32(header[12:], sig.Inception)
+	binary.BigEndian.PutUint16(header[16:], sig.KeyTag)
+	return header
+}
+
+func (r *RRSIGRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *RRSIGRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 19 {
+		return nil, errors.New("RRSIG RDATA too short")
+	}
+
+	signer, next, err := r.ReadDomainName(msg[:end], offset+18)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG signer: %w", err)
+	}
+
+	return RRSIGData{
+		TypeCovered: binary.BigEndian.Uint16(msg[offset:]),
+		Algorithm:   msg[offset+2],
+		Labels:      msg[offset+3],
+		OriginalTTL: binary.BigEndian.Uint32(msg[offset+4:]),
+		Expiration:  binary.BigEndian.Uint32(msg[offset+8:]),
+		Inception:   binary.BigEndian.Uint32(msg[offset+12:]),
+		KeyTag:      binary.BigEndian.Uint16(msg[offset+16:]),
+		SignerName:  signer,
+		Signature:   append([]byte(nil), msg[next:end]...),
+	}, nil
+}
+
+// ParseZoneData reads "<type covered> <algorithm> <labels> <original TTL>
+// <expiration> <inception> <key tag> <signer> <base64 signature>"
+func (r *RRSIGRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 9 {
+		return nil, fmt.Errorf("RRSIG record expects 9 fields, got %d", len(fields))
+	}
+
+	covered, err := TypeByName(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := parseUint8Field(fields[1], "RRSIG algorithm")
+	if err != nil {
+		return nil, err
+	}
+	labels, err := parseUint8Field(fields[2], "RRSIG labels")
+	if err != nil {
+		return nil, err
+	}
+	originalTTL, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG original TTL %q: %w", fields[3], err)
+	}
+	expiration, err := parseSignatureTime(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	inception, err := parseSignatureTime(fields[5])
+	if err != nil {
+		return nil, err
+	}
+	keyTag, err := parseUint16Field(fields[6], "RRSIG key tag")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(fields[8:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG signature: %w", err)
+	}
+
+	return RRSIGData{
+		TypeCovered: covered,
+		Algorithm:   algorithm,
+		Labels:      labels,
+		OriginalTTL: uint32(originalTTL),
+		Expiration:  expiration,
+		Inception:   inception,
+		KeyTag:      keyTag,
+		SignerName:  qualifyName(fields[7], origin),
+		Signature:   signature,
+	}, nil
+}
+
+// parseSignatureTime accepts YYYYMMDDHHmmSS (UTC) or plain epoch seconds
+func parseSignatureTime(field string) (uint32, error) {
+	if len(field) == 14 {
+		t, err := time.Parse("20060102150405", field)
+		if err != nil {
+			return 0, fmt.Errorf("invalid signature time %q: %w", field, err)
+		}
+		return uint32(t.Unix()), nil
+	}
+	v, err := strconv.ParseUint(field, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid signature time %q: %w", field, err)
+	}
+	return uint32(v), nil
+}
+
+// FormatZoneData writes the signature times as YYYYMMDDHHmmSS
+func (r *RRSIGRecord) FormatZoneData(data interface{}) (string, error) {
+	sig, ok := data.(RRSIGData)
+	if !ok {
+		return "", errors.New("invalid RRSIG data format")
+	}
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s", TypeName(sig.TypeCovered), sig.Algorithm,
+		sig.Labels, sig.OriginalTTL, formatSignatureTime(sig.Expiration), formatSignatureTime(sig.Inception),
+		sig.KeyTag, fqdn(sig.SignerName), base64.StdEncoding.EncodeToString(sig.Signature)), nil
+}
+
+func formatSignatureTime(t uint32) string {
+	return time.Unix(int64(t), 0).UTC().Format("20060102150405")
+}
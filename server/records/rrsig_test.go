@@ -0,0 +1,56 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRRSIGRecord_ParseZoneData(t *testing.T) {
+	rrsig := &RRSIGRecord{}
+	data, err := rrsig.ParseZoneData([]string{
+		"A", "13", "3", "300", "20300101000000", "1700000000", "2371", "example.com.", "c2lnbmF0dXJl",
+	}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sig := data.(RRSIGData)
+	if sig.TypeCovered != TypeA || sig.Labels != 3 || sig.OriginalTTL != 300 || sig.KeyTag != 2371 {
+		t.Errorf("Unexpected RRSIG: %+v", sig)
+	}
+	if sig.Expiration != 1893456000 || sig.Inception != 1700000000 {
+		t.Errorf("Unexpected validity window: %d-%d", sig.Inception, sig.Expiration)
+	}
+	if sig.SignerName != "example.com" || string(sig.Signature) != "signature" {
+		t.Errorf("Unexpected signer/signature: %q %q", sig.SignerName, sig.Signature)
+	}
+
+	if _, err := rrsig.ParseZoneData([]string{"BOGUS", "13", "3", "300", "0", "0", "1", "example.com.", "AA=="}, ""); err == nil {
+		t.Error("Expected error for unknown covered type")
+	}
+}
+
+func TestRRSIGRecord_RoundTrip(t *testing.T) {
+	rrsig := &RRSIGRecord{}
+	want := RRSIGData{
+		TypeCovered: TypeMX, Algorithm: 8, Labels: 2, OriginalTTL: 3600,
+		Expiration: 2000000000, Inception: 1000000000, KeyTag: 4242,
+		SignerName: "example.com", Signature: bytes.Repeat([]byte{1}, 64),
+	}
+
+	got := roundTripRecordData(t, rrsig, want).(RRSIGData)
+	if got.SignerName != want.SignerName || got.KeyTag != want.KeyTag || !bytes.Equal(got.Signature, want.Signature) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTypeByName(t *testing.T) {
+	for name, want := range map[string]uint16{"A": TypeA, "mx": TypeMX, "TYPE44": 44, "RRSIG": TypeRRSIG} {
+		if got, err := TypeByName(name); err != nil || got != want {
+			t.Errorf("TypeByName(%q) = %d, %v; want %d", name, got, err, want)
+		}
+	}
+	if TypeName(44) != "TYPE44" || TypeName(TypeCAA) != "CAA" {
+		t.Errorf("Unexpected type names %q %q", TypeName(44), TypeName(TypeCAA))
+	}
+}
@@ -0,0 +1,136 @@
+package records
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SOARecord handles start of authority records (RFC 1035 section 3.3.13)
+type SOARecord struct {
+	BaseHandler
+}
+
+func (r *SOARecord) Type() uint16       { return TypeSOA }
+func (r *SOARecord) Class() uint16      { return ClassIN }
+func (r *SOARecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// SOAData holds the zone's primary server, contact mailbox and timers
+type SOAData struct {
+	MName   string
+	RName   string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minimum uint32
+}
+
+func (r *SOARecord) ValidateData(data interface{}) error {
+	soa, ok := data.(SOAData)
+	if !ok {
+		return errors.New("invalid SOA data format")
+	}
+	if err := validateDomain(soa.MName); err != nil {
+		return fmt.Errorf("invalid SOA mname: %w", err)
+	}
+	if err := validateDomain(soa.RName); err != nil {
+		return fmt.Errorf("invalid SOA rname: %w", err)
+	}
+	return nil
+}
+
+func (r *SOARecord) BuildRecordData(data interface{}) ([]byte, error) {
+	return r.BuildCompressedRecordData(data, r.Writer)
+}
+
+// BuildCompressedRecordData writes both names, compressed when w is set,
+// followed by the five timers
+func (r *SOARecord) BuildCompressedRecordData(data interface{}, w *DomainNameWriter) ([]byte, error) {
+	soa, ok := data.(SOAData)
+	if !ok {
+		return nil, errors.New("invalid SOA data format")
+	}
+
+	var buf bytes.Buffer
+	if err := w.WriteDomainName(&buf, soa.MName); err != nil {
+		return nil, err
+	}
+	if err := w.WriteDomainName(&buf, soa.RName); err != nil {
+		return nil, err
+	}
+	for _, v := range []uint32{soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minimum} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *SOARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *SOARecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+
+	mname, next, err := r.ReadDomainName(msg, offset)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOA mname: %w", err)
+	}
+	rname, next, err := r.ReadDomainName(msg, next)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SOA rname: %w", err)
+	}
+	if next+20 != end {
+		return nil, errors.New("SOA timers do not fill RDATA")
+	}
+
+	return SOAData{
+		MName:   mname,
+		RName:   rname,
+		Serial:  binary.BigEndian.Uint32(msg[next:]),
+		Refresh: binary.BigEndian.Uint32(msg[next+4:]),
+		Retry:   binary.BigEndian.Uint32(msg[next+8:]),
+		Expire:  binary.BigEndian.Uint32(msg[next+12:]),
+		Minimum: binary.BigEndian.Uint32(msg[next+16:]),
+	}, nil
+}
+
+// ParseZoneData reads "<mname> <rname> <serial> <refresh> <retry> <expire> <minimum>"
+func (r *SOARecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 7 {
+		return nil, fmt.Errorf("SOA record expects 7 fields, got %d", len(fields))
+	}
+
+	var timers [5]uint32
+	for i, field := range fields[2:] {
+		v, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOA timer %q: %w", field, err)
+		}
+		timers[i] = uint32(v)
+	}
+
+	return SOAData{
+		MName:   qualifyName(fields[0], origin),
+		RName:   qualifyName(fields[1], origin),
+		Serial:  timers[0],
+		Refresh: timers[1],
+		Retry:   timers[2],
+		Expire:  timers[3],
+		Minimum: timers[4],
+	}, nil
+}
+
+func (r *SOARecord) FormatZoneData(data interface{}) (string, error) {
+	soa, ok := data.(SOAData)
+	if !ok {
+		return "", errors.New("invalid SOA data format")
+	}
+	return fmt.Sprintf("%s %s %d %d %d %d %d", fqdn(soa.MName), fqdn(soa.RName),
+		soa.Serial, soa.Refresh, soa.Retry, soa.Expire, soa.Minimum), nil
+}
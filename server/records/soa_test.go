@@ -0,0 +1,43 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSOARecord_ParseZoneData(t *testing.T) {
+	soa := &SOARecord{}
+	data, err := soa.ParseZoneData([]string{"ns1", "hostmaster.example.com.", "2024010101", "7200", "3600", "1209600", "300"}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := SOAData{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300}
+	if data != want {
+		t.Errorf("Expected %+v, got %+v", want, data)
+	}
+
+	if _, err := soa.ParseZoneData([]string{"ns1", "hostmaster", "x", "1", "2", "3", "4"}, "example.com."); err == nil {
+		t.Error("Expected error for a non-numeric serial")
+	}
+}
+
+func TestSOARecord_RoundTrip(t *testing.T) {
+	soa := &SOARecord{}
+	want := SOAData{MName: "ns1.example.com", RName: "hostmaster.example.com", Serial: 1, Refresh: 2, Retry: 3, Expire: 4, Minimum: 5}
+	if got := roundTripRecordData(t, soa, want); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSOARecord_CompressesBothNames(t *testing.T) {
+	soa := &SOARecord{}
+	w := &DomainNameWriter{Offsets: map[string]int{"example.com": 12}, Pos: 40}
+	rdata, err := soa.BuildCompressedRecordData(SOAData{MName: "ns1.example.com", RName: "hostmaster.example.com"}, w)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []byte{3, 'n', 's', '1', 0xC0, 12, 10, 'h', 'o', 's', 't', 'm', 'a', 's', 't', 'e', 'r', 0xC0, 12}
+	if !bytes.HasPrefix(rdata, want) || len(rdata) != len(want)+20 {
+		t.Errorf("Unexpected RDATA %x", rdata)
+	}
+}
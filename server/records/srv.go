@@ -0,0 +1,129 @@
+package records
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// SRVRecord handles service location records (RFC 2782)
+type SRVRecord struct {
+	BaseHandler
+}
+
+func (r *SRVRecord) Type() uint16       { return TypeSRV }
+func (r *SRVRecord) Class() uint16      { return ClassIN }
+func (r *SRVRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// SRVData holds the RDATA of a single SRV record. A Target of "."
+// means the service is decidedly not available at this domain.
+type SRVData struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (r *SRVRecord) ValidateData(data interface{}) error {
+	srv, ok := data.(SRVData)
+	if !ok {
+		return errors.New("invalid SRV data format")
+	}
+	return validateDomain(srv.Target)
+}
+
+func (r *SRVRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	srv, ok := data.(SRVData)
+	if !ok {
+		return nil, errors.New("invalid SRV data format")
+	}
+
+	var buf bytes.Buffer
+	// Write priority, weight and port (2 bytes each)
+	for _, v := range []uint16{srv.Priority, srv.Weight, srv.Port} {
+		if err := binary.Write(&buf, binary.BigEndian, v); err != nil {
+			return nil, err
+		}
+	}
+
+	// Write target domain
+	if err := r.WriteDomainName(&buf, srv.Target); err != nil {
+		return nil, fmt.Errorf("failed to write SRV target: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (r *SRVRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *SRVRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 7 {
+		return nil, errors.New("SRV RDATA too short")
+	}
+
+	target, next, err := r.ReadDomainName(msg, offset+6)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRV target: %w", err)
+	}
+	if next != end {
+		return nil, errors.New("SRV target does not fill RDATA")
+	}
+	return SRVData{
+		Priority: binary.BigEndian.Uint16(msg[offset:]),
+		Weight:   binary.BigEndian.Uint16(msg[offset+2:]),
+		Port:     binary.BigEndian.Uint16(msg[offset+4:]),
+		Target:   target,
+	}, nil
+}
+
+// ParseZoneData reads "<priority> <weight> <port> <target>"
+func (r *SRVRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("SRV record expects 4 fields, got %d", len(fields))
+	}
+
+	priority, err := parseUint16Field(fields[0], "SRV priority")
+	if err != nil {
+		return nil, err
+	}
+	weight, err := parseUint16Field(fields[1], "SRV weight")
+	if err != nil {
+		return nil, err
+	}
+	port, err := parseUint16Field(fields[2], "SRV port")
+	if err != nil {
+		return nil, err
+	}
+
+	return SRVData{
+		Priority: priority,
+		Weight:   weight,
+		Port:     port,
+		Target:   qualifyName(fields[3], origin),
+	}, nil
+}
+
+// AdditionalNames returns the target host so its A/AAAA records can be
+// added to the additional section
+func (r *SRVRecord) AdditionalNames(data interface{}) []string {
+	srv, ok := data.(SRVData)
+	if !ok || srv.Target == "." {
+		return nil
+	}
+	return []string{srv.Target}
+}
+
+func (r *SRVRecord) FormatZoneData(data interface{}) (string, error) {
+	srv, ok := data.(SRVData)
+	if !ok {
+		return "", errors.New("invalid SRV data format")
+	}
+	return fmt.Sprintf("%d %d %d %s", srv.Priority, srv.Weight, srv.Port, fqdn(srv.Target)), nil
+}
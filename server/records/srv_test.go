@@ -0,0 +1,118 @@
+package records
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSRVRecord_BuildRecordData(t *testing.T) {
+	srv := &SRVRecord{}
+	expected := []byte{
+		0, 10, // priority
+		0, 60, // weight
+		0x1f, 0x90, // port 8080
+		3, 's', 'v', 'c',
+		8, 'i', 'n', 't', 'e', 'r', 'n', 'a', 'l',
+		0,
+	}
+
+	data, err := srv.BuildRecordData(SRVData{Priority: 10, Weight: 60, Port: 8080, Target: "svc.internal"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !bytes.Equal(data, expected) {
+		t.Errorf("Expected:\n%x\nGot:\n%x", expected, data)
+	}
+}
+
+func TestSRVRecord_RootTarget(t *testing.T) {
+	srv := &SRVRecord{}
+	data, err := srv.BuildRecordData(SRVData{Target: "."})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(data, []byte{0, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("Unexpected root target encoding: %x", data)
+	}
+	if names := srv.AdditionalNames(SRVData{Target: "."}); len(names) != 0 {
+		t.Errorf("Root target should not need additional records, got %v", names)
+	}
+}
+
+func TestSRVRecord_Comprehensive(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    interface{}
+		wantErr bool
+	}{
+		{"valid", SRVData{Priority: 0, Weight: 5, Port: 443, Target: "grpc1.svc.internal"}, false},
+		{"invalid_target", SRVData{Port: 443, Target: "invalid..domain"}, true},
+		{"empty_target", SRVData{Port: 443, Target: ""}, true},
+		{"wrong_type", "grpc1.svc.internal", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &SRVRecord{}
+			answer, err := srv.BuildAnswer("_grpc._tcp.svc.internal", tt.data, 300)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("BuildAnswer() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !bytes.Contains(answer.Bytes(), []byte{0x00, 0x21, 0x00, 0x01}) {
+				t.Error("Missing SRV type/class in answer")
+			}
+		})
+	}
+}
+
+func TestSRVRecord_ParseZoneData(t *testing.T) {
+	srv := &SRVRecord{}
+
+	data, err := srv.ParseZoneData([]string{"10", "60", "5060", "sip"}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := SRVData{Priority: 10, Weight: 60, Port: 5060, Target: "sip.example.com"}
+	if data != want {
+		t.Errorf("Expected %+v, got %+v", want, data)
+	}
+
+	data, err = srv.ParseZoneData([]string{"0", "0", "443", "grpc.svc.internal."}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data.(SRVData).Target != "grpc.svc.internal" {
+		t.Errorf("Absolute target was qualified: %q", data.(SRVData).Target)
+	}
+
+	for _, fields := range [][]string{
+		{"10", "60", "sip"},
+		{"10", "60", "70000", "sip"},
+		{"x", "60", "5060", "sip"},
+	} {
+		if _, err := srv.ParseZoneData(fields, "example.com."); err == nil {
+			t.Errorf("Expected error for fields %v", fields)
+		}
+	}
+}
+
+func TestSRVHandler_Registration(t *testing.T) {
+	handler, ok := GetHandler(TypeSRV)
+	if !ok {
+		t.Fatal("SRV handler not registered")
+	}
+
+	if handler.Type() != TypeSRV {
+		t.Errorf("Wrong type: got %d, want %d", handler.Type(), TypeSRV)
+	}
+}
+
+func TestSRVRecord_ParseRecordData(t *testing.T) {
+	srv := &SRVRecord{}
+	want := SRVData{Priority: 1, Weight: 2, Port: 443, Target: "grpc.svc.internal"}
+	if got := roundTripRecordData(t, srv, want); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
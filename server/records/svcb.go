@@ -0,0 +1,388 @@
+package records
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SVCBRecord handles service binding records (RFC 9460)
+type SVCBRecord struct {
+	BaseHandler
+}
+
+func (r *SVCBRecord) Type() uint16       { return TypeSVCB }
+func (r *SVCBRecord) Class() uint16      { return ClassIN }
+func (r *SVCBRecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// HTTPSRecord is the HTTPS-specific variant of SVCB; it shares the same RDATA
+type HTTPSRecord struct {
+	SVCBRecord
+}
+
+func (r *HTTPSRecord) Type() uint16 { return TypeHTTPS }
+
+func (r *HTTPSRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+// SvcParamKeys registered in RFC 9460 and its companions
+const (
+	SVCParamMandatory     uint16 = 0
+	SVCParamALPN          uint16 = 1
+	SVCParamNoDefaultALPN uint16 = 2
+	SVCParamPort          uint16 = 3
+	SVCParamIPv4Hint      uint16 = 4
+	SVCParamECH           uint16 = 5
+	SVCParamIPv6Hint      uint16 = 6
+	SVCParamDoHPath       uint16 = 7
+	SVCParamOHTTP         uint16 = 8
+)
+
+var svcParamNames = map[uint16]string{
+	SVCParamMandatory:     "mandatory",
+	SVCParamALPN:          "alpn",
+	SVCParamNoDefaultALPN: "no-default-alpn",
+	SVCParamPort:          "port",
+	SVCParamIPv4Hint:      "ipv4hint",
+	SVCParamECH:           "ech",
+	SVCParamIPv6Hint:      "ipv6hint",
+	SVCParamDoHPath:       "dohpath",
+	SVCParamOHTTP:         "ohttp",
+}
+
+// SVCParam is a single SvcParam with its value in wire format
+type SVCParam struct {
+	Key   uint16
+	Value []byte
+}
+
+// SVCBData holds the RDATA of SVCB and HTTPS records. Priority 0 is
+// AliasMode; a Target of "." refers to the owner name.
+type SVCBData struct {
+	Priority uint16
+	Target   string
+	Params   []SVCParam
+}
+
+// Param returns the wire value of the given key
+func (d SVCBData) Param(key uint16) ([]byte, bool) {
+	for _, p := range d.Params {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (r *SVCBRecord) ValidateData(data interface{}) error {
+	svcb, ok := data.(SVCBData)
+	if !ok {
+		return errors.New("invalid SVCB data format")
+	}
+	if err := validateDomain(svcb.Target); err != nil {
+		return err
+	}
+	return validateSVCParams(svcb.Params)
+}
+
+func validateSVCParams(params []SVCParam) error {
+	present := make(map[uint16]bool, len(params))
+	for _, p := range params {
+		if present[p.Key] {
+			return fmt.Errorf("duplicate SvcParamKey %s", svcParamKeyName(p.Key))
+		}
+		present[p.Key] = true
+		if err := validateSVCParamValue(p); err != nil {
+			return err
+		}
+	}
+
+	if present[SVCParamNoDefaultALPN] && !present[SVCParamALPN] {
+		return errors.New("no-default-alpn requires alpn")
+	}
+
+	for _, p := range params {
+		if p.Key != SVCParamMandatory {
+			continue
+		}
+		for i := 0; i < len(p.Value); i += 2 {
+			key := binary.BigEndian.Uint16(p.Value[i:])
+			if !present[key] {
+				return fmt.Errorf("mandatory key %s is missing", svcParamKeyName(key))
+			}
+		}
+	}
+	return nil
+}
+
+func validateSVCParamValue(p SVCParam) error {
+	name := svcParamKeyName(p.Key)
+	switch p.Key {
+	case SVCParamMandatory:
+		if len(p.Value) == 0 || len(p.Value)%2 != 0 {
+			return fmt.Errorf("malformed %s value", name)
+		}
+		for i := 0; i < len(p.Value); i += 2 {
+			if binary.BigEndian.Uint16(p.Value[i:]) == SVCParamMandatory {
+				return errors.New("mandatory must not list itself")
+			}
+		}
+	case SVCParamALPN:
+		if len(p.Value) == 0 {
+			return fmt.Errorf("empty %s value", name)
+		}
+		for i := 0; i < len(p.Value); {
+			n := int(p.Value[i])
+			if n == 0 || i+1+n > len(p.Value) {
+				return fmt.Errorf("malformed %s value", name)
+			}
+			i += 1 + n
+		}
+	case SVCParamNoDefaultALPN, SVCParamOHTTP:
+		if len(p.Value) != 0 {
+			return fmt.Errorf("%s takes no value", name)
+		}
+	case SVCParamPort:
+		if len(p.Value) != 2 {
+			return fmt.Errorf("malformed %s value", name)
+		}
+	case SVCParamIPv4Hint:
+		if len(p.Value) == 0 || len(p.Value)%net.IPv4len != 0 {
+			return fmt.Errorf("malformed %s value", name)
+		}
+	case SVCParamIPv6Hint:
+		if len(p.Value) == 0 || len(p.Value)%net.IPv6len != 0 {
+			return fmt.Errorf("malformed %s value", name)
+		}
+	}
+	return nil
+}
+
+func (r *SVCBRecord) BuildRecordData(data interface{}) ([]byte, error) {
+	svcb, ok := data.(SVCBData)
+	if !ok {
+		return nil, errors.New("invalid SVCB data format")
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, svcb.Priority); err != nil {
+		return nil, err
+	}
+	// TargetName is never compressed
+	if err := r.WriteDomainName(&buf, svcb.Target); err != nil {
+		return nil, fmt.Errorf("failed to write SVCB target: %w", err)
+	}
+
+	// SvcParams must appear in strictly increasing key order
+	params := append([]SVCParam(nil), svcb.Params...)
+	sort.Slice(params, func(i, j int) bool { return params[i].Key < params[j].Key })
+	for _, p := range params {
+		if len(p.Value) > 0xFFFF {
+			return nil, fmt.Errorf("%s value too long", svcParamKeyName(p.Key))
+		}
+		binary.Write(&buf, binary.BigEndian, p.Key)
+		binary.Write(&buf, binary.BigEndian, uint16(len(p.Value)))
+		buf.Write(p.Value)
+	}
+	return buf.Bytes(), nil
+}
+
+func (r *SVCBRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *SVCBRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 3 {
+		return nil, errors.New("SVCB RDATA too short")
+	}
+
+	svcb := SVCBData{Priority: binary.BigEndian.Uint16(msg[offset:])}
+	target, pos, err := r.ReadDomainName(msg[:end], offset+2)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SVCB target: %w", err)
+	}
+	svcb.Target = target
+
+	lastKey := -1
+	for pos < end {
+		if pos+4 > end {
+			return nil, errors.New("truncated SvcParam")
+		}
+		key := binary.BigEndian.Uint16(msg[pos:])
+		valueLen := int(binary.BigEndian.Uint16(msg[pos+2:]))
+		pos += 4
+		if int(key) <= lastKey {
+			return nil, errors.New("SvcParamKeys out of order")
+		}
+		if pos+valueLen > end {
+			return nil, fmt.Errorf("%s value exceeds RDATA", svcParamKeyName(key))
+		}
+		lastKey = int(key)
+		svcb.Params = append(svcb.Params, SVCParam{
+			Key:   key,
+			Value: append([]byte(nil), msg[pos:pos+valueLen]...),
+		})
+		pos += valueLen
+	}
+
+	if err := validateSVCParams(svcb.Params); err != nil {
+		return nil, err
+	}
+	return svcb, nil
+}
+
+// ParseZoneData reads "<priority> <target> [key=value ...]", e.g.
+// 1 . alpn=h2,h3 port=443 ipv4hint=192.0.2.1
+func (r *SVCBRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("SVCB record expects at least 2 fields, got %d", len(fields))
+	}
+
+	priority, err := parseUint16Field(fields[0], "SVCB priority")
+	if err != nil {
+		return nil, err
+	}
+
+	svcb := SVCBData{Priority: priority, Target: qualifyName(fields[1], origin)}
+
+	for _, field := range fields[2:] {
+		name, text, _ := strings.Cut(field, "=")
+		key, err := parseSVCParamKey(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := parseSVCParamValue(key, text)
+		if err != nil {
+			return nil, err
+		}
+		svcb.Params = append(svcb.Params, SVCParam{Key: key, Value: value})
+	}
+
+	if err := validateSVCParams(svcb.Params); err != nil {
+		return nil, err
+	}
+	return svcb, nil
+}
+
+// AdditionalNames returns the target host so its addresses can be added
+// to the additional section
+func (r *SVCBRecord) AdditionalNames(data interface{}) []string {
+	svcb, ok := data.(SVCBData)
+	if !ok || svcb.Target == "." {
+		return nil
+	}
+	return []string{svcb.Target}
+}
+
+func svcParamKeyName(key uint16) string {
+	if name, ok := svcParamNames[key]; ok {
+		return name
+	}
+	return "key" + strconv.Itoa(int(key))
+}
+
+func parseSVCParamKey(name string) (uint16, error) {
+	for key, known := range svcParamNames {
+		if known == name {
+			return key, nil
+		}
+	}
+	if strings.HasPrefix(name, "key") {
+		if v, err := strconv.ParseUint(name[3:], 10, 16); err == nil {
+			return uint16(v), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown SvcParamKey %q", name)
+}
+
+// parseSVCParamValue converts the presentation value of a key to wire format
+func parseSVCParamValue(key uint16, text string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch key {
+	case SVCParamMandatory:
+		var keys []uint16
+		for _, name := range strings.Split(text, ",") {
+			k, err := parseSVCParamKey(name)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+		for _, k := range keys {
+			binary.Write(&buf, binary.BigEndian, k)
+		}
+	case SVCParamALPN:
+		for _, id := range splitALPN(text) {
+			if len(id) == 0 || len(id) > 255 {
+				return nil, fmt.Errorf("invalid alpn id %q", id)
+			}
+			buf.WriteByte(byte(len(id)))
+			buf.WriteString(id)
+		}
+	case SVCParamNoDefaultALPN, SVCParamOHTTP:
+		if text != "" {
+			return nil, fmt.Errorf("%s takes no value", svcParamKeyName(key))
+		}
+	case SVCParamPort:
+		port, err := parseUint16Field(text, "port")
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, port)
+	case SVCParamIPv4Hint, SVCParamIPv6Hint:
+		for _, addr := range strings.Split(text, ",") {
+			ip := net.ParseIP(addr)
+			if key == SVCParamIPv4Hint && (ip == nil || ip.To4() == nil) {
+				return nil, fmt.Errorf("invalid ipv4hint address %q", addr)
+			}
+			if key == SVCParamIPv6Hint && (ip == nil || ip.To4() != nil) {
+				return nil, fmt.Errorf("invalid ipv6hint address %q", addr)
+			}
+			if key == SVCParamIPv4Hint {
+				buf.Write(ip.To4())
+			} else {
+				buf.Write(ip.To16())
+			}
+		}
+	case SVCParamECH:
+		ech, err := base64.StdEncoding.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ech value: %w", err)
+		}
+		buf.Write(ech)
+	default:
+		buf.WriteString(text)
+	}
+	return buf.Bytes(), nil
+}
+
+// splitALPN splits a comma-separated alpn list, honouring "\," escapes
+func splitALPN(text string) []string {
+	var ids []string
+	var cur strings.Builder
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text):
+			i++
+			cur.WriteByte(text[i])
+		case text[i] == ',':
+			ids = append(ids, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(text[i])
+		}
+	}
+	return append(ids, cur.String())
+}
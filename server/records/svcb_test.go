@@ -0,0 +1,124 @@
+package records
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestSVCBRecord_ParseZoneData(t *testing.T) {
+	svcb := &SVCBRecord{}
+	data, err := svcb.ParseZoneData([]string{
+		"1", ".", "alpn=h2,h3", "port=8443", "ipv4hint=192.0.2.1,192.0.2.2", "ech=AEX+DQ==", "mandatory=port,alpn",
+	}, "example.com.")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got := data.(SVCBData)
+	if got.Priority != 1 || got.Target != "." {
+		t.Errorf("Unexpected priority/target: %+v", got)
+	}
+
+	checks := map[uint16][]byte{
+		SVCParamALPN:      {2, 'h', '2', 2, 'h', '3'},
+		SVCParamPort:      {0x20, 0xfb},
+		SVCParamIPv4Hint:  {192, 0, 2, 1, 192, 0, 2, 2},
+		SVCParamECH:       {0x00, 0x45, 0xfe, 0x0d},
+		SVCParamMandatory: {0, 1, 0, 3},
+	}
+	for key, want := range checks {
+		value, ok := got.Param(key)
+		if !ok || !bytes.Equal(value, want) {
+			t.Errorf("%s: expected %x, got %x", svcParamKeyName(key), want, value)
+		}
+	}
+}
+
+func TestSVCBRecord_ParseZoneDataErrors(t *testing.T) {
+	svcb := &SVCBRecord{}
+	for _, fields := range [][]string{
+		{"1"},
+		{"1", ".", "port=http"},
+		{"1", ".", "ipv4hint=2001:db8::1"},
+		{"1", ".", "ipv6hint=192.0.2.1"},
+		{"1", ".", "no-default-alpn"},
+		{"1", ".", "mandatory=alpn"},
+		{"1", ".", "bogus=1"},
+		{"1", ".", "port=1", "port=2"},
+	} {
+		if _, err := svcb.ParseZoneData(fields, "example.com."); err == nil {
+			t.Errorf("Expected error for fields %v", fields)
+		}
+	}
+}
+
+func TestSVCBRecord_RoundTrip(t *testing.T) {
+	svcb := &SVCBRecord{}
+	want := SVCBData{
+		Priority: 16,
+		Target:   "svc.example.net",
+		Params: []SVCParam{
+			{Key: SVCParamPort, Value: []byte{0x01, 0xbb}},
+			{Key: SVCParamALPN, Value: []byte{2, 'h', '3'}},
+			{Key: SVCParamIPv6Hint, Value: make([]byte, 16)},
+			{Key: 667, Value: []byte("hello")},
+		},
+	}
+
+	rdata, err := svcb.BuildRecordData(want)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, err := svcb.ParseRecordData(rdata, 0, len(rdata))
+	if err != nil {
+		t.Fatalf("ParseRecordData failed: %v", err)
+	}
+	parsed := got.(SVCBData)
+	if parsed.Priority != want.Priority || parsed.Target != want.Target || len(parsed.Params) != len(want.Params) {
+		t.Fatalf("Unexpected round trip: %+v", parsed)
+	}
+
+	// Parameters come back in increasing key order
+	for i := 1; i < len(parsed.Params); i++ {
+		if parsed.Params[i-1].Key >= parsed.Params[i].Key {
+			t.Errorf("Params out of order: %+v", parsed.Params)
+		}
+	}
+	if value, _ := parsed.Param(667); string(value) != "hello" {
+		t.Errorf("Unexpected key667 value: %q", value)
+	}
+}
+
+func TestSVCBRecord_RejectsUnorderedKeys(t *testing.T) {
+	svcb := &SVCBRecord{}
+	var rdata bytes.Buffer
+	binary.Write(&rdata, binary.BigEndian, uint16(1))
+	rdata.WriteByte(0)
+	for _, key := range []uint16{SVCParamPort, SVCParamALPN} {
+		binary.Write(&rdata, binary.BigEndian, key)
+		binary.Write(&rdata, binary.BigEndian, uint16(2))
+		rdata.Write([]byte{1, 'x'})
+	}
+
+	if _, err := svcb.ParseRecordData(rdata.Bytes(), 0, rdata.Len()); err == nil {
+		t.Error("Expected error for out of order SvcParamKeys")
+	}
+}
+
+func TestHTTPSRecord_Type(t *testing.T) {
+	https := &HTTPSRecord{}
+	answer, err := https.BuildAnswer("example.com", SVCBData{Priority: 0, Target: "cdn.example.net"}, 300)
+	if err != nil {
+		t.Fatalf("Failed to build answer: %v", err)
+	}
+	if !bytes.Contains(answer.Bytes(), []byte{0x00, 0x41, 0x00, 0x01}) {
+		t.Error("Missing HTTPS type/class in answer")
+	}
+
+	handler, ok := GetHandler(TypeHTTPS)
+	if !ok || handler.Type() != TypeHTTPS {
+		t.Fatal("HTTPS handler not registered")
+	}
+}
@@ -0,0 +1,125 @@
+package records
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TLSARecord handles DANE TLS association records (RFC 6698)
+type TLSARecord struct {
+	BaseHandler
+}
+
+func (r *TLSARecord) Type() uint16       { return TypeTLSA }
+func (r *TLSARecord) Class() uint16      { return ClassIN }
+func (r *TLSARecord) DefaultTTL() uint32 { return DefaultTTL }
+
+// TLSAData holds the certificate usage, selector, matching type and the
+// certificate association data (a full certificate/key or its digest)
+type TLSAData struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Data         []byte
+}
+
+func (r *TLSARecord) ValidateData(data interface{}) error {
+	tlsa, ok := data.(TLSAData)
+	if !ok {
+		return errors.New("invalid TLSA data format")
+	}
+	return validateTLSADigest(tlsa)
+}
+
+// validateTLSADigest checks the data length for the SHA-256 and SHA-512 matching types
+func validateTLSADigest(tlsa TLSAData) error {
+	want := map[uint8]int{1: 32, 2: 64}[tlsa.MatchingType]
+	if want != 0 && len(tlsa.Data) != want {
+		return fmt.Errorf("TLSA matching type %d expects %d bytes of data, got %d",
+			tlsa.MatchingType, want, len(tlsa.Data))
+	}
+	if len(tlsa.Data) == 0 {
+		return errors.New("empty TLSA association data")
+	}
+	return nil
+}
+
+func (r *TLSARecord) BuildRecordData(data interface{}) ([]byte, error) {
+	tlsa, ok := data.(TLSAData)
+	if !ok {
+		return nil, errors.New("invalid TLSA data format")
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte{tlsa.Usage, tlsa.Selector, tlsa.MatchingType})
+	buf.Write(tlsa.Data)
+	return buf.Bytes(), nil
+}
+
+func (r *TLSARecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
+	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
+}
+
+func (r *TLSARecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length < 4 {
+		return nil, errors.New("TLSA RDATA too short")
+	}
+
+	tlsa := TLSAData{
+		Usage:        msg[offset],
+		Selector:     msg[offset+1],
+		MatchingType: msg[offset+2],
+		Data:         append([]byte(nil), msg[offset+3:end]...),
+	}
+	if err := validateTLSADigest(tlsa); err != nil {
+		return nil, err
+	}
+	return tlsa, nil
+}
+
+// ParseZoneData reads "<usage> <selector> <matching type> <hex data>";
+// the hex data may be split over several fields
+func (r *TLSARecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) < 4 {
+		return nil, fmt.Errorf("TLSA record expects 4 fields, got %d", len(fields))
+	}
+
+	usage, err := parseUint8Field(fields[0], "TLSA usage")
+	if err != nil {
+		return nil, err
+	}
+	selector, err := parseUint8Field(fields[1], "TLSA selector")
+	if err != nil {
+		return nil, err
+	}
+	matching, err := parseUint8Field(fields[2], "TLSA matching type")
+	if err != nil {
+		return nil, err
+	}
+	assoc, err := hex.DecodeString(strings.Join(fields[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLSA association data: %w", err)
+	}
+
+	tlsa := TLSAData{Usage: usage, Selector: selector, MatchingType: matching, Data: assoc}
+	if err := validateTLSADigest(tlsa); err != nil {
+		return nil, err
+	}
+	return tlsa, nil
+}
+
+func (r *TLSARecord) FormatZoneData(data interface{}) (string, error) {
+	tlsa, ok := data.(TLSAData)
+	if !ok {
+		return "", errors.New("invalid TLSA data format")
+	}
+	return fmt.Sprintf("%d %d %d %s", tlsa.Usage, tlsa.Selector, tlsa.MatchingType,
+		strings.ToUpper(hex.EncodeToString(tlsa.Data))), nil
+}
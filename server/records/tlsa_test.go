@@ -0,0 +1,73 @@
+package records
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const tlsaDigest = "0c72ac70b745ac19998811b131d662c9ac69dbdbe7cb23e5b514b56664c5d3d6"
+
+func TestTLSARecord_ParseZoneData(t *testing.T) {
+	tlsa := &TLSARecord{}
+
+	// The association data may be split across several fields
+	data, err := tlsa.ParseZoneData([]string{"3", "1", "1", tlsaDigest[:32], tlsaDigest[32:]}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := data.(TLSAData)
+	if got.Usage != 3 || got.Selector != 1 || got.MatchingType != 1 || len(got.Data) != 32 {
+		t.Errorf("Unexpected TLSA data: %+v", got)
+	}
+
+	for _, fields := range [][]string{
+		{"3", "1", "1"},
+		{"3", "1", "1", "zz"},
+		{"3", "1", "1", tlsaDigest[:10]},
+		{"3", "1", "2", tlsaDigest},
+	} {
+		if _, err := tlsa.ParseZoneData(fields, ""); err == nil {
+			t.Errorf("Expected error for fields %v", fields)
+		}
+	}
+}
+
+func TestTLSARecord_RoundTrip(t *testing.T) {
+	tlsa := &TLSARecord{}
+	parsed, err := tlsa.ParseZoneData([]string{"3", "1", "1", strings.ToUpper(tlsaDigest)}, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	rdata, err := tlsa.BuildRecordData(parsed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.Equal(rdata[:3], []byte{3, 1, 1}) || len(rdata) != 35 {
+		t.Fatalf("Unexpected RDATA: %x", rdata)
+	}
+
+	got, err := tlsa.ParseRecordData(rdata, 0, len(rdata))
+	if err != nil {
+		t.Fatalf("ParseRecordData failed: %v", err)
+	}
+	if !bytes.Equal(got.(TLSAData).Data, parsed.(TLSAData).Data) {
+		t.Errorf("Association data mismatch: %x", got.(TLSAData).Data)
+	}
+}
+
+func TestTLSARecord_BuildAnswer(t *testing.T) {
+	tlsa := &TLSARecord{}
+	answer, err := tlsa.BuildAnswer("_443._tcp.example.com", TLSAData{Usage: 3, MatchingType: 0, Data: []byte{1, 2, 3}}, 300)
+	if err != nil {
+		t.Fatalf("Failed to build answer: %v", err)
+	}
+	if !bytes.Contains(answer.Bytes(), []byte{0x00, 0x34, 0x00, 0x01}) {
+		t.Error("Missing TLSA type/class in answer")
+	}
+
+	if _, err := tlsa.BuildAnswer("_443._tcp.example.com", TLSAData{Usage: 3}, 300); err == nil {
+		t.Error("Expected error for empty association data")
+	}
+}
@@ -3,6 +3,8 @@ package records
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 type TXTRecord struct {
@@ -67,3 +69,78 @@ func (r *TXTRecord) BuildRecordData(data interface{}) ([]byte, error) {
 func (r *TXTRecord) BuildAnswer(domain string, data interface{}, ttl uint32) (*bytes.Buffer, error) {
 	return r.BaseHandler.BuildAnswer(r, domain, data, ttl)
 }
+
+// ParseRecordData always returns []string, one entry per character-string
+func (r *TXTRecord) ParseRecordData(msg []byte, offset, length int) (interface{}, error) {
+	end, err := rdataBounds(msg, offset, length)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return nil, errors.New("empty TXT RDATA")
+	}
+
+	texts := []string{}
+	for pos := offset; pos < end; {
+		n := int(msg[pos])
+		if pos+1+n > end {
+			return nil, errors.New("TXT string exceeds RDATA")
+		}
+		texts = append(texts, string(msg[pos+1:pos+1+n]))
+		pos += 1 + n
+	}
+	return texts, nil
+}
+
+// ParseZoneData takes one character-string per field, with quotes and
+// escapes already removed by the zone file lexer
+func (r *TXTRecord) ParseZoneData(fields []string, origin string) (interface{}, error) {
+	if len(fields) == 0 {
+		return nil, errors.New("TXT record expects at least one string")
+	}
+	texts := append([]string(nil), fields...)
+	if err := r.ValidateData(texts); err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// FormatZoneData writes each string quoted, escaping quotes, backslashes
+// and non-printable bytes
+func (r *TXTRecord) FormatZoneData(data interface{}) (string, error) {
+	var texts []string
+	switch v := data.(type) {
+	case string:
+		texts = []string{v}
+	case []string:
+		texts = v
+	default:
+		return "", errors.New("invalid data type for TXT record")
+	}
+
+	quoted := make([]string, len(texts))
+	for i, text := range texts {
+		quoted[i] = quoteText(text)
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// quoteText writes a character-string in quoted zone-file form
+func quoteText(text string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c > 0x7E:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -98,3 +98,16 @@ func TestTXTHandler_Registration(t *testing.T) {
 		t.Errorf("Wrong type: got %d, want %d", handler.Type(), TypeTXT)
 	}
 }
+
+func TestTXTRecord_ParseRecordData(t *testing.T) {
+	txt := &TXTRecord{}
+	want := []string{"v=spf1 -all", "", strings.Repeat("b", 255)}
+	got := roundTripRecordData(t, txt, want).([]string)
+	if strings.Join(got, "|") != strings.Join(want, "|") || len(got) != len(want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if _, err := txt.ParseRecordData([]byte{5, 'a'}, 0, 2); err == nil {
+		t.Error("Expected error for string exceeding RDATA")
+	}
+}
@@ -0,0 +1,60 @@
+package records
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// typeNames maps record types to their zone-file mnemonics
+var typeNames = map[uint16]string{
+	TypeA:          "A",
+	TypeNS:         "NS",
+	TypeSOA:        "SOA",
+	TypeCNAME:      "CNAME",
+	TypeMX:         "MX",
+	TypeTXT:        "TXT",
+	TypeAAAA:       "AAAA",
+	TypeSRV:        "SRV",
+	TypeOPT:        "OPT",
+	TypeDS:         "DS",
+	TypeRRSIG:      "RRSIG",
+	TypeDNSKEY:     "DNSKEY",
+	TypeNSEC:       "NSEC",
+	TypeNSEC3:      "NSEC3",
+	TypeNSEC3PARAM: "NSEC3PARAM",
+	TypeCDS:        "CDS",
+	TypeCDNSKEY:    "CDNSKEY",
+	TypeTLSA:       "TLSA",
+	TypeSVCB:       "SVCB",
+	TypeHTTPS:      "HTTPS",
+	TypeCAA:        "CAA",
+	TypeTSIG:       "TSIG",
+	TypeIXFR:       "IXFR",
+	TypeAXFR:       "AXFR",
+	TypeANY:        "ANY",
+}
+
+// TypeName returns the mnemonic of rrtype, or the RFC 3597 "TYPEnnn" form
+func TypeName(rrtype uint16) string {
+	if name, ok := typeNames[rrtype]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(rrtype))
+}
+
+// TypeByName parses a mnemonic or "TYPEnnn" (case-insensitive)
+func TypeByName(name string) (uint16, error) {
+	upper := strings.ToUpper(name)
+	for rrtype, known := range typeNames {
+		if known == upper {
+			return rrtype, nil
+		}
+	}
+	if strings.HasPrefix(upper, "TYPE") {
+		if v, err := strconv.ParseUint(upper[4:], 10, 16); err == nil {
+			return uint16(v), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown record type %q", name)
+}
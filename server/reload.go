@@ -0,0 +1,232 @@
+// server/reload.go
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+// ZoneFile is a zone served from a master file
+type ZoneFile struct {
+	Origin string
+	Path   string
+	Signer *zone.Signer
+}
+
+// FileZones keeps the zones of a ZoneStore in sync with their files. Each
+// Load reads every file and swaps in the zones whose content changed, so
+// zones that did not change keep the updates applied to them since.
+type FileZones struct {
+	store *ZoneStore
+
+	mu     sync.Mutex
+	files  []ZoneFile
+	loaded map[string]*zone.Zone // as last read from the files
+}
+
+// NewFileZones serves files from store once Load succeeds
+func NewFileZones(store *ZoneStore, files []ZoneFile) *FileZones {
+	return &FileZones{store: store, files: files, loaded: make(map[string]*zone.Zone)}
+}
+
+// Paths returns the zone files, for watching them
+func (f *FileZones) Paths() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	paths := make([]string, len(f.files))
+	for i, file := range f.files {
+		paths[i] = file.Path
+	}
+	return paths
+}
+
+// Origins returns the origins of the zone files, the zones that are
+// served once Load succeeds
+func (f *FileZones) Origins() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	origins := make([]string, len(f.files))
+	for i, file := range f.files {
+		origins[i] = file.Origin
+	}
+	return origins
+}
+
+// Load reads and validates every zone file and serves the changed zones.
+// When any file fails, nothing is swapped in and the error names it.
+func (f *FileZones) Load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.load(f.files)
+}
+
+// LoadFiles replaces the set of zone files, as Load does for the current
+// set. Zones no longer listed stop being served; on error the previous set
+// stays in place.
+func (f *FileZones) LoadFiles(files []ZoneFile) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.load(files); err != nil {
+		return err
+	}
+	f.files = files
+	return nil
+}
+
+func (f *FileZones) load(files []ZoneFile) error {
+	loaded := make(map[string]*zone.Zone, len(files))
+	var changed []ZoneSource
+	for _, file := range files {
+		z, err := zone.LoadFile(file.Path, file.Origin)
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", dnssec.CanonicalName(file.Origin), err)
+		}
+		if _, dup := loaded[z.Origin]; dup {
+			return fmt.Errorf("zone %s is listed twice", z.Origin)
+		}
+		loaded[z.Origin] = z
+
+		if previous, ok := f.loaded[z.Origin]; ok {
+			delta, err := zone.Diff(previous, z)
+			if err != nil {
+				return fmt.Errorf("zone %s: %w", z.Origin, err)
+			}
+			if delta.Empty() {
+				continue
+			}
+			if previous.Serial() == z.Serial() {
+				log.Printf("[RELOAD] Zone %s changed without a serial increase; secondaries will not notice", z.Origin)
+			}
+		}
+		changed = append(changed, ZoneSource{Zone: z, Signer: file.Signer})
+	}
+
+	var removed []string
+	for origin := range f.loaded {
+		if _, ok := loaded[origin]; !ok {
+			removed = append(removed, origin)
+		}
+	}
+	if err := f.store.ReplaceZones(changed, removed); err != nil {
+		return err
+	}
+	f.loaded = loaded
+	return nil
+}
+
+// Reloader re-reads configuration when the process receives SIGHUP and,
+// with a poll interval, when one of the watched files changes. Reloads run
+// one at a time; a reload that fails leaves the running state untouched.
+type Reloader struct {
+	mu      sync.Mutex
+	reload  func() error
+	watched func() []string
+	stamps  map[string]fileStamp
+}
+
+// fileStamp is what polling compares to notice a changed file
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader creates a reloader calling reload, which must validate the
+// new state completely before swapping it in. watched lists the files to
+// poll; it may be nil.
+func NewReloader(reload func() error, watched func() []string) *Reloader {
+	r := &Reloader{reload: reload, watched: watched}
+	r.stamps = r.stat()
+	return r
+}
+
+// Reload runs one reload, logging its outcome
+func (r *Reloader) Reload(reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log.Printf("[RELOAD] Reloading (%s)", reason)
+	if err := r.reload(); err != nil {
+		log.Printf("[RELOAD] Reload failed, keeping the running configuration: %v", err)
+		return err
+	}
+	// The reload may have changed the set of files to watch
+	r.stamps = r.stat()
+	log.Printf("[RELOAD] Reload complete")
+	return nil
+}
+
+// Run reloads on SIGHUP and, when interval is positive, when a watched
+// file changes. It returns when ctx is done.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	if interval > 0 && r.watched != nil {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.Reload("SIGHUP")
+		case <-poll:
+			if path, ok := r.changed(); ok {
+				r.Reload(path + " changed")
+			}
+		}
+	}
+}
+
+// changed reports the first watched file that differs from the last poll.
+// The stamps are updated either way, so a file that fails to load is not
+// retried until it changes again.
+func (r *Reloader) changed() (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamps := r.stat()
+	var changed string
+	for path, stamp := range stamps {
+		if old, ok := r.stamps[path]; !ok || old != stamp {
+			changed = path
+			break
+		}
+	}
+	for path := range r.stamps {
+		if _, ok := stamps[path]; !ok && changed == "" {
+			changed = path
+		}
+	}
+	r.stamps = stamps
+	return changed, changed != ""
+}
+
+// stat records the modification time and size of the watched files;
+// missing files are left out
+func (r *Reloader) stat() map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	if r.watched == nil {
+		return stamps
+	}
+	for _, path := range r.watched() {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return stamps
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+func writeZoneFile(t *testing.T, path string, serial, www string) {
+	t.Helper()
+	text := strings.Replace(testZoneFile, "hostmaster 1 ", "hostmaster "+serial+" ", 1)
+	text = strings.Replace(text, "192.0.2.80", www, 1)
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileZones_Load(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.test.zone")
+	writeZoneFile(t, path, "1", "192.0.2.80")
+
+	store := NewZoneStore()
+	var notified []uint32
+	store.OnSerialChange(func(soa records.ResourceRecord) { notified = append(notified, serialOf(soa)) })
+	files := NewFileZones(store, []ZoneFile{{Origin: "example.test", Path: path}})
+	if err := files.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := lookupA(t, store, "www.example.test"); got != "192.0.2.80" {
+		t.Fatalf("Unexpected answer %v", got)
+	}
+
+	// A broken file keeps the running zone and names the failing line
+	if err := os.WriteFile(path, []byte("@ SOA ns hm 2 2 3 4 5\nwww A not-an-address\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	err := files.Load()
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error naming line 2, got %v", err)
+	}
+	if got := lookupA(t, store, "www.example.test"); got != "192.0.2.80" {
+		t.Errorf("Failed reload replaced the zone: %v", got)
+	}
+
+	// An unchanged file keeps changes made since, e.g. by dynamic updates
+	writeZoneFile(t, path, "1", "192.0.2.80")
+	if err := store.Update("example.test", func(z *zone.Zone) (bool, error) {
+		return true, z.Add(records.ResourceRecord{Name: "new.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 60, Data: "192.0.2.9"})
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := files.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookupA(t, store, "new.example.test"); got != "192.0.2.9" {
+		t.Errorf("Unchanged zone was reloaded: %v", got)
+	}
+
+	writeZoneFile(t, path, "5", "192.0.2.81")
+	if err := files.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := lookupA(t, store, "www.example.test"); got != "192.0.2.81" {
+		t.Errorf("Changed zone not swapped in: %v", got)
+	}
+	if len(notified) != 1 || notified[0] != 5 {
+		t.Errorf("Expected one serial change to 5, got %v", notified)
+	}
+
+	// Zones no longer listed stop being served
+	if err := files.LoadFiles(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.Lookup(context.Background(), "www.example.test", records.TypeA); ok {
+		t.Error("Expected the removed zone to be gone")
+	}
+}
+
+func TestReloader_PollsWatchedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watched")
+	if err := os.WriteFile(path, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := make(chan struct{}, 10)
+	r := NewReloader(func() error {
+		reloads <- struct{}{}
+		return nil
+	}, func() []string { return []string{path} })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx, 10*time.Millisecond)
+
+	select {
+	case <-reloads:
+		t.Fatal("Reloaded without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected a reload after the file changed")
+	}
+}
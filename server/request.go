@@ -5,151 +5,350 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
-	"fmt"
 	"log"
 	"net"
-
-	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"sync"
+	"sync/atomic"
 )
 
 type contextKey string
 
-const clientIPKey = contextKey("client_ip")
+const (
+	clientIPKey = contextKey("client_ip")
+	dnssecOKKey = contextKey("dnssec_ok")
+	opcodeKey   = contextKey("opcode")
+	maxUDPSize  = 4096
+	minUDPSize  = 512
+)
 
 const (
 	responseSuccess       = 0x8180
 	responseServerFailure = 0x8182
+	responseRefused       = 0x8185
+	responseNotAuth       = 0x8189
 )
 
-// HandleDNSRequest orchestrates the DNS request handling process
-func HandleDNSRequest(conn *net.UDPConn, clientAddr *net.UDPAddr, request []byte, handler DNSHandler) {
-	ctx := context.WithValue(context.Background(), clientIPKey, clientAddr.IP.String())
+// Opcodes (RFC 1035, RFC 1996, RFC 2136)
+const (
+	opcodeQuery  = 0
+	opcodeNotify = 4
+	opcodeUpdate = 5
+)
 
-	txnID, domain, qtype, err := parseRequest(request)
+const (
+	rcodeFormErr  = 1
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+	rcodeNotImp   = 4
+	rcodeRefused  = 5
+	rcodeNotAuth  = 9
+)
+
+// ErrRefused makes the server answer REFUSED instead of SERVFAIL
+var ErrRefused = errors.New("refused")
+
+// logQueries logs a line for every request received
+var logQueries atomic.Bool
+
+func init() {
+	logQueries.Store(true)
+}
+
+// SetQueryLogging turns the log line written for every request on or off.
+// It is on by default; formatting it costs allocations on every query.
+func SetQueryLogging(on bool) {
+	logQueries.Store(on)
+}
+
+// ResponseWriter sends the response to a request over the transport it
+// came in on
+type ResponseWriter interface {
+	// WriteMsg packs m and sends it. Responses larger than the client
+	// accepts are sent truncated, with TC set. m is not kept, so the
+	// caller may reuse it once WriteMsg returns.
+	WriteMsg(m *Msg) error
+	// WritePacked sends a message the caller packed, e.g. to sign it
+	WritePacked(msg []byte) error
+	// RemoteAddr is the client's address
+	RemoteAddr() net.Addr
+	// MaxSize is the largest response the client accepts
+	MaxSize() int
+}
+
+// Handler answers a request by writing complete response messages to w.
+// Handlers that pass a request on call the next handler's ServeDNS.
+type Handler interface {
+	ServeDNS(ctx context.Context, w ResponseWriter, req *Msg)
+}
+
+// HandlerFunc adapts a function to Handler
+type HandlerFunc func(ctx context.Context, w ResponseWriter, req *Msg)
+
+func (f HandlerFunc) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	f(ctx, w, req)
+}
+
+// sizedWriter is a writer whose size limit is set by each request
+type sizedWriter interface {
+	limitTo(req *Msg)
+}
+
+// responseBuffers recycles the buffers responses are packed into
+var responseBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, maxUDPSize)
+		return &buf
+	},
+}
+
+// udpWriter answers a datagram, limited to the client's UDP payload size
+type udpWriter struct {
+	conn udpSender
+	addr *net.UDPAddr
+	oob  []byte
+	size int
+}
+
+// WriteMsg packs m into a pooled buffer, which the sender copies or has
+// sent by the time WriteMsgUDP returns
+func (w *udpWriter) WriteMsg(m *Msg) error {
+	buf := responseBuffers.Get().(*[]byte)
+	defer responseBuffers.Put(buf)
+	msg, err := appendTruncated((*buf)[:0], m, w.MaxSize())
 	if err != nil {
-		handleError(conn, clientAddr, txnID, "Request parsing", err)
-		return
+		return err
+	}
+	*buf = msg[:0]
+	return w.WritePacked(msg)
+}
+
+func (w *udpWriter) WritePacked(msg []byte) error {
+	_, _, err := w.conn.WriteMsgUDP(msg, w.oob, w.addr)
+	return err
+}
+
+func (w *udpWriter) RemoteAddr() net.Addr { return w.addr }
+
+func (w *udpWriter) MaxSize() int {
+	if w.size == 0 {
+		return minUDPSize
 	}
+	return w.size
+}
+
+func (w *udpWriter) limitTo(req *Msg) { w.size = req.udpSize() }
 
-	log.Printf("[%d] Received query for: %s", txnID, domain)
+// packTruncated packs m, dropping every record but the OPT and setting TC
+// when the result exceeds max
+func packTruncated(m *Msg, max int) ([]byte, error) {
+	return appendTruncated(make([]byte, 0, minUDPSize), m, max)
+}
+
+// appendTruncated is packTruncated reusing the capacity of buf
+func appendTruncated(buf []byte, m *Msg, max int) ([]byte, error) {
+	msg, err := m.appendPack(buf)
+	if err != nil || len(msg) <= max {
+		return msg, err
+	}
+	truncated := *m
+	truncated.Truncated = true
+	truncated.Answer, truncated.Authority, truncated.Additional = nil, nil, nil
+	return truncated.appendPack(msg)
+}
+
+// requestContext carries the client address and the request to handlers.
+// It answers the context keys itself, replacing a chain of WithValue
+// contexts, and formats the address only when asked for it.
+type requestContext struct {
+	context.Context
+	clientIP net.IP
+	req      *Msg
+}
 
-	recordHandler, data, err := resolveDomain(ctx, handler, domain, qtype)
+func (c *requestContext) Value(key interface{}) interface{} {
+	switch {
+	case key == clientIPKey && c.clientIP != nil:
+		return c.clientIP.String()
+	case key == dnssecOKKey && c.req != nil:
+		return c.req.DNSSECOK()
+	case key == opcodeKey && c.req != nil:
+		return c.req.Opcode
+	}
+	return c.Context.Value(key)
+}
+
+// udpExchange holds what answering one datagram needs, so that a request
+// costs no allocation once the pool is warm
+type udpExchange struct {
+	ctx requestContext
+	w   udpWriter
+	req msgStorage
+}
+
+// HandleDNSRequest orchestrates the DNS request handling process
+func HandleDNSRequest(conn *net.UDPConn, clientAddr *net.UDPAddr, request []byte, handler Handler) {
+	handleUDPRequest(conn, clientAddr, nil, request, handler)
+}
+
+// udpExchanges recycles the udpExchange of answered datagrams. Handlers
+// must not keep the request or its context once ServeDNS returns.
+var udpExchanges = sync.Pool{
+	New: func() interface{} { return new(udpExchange) },
+}
+
+func handleUDPRequest(conn udpSender, clientAddr *net.UDPAddr, oob, request []byte, handler Handler) {
+	x := udpExchanges.Get().(*udpExchange)
+	x.ctx = requestContext{Context: context.Background(), clientIP: clientAddr.IP}
+	x.w = udpWriter{conn: conn, addr: clientAddr, oob: oob}
+	serveRequest(&x.ctx, &x.w, &x.req, request, handler)
+	*x = udpExchange{}
+	udpExchanges.Put(x)
+}
+
+// handleRequest answers one request through w, whatever the transport
+func handleRequest(ctx context.Context, w ResponseWriter, request []byte, handler Handler) {
+	serveRequest(&requestContext{Context: ctx}, w, new(msgStorage), request, handler)
+}
+
+// serveRequest unpacks request into storage and passes it to handler
+func serveRequest(ctx *requestContext, w ResponseWriter, storage *msgStorage, request []byte, handler Handler) {
+	req, err := storage.unpack(request)
 	if err != nil {
-		handleError(conn, clientAddr, txnID, "Domain resolution", err)
+		log.Printf("Request parsing error: %v", err)
+		if len(request) >= 12 && request[2]&0x80 == 0 {
+			sendErrorResponse(w, binary.BigEndian.Uint16(request[0:2]), flagQR|rcodeFormErr)
+		}
 		return
 	}
+	if req.Response {
+		log.Printf("[%d] Ignoring a response sent as a request", req.ID)
+		return
+	}
+	if sized, ok := w.(sizedWriter); ok {
+		sized.limitTo(req)
+	}
+	if len(req.Question) != 1 {
+		log.Printf("[%d] Request with %d questions", req.ID, len(req.Question))
+		writeRcode(w, req, rcodeFormErr)
+		return
+	}
+	if req.Opcode != opcodeQuery && req.Opcode != opcodeNotify && req.Opcode != opcodeUpdate {
+		log.Printf("[%d] Opcode %d not implemented", req.ID, req.Opcode)
+		writeRcode(w, req, rcodeNotImp)
+		return
+	}
+	ctx.req = req
 
-	log.Printf("[%d] Resolved %s → %s", txnID, domain, data)
-
-	if err := buildAndSendResponse(conn, clientAddr, txnID, domain, recordHandler, data); err != nil {
-		handleError(conn, clientAddr, txnID, "Response building", err)
+	if logQueries.Load() {
+		log.Printf("[%d] Received query for: %s", req.ID, req.Question[0].Name)
 	}
+	metrics.Add(metricQueries, 1)
+	handler.ServeDNS(ctx, w, req)
 }
 
-// parseRequest extracts transaction ID, domain, and query type from the request
-func parseRequest(request []byte) (uint16, string, uint16, error) {
+// parseRequest extracts transaction ID, opcode, domain, and query type from the request
+func parseRequest(request []byte) (uint16, uint8, string, uint16, error) {
 	if len(request) < 12 {
-		return 0, "", 0, errors.New("request shorter than header size")
+		return 0, 0, "", 0, errors.New("request shorter than header size")
 	}
 
 	txnID := binary.BigEndian.Uint16(request[0:2])
+	flags := binary.BigEndian.Uint16(request[2:4])
+	if flags&flagQR != 0 {
+		return txnID, 0, "", 0, errors.New("message is a response, not a request")
+	}
+	opcode := uint8(flags>>11) & 0x0F
 
 	// Parse QNAME starting at offset 12 with byte length tracking
 	parser := NewDomainParser()
 	domain, bytesConsumed, err := parser.Parse(request[12:])
 	if err != nil {
-		return 0, "", 0, err
+		return 0, 0, "", 0, err
 	}
 
 	// Calculate QTYPE position using actual bytes consumed
 	qtypeStart := 12 + bytesConsumed
 	if len(request) < qtypeStart+4 {
-		return 0, "", 0, errors.New("request too short for qtype/qclass")
+		return 0, 0, "", 0, errors.New("request too short for qtype/qclass")
 	}
 
 	qtype := binary.BigEndian.Uint16(request[qtypeStart : qtypeStart+2])
-	return txnID, domain, qtype, nil
+	return txnID, opcode, domain, qtype, nil
 }
 
-// resolveDomain delegates to the DNS handler
-func resolveDomain(ctx context.Context, handler DNSHandler, domain string, qtype uint16) (records.RecordHandler, interface{}, error) {
-	// Add debug logging
-	log.Printf("Resolving domain %s with query type %d", domain, qtype)
-
-	// Get handler for query type first
-	recordHandler, ok := records.GetHandler(qtype)
-	if !ok {
-		log.Printf("No handler found for query type %d", qtype)
-		return nil, nil, fmt.Errorf("unsupported query type: %d", qtype)
-	}
+// opcodeFromContext returns the opcode of the request being handled
+func opcodeFromContext(ctx context.Context) uint8 {
+	opcode, _ := ctx.Value(opcodeKey).(uint8)
+	return opcode
+}
 
-	// Get the data from the DNS handler
-	data, err := handler.HandleQuery(ctx, domain, qtype)
-	if err != nil {
-		log.Printf("HandleQuery error for %s (type %d): %v", domain, qtype, err)
-		return nil, nil, err
-	}
+// dnssecOKFromContext reports whether the client set the DO bit
+func dnssecOKFromContext(ctx context.Context) bool {
+	do, _ := ctx.Value(dnssecOKKey).(bool)
+	return do
+}
 
-	// Validate the data
-	if err := recordHandler.ValidateData(data); err != nil {
-		log.Printf("Data validation error for %s (type %d): %v", domain, qtype, err)
-		return nil, nil, fmt.Errorf("invalid data for type %d: %v", qtype, err)
+// writeZoneAnswer writes an authoritative answer. Referrals are not
+// authoritative unless a CNAME from the zone was followed to them.
+func writeZoneAnswer(w ResponseWriter, req *Msg, answer *ZoneAnswer) {
+	metrics.Add(metricZoneAnswers, 1)
+	reply := req.Reply()
+	reply.Authoritative = !answer.Referral || len(answer.Answer.Answer) > 0
+	reply.Rcode = answer.Rcode
+	reply.Answer = answer.Answer.Answer
+	reply.Authority = answer.Authority
+	reply.Additional = answer.Additional
+	if err := w.WriteMsg(reply); err != nil {
+		writeError(w, req, "Response building", err)
 	}
+}
 
-	// Improved Debug logging format
-	switch data := data.(type) {
-	case records.MXData:
-		log.Printf("[%d] Resolved %s → MX {preference: %d, exchange: %s}",
-			qtype, domain, data.Preference, data.Exchange)
-	case []string:
-		log.Printf("[%d] Resolved %s → TXT %q", qtype, domain, data[0])
-	default:
-		log.Printf("[%d] Resolved %s → %v", qtype, domain, data)
+// writeError centralizes error handling: ErrRefused answers REFUSED,
+// anything else SERVFAIL
+func writeError(w ResponseWriter, req *Msg, context string, err error) {
+	log.Printf("%s error: %v", context, err)
+	if errors.Is(err, ErrRefused) {
+		writeRcode(w, req, rcodeRefused)
+		return
 	}
-
-	return recordHandler, data, nil
+	writeRcode(w, req, rcodeServFail)
 }
 
-// buildAndSendResponse constructs and sends the DNS response
-func buildAndSendResponse(conn *net.UDPConn, addr *net.UDPAddr, txnID uint16, domain string, handler records.RecordHandler, data interface{}) error {
-	response, err := BuildResponse(txnID, domain, handler, data, responseSuccess, handler.DefaultTTL())
-	if err != nil {
-		return err
+// writeRcode answers req with an empty response carrying rcode
+func writeRcode(w ResponseWriter, req *Msg, rcode uint16) {
+	switch rcode {
+	case rcodeRefused:
+		metrics.Add(metricRefused, 1)
+	case rcodeServFail:
+		metrics.Add(metricServFail, 1)
 	}
-
-	// Handle single or multiple answers generically
-	switch d := data.(type) {
-	case []interface{}:
-		for _, record := range d {
-			answer, err := handler.BuildAnswer(domain, record, handler.DefaultTTL())
-			if err != nil {
-				return err
-			}
-			response = append(response, answer.Bytes()...)
-		}
-	default:
-		answer, err := handler.BuildAnswer(domain, data, handler.DefaultTTL())
-		if err != nil {
-			return err
-		}
-		response = append(response, answer.Bytes()...)
+	reply := req.Reply()
+	reply.Rcode = rcode
+	if err := w.WriteMsg(reply); err != nil {
+		log.Printf("Error sending failure response: %v", err)
 	}
-
-	_, err = conn.WriteToUDP(response, addr)
-	return err
 }
 
-// handleError centralizes error handling and response
-func handleError(conn *net.UDPConn, addr *net.UDPAddr, txnID uint16, context string, err error) {
+// handleError answers with a bare header carrying REFUSED for ErrRefused
+// and SERVFAIL otherwise, for transfers which answer from the raw request
+func handleError(w ResponseWriter, txnID uint16, context string, err error) {
 	log.Printf("%s error: %v", context, err)
-	sendErrorResponse(conn, addr, txnID, responseServerFailure)
+	if errors.Is(err, ErrRefused) {
+		metrics.Add(metricRefused, 1)
+		sendErrorResponse(w, txnID, responseRefused)
+		return
+	}
+	metrics.Add(metricServFail, 1)
+	sendErrorResponse(w, txnID, responseServerFailure)
 }
 
-func sendErrorResponse(conn *net.UDPConn, addr *net.UDPAddr, txnID uint16, flags uint16) {
+// sendErrorResponse answers with a bare header, for requests that could
+// not be unpacked and for transfers
+func sendErrorResponse(w ResponseWriter, txnID uint16, flags uint16) {
 	header := make([]byte, 12)
 	binary.BigEndian.PutUint16(header[0:2], txnID)
 	binary.BigEndian.PutUint16(header[2:4], flags)
-	if _, err := conn.WriteToUDP(header, addr); err != nil {
+	if err := w.WritePacked(header); err != nil {
 		log.Printf("Error sending failure response: %v", err)
 	}
 }
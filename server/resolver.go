@@ -6,6 +6,7 @@ import (
 	"errors"
 
 	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
 )
 
 // ResolutionContext holds query context information
@@ -18,6 +19,8 @@ type ResolutionContext struct {
 type DNSResolver struct {
 	forwarder  *Forwarder
 	strategies map[uint16]ResolutionStrategy
+	validator  *Validator
+	zones      *ZoneStore
 }
 
 // NewDNSResolver initializes a new DNSResolver
@@ -28,33 +31,136 @@ func NewDNSResolver(upstream string) *DNSResolver {
 		strategies: map[uint16]ResolutionStrategy{
 			records.TypeA:    NewIPResolution(f, isIPv4),
 			records.TypeAAAA: NewIPResolution(f, isIPv6),
+			records.TypeSRV:  NewSRVResolution(f),
 		},
 	}
 }
 
+// EnableDNSSEC validates every forwarded answer against the given trust anchors
+func (r *DNSResolver) EnableDNSSEC(anchors []records.ResourceRecord) error {
+	v, err := NewValidator(r.forwarder, anchors)
+	if err != nil {
+		return err
+	}
+	r.validator = v
+	return nil
+}
+
+// SignUpstream TSIG signs every query to the upstream with key. Address
+// and SRV lookups move from the Go resolver to wire queries so they are
+// signed as well.
+func (r *DNSResolver) SignUpstream(key *tsig.Key) {
+	r.forwarder.SignWith(key)
+	for _, qtype := range []uint16{records.TypeA, records.TypeAAAA, records.TypeSRV} {
+		delete(r.strategies, qtype)
+	}
+}
+
+// ServeZones answers names inside the store's zones authoritatively
+// instead of forwarding them
+func (r *DNSResolver) ServeZones(store *ZoneStore) {
+	r.zones = store
+}
+
+// Exchange forwards domain/qtype and returns the upstream's response, with
+// the DO and CD bits of the client. With DNSSEC validation it holds the
+// validated answer and authority sections and AD says whether they are
+// secure; otherwise the upstream's AD bit is not passed on.
+func (r *DNSResolver) Exchange(ctx context.Context, domain string, qtype uint16, do, cd bool) (*Msg, error) {
+	if r.validator != nil {
+		resp, secure, err := r.validator.Validate(ctx, domain, qtype)
+		if err != nil {
+			return nil, err
+		}
+		return &Msg{Response: true, Rcode: resp.Rcode, AuthenticatedData: secure, Answer: resp.Answer, Authority: resp.Authority}, nil
+	}
+	resp, err := r.forwarder.Forward(ctx, domain, qtype, do, cd)
+	if err != nil {
+		return nil, err
+	}
+	resp.AuthenticatedData = false
+	return resp, nil
+}
+
 // ResolveDomain resolves a domain using the appropriate strategy
-func (r *DNSResolver) ResolveDomain(domain string, qtype uint16) (string, error) {
+func (r *DNSResolver) ResolveDomain(domain string, qtype uint16) (interface{}, error) {
 	strategy, exists := r.strategies[qtype]
 	if !exists {
-		return "", errors.New("unsupported query type")
+		if !records.IsDataType(qtype) {
+			return nil, errors.New("unsupported query type")
+		}
+		strategy = NewWireResolution(r.forwarder, qtype)
 	}
 	return strategy.Resolve(domain)
 }
 
 func (r *DNSResolver) Resolve(ctx context.Context, rc ResolutionContext) (interface{}, error) {
-	handler, ok := records.GetHandler(rc.QType)
+	handler, ok := records.HandlerFor(rc.QType)
 	if !ok {
 		return nil, errors.New("unsupported query type")
 	}
 
-	ip, err := r.ResolveDomain(rc.Domain, rc.QType)
+	if r.zones != nil {
+		answer, ok, err := r.zones.Lookup(ctx, rc.Domain, rc.QType)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return answer, nil
+		}
+	}
+
+	if r.validator != nil {
+		return r.resolveValidated(ctx, handler, rc)
+	}
+
+	data, err := r.ResolveDomain(rc.Domain, rc.QType)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := handler.ValidateData(ip); err != nil {
+	if err := validateAnswers(handler, data); err != nil {
 		return nil, err
 	}
 
-	return ip, nil
+	return data, nil
+}
+
+// resolveValidated forwards the query with DNSSEC records and wraps secure
+// answers in SecureAnswer
+func (r *DNSResolver) resolveValidated(ctx context.Context, handler records.RecordHandler, rc ResolutionContext) (interface{}, error) {
+	resp, secure, err := r.validator.Validate(ctx, rc.Domain, rc.QType)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := answersOfType(resp.Answer, rc.QType)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAnswers(handler, data); err != nil {
+		return nil, err
+	}
+
+	if secure {
+		return SecureAnswer{Data: data}, nil
+	}
+	return data, nil
+}
+
+// validateAnswers validates a single answer or every entry of a multi-answer result
+func validateAnswers(handler records.RecordHandler, data interface{}) error {
+	answers, ok := data.([]interface{})
+	if !ok {
+		return handler.ValidateData(data)
+	}
+	if len(answers) == 0 {
+		return errors.New("empty answer set")
+	}
+	for _, answer := range answers {
+		if err := handler.ValidateData(answer); err != nil {
+			return err
+		}
+	}
+	return nil
 }
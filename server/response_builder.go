@@ -10,12 +10,37 @@ import (
 	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
 )
 
-// DNSResponseBuilder constructs DNS responses through composition
+// AdditionalRecord is a record destined for the additional section,
+// such as the address of an SRV target
+type AdditionalRecord struct {
+	Domain  string
+	Handler records.RecordHandler
+	Data    interface{}
+	TTL     uint32 // zero uses the handler default
+}
+
+// Message sections in the order they are written
+const (
+	sectionQuestion = iota
+	sectionAnswer
+	sectionAuthority
+	sectionAdditional
+)
+
+// DNSResponseBuilder constructs DNS responses through composition. Sections
+// must be added in message order so every name can be compressed against
+// the names written before it.
 type DNSResponseBuilder struct {
-	buf      *bytes.Buffer
-	header   []byte
-	question []byte
-	answer   []byte
+	buf        *bytes.Buffer
+	header     []byte
+	question   []byte
+	answer     []byte
+	authority  []byte
+	additional []byte
+	anCount    uint16
+	nsCount    uint16
+	arCount    uint16
+	section    int
 	records.BaseHandler
 	position int
 }
@@ -27,25 +52,24 @@ func NewDNSResponseBuilder(txnID uint16, flags uint16) *DNSResponseBuilder {
 		header:   make([]byte, 12),
 		position: 12, // Initialize position after header
 	}
+	b.Writer = &records.DomainNameWriter{Offsets: make(map[string]int)}
 
 	// Initialize header
 	binary.BigEndian.PutUint16(b.header[0:2], txnID)
 	binary.BigEndian.PutUint16(b.header[2:4], flags)
 	binary.BigEndian.PutUint16(b.header[4:6], records.QDCOUNT)
-	binary.BigEndian.PutUint16(b.header[6:8], records.ANCOUNT)
 
 	return b
 }
 
 // WithQuestion adds the question section
 func (b *DNSResponseBuilder) WithQuestion(domain string, qtype uint16) error {
-	var qBuf bytes.Buffer
-
-	b.Writer = &records.DomainNameWriter{
-		Offsets: make(map[string]int),
-		Pos:     12,
+	if err := b.enterSection(sectionQuestion); err != nil {
+		return err
 	}
 
+	var qBuf bytes.Buffer
+	b.Writer.Pos = b.position
 	if err := b.WriteDomainName(&qBuf, domain); err != nil {
 		return err
 	}
@@ -59,41 +83,169 @@ func (b *DNSResponseBuilder) WithQuestion(domain string, qtype uint16) error {
 	}
 
 	b.question = qBuf.Bytes()
-	b.Writer.Pos += len(b.question)
+	b.position += len(b.question)
 	return nil
 }
 
-// WithAnswer adds the answer section
+// WithAnswer adds one record, or one record per entry of a []interface{}, to the answer section
 func (b *DNSResponseBuilder) WithAnswer(domain string, handler records.RecordHandler, data interface{}, ttl uint32) error {
-	// Share compression state with any handler implementing DomainNameCompressor
-	if compressor, ok := handler.(records.DomainNameCompressor); ok {
-		compressor.SetWriter(b.Writer)
+	if err := b.enterSection(sectionAnswer); err != nil {
+		return err
+	}
+	rrs, err := b.buildRecords(domain, handler, data, ttl)
+	if err != nil {
+		return err
+	}
+	b.answer = append(b.answer, rrs...)
+	b.anCount += countRecords(data)
+	return nil
+}
+
+// WithAuthority adds one record, or one record per entry of a []interface{}, to the authority section
+func (b *DNSResponseBuilder) WithAuthority(domain string, handler records.RecordHandler, data interface{}, ttl uint32) error {
+	if err := b.enterSection(sectionAuthority); err != nil {
+		return err
+	}
+	rrs, err := b.buildRecords(domain, handler, data, ttl)
+	if err != nil {
+		return err
 	}
+	b.authority = append(b.authority, rrs...)
+	b.nsCount += countRecords(data)
+	return nil
+}
 
-	answerBuf, err := handler.BuildAnswer(domain, data, ttl)
+// WithAdditional adds a record to the additional section
+func (b *DNSResponseBuilder) WithAdditional(record AdditionalRecord) error {
+	if err := b.enterSection(sectionAdditional); err != nil {
+		return err
+	}
+	rrs, err := b.buildRecords(record.Domain, record.Handler, record.Data, record.TTL)
 	if err != nil {
 		return err
 	}
-	b.answer = answerBuf.Bytes()
+	b.additional = append(b.additional, rrs...)
+	b.arCount += countRecords(record.Data)
+	return nil
+}
+
+// WithOPT adds an EDNS(0) OPT pseudo-record advertising payload; it goes
+// last in the additional section
+func (b *DNSResponseBuilder) WithOPT(payload uint16, flags uint32) error {
+	if err := b.enterSection(sectionAdditional); err != nil {
+		return err
+	}
+	opt := []byte{0} // root owner
+	opt = binary.BigEndian.AppendUint16(opt, records.TypeOPT)
+	opt = binary.BigEndian.AppendUint16(opt, payload)
+	opt = binary.BigEndian.AppendUint32(opt, flags)
+	opt = binary.BigEndian.AppendUint16(opt, 0)
+	b.additional = append(b.additional, opt...)
+	b.position += len(opt)
+	b.arCount++
 	return nil
 }
 
+// enterSection enforces message order; compression offsets depend on it
+func (b *DNSResponseBuilder) enterSection(section int) error {
+	if section < b.section || (section == sectionQuestion && b.question != nil) {
+		return fmt.Errorf("section %d added after section %d", section, b.section)
+	}
+	b.section = section
+	return nil
+}
+
+// buildRecords encodes each record at the current message position
+func (b *DNSResponseBuilder) buildRecords(domain string, handler records.RecordHandler, data interface{}, ttl uint32) ([]byte, error) {
+	multi, ok := data.([]interface{})
+	if !ok {
+		multi = []interface{}{data}
+	}
+
+	var out []byte
+	for _, record := range multi {
+		rr, err := b.buildRecord(domain, handler, record, ttl)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rr...)
+		b.position += len(rr)
+	}
+	return out, nil
+}
+
+// buildRecord encodes a single resource record starting at b.position,
+// compressing the owner name and, for compressible types, RDATA names
+func (b *DNSResponseBuilder) buildRecord(domain string, handler records.RecordHandler, data interface{}, ttl uint32) ([]byte, error) {
+	if err := handler.ValidateData(data); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	b.Writer.Pos = b.position
+	if err := b.WriteDomainName(&buf, domain); err != nil {
+		return nil, fmt.Errorf("failed to write domain: %w", err)
+	}
+
+	// Use default TTL if not specified
+	if ttl == 0 {
+		ttl = handler.DefaultTTL()
+	}
+	binary.Write(&buf, binary.BigEndian, handler.Type())
+	binary.Write(&buf, binary.BigEndian, handler.Class())
+	binary.Write(&buf, binary.BigEndian, ttl)
+
+	// RDATA follows the 2-byte length
+	rdata, err := b.buildRecordData(b.position+buf.Len()+2, handler, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build record data: %w", err)
+	}
+	if len(rdata) > 0xFFFF {
+		return nil, errors.New("record data exceeds 65535 bytes")
+	}
+	binary.Write(&buf, binary.BigEndian, uint16(len(rdata)))
+	buf.Write(rdata)
+
+	return buf.Bytes(), nil
+}
+
+func (b *DNSResponseBuilder) buildRecordData(pos int, handler records.RecordHandler, data interface{}) ([]byte, error) {
+	compressible, ok := handler.(records.CompressibleRecord)
+	if !ok {
+		return handler.BuildRecordData(data)
+	}
+	return compressible.BuildCompressedRecordData(data, &records.DomainNameWriter{
+		Offsets: b.Writer.Offsets,
+		Pos:     pos,
+	})
+}
+
+func countRecords(data interface{}) uint16 {
+	if multi, ok := data.([]interface{}); ok {
+		return uint16(len(multi))
+	}
+	return 1
+}
+
 // Build constructs the final DNS response
 func (b *DNSResponseBuilder) Build() []byte {
-	b.buf.Write(b.header)
-	b.position += len(b.header)
+	binary.BigEndian.PutUint16(b.header[6:8], b.anCount)
+	binary.BigEndian.PutUint16(b.header[8:10], b.nsCount)
+	binary.BigEndian.PutUint16(b.header[10:12], b.arCount)
 
+	b.buf.Reset()
+	b.buf.Write(b.header)
 	b.buf.Write(b.question)
-	b.position += len(b.question)
-
 	b.buf.Write(b.answer)
-	b.position += len(b.answer)
+	b.buf.Write(b.authority)
+	b.buf.Write(b.additional)
 
 	return b.buf.Bytes()
 }
 
-// BuildResponse provides a simplified interface for response construction
-func BuildResponse(txnID uint16, domain string, handler records.RecordHandler, data interface{}, flags uint16, ttl uint32) ([]byte, error) {
+// BuildResponse provides a simplified interface for response construction.
+// Optional additional records are appended after the answer section.
+func BuildResponse(txnID uint16, domain string, handler records.RecordHandler, data interface{}, flags uint16, ttl uint32, additional ...AdditionalRecord) ([]byte, error) {
 	// Validate inputs
 	if domain == "" {
 		return nil, errors.New("empty domain name")
@@ -114,5 +266,12 @@ func BuildResponse(txnID uint16, domain string, handler records.RecordHandler, d
 		return nil, fmt.Errorf("failed to add answer: %w", err)
 	}
 
+	// Add additional section
+	for _, record := range additional {
+		if err := builder.WithAdditional(record); err != nil {
+			return nil, fmt.Errorf("failed to add additional record: %w", err)
+		}
+	}
+
 	return builder.Build(), nil
 }
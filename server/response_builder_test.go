@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// unpackSections decodes every record after the single question of msg
+func unpackSections(t *testing.T, msg []byte) []records.ResourceRecord {
+	t.Helper()
+	var names records.BaseHandler
+	_, pos, err := names.ReadDomainName(msg, 12)
+	if err != nil {
+		t.Fatalf("Invalid question: %v", err)
+	}
+	pos += 4
+
+	count := int(binary.BigEndian.Uint16(msg[6:8]) + binary.BigEndian.Uint16(msg[8:10]) + binary.BigEndian.Uint16(msg[10:12]))
+	var rrs []records.ResourceRecord
+	for i := 0; i < count; i++ {
+		rr, next, err := records.UnpackResourceRecord(msg, pos)
+		if err != nil {
+			t.Fatalf("Record %d: %v", i, err)
+		}
+		rrs = append(rrs, rr)
+		pos = next
+	}
+	if pos != len(msg) {
+		t.Errorf("Trailing bytes after records: %d of %d used", pos, len(msg))
+	}
+	return rrs
+}
+
+func TestBuildResponse_CompressesAcrossSections(t *testing.T) {
+	mx, _ := records.GetHandler(records.TypeMX)
+	a, _ := records.GetHandler(records.TypeA)
+	data := []interface{}{
+		records.MXData{Preference: 10, Exchange: "mail.example.com"},
+		records.MXData{Preference: 20, Exchange: "MAIL2.Example.com"},
+	}
+
+	msg, err := BuildResponse(0x1234, "example.com", mx, data, responseSuccess, 300,
+		AdditionalRecord{Domain: "mail.example.com", Handler: a, Data: "192.0.2.25"})
+	if err != nil {
+		t.Fatalf("BuildResponse failed: %v", err)
+	}
+
+	// Question name written once at offset 12, every later reference is a pointer
+	if n := bytes.Count(msg, []byte("example")); n != 1 {
+		t.Errorf("Expected the owner name once, found %d copies in %x", n, msg)
+	}
+	if n := bytes.Count(msg, []byte{4, 'm', 'a', 'i', 'l'}); n != 1 {
+		t.Errorf("Expected mail label once, found %d copies", n)
+	}
+
+	rrs := unpackSections(t, msg)
+	if len(rrs) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(rrs))
+	}
+	if rrs[0].Name != "example.com" || rrs[0].Data != data[0] {
+		t.Errorf("Unexpected first answer: %+v", rrs[0])
+	}
+	if rrs[1].Data.(records.MXData).Exchange != "MAIL2.example.com" {
+		t.Errorf("Unexpected second exchange: %+v", rrs[1].Data)
+	}
+	if rrs[2].Name != "mail.example.com" || rrs[2].Data != "192.0.2.25" {
+		t.Errorf("Unexpected additional record: %+v", rrs[2])
+	}
+}
+
+func TestBuildResponse_SRVTargetNotCompressed(t *testing.T) {
+	srv, _ := records.GetHandler(records.TypeSRV)
+	msg, err := BuildResponse(1, "_grpc._tcp.svc.internal", srv,
+		records.SRVData{Priority: 1, Port: 443, Target: "grpc.svc.internal"}, responseSuccess, 300)
+	if err != nil {
+		t.Fatalf("BuildResponse failed: %v", err)
+	}
+
+	// The owner is compressed, but the SRV target must be written in full
+	if !bytes.Contains(msg, []byte{4, 'g', 'r', 'p', 'c', 3, 's', 'v', 'c', 8, 'i', 'n', 't', 'e', 'r', 'n', 'a', 'l', 0}) {
+		t.Errorf("SRV target was compressed: %x", msg)
+	}
+	if rrs := unpackSections(t, msg); rrs[0].Data.(records.SRVData).Target != "grpc.svc.internal" {
+		t.Errorf("Unexpected SRV data: %+v", rrs[0].Data)
+	}
+}
+
+func TestDNSResponseBuilder_SectionOrder(t *testing.T) {
+	ns, _ := records.GetHandler(records.TypeNS)
+	a, _ := records.GetHandler(records.TypeA)
+
+	b := NewDNSResponseBuilder(1, responseSuccess)
+	if err := b.WithQuestion("example.com", records.TypeNS); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WithAuthority("example.com", ns, "ns1.example.com", 300); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WithAdditional(AdditionalRecord{Domain: "ns1.example.com", Handler: a, Data: "192.0.2.53"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.WithAnswer("example.com", ns, "ns2.example.com", 300); err == nil {
+		t.Error("Expected error adding an answer after the additional section")
+	}
+
+	msg := b.Build()
+	if got := binary.BigEndian.Uint16(msg[8:10]); got != 1 {
+		t.Errorf("Expected NSCOUNT 1, got %d", got)
+	}
+	rrs := unpackSections(t, msg)
+	if rrs[0].Data != "ns1.example.com" || rrs[1].Name != "ns1.example.com" {
+		t.Errorf("Unexpected records: %+v", rrs)
+	}
+}
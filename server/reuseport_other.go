@@ -0,0 +1,14 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+// server/reuseport_other.go
+package server
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort fails where SO_REUSEPORT is not available
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -0,0 +1,181 @@
+// server/secondary.go
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+const (
+	// Used until the first successful transfer provides the SOA timers
+	initialRetry = 30 * time.Second
+	// Bounds on the SOA timers so a bad SOA cannot stall or hammer a primary
+	minRefresh      = 5 * time.Second
+	transferTimeout = 2 * time.Minute
+)
+
+// Secondary keeps a local copy of a zone pulled from its primaries
+// (RFC 1034 section 4.3.5). The serial is checked every SOA refresh
+// interval, or every retry interval after a failure, and immediately on
+// Notify. A newer zone is transferred in full before it replaces the copy
+// being served; the copy stops being served once expire passes without
+// reaching a primary.
+type Secondary struct {
+	Origin    string
+	Primaries []string
+	Key       *tsig.Key
+
+	store  *ZoneStore
+	notify chan struct{}
+	now    func() time.Time
+
+	mu          sync.Mutex
+	current     *zone.Zone
+	lastSuccess time.Time
+}
+
+// NewSecondary creates a secondary for origin serving into store
+func NewSecondary(origin string, primaries []string, key *tsig.Key, store *ZoneStore) *Secondary {
+	return &Secondary{
+		Origin:    dnssec.CanonicalName(origin),
+		Primaries: primaries,
+		Key:       key,
+		store:     store,
+		notify:    make(chan struct{}, 1),
+		now:       time.Now,
+	}
+}
+
+// Notify asks for an immediate serial check, as a NOTIFY from a primary does
+func (s *Secondary) Notify() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// IsPrimary reports whether ip is the address of one of the primaries
+func (s *Secondary) IsPrimary(ip net.IP) bool {
+	for _, primary := range s.Primaries {
+		host, _, err := net.SplitHostPort(primary)
+		if err != nil {
+			host = primary
+		}
+		if addr := net.ParseIP(host); addr != nil && addr.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run refreshes the zone until ctx is cancelled
+func (s *Secondary) Run(ctx context.Context) {
+	for {
+		wait := s.timers(s.Refresh(ctx))
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// timers returns how long to wait before the next check after a refresh
+// that ended with err, expiring the zone when it is overdue
+func (s *Secondary) timers(err error) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return initialRetry
+	}
+	_, soa, _ := s.current.SOA()
+	if err == nil {
+		return max(time.Duration(soa.Refresh)*time.Second, minRefresh)
+	}
+
+	log.Printf("[SECONDARY] Refresh of %s failed: %v", s.Origin, err)
+	if s.now().Sub(s.lastSuccess) > time.Duration(soa.Expire)*time.Second {
+		log.Printf("[SECONDARY] Zone %s expired, no longer serving it", s.Origin)
+		s.store.RemoveZone(s.Origin)
+		s.current = nil
+		return initialRetry
+	}
+	return max(time.Duration(soa.Retry)*time.Second, minRefresh)
+}
+
+// Refresh checks the primaries in order and transfers the zone from the
+// first one with a newer serial
+func (s *Secondary) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+
+	var errs []error
+	for _, primary := range s.Primaries {
+		updated, err := s.refreshFrom(ctx, primary, current)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", primary, err))
+			continue
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.lastSuccess = s.now()
+		if updated == current {
+			return nil
+		}
+		if err := s.store.AddZone(updated, nil); err != nil {
+			return err
+		}
+		s.current = updated
+		return nil
+	}
+	if len(errs) == 0 {
+		return errors.New("no primaries configured")
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Secondary) refreshFrom(ctx context.Context, primary string, current *zone.Zone) (*zone.Zone, error) {
+	ctx, cancel := context.WithTimeout(ctx, transferTimeout)
+	defer cancel()
+
+	if current != nil {
+		serial, err := primarySerial(ctx, primary, s.Origin)
+		if err != nil {
+			return nil, err
+		}
+		if !zone.SerialNewer(serial, current.Serial()) {
+			return current, nil
+		}
+	}
+	return FetchZone(ctx, primary, s.Origin, current, s.Key)
+}
+
+// primarySerial asks primary for the zone's SOA
+func primarySerial(ctx context.Context, primary, origin string) (uint32, error) {
+	answers, err := NewForwarder(primary).Query(ctx, origin, records.TypeSOA)
+	if err != nil {
+		return 0, err
+	}
+	for _, rr := range answers {
+		if soa, ok := rr.Data.(records.SOAData); ok {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA for %s", origin)
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+// startPrimary serves store over UDP and TCP on one local port, as a
+// second instance of this server acting as primary would
+func startPrimary(t *testing.T, store *ZoneStore) string {
+	t.Helper()
+	resolver := NewDNSResolver("127.0.0.1:1")
+	resolver.ServeZones(store)
+	handler := ForwardHandler(resolver)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: ln.Addr().(*net.TCPAddr).Port})
+	if err != nil {
+		ln.Close()
+		t.Skipf("UDP port unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		ln.Close()
+		conn.Close()
+	})
+
+	go ServeTCP(ln, handler, NewTransferServer(store, localhostACL(t)))
+	go func() {
+		for {
+			buf := make([]byte, 512)
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			go HandleDNSRequest(conn, addr, buf[:n], handler)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func updateTestZone(t *testing.T, store *ZoneStore, serial, address string) {
+	t.Helper()
+	text := strings.Replace(testZoneFile, "hostmaster 1", "hostmaster "+serial, 1)
+	text = strings.Replace(text, "192.0.2.80", address, 1)
+	z, err := zone.Parse(strings.NewReader(text), "example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddZone(z, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func lookupA(t *testing.T, store *ZoneStore, name string) interface{} {
+	t.Helper()
+	answer, ok, err := store.Lookup(context.Background(), name, records.TypeA)
+	if err != nil || !ok || len(answer.Answer.Answer) == 0 {
+		t.Fatalf("Lookup of %s failed: ok=%v err=%v", name, ok, err)
+	}
+	return answer.Answer.Answer[0].Data
+}
+
+func TestSecondary_RefreshFromPrimary(t *testing.T) {
+	primaryStore := newTestStore(t, nil)
+	primary := startPrimary(t, primaryStore)
+
+	store := NewZoneStore()
+	s := NewSecondary("example.test", []string{primary}, nil, store)
+	ctx := context.Background()
+
+	if err := s.Refresh(ctx); err != nil {
+		t.Fatalf("Initial transfer failed: %v", err)
+	}
+	if got := lookupA(t, store, "www.example.test"); got != "192.0.2.80" {
+		t.Errorf("Expected the transferred record, got %v", got)
+	}
+
+	// Nothing newer: the served copy is kept as is
+	before, _ := store.zone("example.test")
+	if err := s.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := store.zone("example.test"); after != before {
+		t.Error("Zone replaced although the serial did not change")
+	}
+
+	updateTestZone(t, primaryStore, "2", "192.0.2.81")
+	if err := s.Refresh(ctx); err != nil {
+		t.Fatalf("Incremental transfer failed: %v", err)
+	}
+	if got := lookupA(t, store, "www.example.test"); got != "192.0.2.81" {
+		t.Errorf("Expected the updated record, got %v", got)
+	}
+	if served, _ := store.zone("example.test"); served.source.Serial() != 2 {
+		t.Errorf("Expected serial 2, got %d", served.source.Serial())
+	}
+}
+
+func TestSecondary_KeepsServingUntilExpire(t *testing.T) {
+	primaryStore := newTestStore(t, nil)
+	primary := startPrimary(t, primaryStore)
+
+	store := NewZoneStore()
+	s := NewSecondary("example.test", []string{primary}, nil, store)
+	if err := s.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	// Refresh 7200, retry 3600, expire 1209600 from the test SOA
+	if wait := s.timers(nil); wait != 7200*time.Second {
+		t.Errorf("Expected the refresh interval, got %v", wait)
+	}
+	failure := errors.New("primary unreachable")
+	if wait := s.timers(failure); wait != 3600*time.Second {
+		t.Errorf("Expected the retry interval, got %v", wait)
+	}
+	if _, ok := store.zone("example.test"); !ok {
+		t.Fatal("Zone must be served until it expires")
+	}
+
+	now = now.Add(1209601 * time.Second)
+	s.timers(failure)
+	if _, ok := store.zone("example.test"); ok {
+		t.Error("Expired zone is still served")
+	}
+}
+
+func TestTransferStream_IXFR(t *testing.T) {
+	soa := func(serial uint32) records.ResourceRecord {
+		return records.ResourceRecord{Name: "example.test", Type: records.TypeSOA, TTL: 300,
+			Data: records.SOAData{MName: "ns1.example.test", RName: "h.example.test", Serial: serial}}
+	}
+	a := func(name, ip string) records.ResourceRecord {
+		return records.ResourceRecord{Name: name, Type: records.TypeA, TTL: 300, Data: ip}
+	}
+
+	current := zone.New("example.test")
+	current.Add(soa(1))
+	current.Add(a("www.example.test", "192.0.2.1"))
+
+	in := &transferStream{}
+	for _, rr := range []records.ResourceRecord{
+		soa(3),
+		soa(1), a("www.example.test", "192.0.2.1"), soa(2), a("www.example.test", "192.0.2.2"),
+		soa(2), soa(3), a("mail.example.test", "192.0.2.3"),
+		soa(3),
+	} {
+		if err := in.add(rr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !in.done || len(in.deltas) != 2 {
+		t.Fatalf("Expected a complete stream of 2 deltas, done=%v deltas=%d", in.done, len(in.deltas))
+	}
+
+	z, err := in.result("example.test", current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Serial() != 3 || len(z.RRset("www.example.test", records.TypeA)) != 1 || !z.Exists("mail.example.test") {
+		t.Errorf("Unexpected zone after IXFR: %+v", z.Records())
+	}
+	if z.RRset("www.example.test", records.TypeA)[0].Data != "192.0.2.2" {
+		t.Error("Removed record still present")
+	}
+}
@@ -0,0 +1,351 @@
+// server/server.go
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// udpReadSize is the largest request read from a UDP socket, the most a
+// datagram can carry. Requests are not bound by the 512 bytes of replies:
+// UPDATE and signed messages are often larger.
+const udpReadSize = 65535
+
+// udpReadBackoff is the first wait after a failed read from a UDP socket;
+// it doubles with each failure in a row, up to a second
+const udpReadBackoff = 5 * time.Millisecond
+
+// OverloadPolicy says what happens to a datagram arriving while every
+// worker is busy and the queue is full
+type OverloadPolicy int
+
+const (
+	// OverloadDrop discards the datagram; the client retries or fails over
+	OverloadDrop OverloadPolicy = iota
+	// OverloadRefuse answers REFUSED with a bare header
+	OverloadRefuse
+)
+
+// ParseOverloadPolicy parses "drop" or "refuse"
+func ParseOverloadPolicy(s string) (OverloadPolicy, error) {
+	switch strings.ToLower(s) {
+	case "drop":
+		return OverloadDrop, nil
+	case "refuse":
+		return OverloadRefuse, nil
+	}
+	return 0, fmt.Errorf("unknown overload policy %q", s)
+}
+
+// udpRequest is a datagram waiting for a worker, copied out of the read
+// buffer into buf, which is released once it is answered; oob, when set,
+// sends the reply from the address the request came to.
+type udpRequest struct {
+	out  udpSender
+	addr *net.UDPAddr
+	oob  []byte
+	buf  *[]byte
+}
+
+// handle answers the request and recycles its buffer
+func (r udpRequest) handle(handler Handler) {
+	handleUDPRequest(r.out, r.addr, r.oob, *r.buf, handler)
+	releaseRequest(r.buf)
+}
+
+// Server answers DNS over the UDP sockets and TCP, TLS and HTTPS listeners
+// it is given. It tracks the requests and TCP sessions in flight so
+// Shutdown can stop taking new work and wait for them.
+type Server struct {
+	handler   Handler
+	transfers *TransferServer
+
+	mu        sync.Mutex
+	closing   bool
+	udpConns  map[*net.UDPConn]struct{}
+	listeners map[net.Listener]struct{}
+	tcpConns  map[net.Conn]struct{}
+	https     map[*http.Server]struct{}
+	inFlight  sync.WaitGroup
+
+	// With workers, UDP requests wait in queue for one of them
+	queue    chan udpRequest
+	overload OverloadPolicy
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewServer answers requests with handler. AXFR and IXFR requests go to
+// transfers, or are refused when it is nil.
+func NewServer(handler Handler, transfers *TransferServer) *Server {
+	return &Server{
+		handler:   handler,
+		transfers: transfers,
+		udpConns:  make(map[*net.UDPConn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+		tcpConns:  make(map[net.Conn]struct{}),
+		https:     make(map[*http.Server]struct{}),
+		stop:      make(chan struct{}),
+	}
+}
+
+// LimitWorkers answers UDP requests with a fixed number of workers
+// instead of a goroutine each. Requests wait in a queue of queueSize;
+// when it is full they are shed by overload and counted. It must be
+// called before serving.
+func (s *Server) LimitWorkers(workers, queueSize int, overload OverloadPolicy) {
+	s.queue = make(chan udpRequest, queueSize)
+	s.overload = overload
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+}
+
+func (s *Server) work() {
+	for {
+		select {
+		case req := <-s.queue:
+			req.handle(s.handler)
+			s.inFlight.Done()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// dispatch hands a tracked request to a worker, or to a new goroutine
+// without workers
+func (s *Server) dispatch(req udpRequest) {
+	if s.queue == nil {
+		go func() {
+			defer s.inFlight.Done()
+			req.handle(s.handler)
+		}()
+		return
+	}
+	select {
+	case s.queue <- req:
+	default:
+		s.shed(req)
+		releaseRequest(req.buf)
+		s.inFlight.Done()
+	}
+}
+
+// shed applies the overload policy to a request no worker can take
+func (s *Server) shed(req udpRequest) {
+	if s.overload != OverloadRefuse {
+		metrics.Add(metricOverloadDropped, 1)
+		return
+	}
+	metrics.Add(metricOverloadRefused, 1)
+	// Only queries get an answer, and without parsing more than the ID
+	if msg := *req.buf; len(msg) >= 12 && msg[2]&0x80 == 0 {
+		w := &udpWriter{conn: req.out, addr: req.addr, oob: req.oob}
+		sendErrorResponse(w, binary.BigEndian.Uint16(msg[0:2]), responseRefused)
+	}
+}
+
+// ServeUDP answers the datagrams read from conn until Shutdown, each in its
+// own goroutine or, after LimitWorkers, by the workers. Datagrams are read
+// and responses sent in batches, from the address each request came to
+// when conn is bound to a wildcard address. Shutdown closes conn once the
+// requests in flight are answered.
+func (s *Server) ServeUDP(conn *net.UDPConn) error {
+	if !s.register(func() { s.udpConns[conn] = struct{}{} }) {
+		conn.Close()
+		return nil
+	}
+	batch := newBatchConn(conn)
+	replySource := replySourceFor(conn)
+	out := newBatchSender(s, batch)
+
+	// The read buffers stay with this loop: each datagram is copied out,
+	// so a request waiting for a worker holds no more than its size
+	msgs := make([]ipv4.Message, udpBatchSize)
+	views := make([][]byte, udpBatchSize)
+	for i := range msgs {
+		views[i] = make([]byte, udpReadSize)
+		msgs[i].Buffers = views[i : i+1]
+		if replySource != nil {
+			msgs[i].OOB = make([]byte, udpOOBSize)
+		}
+	}
+	var backoff time.Duration
+	for {
+		n, err := batch.ReadBatch(msgs, 0)
+		if err != nil {
+			if s.shuttingDown() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			// Like http.Server's accept loop, wait before trying again
+			// rather than spin on a socket that keeps failing
+			backoff = min(max(2*backoff, udpReadBackoff), time.Second)
+			log.Printf("Read error: %v; retrying in %v", err, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return nil
+			}
+			continue
+		}
+		backoff = 0
+
+		for i := 0; i < n; i++ {
+			clientAddr, ok := msgs[i].Addr.(*net.UDPAddr)
+			if !ok {
+				continue
+			}
+			if msgs[i].Flags&msgTrunc != 0 {
+				log.Printf("Dropping a truncated datagram from %v", clientAddr)
+				continue
+			}
+			if !s.track() {
+				return nil
+			}
+			var oob []byte
+			if replySource != nil && msgs[i].NN > 0 {
+				oob = replySource(msgs[i].OOB[:msgs[i].NN])
+			}
+			s.dispatch(udpRequest{out: out, addr: clientAddr, oob: oob, buf: copyRequest(views[i][:msgs[i].N])})
+		}
+	}
+}
+
+// ServeTCP answers DNS over TCP (RFC 7766) until ln is closed or Shutdown
+// is called. Queries on a connection are answered in order.
+func (s *Server) ServeTCP(ln net.Listener) error {
+	if !s.register(func() { s.listeners[ln] = struct{}{} }) {
+		ln.Close()
+		return nil
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.shuttingDown() || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !s.register(func() { s.tcpConns[conn] = struct{}{} }) {
+			conn.Close()
+			return nil
+		}
+		s.inFlight.Add(1)
+		go func() {
+			defer s.inFlight.Done()
+			defer s.forget(conn)
+			s.serveTCPConn(conn)
+		}()
+	}
+}
+
+// Shutdown stops reading requests and accepting connections, then waits
+// for the requests in flight and the TCP sessions to finish. Idle TCP
+// sessions are closed at once, busy ones after their current request.
+// When ctx is done first the remaining connections are closed and
+// ctx.Err() is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	now := time.Now()
+	for conn := range s.udpConns {
+		conn.SetReadDeadline(now)
+	}
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.tcpConns {
+		conn.SetReadDeadline(now)
+	}
+	s.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.inFlight.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+		s.mu.Lock()
+		for conn := range s.tcpConns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+	}
+
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.udpConns {
+		conn.Close()
+	}
+	for hs := range s.https {
+		hs.Close()
+	}
+	return err
+}
+
+// register runs add under the lock unless the server is shutting down
+func (s *Server) register(add func()) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	add()
+	return true
+}
+
+// track counts a new request in flight unless the server is shutting
+// down. Checking under the lock keeps Add from racing with the Wait in
+// Shutdown.
+func (s *Server) track() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.inFlight.Add(1)
+	return true
+}
+
+func (s *Server) forget(conn net.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.tcpConns, conn)
+	s.mu.Unlock()
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closing
+}
+
+// awaitRequest sets the idle deadline for the next request on a TCP
+// session, or reports that the session should end. Shutdown expires the
+// deadlines under the same lock, so it cannot be pushed back afterwards.
+func (s *Server) awaitRequest(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	conn.SetReadDeadline(time.Now().Add(tcpIdleTimeout))
+	return true
+}
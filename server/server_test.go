@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// blockingHandler answers once release is closed, signalling started first
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	h.started <- struct{}{}
+	<-h.release
+	w.WriteMsg(req.Reply())
+}
+
+func startServer(t *testing.T, handler Handler, options ...func(*Server)) (*Server, *net.UDPConn, net.Listener) {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	srv := NewServer(handler, nil)
+	for _, option := range options {
+		option(srv)
+	}
+	go srv.ServeUDP(conn)
+	go srv.ServeTCP(ln)
+	t.Cleanup(func() {
+		conn.Close()
+		ln.Close()
+	})
+	return srv, conn, ln
+}
+
+func TestServer_ShutdownDrainsRequests(t *testing.T) {
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	srv, conn, ln := startServer(t, handler)
+
+	// An idle TCP session must not hold up the shutdown
+	idle, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	query, err := queryMsg("example.test", records.TypeA).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write(query); err != nil {
+		t.Fatal(err)
+	}
+	<-handler.started
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with a request in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	// The request in flight was answered before the socket closed
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("no response to the request in flight: %v", err)
+	}
+	if resp, err := UnpackMsg(buf[:n]); err != nil || resp.ID != 1 {
+		t.Errorf("response = %+v, %v", resp, err)
+	}
+
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := idle.Read(buf); err == nil {
+		t.Error("idle TCP session still open after shutdown")
+	}
+	if _, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Error("TCP listener still accepting after shutdown")
+	}
+}
+
+func TestServer_ShutdownDeadline(t *testing.T) {
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer close(handler.release)
+	srv, _, ln := startServer(t, handler)
+
+	session, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	query, err := queryMsg("example.test", records.TypeA).Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&tcpWriter{conn: session}).WritePacked(query); err != nil {
+		t.Fatal(err)
+	}
+	<-handler.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want the deadline exceeded", err)
+	}
+	session.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := session.Read(make([]byte, 1)); err == nil {
+		t.Error("busy TCP session still open after the deadline")
+	}
+}
+
+// counter reads one of the expvar counters
+func counter(name string) int64 {
+	if v, ok := metrics.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestServer_WorkersShedLoad(t *testing.T) {
+	handler := &blockingHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	_, conn, _ := startServer(t, handler, func(srv *Server) { srv.LimitWorkers(1, 1, OverloadRefuse) })
+	refused := counter(metricOverloadRefused)
+
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	send := func(id uint16) {
+		req := queryMsg("example.test", records.TypeA)
+		req.ID = id
+		query, err := req.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Write(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() *Msg {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 512)
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("no response: %v", err)
+		}
+		resp, err := UnpackMsg(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// The worker takes the first request and the second waits in the
+	// queue, so the third is refused at once
+	send(1)
+	<-handler.started
+	send(2)
+	time.Sleep(20 * time.Millisecond)
+	send(3)
+	if resp := receive(); resp.ID != 3 || resp.Rcode != rcodeRefused {
+		t.Errorf("response = %+v, want REFUSED for request 3", resp)
+	}
+	if got := counter(metricOverloadRefused) - refused; got != 1 {
+		t.Errorf("overload_refused grew by %d, want 1", got)
+	}
+
+	close(handler.release)
+	for _, want := range []uint16{1, 2} {
+		if resp := receive(); resp.ID != want || resp.Rcode != 0 {
+			t.Errorf("response = %+v, want an answer to request %d", resp, want)
+		}
+	}
+}
@@ -5,21 +5,28 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
 )
 
 // ResolutionStrategy defines a DNS resolution method
 type ResolutionStrategy interface {
-	Resolve(domain string) (string, error)
+	Resolve(domain string) (interface{}, error)
 }
 
 // Forwarder handles upstream DNS queries
 type Forwarder struct {
+	upstream string
 	resolver *net.Resolver
+	key      *tsig.Key
 }
 
 // NewForwarder initializes a new Forwarder
 func NewForwarder(upstream string) *Forwarder {
 	return &Forwarder{
+		upstream: upstream,
 		resolver: &net.Resolver{
 			PreferGo: true,
 			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
@@ -30,6 +37,12 @@ func NewForwarder(upstream string) *Forwarder {
 	}
 }
 
+// SignWith signs the queries sent by Exchange with key and rejects answers
+// not signed with it. Lookups through the Go resolver are not signed.
+func (f *Forwarder) SignWith(key *tsig.Key) {
+	f.key = key
+}
+
 // IPResolution is a generic resolver that filters IP addresses
 type IPResolution struct {
 	forwarder *Forwarder
@@ -42,7 +55,7 @@ func NewIPResolution(f *Forwarder, filterFunc func(net.IP) bool) *IPResolution {
 }
 
 // Resolve filters the resolved IP addresses based on the provided filter function
-func (r *IPResolution) Resolve(domain string) (string, error) {
+func (r *IPResolution) Resolve(domain string) (interface{}, error) {
 	addrs, err := r.forwarder.resolver.LookupIPAddr(context.Background(), domain)
 	if err != nil {
 		return "", err
@@ -55,6 +68,38 @@ func (r *IPResolution) Resolve(domain string) (string, error) {
 	return "", errors.New("no valid record found")
 }
 
+// SRVResolution looks up service records through the forwarder
+type SRVResolution struct {
+	forwarder *Forwarder
+}
+
+// NewSRVResolution creates a new instance of SRVResolution
+func NewSRVResolution(f *Forwarder) *SRVResolution {
+	return &SRVResolution{forwarder: f}
+}
+
+// Resolve returns every SRV record of the domain, e.g. "_grpc._tcp.svc.internal"
+func (r *SRVResolution) Resolve(domain string) (interface{}, error) {
+	_, addrs, err := r.forwarder.resolver.LookupSRV(context.Background(), "", "", domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, errors.New("no valid record found")
+	}
+
+	answers := make([]interface{}, 0, len(addrs))
+	for _, addr := range addrs {
+		answers = append(answers, records.SRVData{
+			Priority: addr.Priority,
+			Weight:   addr.Weight,
+			Port:     addr.Port,
+			Target:   strings.TrimSuffix(addr.Target, "."),
+		})
+	}
+	return answers, nil
+}
+
 // Helper functions for filtering IP addresses
 func isIPv4(ip net.IP) bool {
 	return ip.To4() != nil
@@ -63,3 +108,45 @@ func isIPv4(ip net.IP) bool {
 func isIPv6(ip net.IP) bool {
 	return ip.To16() != nil && ip.To4() == nil
 }
+
+// WireResolution forwards the query as-is and decodes the upstream answers.
+// It serves every record type without a dedicated strategy, falling back to
+// opaque RFC 3597 data for types without a handler.
+type WireResolution struct {
+	forwarder *Forwarder
+	qtype     uint16
+}
+
+// NewWireResolution creates a new instance of WireResolution for qtype
+func NewWireResolution(f *Forwarder, qtype uint16) *WireResolution {
+	return &WireResolution{forwarder: f, qtype: qtype}
+}
+
+// Resolve returns the answers of the requested type, one value or a []interface{}
+func (r *WireResolution) Resolve(domain string) (interface{}, error) {
+	rrs, err := r.forwarder.Query(context.Background(), domain, r.qtype)
+	if err != nil {
+		return nil, err
+	}
+	return answersOfType(rrs, r.qtype)
+}
+
+// answersOfType keeps the records of qtype (dropping e.g. the CNAME chain
+// that led to them) and returns one value or a []interface{}
+func answersOfType(rrs []records.ResourceRecord, qtype uint16) (interface{}, error) {
+	var answers []interface{}
+	for _, rr := range rrs {
+		if rr.Type == qtype {
+			answers = append(answers, rr.Data)
+		}
+	}
+
+	switch len(answers) {
+	case 0:
+		return nil, errors.New("no valid record found")
+	case 1:
+		return answers[0], nil
+	default:
+		return answers, nil
+	}
+}
@@ -0,0 +1,123 @@
+// server/tcp.go
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+const (
+	tcpIdleTimeout  = 10 * time.Second
+	tcpWriteTimeout = 30 * time.Second
+)
+
+// tcpWriter frames responses with the two byte length prefix of
+// RFC 1035 section 4.2.2
+type tcpWriter struct {
+	conn net.Conn
+}
+
+func (w *tcpWriter) WriteMsg(m *Msg) error {
+	msg, err := packTruncated(m, w.MaxSize())
+	if err != nil {
+		return err
+	}
+	return w.WritePacked(msg)
+}
+
+func (w *tcpWriter) WritePacked(msg []byte) error {
+	if len(msg) > 0xFFFF {
+		return errors.New("message exceeds 65535 bytes")
+	}
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, len(msg)+2), uint16(len(msg)))
+	framed = append(framed, msg...)
+	w.conn.SetWriteDeadline(time.Now().Add(tcpWriteTimeout))
+	_, err := w.conn.Write(framed)
+	return err
+}
+
+func (w *tcpWriter) RemoteAddr() net.Addr { return w.conn.RemoteAddr() }
+
+func (w *tcpWriter) MaxSize() int {
+	return 0xFFFF
+}
+
+// ServeTCP answers DNS over TCP (RFC 7766) until ln is closed. Queries on a
+// connection are answered in order. AXFR and IXFR requests go to
+// transfers, or are refused when it is nil.
+func ServeTCP(ln net.Listener, handler Handler, transfers *TransferServer) error {
+	return NewServer(handler, transfers).ServeTCP(ln)
+}
+
+// ServeDoT answers DNS over TLS (RFC 7858) on ln with the certificates of
+// config, as ServeTCP does over plain TCP. The handshake runs on the
+// first read, under the idle timeout.
+func (s *Server) ServeDoT(ln net.Listener, config *tls.Config) error {
+	config = config.Clone()
+	config.NextProtos = []string{"dot"}
+	return s.ServeTCP(tls.NewListener(ln, config))
+}
+
+func (s *Server) serveTCPConn(conn net.Conn) {
+	w := &tcpWriter{conn: conn}
+	clientIP := remoteIP(conn.RemoteAddr())
+
+	for s.awaitRequest(conn) {
+		request, err := readTCPMessage(conn)
+		if err != nil {
+			var netErr net.Error
+			if !errors.Is(err, io.EOF) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+				log.Printf("TCP read error from %s: %v", clientIP, err)
+			}
+			return
+		}
+
+		txnID, _, _, qtype, err := parseRequest(request)
+		if err == nil && (qtype == records.TypeAXFR || qtype == records.TypeIXFR) {
+			if s.transfers == nil {
+				sendErrorResponse(w, txnID, responseRefused)
+				continue
+			}
+			s.transfers.serve(w, clientIP, request)
+			continue
+		}
+
+		ctx := &requestContext{Context: context.Background(), clientIP: clientIP}
+		serveRequest(ctx, w, new(msgStorage), request, s.handler)
+	}
+}
+
+// readTCPMessage reads one length-prefixed message
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func remoteIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
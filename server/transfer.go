@@ -0,0 +1,242 @@
+// server/transfer.go
+package server
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+// Transfer messages are filled up to this size before starting the next
+const transferMessageSize = 16 * 1024
+
+var errNotAuthoritative = errors.New("not authoritative for zone")
+
+// TransferACL decides who may transfer zones: the client address must be
+// in Allow and, when Keys is not empty, the request must be TSIG signed
+// with one of them
+type TransferACL struct {
+	Allow []*net.IPNet
+	Keys  tsig.Keyring
+}
+
+// ParseNetworks parses a comma separated list of IP addresses and CIDR prefixes
+func ParseNetworks(spec string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+func (a TransferACL) allows(ip net.IP) bool {
+	for _, network := range a.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TransferServer answers AXFR (RFC 5936) and IXFR (RFC 1995) requests for
+// the zones of a store
+type TransferServer struct {
+	zones *ZoneStore
+	acl   TransferACL
+}
+
+// NewTransferServer creates a transfer server restricted by acl
+func NewTransferServer(zones *ZoneStore, acl TransferACL) *TransferServer {
+	return &TransferServer{zones: zones, acl: acl}
+}
+
+// serve answers one transfer request, streaming the zone as one or more
+// messages through w
+func (t *TransferServer) serve(w ResponseWriter, clientIP net.IP, request []byte) {
+	txnID, _, domain, qtype, err := parseRequest(request)
+	if err != nil {
+		handleError(w, txnID, "Transfer request parsing", err)
+		return
+	}
+
+	if !t.acl.allows(clientIP) {
+		log.Printf("[XFR] Refused %s of %s to %s: address not allowed", records.TypeName(qtype), domain, clientIP)
+		sendErrorResponse(w, txnID, responseRefused)
+		return
+	}
+
+	var stream *tsig.Stream
+	if len(t.acl.Keys) > 0 {
+		rec, err := tsig.Verify(request, t.acl.Keys, nil, time.Now())
+		if err != nil {
+			log.Printf("[XFR] Refused %s of %s to %s: %v", records.TypeName(qtype), domain, clientIP, err)
+			if rec == nil || tsig.ErrorCode(err) == 0 {
+				sendErrorResponse(w, txnID, responseRefused)
+				return
+			}
+			sendTSIGError(w, txnID, domain, qtype, rec, t.acl.Keys, err)
+			return
+		}
+		key, _ := t.acl.Keys.Get(rec.KeyName)
+		stream = tsig.NewStream(key, rec.MAC)
+	}
+
+	serial, incremental := requestSOASerial(request)
+	rrs, err := t.zones.transferRecords(domain, qtype == records.TypeIXFR && incremental, serial)
+	if errors.Is(err, errNotAuthoritative) {
+		log.Printf("[XFR] Refused %s of %s to %s: %v", records.TypeName(qtype), domain, clientIP, err)
+		sendErrorResponse(w, txnID, responseNotAuth)
+		return
+	}
+	if err != nil {
+		handleError(w, txnID, "Transfer", err)
+		return
+	}
+
+	messages, err := packTransfer(txnID, domain, qtype, rrs)
+	if err != nil {
+		handleError(w, txnID, "Transfer", err)
+		return
+	}
+	for _, msg := range messages {
+		if stream != nil {
+			if msg, err = stream.Sign(msg); err != nil {
+				log.Printf("[XFR] Signing failed: %v", err)
+				return
+			}
+		}
+		if err := w.WritePacked(msg); err != nil {
+			log.Printf("[XFR] Transfer of %s to %s aborted: %v", domain, clientIP, err)
+			return
+		}
+	}
+	log.Printf("[XFR] Sent %s of %s to %s: %d records in %d messages", records.TypeName(qtype), domain, clientIP, len(rrs), len(messages))
+}
+
+// sendTSIGError answers a request whose signature failed verification
+// with NOTAUTH and the TSIG error code
+func sendTSIGError(w ResponseWriter, txnID uint16, domain string, qtype uint16, rec *tsig.Record, keys tsig.Keyring, verifyErr error) {
+	b := NewDNSResponseBuilder(txnID, flagQR|rcodeNotAuth)
+	if err := b.WithQuestion(domain, qtype); err != nil {
+		handleError(w, txnID, "TSIG error response", err)
+		return
+	}
+	msg, err := tsig.AppendError(b.Build(), rec, keys, verifyErr, time.Now())
+	if err != nil {
+		handleError(w, txnID, "TSIG error response", err)
+		return
+	}
+	if err := w.WritePacked(msg); err != nil {
+		log.Printf("Error sending TSIG error response: %v", err)
+	}
+}
+
+// requestSOASerial returns the serial of the SOA an IXFR request carries
+// in its authority section
+func requestSOASerial(request []byte) (uint32, bool) {
+	var names records.BaseHandler
+	_, pos, err := names.ReadDomainName(request, 12)
+	if err != nil {
+		return 0, false
+	}
+	count := int(binary.BigEndian.Uint16(request[6:8])) + int(binary.BigEndian.Uint16(request[8:10]))
+	rrs, _, err := unpackSection(request, pos+4, count)
+	if err != nil {
+		return 0, false
+	}
+	for _, rr := range rrs {
+		if soa, ok := rr.Data.(records.SOAData); ok {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
+
+// transferRecords returns the record stream of a transfer of the zone at
+// origin. Incremental transfers from serial use the journal and fall back
+// to the full zone when it does not reach back that far.
+func (s *ZoneStore) transferRecords(origin string, incremental bool, serial uint32) ([]records.ResourceRecord, error) {
+	served, ok := s.zone(origin)
+	if !ok {
+		return nil, fmt.Errorf("%w %s", errNotAuthoritative, origin)
+	}
+	soa, current, err := served.source.SOA()
+	if err != nil {
+		return nil, err
+	}
+
+	if incremental {
+		if !zone.SerialNewer(current.Serial, serial) {
+			return []records.ResourceRecord{soa}, nil
+		}
+		if deltas, ok := served.journal.Since(serial); ok {
+			rrs := []records.ResourceRecord{soa}
+			for _, d := range deltas {
+				rrs = append(rrs, d.OldSOA)
+				rrs = append(rrs, d.Removed...)
+				rrs = append(rrs, d.NewSOA)
+				rrs = append(rrs, d.Added...)
+			}
+			return append(rrs, soa), nil
+		}
+	}
+	return append(served.source.Records(), soa), nil
+}
+
+// packTransfer encodes the record stream into messages with the record
+// handlers, each message compressed on its own
+func packTransfer(txnID uint16, domain string, qtype uint16, rrs []records.ResourceRecord) ([][]byte, error) {
+	var messages [][]byte
+	var b *DNSResponseBuilder
+	for _, rr := range rrs {
+		if b == nil {
+			b = NewDNSResponseBuilder(txnID, flagQR|flagAA)
+			if err := b.WithQuestion(domain, qtype); err != nil {
+				return nil, fmt.Errorf("failed to add question: %w", err)
+			}
+		}
+		handler, err := zoneRecordHandler(rr)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.WithAnswer(rr.Name, handler, rr.Data, rr.TTL); err != nil {
+			return nil, fmt.Errorf("failed to add %s record %s: %w", records.TypeName(rr.Type), rr.Name, err)
+		}
+		if b.position >= transferMessageSize {
+			messages = append(messages, b.Build())
+			b = nil
+		}
+	}
+	if b != nil {
+		messages = append(messages, b.Build())
+	}
+	return messages, nil
+}
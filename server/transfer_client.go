@@ -0,0 +1,230 @@
+// server/transfer_client.go
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+var errIncompleteTransfer = errors.New("transfer ended before the closing SOA")
+
+// FetchZone transfers origin from primary over TCP. Given the current copy
+// it asks for an IXFR from its serial and applies the deltas, falling back
+// to AXFR when the primary refuses or cannot answer incrementally. It
+// returns current unchanged when the primary has nothing newer.
+func FetchZone(ctx context.Context, primary, origin string, current *zone.Zone, key *tsig.Key) (*zone.Zone, error) {
+	if current != nil {
+		z, err := fetchZone(ctx, primary, origin, current, key)
+		if err == nil {
+			return z, nil
+		}
+	}
+	return fetchZone(ctx, primary, origin, nil, key)
+}
+
+func fetchZone(ctx context.Context, primary, origin string, current *zone.Zone, key *tsig.Key) (*zone.Zone, error) {
+	var soa *records.ResourceRecord
+	if current != nil {
+		rr, _, err := current.SOA()
+		if err != nil {
+			return nil, err
+		}
+		soa = &rr
+	}
+	query, err := buildTransferQuery(queryID(), origin, soa)
+	if err != nil {
+		return nil, err
+	}
+
+	var stream *tsig.Stream
+	if key != nil {
+		signed, mac, err := tsig.Sign(query, *key, nil, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		query, stream = signed, tsig.NewStream(*key, mac)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", primary)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	w := &tcpWriter{conn: conn}
+	if err := w.WritePacked(query); err != nil {
+		return nil, err
+	}
+
+	in := &transferStream{}
+	for first := true; !in.done; first = false {
+		msg, err := readTCPMessage(conn)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errIncompleteTransfer, err)
+		}
+		if len(msg) < 12 || !bytes.Equal(msg[0:2], query[0:2]) {
+			return nil, errors.New("transfer answered with a mismatched transaction ID")
+		}
+		if stream != nil {
+			if err := stream.Verify(msg); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := parseResponse(msg)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Rcode != 0 {
+			return nil, fmt.Errorf("transfer of %s refused with rcode %d", origin, resp.Rcode)
+		}
+		for _, rr := range resp.Answer {
+			if err := in.add(rr); err != nil {
+				return nil, err
+			}
+		}
+		// A first message holding only the SOA means we are up to date
+		if first && current != nil && in.upToDate() {
+			return current, nil
+		}
+	}
+	return in.result(origin, current)
+}
+
+// buildTransferQuery asks for an AXFR, or an IXFR from soa's serial when
+// soa is given (RFC 1995 section 3)
+func buildTransferQuery(id uint16, origin string, soa *records.ResourceRecord) ([]byte, error) {
+	qtype := uint16(records.TypeAXFR)
+	if soa != nil {
+		qtype = records.TypeIXFR
+	}
+	query, err := buildQuery(id, origin, qtype)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(query[2:4], 0) // no recursion
+	if soa == nil {
+		return query, nil
+	}
+
+	rr, err := (&records.SOARecord{}).BuildAnswer(origin, soa.Data, soa.TTL)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(query[8:10], 1)
+	return append(query, rr.Bytes()...), nil
+}
+
+// Transfer stream parser states
+const (
+	xfrStart = iota
+	xfrSecond
+	xfrFull
+	xfrRemoved
+	xfrAdded
+)
+
+// transferStream reassembles the records of an AXFR or IXFR response,
+// telling the two IXFR forms apart by the second record
+type transferStream struct {
+	state  int
+	soa    records.ResourceRecord
+	full   []records.ResourceRecord
+	deltas []zone.Delta
+	delta  zone.Delta
+	done   bool
+}
+
+func (s *transferStream) add(rr records.ResourceRecord) error {
+	if s.done {
+		return errors.New("records after the closing SOA")
+	}
+	isSOA := rr.Type == records.TypeSOA
+
+	switch s.state {
+	case xfrStart:
+		if !isSOA {
+			return errors.New("transfer does not start with an SOA")
+		}
+		s.soa, s.state = rr, xfrSecond
+	case xfrSecond:
+		switch {
+		case isSOA && soaSerial(rr) == soaSerial(s.soa):
+			s.full, s.done = []records.ResourceRecord{s.soa}, true
+		case isSOA:
+			s.delta, s.state = zone.Delta{OldSOA: rr}, xfrRemoved
+		default:
+			s.full, s.state = []records.ResourceRecord{s.soa, rr}, xfrFull
+		}
+	case xfrFull:
+		if isSOA {
+			s.done = true
+			return nil
+		}
+		s.full = append(s.full, rr)
+	case xfrRemoved:
+		if isSOA {
+			s.delta.NewSOA, s.state = rr, xfrAdded
+			return nil
+		}
+		s.delta.Removed = append(s.delta.Removed, rr)
+	case xfrAdded:
+		if !isSOA {
+			s.delta.Added = append(s.delta.Added, rr)
+			return nil
+		}
+		s.deltas = append(s.deltas, s.delta)
+		if soaSerial(s.delta.NewSOA) == soaSerial(s.soa) && soaSerial(rr) == soaSerial(s.soa) {
+			s.done = true
+			return nil
+		}
+		s.delta, s.state = zone.Delta{OldSOA: rr}, xfrRemoved
+	}
+	return nil
+}
+
+func (s *transferStream) upToDate() bool {
+	return s.state == xfrSecond
+}
+
+// result builds the transferred zone, applying deltas to current
+func (s *transferStream) result(origin string, current *zone.Zone) (*zone.Zone, error) {
+	if s.deltas == nil {
+		z := zone.New(origin)
+		for _, rr := range s.full {
+			if err := z.Add(rr); err != nil {
+				return nil, err
+			}
+		}
+		return z, z.Validate()
+	}
+
+	if current == nil {
+		return nil, errors.New("incremental transfer without a current zone")
+	}
+	z := current
+	for _, d := range s.deltas {
+		next, err := d.Apply(z)
+		if err != nil {
+			return nil, err
+		}
+		z = next
+	}
+	return z, z.Validate()
+}
+
+func soaSerial(rr records.ResourceRecord) uint32 {
+	soa, _ := rr.Data.(records.SOAData)
+	return soa.Serial
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+func startTransferServer(t *testing.T, store *ZoneStore, acl TransferACL) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go ServeTCP(ln, ForwardHandler(NewDNSResolver("127.0.0.1:1")), NewTransferServer(store, acl))
+	return ln.Addr().String()
+}
+
+func localhostACL(t *testing.T) TransferACL {
+	t.Helper()
+	allow, err := ParseNetworks("127.0.0.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return TransferACL{Allow: allow}
+}
+
+// ixfrQuery asks for the changes since serial (RFC 1995 section 3)
+func ixfrQuery(t *testing.T, origin string, serial uint32) []byte {
+	t.Helper()
+	query, err := buildQuery(7, origin, records.TypeIXFR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	soa, err := (&records.SOARecord{}).BuildAnswer(origin, records.SOAData{MName: "ns1." + origin, RName: "hostmaster." + origin, Serial: serial}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.BigEndian.PutUint16(query[8:10], 1)
+	return append(query, soa.Bytes()...)
+}
+
+// exchangeTransfer sends request and collects the answer records until
+// the closing SOA, decoding each message with verify when set
+func exchangeTransfer(t *testing.T, addr string, request []byte, verify func([]byte) error) (uint16, []records.ResourceRecord) {
+	t.Helper()
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := (&tcpWriter{conn: conn}).WritePacked(request); err != nil {
+		t.Fatal(err)
+	}
+
+	var rrs []records.ResourceRecord
+	for {
+		msg, err := readTCPMessage(conn)
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if verify != nil {
+			if err := verify(msg); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+		}
+		resp, err := parseResponse(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Rcode != 0 {
+			return resp.Rcode, nil
+		}
+		rrs = append(rrs, resp.Answer...)
+
+		// Done on a lone SOA (up to date) or once the first SOA is repeated
+		last := rrs[len(rrs)-1]
+		if len(rrs) == 1 || last.Type == records.TypeSOA && serialOf(last) == serialOf(rrs[0]) {
+			return 0, rrs
+		}
+	}
+}
+
+func serialOf(rr records.ResourceRecord) uint32 {
+	return rr.Data.(records.SOAData).Serial
+}
+
+func TestTransfer_AXFR(t *testing.T) {
+	store := newTestStore(t, nil)
+	addr := startTransferServer(t, store, localhostACL(t))
+
+	query, err := buildQuery(1, "example.test", records.TypeAXFR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rcode, rrs := exchangeTransfer(t, addr, query, nil)
+	if rcode != 0 {
+		t.Fatalf("AXFR failed with rcode %d", rcode)
+	}
+
+	z, _ := zone.Parse(strings.NewReader(testZoneFile), "example.test.")
+	if want := len(z.Records()) + 1; len(rrs) != want {
+		t.Fatalf("Expected %d records, got %d: %+v", want, len(rrs), rrs)
+	}
+	if rrs[0].Type != records.TypeSOA || rrs[len(rrs)-1].Type != records.TypeSOA {
+		t.Error("AXFR must start and end with the SOA")
+	}
+}
+
+func TestTransfer_IXFR(t *testing.T) {
+	store := newTestStore(t, nil)
+	updated := strings.Replace(testZoneFile, "hostmaster 1", "hostmaster 2", 1)
+	updated = strings.Replace(updated, "192.0.2.80", "192.0.2.81", 1)
+	z, err := zone.Parse(strings.NewReader(updated), "example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddZone(z, nil); err != nil {
+		t.Fatal(err)
+	}
+	addr := startTransferServer(t, store, localhostACL(t))
+
+	_, rrs := exchangeTransfer(t, addr, ixfrQuery(t, "example.test", 1), nil)
+	// SOA 2, SOA 1, removed A, SOA 2, added A, SOA 2
+	if len(rrs) != 6 {
+		t.Fatalf("Expected an incremental transfer of 6 records, got %+v", rrs)
+	}
+	if serialOf(rrs[1]) != 1 || rrs[2].Data != "192.0.2.80" || serialOf(rrs[3]) != 2 || rrs[4].Data != "192.0.2.81" {
+		t.Errorf("Unexpected IXFR sequence %+v", rrs)
+	}
+
+	_, rrs = exchangeTransfer(t, addr, ixfrQuery(t, "example.test", 2), nil)
+	if len(rrs) != 1 || serialOf(rrs[0]) != 2 {
+		t.Errorf("Up to date client should get only the SOA, got %+v", rrs)
+	}
+
+	// Serials the journal does not know fall back to a full transfer
+	_, rrs = exchangeTransfer(t, addr, ixfrQuery(t, "example.test", 0), nil)
+	if len(rrs) != len(z.Records())+1 {
+		t.Errorf("Expected AXFR fallback, got %+v", rrs)
+	}
+}
+
+func TestTransfer_Refused(t *testing.T) {
+	store := newTestStore(t, nil)
+	allow, _ := ParseNetworks("192.0.2.0/24")
+	addr := startTransferServer(t, store, TransferACL{Allow: allow})
+
+	query, _ := buildQuery(1, "example.test", records.TypeAXFR)
+	if rcode, _ := exchangeTransfer(t, addr, query, nil); rcode != 5 {
+		t.Errorf("Expected REFUSED for a client outside the allow-list, got %d", rcode)
+	}
+
+	addr = startTransferServer(t, store, localhostACL(t))
+	query, _ = buildQuery(1, "other.test", records.TypeAXFR)
+	if rcode, _ := exchangeTransfer(t, addr, query, nil); rcode != 9 {
+		t.Errorf("Expected NOTAUTH for an unknown zone, got %d", rcode)
+	}
+}
+
+func TestTransfer_TSIG(t *testing.T) {
+	key, err := tsig.ParseKey("xfr-key:c2VjcmV0LXNlY3JldC1zZWNyZXQ=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl := localhostACL(t)
+	acl.Keys = tsig.Keyring{}
+	acl.Keys.Add(key)
+	addr := startTransferServer(t, newTestStore(t, nil), acl)
+
+	query, _ := buildQuery(1, "example.test", records.TypeAXFR)
+	if rcode, _ := exchangeTransfer(t, addr, query, nil); rcode != 5 {
+		t.Errorf("Expected REFUSED for an unsigned request, got %d", rcode)
+	}
+
+	signed, mac, err := tsig.Sign(query, key, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := tsig.NewStream(key, mac)
+	if rcode, rrs := exchangeTransfer(t, addr, signed, stream.Verify); rcode != 0 || len(rrs) == 0 {
+		t.Errorf("Signed transfer failed: rcode %d, %d records", rcode, len(rrs))
+	}
+}
+
+func TestPackTransfer_SplitsMessages(t *testing.T) {
+	z := zone.New("big.test")
+	z.Add(records.ResourceRecord{Name: "big.test", Type: records.TypeSOA, TTL: 300, Data: records.SOAData{MName: "ns.big.test", RName: "h.big.test", Serial: 1}})
+	for i := 0; i < 2000; i++ {
+		z.Add(records.ResourceRecord{Name: "big.test", Type: records.TypeTXT, TTL: 300, Data: []string{strings.Repeat("x", 20) + string(rune('a'+i%26)) + strings.Repeat("y", i%50)}})
+	}
+
+	messages, err := packTransfer(1, "big.test", records.TypeAXFR, z.Records())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) < 2 {
+		t.Fatalf("Expected the zone to span several messages, got %d", len(messages))
+	}
+	total := 0
+	for _, msg := range messages {
+		if len(msg) > 0xFFFF {
+			t.Errorf("Message of %d bytes exceeds the TCP limit", len(msg))
+		}
+		total += int(binary.BigEndian.Uint16(msg[6:8]))
+	}
+	if total != len(z.Records()) {
+		t.Errorf("Expected %d records across messages, got %d", len(z.Records()), total)
+	}
+}
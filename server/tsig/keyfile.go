@@ -0,0 +1,123 @@
+package tsig
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// LoadKeyring reads the keys of a BIND style key file, as written by
+// tsig-keygen:
+//
+//	key "update.example.com" {
+//		algorithm hmac-sha256;
+//		secret "base64";
+//	};
+func LoadKeyring(path string) (Keyring, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	keys, err := ParseKeyring(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// ParseKeyring parses key statements, ignoring #, // and /* */ comments
+func ParseKeyring(r io.Reader) (Keyring, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := keyfileTokens(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := Keyring{}
+	for len(tokens) > 0 {
+		if len(tokens) < 3 || tokens[0] != "key" || tokens[2] != "{" {
+			return nil, fmt.Errorf("tsig: expected key \"name\" { ... }; near %q", strings.Join(tokens[:min(len(tokens), 3)], " "))
+		}
+		name := tokens[1]
+		tokens = tokens[3:]
+
+		var algorithm, secret string
+		for len(tokens) > 0 && tokens[0] != "}" {
+			if len(tokens) < 3 || tokens[2] != ";" {
+				return nil, fmt.Errorf("tsig: key %s: expected option value;", name)
+			}
+			switch tokens[0] {
+			case "algorithm":
+				algorithm = tokens[1]
+			case "secret":
+				secret = tokens[1]
+			default:
+				return nil, fmt.Errorf("tsig: key %s: unknown option %q", name, tokens[0])
+			}
+			tokens = tokens[3:]
+		}
+		if len(tokens) < 2 || tokens[1] != ";" {
+			return nil, fmt.Errorf("tsig: key %s is not terminated by };", name)
+		}
+		tokens = tokens[2:]
+
+		if algorithm == "" || secret == "" {
+			return nil, fmt.Errorf("tsig: key %s needs an algorithm and a secret", name)
+		}
+		key, err := NewKey(name, algorithm, secret)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := keys.Get(key.Name); dup {
+			return nil, fmt.Errorf("tsig: key %s defined twice", key.Name)
+		}
+		keys.Add(key)
+	}
+	return keys, nil
+}
+
+// keyfileTokens splits a key file into words, quoted strings and the
+// punctuation { } ;
+func keyfileTokens(text string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '#' || strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("tsig: unterminated comment")
+			}
+			i += end + 4
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("tsig: unterminated string")
+			}
+			tokens = append(tokens, text[i+1:i+1+end])
+			i += end + 2
+		default:
+			start := i
+			for i < len(text) && !unicode.IsSpace(rune(text[i])) && !strings.ContainsRune("{};\"#", rune(text[i])) {
+				i++
+			}
+			tokens = append(tokens, text[start:i])
+		}
+	}
+	return tokens, nil
+}
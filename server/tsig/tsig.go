@@ -0,0 +1,430 @@
+// Package tsig signs and verifies DNS messages with shared secret
+// transaction signatures (RFC 8945).
+package tsig
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Algorithm names (RFC 8945 section 6)
+const (
+	HMACSHA256 = "hmac-sha256"
+	HMACSHA384 = "hmac-sha384"
+	HMACSHA512 = "hmac-sha512"
+)
+
+// DefaultFudge is the permitted clock skew in seconds
+const DefaultFudge = 300
+
+// Extended error codes carried in the TSIG record (RFC 8945 section 3)
+const (
+	RcodeBadSig  = 16
+	RcodeBadKey  = 17
+	RcodeBadTime = 18
+)
+
+var (
+	ErrNoSignature = errors.New("tsig: message is not signed")
+	ErrFormat      = errors.New("tsig: malformed TSIG record")
+	ErrBadKey      = errors.New("tsig: unknown key or algorithm")
+	ErrBadSig      = errors.New("tsig: signature mismatch")
+	ErrBadTime     = errors.New("tsig: signing time outside fudge")
+)
+
+var algorithms = map[string]func() hash.Hash{
+	HMACSHA256: sha256.New,
+	HMACSHA384: sha512.New384,
+	HMACSHA512: sha512.New,
+}
+
+// ErrorCode returns the TSIG error code answering a verification error,
+// or 0 for errors without one
+func ErrorCode(err error) uint16 {
+	switch {
+	case errors.Is(err, ErrBadSig):
+		return RcodeBadSig
+	case errors.Is(err, ErrBadKey):
+		return RcodeBadKey
+	case errors.Is(err, ErrBadTime):
+		return RcodeBadTime
+	}
+	return 0
+}
+
+func errorFor(code uint16) error {
+	switch code {
+	case RcodeBadSig:
+		return ErrBadSig
+	case RcodeBadKey:
+		return ErrBadKey
+	case RcodeBadTime:
+		return ErrBadTime
+	}
+	return fmt.Errorf("%w: error %d", ErrFormat, code)
+}
+
+// Key is a named shared secret
+type Key struct {
+	Name      string
+	Algorithm string
+	Secret    []byte
+}
+
+// ParseKey parses "[algorithm:]name:base64-secret", the form dig -y
+// takes. The algorithm defaults to HMAC-SHA256.
+func ParseKey(spec string) (Key, error) {
+	parts := strings.Split(spec, ":")
+	algorithm := HMACSHA256
+	switch len(parts) {
+	case 2:
+	case 3:
+		algorithm, parts = parts[0], parts[1:]
+	default:
+		return Key{}, fmt.Errorf("tsig: key %q is not [algorithm:]name:secret", spec)
+	}
+	if parts[0] == "" {
+		return Key{}, fmt.Errorf("tsig: key %q has no name", spec)
+	}
+	return NewKey(parts[0], algorithm, parts[1])
+}
+
+// NewKey creates a key from its name, algorithm and base64 secret
+func NewKey(name, algorithm, secret string) (Key, error) {
+	algorithm = canonical(algorithm)
+	if _, ok := algorithms[algorithm]; !ok {
+		return Key{}, fmt.Errorf("tsig: key %s: unsupported algorithm %s", name, algorithm)
+	}
+	raw, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return Key{}, fmt.Errorf("tsig: key %s: %w", name, err)
+	}
+	if len(raw) == 0 {
+		return Key{}, fmt.Errorf("tsig: key %s has an empty secret", name)
+	}
+	return Key{Name: canonical(name), Algorithm: algorithm, Secret: raw}, nil
+}
+
+// Keyring holds keys by name
+type Keyring map[string]Key
+
+// Add stores key under its canonical name
+func (k Keyring) Add(key Key) {
+	key.Name = canonical(key.Name)
+	k[key.Name] = key
+}
+
+// Get looks up a key by name, ignoring case and any trailing dot
+func (k Keyring) Get(name string) (Key, bool) {
+	key, ok := k[canonical(name)]
+	return key, ok
+}
+
+// Record is a decoded TSIG record
+type Record struct {
+	KeyName    string
+	Algorithm  string
+	TimeSigned uint64 // seconds since the epoch, 48 bits on the wire
+	Fudge      uint16
+	MAC        []byte
+	OriginalID uint16
+	Error      uint16
+	OtherData  []byte
+}
+
+// Sign appends a TSIG record to msg. requestMAC is nil for requests and
+// the request's MAC for responses. It returns the signed message and its MAC.
+func Sign(msg []byte, key Key, requestMAC []byte, now time.Time) ([]byte, []byte, error) {
+	return sign(msg, key, requestMAC, false, now)
+}
+
+// Verify checks the TSIG record ending msg against keys. requestMAC is nil
+// when verifying a request. The record is returned with ErrBadKey,
+// ErrBadSig and ErrBadTime so the caller can answer with AppendError. A
+// response reporting one of these errors fails with the same error.
+func Verify(msg []byte, keys Keyring, requestMAC []byte, now time.Time) (*Record, error) {
+	rec, unsigned, err := Split(msg)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Error != 0 {
+		return rec, fmt.Errorf("tsig: rejected by peer: %w", errorFor(rec.Error))
+	}
+	key, ok := keys.Get(rec.KeyName)
+	if !ok || key.Algorithm != rec.Algorithm {
+		return rec, ErrBadKey
+	}
+	return rec, check(key, rec, unsigned, requestMAC, false, now)
+}
+
+// Stream chains the MACs across the messages of a multi-message response
+// such as a zone transfer (RFC 8945 section 5.3.1): the first message
+// covers the request MAC and each later one the previous MAC, with only
+// the timers as variables.
+type Stream struct {
+	key     Key
+	mac     []byte
+	started bool
+	now     func() time.Time
+}
+
+// NewStream starts a response stream answering a request signed with mac
+func NewStream(key Key, requestMAC []byte) *Stream {
+	return &Stream{key: key, mac: requestMAC, now: time.Now}
+}
+
+// Sign signs the next message of the stream
+func (s *Stream) Sign(msg []byte) ([]byte, error) {
+	signed, mac, err := sign(msg, s.key, s.mac, s.started, s.now())
+	if err != nil {
+		return nil, err
+	}
+	s.mac, s.started = mac, true
+	return signed, nil
+}
+
+// Verify checks the next message of the stream
+func (s *Stream) Verify(msg []byte) error {
+	rec, unsigned, err := Split(msg)
+	if err != nil {
+		return err
+	}
+	if rec.Error != 0 {
+		return fmt.Errorf("tsig: rejected by peer: %w", errorFor(rec.Error))
+	}
+	if canonical(rec.KeyName) != canonical(s.key.Name) || rec.Algorithm != s.key.Algorithm {
+		return ErrBadKey
+	}
+	if err := check(s.key, rec, unsigned, s.mac, s.started, s.now()); err != nil {
+		return err
+	}
+	s.mac, s.started = rec.MAC, true
+	return nil
+}
+
+func sign(msg []byte, key Key, prevMAC []byte, timersOnly bool, now time.Time) ([]byte, []byte, error) {
+	if len(msg) < 12 {
+		return nil, nil, errors.New("tsig: message shorter than header")
+	}
+	if _, ok := algorithms[key.Algorithm]; !ok {
+		return nil, nil, ErrBadKey
+	}
+	rec := &Record{
+		KeyName:    canonical(key.Name),
+		Algorithm:  key.Algorithm,
+		TimeSigned: uint64(now.Unix()),
+		Fudge:      DefaultFudge,
+		OriginalID: binary.BigEndian.Uint16(msg[0:2]),
+	}
+	rec.MAC = computeMAC(key, rec, msg, prevMAC, timersOnly)
+	return appendRecord(msg, rec), rec.MAC, nil
+}
+
+// AppendError adds the TSIG record of a response rejecting the request
+// whose record is req with verifyErr (RFC 8945 section 5.3.2). The caller
+// sets the NOTAUTH rcode. BADKEY and BADSIG answers are unsigned, as the
+// client's key cannot be trusted; BADTIME answers are signed and carry the
+// server's clock so the client can see the skew.
+func AppendError(resp []byte, req *Record, keys Keyring, verifyErr error, now time.Time) ([]byte, error) {
+	if len(resp) < 12 {
+		return nil, errors.New("tsig: message shorter than header")
+	}
+	code := ErrorCode(verifyErr)
+	if code == 0 {
+		return nil, fmt.Errorf("tsig: no error code for %v", verifyErr)
+	}
+	rec := &Record{
+		KeyName:    req.KeyName,
+		Algorithm:  req.Algorithm,
+		TimeSigned: req.TimeSigned,
+		Fudge:      req.Fudge,
+		OriginalID: binary.BigEndian.Uint16(resp[0:2]),
+		Error:      code,
+	}
+	if code != RcodeBadTime {
+		return appendRecord(resp, rec), nil
+	}
+
+	key, ok := keys.Get(req.KeyName)
+	if !ok {
+		return nil, ErrBadKey
+	}
+	rec.OtherData = appendTime(nil, uint64(now.Unix()))
+	rec.MAC = computeMAC(key, rec, resp, req.MAC, false)
+	return appendRecord(resp, rec), nil
+}
+
+func check(key Key, rec *Record, unsigned, prevMAC []byte, timersOnly bool, now time.Time) error {
+	if !hmac.Equal(rec.MAC, computeMAC(key, rec, unsigned, prevMAC, timersOnly)) {
+		return ErrBadSig
+	}
+	skew := now.Unix() - int64(rec.TimeSigned)
+	if skew < -int64(rec.Fudge) || skew > int64(rec.Fudge) {
+		return ErrBadTime
+	}
+	return nil
+}
+
+// computeMAC digests the previous MAC, the unsigned message and the TSIG
+// variables in their canonical wire form
+func computeMAC(key Key, rec *Record, msg, prevMAC []byte, timersOnly bool) []byte {
+	mac := hmac.New(algorithms[key.Algorithm], key.Secret)
+	if prevMAC != nil {
+		mac.Write(binary.BigEndian.AppendUint16(nil, uint16(len(prevMAC))))
+		mac.Write(prevMAC)
+	}
+	mac.Write(msg)
+
+	var vars []byte
+	if !timersOnly {
+		vars = append(vars, wireName(rec.KeyName)...)
+		vars = binary.BigEndian.AppendUint16(vars, records.ClassANY)
+		vars = binary.BigEndian.AppendUint32(vars, 0)
+		vars = append(vars, wireName(rec.Algorithm)...)
+	}
+	vars = appendTime(vars, rec.TimeSigned)
+	vars = binary.BigEndian.AppendUint16(vars, rec.Fudge)
+	if !timersOnly {
+		vars = binary.BigEndian.AppendUint16(vars, rec.Error)
+		vars = binary.BigEndian.AppendUint16(vars, uint16(len(rec.OtherData)))
+		vars = append(vars, rec.OtherData...)
+	}
+	mac.Write(vars)
+	return mac.Sum(nil)
+}
+
+// appendRecord adds rec to the additional section of msg
+func appendRecord(msg []byte, rec *Record) []byte {
+	rdata := wireName(rec.Algorithm)
+	rdata = appendTime(rdata, rec.TimeSigned)
+	rdata = binary.BigEndian.AppendUint16(rdata, rec.Fudge)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(rec.MAC)))
+	rdata = append(rdata, rec.MAC...)
+	rdata = binary.BigEndian.AppendUint16(rdata, rec.OriginalID)
+	rdata = binary.BigEndian.AppendUint16(rdata, rec.Error)
+	rdata = binary.BigEndian.AppendUint16(rdata, uint16(len(rec.OtherData)))
+	rdata = append(rdata, rec.OtherData...)
+
+	out := append([]byte(nil), msg...)
+	out = append(out, wireName(rec.KeyName)...)
+	out = binary.BigEndian.AppendUint16(out, records.TypeTSIG)
+	out = binary.BigEndian.AppendUint16(out, records.ClassANY)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(rdata)))
+	out = append(out, rdata...)
+	binary.BigEndian.PutUint16(out[10:12], binary.BigEndian.Uint16(out[10:12])+1)
+	return out
+}
+
+// Split decodes the TSIG record ending msg and returns it with the message
+// as it was before signing: without the record and with the original ID
+func Split(msg []byte) (*Record, []byte, error) {
+	if len(msg) < 12 {
+		return nil, nil, ErrFormat
+	}
+	arCount := binary.BigEndian.Uint16(msg[10:12])
+	if arCount == 0 {
+		return nil, nil, ErrNoSignature
+	}
+
+	var names records.BaseHandler
+	pos := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(msg[4:6])); i++ {
+		_, next, err := names.ReadDomainName(msg, pos)
+		if err != nil {
+			return nil, nil, ErrFormat
+		}
+		pos = next + 4
+	}
+
+	count := int(binary.BigEndian.Uint16(msg[6:8])) + int(binary.BigEndian.Uint16(msg[8:10])) + int(arCount)
+	var last records.ResourceRecord
+	start := pos
+	for i := 0; i < count; i++ {
+		rr, next, err := records.UnpackResourceRecord(msg, pos)
+		if err != nil {
+			return nil, nil, ErrFormat
+		}
+		last, start, pos = rr, pos, next
+	}
+	if last.Type != records.TypeTSIG {
+		return nil, nil, ErrNoSignature
+	}
+	raw, ok := last.Data.(records.RawData)
+	if !ok {
+		return nil, nil, ErrFormat
+	}
+
+	rec, err := parseRData(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	rec.KeyName = canonical(last.Name)
+
+	unsigned := append([]byte(nil), msg[:start]...)
+	binary.BigEndian.PutUint16(unsigned[0:2], rec.OriginalID)
+	binary.BigEndian.PutUint16(unsigned[10:12], arCount-1)
+	return rec, unsigned, nil
+}
+
+func parseRData(rdata []byte) (*Record, error) {
+	var names records.BaseHandler
+	alg, pos, err := names.ReadDomainName(rdata, 0)
+	if err != nil || pos+10 > len(rdata) {
+		return nil, ErrFormat
+	}
+	rec := &Record{Algorithm: canonical(alg)}
+	rec.TimeSigned = uint64(binary.BigEndian.Uint16(rdata[pos:]))<<32 | uint64(binary.BigEndian.Uint32(rdata[pos+2:]))
+	rec.Fudge = binary.BigEndian.Uint16(rdata[pos+6:])
+	macLen := int(binary.BigEndian.Uint16(rdata[pos+8:]))
+	pos += 10
+	if pos+macLen+6 > len(rdata) {
+		return nil, ErrFormat
+	}
+	rec.MAC = append([]byte(nil), rdata[pos:pos+macLen]...)
+	pos += macLen
+	rec.OriginalID = binary.BigEndian.Uint16(rdata[pos:])
+	rec.Error = binary.BigEndian.Uint16(rdata[pos+2:])
+	otherLen := int(binary.BigEndian.Uint16(rdata[pos+4:]))
+	pos += 6
+	if pos+otherLen != len(rdata) {
+		return nil, ErrFormat
+	}
+	rec.OtherData = append([]byte(nil), rdata[pos:]...)
+	return rec, nil
+}
+
+func appendTime(b []byte, t uint64) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(t>>32))
+	return binary.BigEndian.AppendUint32(b, uint32(t))
+}
+
+// wireName encodes name uncompressed and lowercased, as TSIG requires
+func wireName(name string) []byte {
+	var out []byte
+	if name = canonical(name); name != "." {
+		for _, label := range strings.Split(name, ".") {
+			out = append(out, byte(len(label)))
+			out = append(out, label...)
+		}
+	}
+	return append(out, 0)
+}
+
+func canonical(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name == "" {
+		return "."
+	}
+	return name
+}
@@ -0,0 +1,233 @@
+package tsig
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testQuery is a query for example.com/A with ID 0x1234
+var testQuery = []byte{
+	0x12, 0x34, 0x00, 0x00, 0, 1, 0, 0, 0, 0, 0, 0,
+	7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+	0, 1, 0, 1,
+}
+
+func testKeyring(t *testing.T) (Keyring, Key) {
+	t.Helper()
+	key, err := ParseKey("Transfer.Key.:c2VjcmV0LXNlY3JldC1zZWNyZXQ=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := Keyring{}
+	keys.Add(key)
+	return keys, key
+}
+
+func TestSignVerify(t *testing.T) {
+	keys, key := testKeyring(t)
+	now := time.Unix(1_700_000_000, 0)
+
+	signed, mac, err := Sign(testQuery, key, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint16(signed[10:12]) != 1 {
+		t.Fatal("ARCOUNT not incremented")
+	}
+
+	rec, err := Verify(signed, keys, nil, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if rec.KeyName != "transfer.key" || rec.Algorithm != HMACSHA256 || string(rec.MAC) != string(mac) {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+
+	// The ID may be rewritten in transit; the original ID is signed instead
+	rewritten := append([]byte(nil), signed...)
+	rewritten[0], rewritten[1] = 0xAB, 0xCD
+	if _, err := Verify(rewritten, keys, nil, now); err != nil {
+		t.Errorf("Rewritten ID rejected: %v", err)
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	keys, key := testKeyring(t)
+	now := time.Unix(1_700_000_000, 0)
+	signed, _, err := Sign(testQuery, key, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte(nil), signed...)
+	tampered[2] = 0x01 // set RD
+	if _, err := Verify(tampered, keys, nil, now); !errors.Is(err, ErrBadSig) {
+		t.Errorf("Tampered message: got %v", err)
+	}
+
+	if _, err := Verify(signed, Keyring{}, nil, now); !errors.Is(err, ErrBadKey) {
+		t.Errorf("Unknown key: got %v", err)
+	}
+
+	if _, err := Verify(signed, keys, nil, now.Add(time.Hour)); !errors.Is(err, ErrBadTime) {
+		t.Errorf("Stale signature: got %v", err)
+	}
+
+	if _, err := Verify(signed, keys, []byte("request-mac"), now); !errors.Is(err, ErrBadSig) {
+		t.Errorf("Response MAC must cover the request MAC, got %v", err)
+	}
+
+	if _, err := Verify(testQuery, keys, nil, now); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Unsigned message: got %v", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	keys, key := testKeyring(t)
+	request, requestMAC, err := Sign(testQuery, key, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(request, keys, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewStream(key, requestMAC)
+	client := NewStream(key, requestMAC)
+	var messages [][]byte
+	for i := 0; i < 3; i++ {
+		msg, err := server.Sign(testQuery)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, msg)
+	}
+	for i, msg := range messages {
+		if err := client.Verify(msg); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+
+	// Messages out of order break the chain
+	reordered := NewStream(key, requestMAC)
+	if err := reordered.Verify(messages[1]); !errors.Is(err, ErrBadSig) {
+		t.Errorf("Out of order message: got %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, spec := range []string{"nokey", ":c2VjcmV0", "name:not base64!"} {
+		if _, err := ParseKey(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	for _, alg := range []string{HMACSHA256, HMACSHA384, HMACSHA512} {
+		key, err := ParseKey(alg + ":key.example:c2VjcmV0LXNlY3JldC1zZWNyZXQ=")
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, _, err := Sign(testQuery, key, nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := Verify(signed, Keyring{key.Name: key}, nil, now)
+		if err != nil {
+			t.Errorf("%s: %v", alg, err)
+			continue
+		}
+		if rec.Algorithm != alg || len(rec.MAC) != algorithms[alg]().Size() {
+			t.Errorf("%s: unexpected record %+v", alg, rec)
+		}
+	}
+
+	if _, err := ParseKey("hmac-md5:key.example:c2VjcmV0"); err == nil {
+		t.Error("Expected an error for an unsupported algorithm")
+	}
+}
+
+func TestAppendError(t *testing.T) {
+	keys, key := testKeyring(t)
+	now := time.Unix(1_700_000_000, 0)
+	signed, mac, err := Sign(testQuery, key, nil, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := append([]byte(nil), testQuery...)
+	response[2] = 0x80
+
+	// A stale request is answered with a signed BADTIME carrying our clock
+	later := now.Add(time.Hour)
+	rec, verifyErr := Verify(signed, keys, nil, later)
+	if !errors.Is(verifyErr, ErrBadTime) {
+		t.Fatalf("Expected BADTIME, got %v", verifyErr)
+	}
+	badTime, err := AppendError(response, rec, keys, verifyErr, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, unsigned, err := Split(badTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Error != RcodeBadTime || got.TimeSigned != uint64(now.Unix()) || len(got.OtherData) != 6 {
+		t.Errorf("Unexpected BADTIME record %+v", got)
+	}
+	if err := check(key, got, unsigned, mac, false, now); err != nil {
+		t.Errorf("BADTIME answer must be signed with the request MAC: %v", err)
+	}
+	if _, err := Verify(badTime, keys, mac, now); !errors.Is(err, ErrBadTime) {
+		t.Errorf("Client must see BADTIME, got %v", err)
+	}
+
+	// An unknown key is answered unsigned
+	rec, verifyErr = Verify(signed, Keyring{}, nil, now)
+	badKey, err := AppendError(response, rec, Keyring{}, verifyErr, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := Split(badKey); got.Error != RcodeBadKey || len(got.MAC) != 0 {
+		t.Errorf("Unexpected BADKEY record %+v", got)
+	}
+	if _, err := Verify(badKey, keys, mac, now); !errors.Is(err, ErrBadKey) {
+		t.Errorf("Client must see BADKEY, got %v", err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	keys, err := ParseKeyring(strings.NewReader(`
+# written by tsig-keygen
+key "update.example.com" {
+	algorithm hmac-sha512;
+	secret "c2VjcmV0LXNlY3JldC1zZWNyZXQ=";
+};
+/* transfers */
+key xfr. { algorithm hmac-sha256; secret "c2VjcmV0"; }; // trailing
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := keys.Get("Update.Example.Com."); !ok || key.Algorithm != HMACSHA512 || string(key.Secret) != "secret-secret-secret" {
+		t.Errorf("Unexpected key %+v", key)
+	}
+	if _, ok := keys.Get("xfr"); !ok || len(keys) != 2 {
+		t.Errorf("Expected two keys, got %d", len(keys))
+	}
+
+	for _, text := range []string{
+		`key "a" { algorithm hmac-sha256; };`,
+		`key "a" { algorithm hmac-sha256; secret "c2VjcmV0"; }`,
+		`key "a" { algorithm hmac-sha256; secret "c2VjcmV0"; foo bar; };`,
+		`key "a" { algorithm hmac-sha256; secret "c2VjcmV0"; }; key "a" { algorithm hmac-sha256; secret "c2VjcmV0"; };`,
+	} {
+		if _, err := ParseKeyring(strings.NewReader(text)); err == nil {
+			t.Errorf("Expected an error for %q", text)
+		}
+	}
+}
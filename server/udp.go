@@ -0,0 +1,206 @@
+// server/udp.go
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// udpBatchSize is the most datagrams read or written per system call. On
+// Linux batches use recvmmsg and sendmmsg; elsewhere each call moves one.
+const udpBatchSize = 32
+
+// udpBuffers recycles buffers that hold the largest datagram, for reading
+// replies from upstreams
+var udpBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, udpReadSize)
+		return &buf
+	},
+}
+
+// requestBuffers recycles the buffers datagrams are copied into once read,
+// each large enough for a request of the EDNS payload size we advertise
+var requestBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, ednsPayloadSize)
+		return &buf
+	},
+}
+
+// copyRequest copies a datagram into a pooled buffer, or into one of its
+// own size when it does not fit
+func copyRequest(datagram []byte) *[]byte {
+	if len(datagram) > ednsPayloadSize {
+		buf := make([]byte, len(datagram))
+		copy(buf, datagram)
+		return &buf
+	}
+	buf := requestBuffers.Get().(*[]byte)
+	*buf = append((*buf)[:0], datagram...)
+	return buf
+}
+
+// releaseRequest recycles the buffer of an answered request; larger ones
+// than the pool hands out are left to the garbage collector
+func releaseRequest(buf *[]byte) {
+	if cap(*buf) <= ednsPayloadSize {
+		requestBuffers.Put(buf)
+	}
+}
+
+// udpSender sends datagrams; *net.UDPConn is one. Like it, senders must
+// not keep b once WriteMsgUDP returns. oob is the control message that
+// picks the source address, or nil.
+type udpSender interface {
+	WriteMsgUDP(b, oob []byte, addr *net.UDPAddr) (n, oobn int, err error)
+}
+
+// batchConn reads and writes datagrams in batches. The ipv4 and ipv6
+// packet connections share the message type.
+type batchConn interface {
+	ReadBatch(ms []ipv4.Message, flags int) (int, error)
+	WriteBatch(ms []ipv4.Message, flags int) (int, error)
+}
+
+// udpOOBSize holds the packet info control message of either family
+const udpOOBSize = 64
+
+func newBatchConn(conn *net.UDPConn) batchConn {
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() != nil {
+		return ipv4.NewPacketConn(conn)
+	}
+	return ipv6.NewPacketConn(conn)
+}
+
+// ListenUDP opens sockets UDP sockets on addr. With more than one they
+// share the port through SO_REUSEPORT, so the kernel spreads datagrams
+// over them and each can have its own read loop.
+func ListenUDP(addr string, sockets int) ([]*net.UDPConn, error) {
+	if sockets <= 1 {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		return []*net.UDPConn{conn}, nil
+	}
+
+	lc := net.ListenConfig{Control: reusePort}
+	var conns []*net.UDPConn
+	for i := 0; i < sockets; i++ {
+		pc, err := lc.ListenPacket(context.Background(), "udp", addr)
+		if err != nil {
+			for _, conn := range conns {
+				conn.Close()
+			}
+			return nil, fmt.Errorf("socket %d: %w", i+1, err)
+		}
+		conns = append(conns, pc.(*net.UDPConn))
+		// A zero port was chosen by the first bind; the others share it
+		addr = pc.LocalAddr().String()
+	}
+	return conns, nil
+}
+
+// batchSender sends the responses written for one socket in batches. Each
+// pending response counts as in flight, so Shutdown waits for it to go
+// out before closing the socket.
+type batchSender struct {
+	conn    batchConn
+	srv     *Server
+	pending chan outgoing
+}
+
+type outgoing struct {
+	buf  *[]byte
+	oob  []byte
+	addr *net.UDPAddr
+}
+
+func newBatchSender(srv *Server, conn batchConn) *batchSender {
+	b := &batchSender{conn: conn, srv: srv, pending: make(chan outgoing, udpBatchSize*4)}
+	go b.run()
+	return b
+}
+
+// WriteMsgUDP queues a copy of msg; oob is never reused and is kept as
+// is. It is only called while answering a request, so the count of
+// requests in flight is above zero and can be raised.
+func (b *batchSender) WriteMsgUDP(msg, oob []byte, addr *net.UDPAddr) (int, int, error) {
+	buf := responseBuffers.Get().(*[]byte)
+	*buf = append((*buf)[:0], msg...)
+	b.srv.inFlight.Add(1)
+	select {
+	case b.pending <- outgoing{buf: buf, oob: oob, addr: addr}:
+		return len(msg), len(oob), nil
+	case <-b.srv.stop:
+		responseBuffers.Put(buf)
+		b.srv.inFlight.Done()
+		return 0, 0, net.ErrClosed
+	}
+}
+
+// run sends whatever is queued, waiting only for the first response of a
+// batch
+func (b *batchSender) run() {
+	msgs := make([]ipv4.Message, udpBatchSize)
+	bufs := make([][]byte, udpBatchSize)
+	owned := make([]*[]byte, udpBatchSize)
+	for i := range msgs {
+		msgs[i].Buffers = bufs[i : i+1]
+	}
+	queue := func(i int, out outgoing) {
+		owned[i], bufs[i], msgs[i].OOB, msgs[i].Addr = out.buf, *out.buf, out.oob, out.addr
+	}
+
+	for {
+		n := 0
+		select {
+		case out := <-b.pending:
+			queue(0, out)
+			n = 1
+		case <-b.srv.stop:
+			return
+		}
+	fill:
+		for n < udpBatchSize {
+			select {
+			case out := <-b.pending:
+				queue(n, out)
+				n++
+			default:
+				break fill
+			}
+		}
+
+		b.send(msgs[:n])
+		for i := 0; i < n; i++ {
+			responseBuffers.Put(owned[i])
+			owned[i], bufs[i], msgs[i].OOB, msgs[i].Addr = nil, nil, nil, nil
+			b.srv.inFlight.Done()
+		}
+	}
+}
+
+// send writes the batch, skipping a message the kernel rejects rather
+// than dropping the rest
+func (b *batchSender) send(msgs []ipv4.Message) {
+	for len(msgs) > 0 {
+		n, err := b.conn.WriteBatch(msgs, 0)
+		if err != nil && n < len(msgs) {
+			log.Printf("Write error to %v: %v", msgs[n].Addr, err)
+			n++
+		}
+		msgs = msgs[n:]
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// echoHandler answers every query with an empty response
+var echoHandler = HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+	w.WriteMsg(req.Reply())
+})
+
+// exchangeAll sends count queries at once and reports the IDs answered
+func exchangeAll(t *testing.T, addr *net.UDPAddr, count int) map[uint16]bool {
+	t.Helper()
+	client, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetReadBuffer(1 << 20)
+
+	for id := 1; id <= count; id++ {
+		req := queryMsg("example.test", records.TypeA)
+		req.ID = uint16(id)
+		query, err := req.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := client.Write(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	answered := make(map[uint16]bool)
+	buf := make([]byte, 512)
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(answered) < count {
+		n, err := client.Read(buf)
+		if err != nil {
+			break
+		}
+		if resp, err := UnpackMsg(buf[:n]); err == nil && resp.Response {
+			answered[resp.ID] = true
+		}
+	}
+	return answered
+}
+
+func TestServeUDP_Batches(t *testing.T) {
+	_, conn, _ := startServer(t, echoHandler)
+
+	const count = 100
+	if answered := exchangeAll(t, conn.LocalAddr().(*net.UDPAddr), count); len(answered) != count {
+		t.Errorf("%d of %d queries answered", len(answered), count)
+	}
+}
+
+func TestListenUDP_ReusePort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("SO_REUSEPORT is not available")
+	}
+	conns, err := ListenUDP("127.0.0.1:0", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(echoHandler, nil)
+	port := conns[0].LocalAddr().(*net.UDPAddr).Port
+	for _, conn := range conns {
+		if got := conn.LocalAddr().(*net.UDPAddr).Port; got != port {
+			t.Errorf("socket on port %d, want %d", got, port)
+		}
+		go srv.ServeUDP(conn)
+	}
+	defer srv.Shutdown(context.Background())
+
+	const count = 50
+	if answered := exchangeAll(t, conns[0].LocalAddr().(*net.UDPAddr), count); len(answered) != count {
+		t.Errorf("%d of %d queries answered", len(answered), count)
+	}
+}
+
+func TestServeUDP_ReplyFromDestination(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("IP_PKTINFO is Linux only")
+	}
+	// Dual-stack sockets see IPv4 clients through mapped addresses
+	for _, network := range []string{"udp4", "udp"} {
+		conn, err := net.ListenUDP(network, &net.UDPAddr{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := NewServer(echoHandler, nil)
+		go srv.ServeUDP(conn)
+
+		// The route back to the client prefers 127.0.0.1 as source, which
+		// a client connected to 127.0.0.2 would not accept
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		if answered := exchangeAll(t, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 2), Port: port}, 1); len(answered) != 1 {
+			t.Errorf("%s: reply did not come from the address queried", network)
+		}
+		srv.Shutdown(context.Background())
+	}
+}
+
+func TestServeUDP_LargeRequest(t *testing.T) {
+	additional := make(chan int, 1)
+	_, conn, _ := startServer(t, HandlerFunc(func(ctx context.Context, w ResponseWriter, req *Msg) {
+		additional <- len(req.Additional)
+		w.WriteMsg(req.Reply())
+	}))
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// Well past 512 bytes, like a large UPDATE
+	req := queryMsg("example.test", records.TypeA)
+	text := strings.Repeat("x", 255)
+	for i := 0; i < 8; i++ {
+		req.Additional = append(req.Additional, records.ResourceRecord{
+			Name: "example.test", Type: records.TypeTXT, Class: records.ClassIN, TTL: 60,
+			Data: []string{text},
+		})
+	}
+	query, err := req.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(query) <= 2048 {
+		t.Fatalf("request is only %d bytes", len(query))
+	}
+	if _, err := client.Write(query); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 512)
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := UnpackMsg(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Rcode != 0 {
+		t.Fatalf("rcode %d, want 0", resp.Rcode)
+	}
+	if got := <-additional; got != len(req.Additional) {
+		t.Errorf("handler saw %d additional records, want %d", got, len(req.Additional))
+	}
+}
+
+func TestCopyRequest(t *testing.T) {
+	small := copyRequest(make([]byte, 40))
+	if len(*small) != 40 || cap(*small) > ednsPayloadSize {
+		t.Errorf("40-byte request held in len %d, cap %d", len(*small), cap(*small))
+	}
+	releaseRequest(small)
+
+	// A request larger than the pooled buffers gets one of its own size,
+	// not a whole read buffer
+	large := copyRequest(make([]byte, 4000))
+	if len(*large) != 4000 || cap(*large) != 4000 {
+		t.Errorf("4000-byte request held in len %d, cap %d", len(*large), cap(*large))
+	}
+	releaseRequest(large)
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+// server/udptrunc_other.go
+package server
+
+// msgTrunc is never set where reads do not report truncated datagrams
+const msgTrunc = 0
@@ -0,0 +1,10 @@
+//go:build unix
+
+// server/udptrunc_unix.go
+package server
+
+import "golang.org/x/sys/unix"
+
+// msgTrunc is the flag the kernel sets on a datagram cut short by the
+// buffer it was read into
+const msgTrunc = unix.MSG_TRUNC
@@ -0,0 +1,164 @@
+// server/update.go
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+// UpdateACL decides who may update zones: the request must be TSIG signed
+// with one of Keys and, when Allow is not empty, come from an address in it
+type UpdateACL struct {
+	Allow []*net.IPNet
+	Keys  tsig.Keyring
+}
+
+func (a UpdateACL) allows(ip net.IP) bool {
+	for _, network := range a.Allow {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return len(a.Allow) == 0
+}
+
+// UpdateHandler applies dynamic updates (RFC 2136) to the zones of a
+// store. Each update is checked and applied to a copy of the zone that
+// replaces it as a whole, so the serial bump, the journal entry for IXFR
+// and NOTIFY follow from ZoneStore. Everything else goes to the next
+// handler.
+type UpdateHandler struct {
+	next  Handler
+	zones *ZoneStore
+	acl   UpdateACL
+	now   func() time.Time
+}
+
+// NewUpdateHandler wraps next, accepting updates to zones allowed by acl
+func NewUpdateHandler(next Handler, zones *ZoneStore, acl UpdateACL) *UpdateHandler {
+	return &UpdateHandler{next: next, zones: zones, acl: acl, now: time.Now}
+}
+
+func (h *UpdateHandler) ServeDNS(ctx context.Context, w ResponseWriter, req *Msg) {
+	if req.Opcode != opcodeUpdate {
+		h.next.ServeDNS(ctx, w, req)
+		return
+	}
+	domain, qtype := req.Question[0].Name, req.Question[0].Type
+
+	ip, _ := GetClientIPFromContext(ctx)
+	if !h.acl.allows(net.ParseIP(ip)) {
+		log.Printf("[UPDATE] Refused update of %s from %s: address not allowed", domain, ip)
+		h.respond(w, req, rcodeRefused, nil)
+		return
+	}
+
+	rec, err := tsig.Verify(req.Raw(), h.acl.Keys, nil, h.now())
+	if err != nil {
+		log.Printf("[UPDATE] Refused update of %s from %s: %v", domain, ip, err)
+		var sign func(msg []byte) ([]byte, error)
+		if rec != nil && tsig.ErrorCode(err) != 0 {
+			sign = func(msg []byte) ([]byte, error) {
+				return tsig.AppendError(msg, rec, h.acl.Keys, err, h.now())
+			}
+		}
+		h.respond(w, req, rcodeNotAuth, sign)
+		return
+	}
+	key, _ := h.acl.Keys.Get(rec.KeyName)
+	_, unsigned, _ := tsig.Split(req.Raw())
+
+	rcode := h.update(domain, qtype, unsigned)
+	if rcode == 0 {
+		log.Printf("[UPDATE] Applied update of %s from %s (key %s)", domain, ip, key.Name)
+	}
+	h.respond(w, req, rcode, func(msg []byte) ([]byte, error) {
+		signed, _, err := tsig.Sign(msg, key, rec.MAC, h.now())
+		return signed, err
+	})
+}
+
+// respond answers an UPDATE, echoing the zone section with rcode. sign
+// adds the TSIG record to the packed response; it is nil when unsigned.
+func (h *UpdateHandler) respond(w ResponseWriter, req *Msg, rcode uint16, sign func(msg []byte) ([]byte, error)) {
+	reply := req.Reply()
+	reply.RecursionDesired, reply.RecursionAvailable = false, false
+	reply.EDNS = nil
+	reply.Rcode = rcode
+	msg, err := reply.Pack()
+	if err == nil && sign != nil {
+		msg, err = sign(msg)
+	}
+	if err == nil {
+		err = w.WritePacked(msg)
+	}
+	if err != nil {
+		log.Printf("[UPDATE] Error answering update of %s: %v", req.Question[0].Name, err)
+	}
+}
+
+// update checks and applies one update message, returning the rcode
+func (h *UpdateHandler) update(origin string, ztype uint16, msg []byte) uint16 {
+	if ztype != records.TypeSOA {
+		log.Printf("[UPDATE] Malformed update of %s: zone type %s", origin, records.TypeName(ztype))
+		return zone.RcodeFormatError
+	}
+	prereqs, updates, err := parseUpdate(msg)
+	if err != nil {
+		log.Printf("[UPDATE] Malformed update of %s: %v", origin, err)
+		return zone.RcodeFormatError
+	}
+
+	err = h.zones.Update(origin, func(z *zone.Zone) (bool, error) {
+		if err := zone.CheckPrerequisites(z, prereqs); err != nil {
+			return false, err
+		}
+		return zone.ApplyUpdate(z, updates)
+	})
+
+	var updateErr *zone.UpdateError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &updateErr):
+		log.Printf("[UPDATE] Rejected update of %s: %v", origin, err)
+		return updateErr.Rcode
+	case errors.Is(err, errNotAuthoritative):
+		log.Printf("[UPDATE] Rejected update of %s: %v", origin, err)
+		return rcodeNotAuth
+	default:
+		log.Printf("[UPDATE] Update of %s failed: %v", origin, err)
+		return rcodeServFail
+	}
+}
+
+// parseUpdate returns the prerequisite and update sections of an unsigned
+// update, which has exactly one zone entry
+func parseUpdate(msg []byte) ([]records.ResourceRecord, []records.ResourceRecord, error) {
+	if binary.BigEndian.Uint16(msg[4:6]) != 1 {
+		return nil, nil, errors.New("zone section must hold exactly one zone")
+	}
+	var names records.BaseHandler
+	_, pos, err := names.ReadDomainName(msg, 12)
+	if err != nil {
+		return nil, nil, err
+	}
+	prereqs, pos, err := unpackSection(msg, pos+4, int(binary.BigEndian.Uint16(msg[6:8])))
+	if err != nil {
+		return nil, nil, fmt.Errorf("prerequisite section: %w", err)
+	}
+	updates, _, err := unpackSection(msg, pos, int(binary.BigEndian.Uint16(msg[8:10])))
+	if err != nil {
+		return nil, nil, fmt.Errorf("update section: %w", err)
+	}
+	return prereqs, updates, nil
+}
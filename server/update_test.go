@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+var updateKey = tsig.Key{Name: "update.key", Algorithm: tsig.HMACSHA256, Secret: []byte("0123456789abcdef0123456789abcdef")}
+
+// buildUpdate encodes an UPDATE for origin. Records without data are
+// written with empty RDATA, as deletions and prerequisites are.
+func buildUpdate(t *testing.T, id uint16, origin string, prereqs, updates []records.ResourceRecord) []byte {
+	t.Helper()
+	var names records.BaseHandler
+	buf := new(bytes.Buffer)
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint16(header[0:2], id)
+	binary.BigEndian.PutUint16(header[2:4], opcodeUpdate<<11)
+	binary.BigEndian.PutUint16(header[4:6], 1)
+	binary.BigEndian.PutUint16(header[6:8], uint16(len(prereqs)))
+	binary.BigEndian.PutUint16(header[8:10], uint16(len(updates)))
+	buf.Write(header)
+	names.WriteDomainName(buf, origin)
+	binary.Write(buf, binary.BigEndian, [2]uint16{records.TypeSOA, records.ClassIN})
+
+	for _, rr := range append(append([]records.ResourceRecord(nil), prereqs...), updates...) {
+		var rdata []byte
+		if rr.Data != nil {
+			handler, _ := records.HandlerFor(rr.Type)
+			var err error
+			if rdata, err = handler.BuildRecordData(rr.Data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		names.WriteDomainName(buf, rr.Name)
+		binary.Write(buf, binary.BigEndian, rr.Type)
+		binary.Write(buf, binary.BigEndian, rr.Class)
+		binary.Write(buf, binary.BigEndian, rr.TTL)
+		binary.Write(buf, binary.BigEndian, uint16(len(rdata)))
+		buf.Write(rdata)
+	}
+	return buf.Bytes()
+}
+
+func sendUpdate(t *testing.T, handler Handler, msg []byte, key *tsig.Key) uint16 {
+	t.Helper()
+	var mac []byte
+	if key != nil {
+		var err error
+		if msg, mac, err = tsig.Sign(msg, *key, nil, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := &recordingWriter{}
+	handleRequest(requestFrom("192.0.2.1"), w, msg, handler)
+	if len(w.msgs) != 1 {
+		t.Fatalf("Expected one response, got %d", len(w.msgs))
+	}
+	resp := w.msgs[0]
+	flags := binary.BigEndian.Uint16(resp[2:4])
+	if (flags>>11)&0x0F != opcodeUpdate {
+		t.Errorf("Response does not echo the UPDATE opcode: %#04x", flags)
+	}
+	if key != nil && flags&0x000F != rcodeNotAuth {
+		if _, err := tsig.Verify(resp, tsig.Keyring{key.Name: *key}, mac, time.Now()); err != nil {
+			t.Errorf("Response signature: %v", err)
+		}
+	}
+	return flags & 0x000F
+}
+
+func TestUpdateHandler(t *testing.T) {
+	store := newTestStore(t, nil)
+	keys := tsig.Keyring{}
+	keys.Add(updateKey)
+	handler := NewUpdateHandler(ForwardHandler(NewDNSResolver("127.0.0.1:1")), store, UpdateACL{Keys: keys})
+
+	add := buildUpdate(t, 1, "example.test",
+		[]records.ResourceRecord{{Name: "host.example.test", Type: records.TypeANY, Class: records.ClassNONE}},
+		[]records.ResourceRecord{
+			{Name: "host.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 60, Data: "192.0.2.10"},
+			{Name: "www.example.test", Type: records.TypeA, Class: records.ClassANY},
+		})
+
+	if rcode := sendUpdate(t, handler, add, nil); rcode != rcodeNotAuth {
+		t.Errorf("Expected NOTAUTH for an unsigned update, got %d", rcode)
+	}
+	otherKey := updateKey
+	otherKey.Secret = []byte("wrong")
+	if rcode := sendUpdate(t, handler, add, &otherKey); rcode != rcodeNotAuth {
+		t.Errorf("Expected NOTAUTH for a bad signature, got %d", rcode)
+	}
+	badSig, _, _ := tsig.Sign(add, otherKey, nil, time.Now())
+	w := &recordingWriter{}
+	handleRequest(requestFrom("192.0.2.1"), w, badSig, handler)
+	if rec, _, err := tsig.Split(w.msgs[0]); err != nil || rec.Error != tsig.RcodeBadSig || len(rec.MAC) != 0 {
+		t.Errorf("Expected an unsigned BADSIG answer, got %+v (%v)", rec, err)
+	}
+
+	if rcode := sendUpdate(t, handler, add, &updateKey); rcode != 0 {
+		t.Fatalf("Update failed with rcode %d", rcode)
+	}
+	if got := lookupA(t, store, "host.example.test"); got != "192.0.2.10" {
+		t.Errorf("Expected the added record, got %v", got)
+	}
+	if ans, _, _ := store.Lookup(requestFrom("192.0.2.1"), "www.example.test", records.TypeA); ans.Rcode != zone.RcodeNameError {
+		t.Errorf("Expected the deleted name to be gone, got rcode %d", ans.Rcode)
+	}
+
+	// The change is journaled so secondaries catch up with IXFR
+	rrs, err := store.transferRecords("example.test", true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rrs) != 6 || serialOf(rrs[0]) != 2 {
+		t.Errorf("Expected an incremental transfer to serial 2, got %d records", len(rrs))
+	}
+
+	// The prerequisite no longer holds
+	if rcode := sendUpdate(t, handler, add, &updateKey); rcode != zone.RcodeYXDomain {
+		t.Errorf("Expected YXDOMAIN, got %d", rcode)
+	}
+	notZone := buildUpdate(t, 2, "other.test", nil,
+		[]records.ResourceRecord{{Name: "a.other.test", Type: records.TypeA, Class: records.ClassIN, TTL: 60, Data: "192.0.2.1"}})
+	if rcode := sendUpdate(t, handler, notZone, &updateKey); rcode != rcodeNotAuth {
+		t.Errorf("Expected NOTAUTH for a zone not served, got %d", rcode)
+	}
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+)
+
+const (
+	upstreamTimeout = 5 * time.Second
+	flagRD          = 0x0100 // Recursion desired
+	flagRA          = 0x0080 // Recursion available
+	flagTC          = 0x0200 // Truncated
+	flagAA          = 0x0400 // Authoritative answer
+	flagQR          = 0x8000 // Response
+	flagAD          = 0x0020 // Authentic data
+	flagCD          = 0x0010 // Checking disabled
+
+	// EDNS0 OPT pseudo-record advertising a 1232 byte payload (RFC 6891)
+	ednsPayloadSize = 1232
+	ednsFlagDO      = 0x8000 // DNSSEC OK
+)
+
+// UpstreamResponse is a decoded upstream reply
+type UpstreamResponse struct {
+	Rcode     uint16
+	Answer    []records.ResourceRecord
+	Authority []records.ResourceRecord
+}
+
+// buildQuery encodes a single-question recursive query
+func buildQuery(id uint16, domain string, qtype uint16) ([]byte, error) {
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint16(header[0:2], id)
+	binary.BigEndian.PutUint16(header[2:4], flagRD)
+	binary.BigEndian.PutUint16(header[4:6], records.QDCOUNT)
+
+	buf := bytes.NewBuffer(header)
+	var names records.BaseHandler
+	if err := names.WriteDomainName(buf, domain); err != nil {
+		return nil, err
+	}
+	binary.Write(buf, binary.BigEndian, qtype)
+	binary.Write(buf, binary.BigEndian, uint16(records.ClassIN))
+	return buf.Bytes(), nil
+}
+
+// buildDNSSECQuery encodes a query with the DO bit set in an OPT record so
+// the upstream returns RRSIGs. CD is set as well: the answer is validated
+// locally and a validating upstream must not hide bogus data from us.
+func buildDNSSECQuery(id uint16, domain string, qtype uint16) ([]byte, error) {
+	return buildEDNSQuery(id, domain, qtype, true, true)
+}
+
+// buildEDNSQuery encodes a recursive query with an OPT record advertising
+// our payload size, the DO bit set when do and the CD bit when cd
+func buildEDNSQuery(id uint16, domain string, qtype uint16, do, cd bool) ([]byte, error) {
+	query, err := buildQuery(id, domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	flags := uint16(flagRD)
+	if cd {
+		flags |= flagCD
+	}
+	var ednsFlags uint32
+	if do {
+		ednsFlags = ednsFlagDO
+	}
+	binary.BigEndian.PutUint16(query[2:4], flags)
+	binary.BigEndian.PutUint16(query[10:12], 1)
+
+	query = append(query, 0) // root owner
+	query = binary.BigEndian.AppendUint16(query, records.TypeOPT)
+	query = binary.BigEndian.AppendUint16(query, ednsPayloadSize)
+	query = binary.BigEndian.AppendUint32(query, ednsFlags)
+	query = binary.BigEndian.AppendUint16(query, 0)
+	return query, nil
+}
+
+// Exchange sends a wire-format query to the upstream over UDP, retrying
+// over TCP when the answer is truncated. With a key the query is TSIG
+// signed and the answer verified.
+func (f *Forwarder) Exchange(ctx context.Context, query []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, upstreamTimeout)
+		defer cancel()
+	}
+
+	var mac []byte
+	if f.key != nil {
+		var err error
+		if query, mac, err = tsig.Sign(query, *f.key, nil, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := f.exchangeUDP(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if binary.BigEndian.Uint16(resp[2:4])&flagTC != 0 {
+		if resp, err = f.exchangeTCP(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.key != nil {
+		keys := tsig.Keyring{}
+		keys.Add(*f.key)
+		if _, err := tsig.Verify(resp, keys, mac, time.Now()); err != nil {
+			return nil, fmt.Errorf("upstream answer: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+func (f *Forwarder) exchangeUDP(ctx context.Context, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", f.upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	pooled := udpBuffers.Get().(*[]byte)
+	defer udpBuffers.Put(pooled)
+	buf := *pooled
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams that do not answer our query
+		if n >= 12 && bytes.Equal(buf[0:2], query[0:2]) && sameQuestion(query, buf[:n]) {
+			return append([]byte(nil), buf[:n]...), nil
+		}
+	}
+}
+
+func (f *Forwarder) exchangeTCP(ctx context.Context, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", f.upstream)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	framed := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err := conn.Write(append(framed, query...)); err != nil {
+		return nil, err
+	}
+
+	var length uint16
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, length)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	if len(resp) < 12 || !bytes.Equal(resp[0:2], query[0:2]) {
+		return nil, errors.New("upstream answered with a mismatched transaction ID")
+	}
+	if !sameQuestion(query, resp) {
+		return nil, errors.New("upstream answered a different question")
+	}
+	return resp, nil
+}
+
+// queryID picks a transaction ID an off-path attacker cannot predict
+func queryID() uint16 {
+	var id [2]byte
+	rand.Read(id[:])
+	return binary.BigEndian.Uint16(id[:])
+}
+
+// sameQuestion reports whether resp repeats the question of query, names
+// compared without regard to case (RFC 5452). Errors such as FORMERR or a
+// TSIG NOTAUTH may come as a bare header; one that would answer the query,
+// NOERROR or NXDOMAIN, must carry the question.
+func sameQuestion(query, resp []byte) bool {
+	if len(query) < 12 || len(resp) < 12 {
+		return false
+	}
+	if rcode := resp[3] & 0x0F; resp[4]|resp[5] == 0 && rcode != 0 && rcode != rcodeNXDomain {
+		return true
+	}
+	if !bytes.Equal(query[4:6], resp[4:6]) {
+		return false
+	}
+	pos := 12
+	for i := 0; i < int(binary.BigEndian.Uint16(query[4:6])); i++ {
+		var want, got [255]byte
+		wantName, next, err := records.DecodeDomainName(want[:0], query, pos)
+		if err != nil || next+4 > len(query) {
+			return false
+		}
+		gotName, gotNext, err := records.DecodeDomainName(got[:0], resp, pos)
+		if err != nil || gotNext != next || next+4 > len(resp) {
+			return false
+		}
+		if !bytes.EqualFold(wantName, gotName) || !bytes.Equal(query[next:next+4], resp[next:next+4]) {
+			return false
+		}
+		pos = next + 4
+	}
+	return true
+}
+
+// Query asks the upstream for domain/qtype and returns the decoded answer section
+func (f *Forwarder) Query(ctx context.Context, domain string, qtype uint16) ([]records.ResourceRecord, error) {
+	query, err := buildQuery(queryID(), domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.Exchange(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return parseAnswers(resp)
+}
+
+// QueryDNSSEC asks the upstream for domain/qtype with DNSSEC records included
+func (f *Forwarder) QueryDNSSEC(ctx context.Context, domain string, qtype uint16) (*UpstreamResponse, error) {
+	query, err := buildDNSSECQuery(queryID(), domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.Exchange(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(resp)
+}
+
+// Forward asks the upstream for domain/qtype as a client would, with the
+// DO and CD bits given, and returns the whole response. Its TSIG record,
+// if any, is verified and dropped.
+func (f *Forwarder) Forward(ctx context.Context, domain string, qtype uint16, do, cd bool) (*Msg, error) {
+	query, err := buildEDNSQuery(queryID(), domain, qtype, do, cd)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.Exchange(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := UnpackMsg(resp)
+	if err != nil {
+		return nil, fmt.Errorf("upstream response: %w", err)
+	}
+	if !msg.Response {
+		return nil, errors.New("upstream message is not a response")
+	}
+	if n := len(msg.Additional); n > 0 && msg.Additional[n-1].Type == records.TypeTSIG {
+		msg.Additional = msg.Additional[:n-1]
+	}
+	return msg, nil
+}
+
+// parseAnswers checks the response code and decodes the answer section
+func parseAnswers(resp []byte) ([]records.ResourceRecord, error) {
+	parsed, err := parseResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Rcode != 0 {
+		return nil, fmt.Errorf("upstream returned rcode %d", parsed.Rcode)
+	}
+	return parsed.Answer, nil
+}
+
+// parseResponse decodes the answer and authority sections of a response
+func parseResponse(resp []byte) (*UpstreamResponse, error) {
+	if len(resp) < 12 {
+		return nil, errors.New("response shorter than header size")
+	}
+
+	flags := binary.BigEndian.Uint16(resp[2:4])
+	if flags&flagQR == 0 {
+		return nil, errors.New("upstream message is not a response")
+	}
+
+	qdCount := int(binary.BigEndian.Uint16(resp[4:6]))
+	anCount := int(binary.BigEndian.Uint16(resp[6:8]))
+	nsCount := int(binary.BigEndian.Uint16(resp[8:10]))
+
+	var names records.BaseHandler
+	pos := 12
+	for i := 0; i < qdCount; i++ {
+		_, next, err := names.ReadDomainName(resp, pos)
+		if err != nil {
+			return nil, fmt.Errorf("invalid question: %w", err)
+		}
+		pos = next + 4
+	}
+
+	parsed := &UpstreamResponse{Rcode: flags & 0x000F}
+	var err error
+	if parsed.Answer, pos, err = unpackSection(resp, pos, anCount); err != nil {
+		return nil, err
+	}
+	if parsed.Authority, _, err = unpackSection(resp, pos, nsCount); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+func unpackSection(resp []byte, pos, count int) ([]records.ResourceRecord, int, error) {
+	section := make([]records.ResourceRecord, 0, count)
+	for i := 0; i < count; i++ {
+		rr, next, err := records.UnpackResourceRecord(resp, pos)
+		if err != nil {
+			return nil, 0, err
+		}
+		section = append(section, rr)
+		pos = next
+	}
+	return section, pos, nil
+}
@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/tsig"
+)
+
+const typeSSHFP = 44
+
+// startFakeUpstream answers every UDP and TCP query on one local port with reply(query)
+func startFakeUpstream(t testing.TB, reply func(query []byte, tcp bool) []byte) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		t.Fatalf("listen tcp: %v", err)
+	}
+	t.Cleanup(func() { pc.Close(); ln.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(reply(buf[:n], false), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			var length uint16
+			binary.Read(conn, binary.BigEndian, &length)
+			query := make([]byte, length)
+			io.ReadFull(conn, query)
+			resp := reply(query, true)
+			binary.Write(conn, binary.BigEndian, uint16(len(resp)))
+			conn.Write(resp)
+			conn.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// answerWith echoes the question and appends one record per RDATA, owner compressed to the question
+func answerWith(query []byte, qtype uint16, flags uint16, rdatas ...[]byte) []byte {
+	end := len(query)
+	if _, next, err := records.DecodeDomainName(nil, query, 12); err == nil && next+4 <= len(query) {
+		end = next + 4
+	}
+	resp := append([]byte(nil), query[:end]...)
+	binary.BigEndian.PutUint16(resp[2:4], flags)
+	binary.BigEndian.PutUint16(resp[10:12], 0)
+	binary.BigEndian.PutUint16(resp[6:8], uint16(len(rdatas)))
+	for _, rdata := range rdatas {
+		resp = append(resp, 0xC0, 12)
+		resp = binary.BigEndian.AppendUint16(resp, qtype)
+		resp = binary.BigEndian.AppendUint16(resp, records.ClassIN)
+		resp = binary.BigEndian.AppendUint32(resp, 3600)
+		resp = binary.BigEndian.AppendUint16(resp, uint16(len(rdata)))
+		resp = append(resp, rdata...)
+	}
+	return resp
+}
+
+func TestForwarder_QueryUnknownType(t *testing.T) {
+	sshfp := []byte{1, 1, 0xde, 0xad, 0xbe, 0xef}
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		return answerWith(query, typeSSHFP, 0x8180, sshfp)
+	})
+
+	rrs, err := NewForwarder(upstream).Query(context.Background(), "host.example.com", typeSSHFP)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rrs) != 1 || rrs[0].Name != "host.example.com" || rrs[0].TTL != 3600 {
+		t.Fatalf("Unexpected answers: %+v", rrs)
+	}
+	if !bytes.Equal(rrs[0].Data.(records.RawData), sshfp) {
+		t.Errorf("Unexpected RDATA: %x", rrs[0].Data)
+	}
+}
+
+func TestForwarder_TruncatedFallsBackToTCP(t *testing.T) {
+	upstream := startFakeUpstream(t, func(query []byte, tcp bool) []byte {
+		if !tcp {
+			return answerWith(query, typeSSHFP, 0x8380)
+		}
+		return answerWith(query, typeSSHFP, 0x8180, []byte{1}, []byte{2})
+	})
+
+	rrs, err := NewForwarder(upstream).Query(context.Background(), "host.example.com", typeSSHFP)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rrs) != 2 {
+		t.Errorf("Expected the full TCP answer, got %d records", len(rrs))
+	}
+}
+
+func TestForwarder_ErrorRcode(t *testing.T) {
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		return answerWith(query, typeSSHFP, 0x8183)
+	})
+
+	if _, err := NewForwarder(upstream).Query(context.Background(), "missing.example.com", typeSSHFP); err == nil {
+		t.Error("Expected error for NXDOMAIN")
+	}
+}
+
+func TestDNSResolver_ForwardsUnknownType(t *testing.T) {
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		return answerWith(query, typeSSHFP, 0x8180, []byte{2, 1, 0xaa}, []byte{3, 2, 0xbb})
+	})
+
+	resolver := NewDNSResolver(upstream)
+	result, err := resolver.Resolve(context.Background(), ResolutionContext{Domain: "host.example.com", QType: typeSSHFP})
+	if err != nil {
+		t.Fatalf("Resolution failed: %v", err)
+	}
+
+	answers, ok := result.([]interface{})
+	if !ok || len(answers) != 2 {
+		t.Fatalf("Expected two opaque answers, got %#v", result)
+	}
+	if !bytes.Equal(answers[1].(records.RawData), []byte{3, 2, 0xbb}) {
+		t.Errorf("Unexpected second answer: %x", answers[1])
+	}
+}
+
+func TestDNSResolver_DecodesCompressedMX(t *testing.T) {
+	// Exchange "mail" + pointer to the question name at offset 12
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		return answerWith(query, records.TypeMX, 0x8180, []byte{0, 10, 4, 'm', 'a', 'i', 'l', 0xC0, 12})
+	})
+
+	resolver := NewDNSResolver(upstream)
+	result, err := resolver.Resolve(context.Background(), ResolutionContext{Domain: "example.com", QType: records.TypeMX})
+	if err != nil {
+		t.Fatalf("Resolution failed: %v", err)
+	}
+
+	want := records.MXData{Preference: 10, Exchange: "mail.example.com"}
+	if result != want {
+		t.Errorf("Expected %+v, got %+v", want, result)
+	}
+}
+
+func TestForwarder_QueryDNSSECSetsDO(t *testing.T) {
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		// The question is followed by an 11 byte OPT record in the additional section
+		opt := query[len(query)-11:]
+		flags := binary.BigEndian.Uint16(query[2:4])
+		if binary.BigEndian.Uint16(query[10:12]) != 1 || binary.BigEndian.Uint16(opt[1:3]) != records.TypeOPT ||
+			binary.BigEndian.Uint32(opt[5:9])&ednsFlagDO == 0 || flags&flagCD == 0 {
+			return answerWith(query[:len(query)-11], records.TypeA, 0x8182)
+		}
+
+		resp := answerWith(query[:len(query)-11], records.TypeA, 0x8180, []byte{192, 0, 2, 1})
+		binary.BigEndian.PutUint16(resp[10:12], 0)
+		return resp
+	})
+
+	resp, err := NewForwarder(upstream).QueryDNSSEC(context.Background(), "example.com", records.TypeA)
+	if err != nil {
+		t.Fatalf("QueryDNSSEC failed: %v", err)
+	}
+	if resp.Rcode != 0 {
+		t.Fatalf("Upstream rejected the query: rcode %d", resp.Rcode)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].Data != "192.0.2.1" {
+		t.Errorf("Unexpected answers: %+v", resp.Answer)
+	}
+}
+
+func TestForwarder_SignsWithTSIG(t *testing.T) {
+	keys := tsig.Keyring{}
+	keys.Add(updateKey)
+	upstream := startFakeUpstream(t, func(query []byte, _ bool) []byte {
+		rec, err := tsig.Verify(query, keys, nil, time.Now())
+		if err != nil {
+			resp := make([]byte, 12)
+			copy(resp, query[0:2])
+			binary.BigEndian.PutUint16(resp[2:4], flagQR|rcodeNotAuth)
+			if rec == nil {
+				return resp
+			}
+			resp, _ = tsig.AppendError(resp, rec, keys, err, time.Now())
+			return resp
+		}
+		_, unsigned, _ := tsig.Split(query)
+		resp, _, _ := tsig.Sign(answerWith(unsigned, records.TypeA, 0x8180, []byte{192, 0, 2, 1}), updateKey, rec.MAC, time.Now())
+		return resp
+	})
+
+	f := NewForwarder(upstream)
+	f.SignWith(&updateKey)
+	answers, err := f.Query(context.Background(), "signed.example.com", records.TypeA)
+	if err != nil || len(answers) != 1 {
+		t.Fatalf("Signed query failed: %v", err)
+	}
+
+	otherKey := tsig.Key{Name: "other.key", Algorithm: tsig.HMACSHA512, Secret: []byte("secret")}
+	f.SignWith(&otherKey)
+	if _, err := f.Query(context.Background(), "signed.example.com", records.TypeA); !errors.Is(err, tsig.ErrBadKey) {
+		t.Errorf("Expected the upstream's BADKEY, got %v", err)
+	}
+
+	f.SignWith(nil)
+	if _, err := f.Query(context.Background(), "signed.example.com", records.TypeA); err == nil {
+		t.Error("Expected the unsigned query to be rejected")
+	}
+}
+
+func TestForwarder_IgnoresAnswerToOtherQuestion(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 512)
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		query := buf[:n]
+		// A spoofed answer that guessed the ID but not the question
+		spoofed, _ := buildQuery(binary.BigEndian.Uint16(query[0:2]), "other.example.com", typeSSHFP)
+		pc.WriteTo(answerWith(spoofed, typeSSHFP, 0x8180, []byte{6, 6, 6}), addr)
+		pc.WriteTo(answerWith(query, typeSSHFP, 0x8180, []byte{1}), addr)
+	}()
+
+	rrs, err := NewForwarder(pc.LocalAddr().String()).Query(context.Background(), "host.example.com", typeSSHFP)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(rrs) != 1 || !bytes.Equal(rrs[0].Data.(records.RawData), []byte{1}) {
+		t.Errorf("Unexpected answers: %+v", rrs)
+	}
+}
+
+func TestSameQuestion(t *testing.T) {
+	query, _ := buildQuery(1, "host.example.com", records.TypeA)
+	for _, tt := range []struct {
+		name  string
+		qtype uint16
+		want  bool
+	}{
+		{"host.example.com", records.TypeA, true},
+		// Case may be echoed differently (RFC 5452)
+		{"HOST.Example.com", records.TypeA, true},
+		{"host.example.net", records.TypeA, false},
+		{"host.example.com", records.TypeAAAA, false},
+	} {
+		resp, _ := buildQuery(1, tt.name, tt.qtype)
+		if got := sameQuestion(query, resp); got != tt.want {
+			t.Errorf("%s %s: sameQuestion = %v, want %v", tt.name, records.TypeName(tt.qtype), got, tt.want)
+		}
+	}
+	// Only errors that answer nothing may leave the question out
+	bare := append([]byte(nil), query[:12]...)
+	binary.BigEndian.PutUint16(bare[4:6], 0)
+	for rcode, want := range map[byte]bool{0: false, rcodeNXDomain: false, rcodeFormErr: true, rcodeRefused: true} {
+		bare[3] = rcode
+		if got := sameQuestion(query, bare); got != want {
+			t.Errorf("bare header with rcode %d: sameQuestion = %v, want %v", rcode, got, want)
+		}
+	}
+}
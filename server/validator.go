@@ -0,0 +1,844 @@
+// server/validator.go
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// ErrBogus is returned for answers whose DNSSEC signatures fail to validate
+var ErrBogus = errors.New("DNSSEC validation failed")
+
+// errInsecure marks names that are provably outside the signed tree
+var errInsecure = errors.New("zone is not signed")
+
+const maxKeyCacheTTL = time.Hour
+
+// DefaultTrustAnchors holds the root zone KSK digests (KSK-2017 and KSK-2024)
+const DefaultTrustAnchors = `
+. IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D
+. IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16
+`
+
+// DNSSECQuerier fetches answers together with their RRSIG records
+type DNSSECQuerier interface {
+	QueryDNSSEC(ctx context.Context, domain string, qtype uint16) (*UpstreamResponse, error)
+}
+
+// SecureAnswer wraps answer data that passed DNSSEC validation so the
+// response can be sent with the AD flag set
+type SecureAnswer struct {
+	Data interface{}
+}
+
+// Validator checks forwarded answers against a chain of trust that starts
+// at the configured trust anchors. A delegation is insecure only when a
+// signed NSEC/NSEC3 record proves it has no DS records, and a negative or
+// wildcard answer is secure only with the NSEC/NSEC3 records proving it.
+type Validator struct {
+	querier   DNSSECQuerier
+	dsAnchors map[string][]records.DSData
+	keyAnchor map[string][]records.DNSKEYData
+	now       func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]keyCacheEntry
+	cuts map[string]cutCacheEntry
+}
+
+type keyCacheEntry struct {
+	keys    []records.DNSKEYData
+	expires time.Time
+}
+
+// NewValidator creates a validator trusting the given DS or DNSKEY records
+func NewValidator(querier DNSSECQuerier, anchors []records.ResourceRecord) (*Validator, error) {
+	v := &Validator{
+		querier:   querier,
+		dsAnchors: make(map[string][]records.DSData),
+		keyAnchor: make(map[string][]records.DNSKEYData),
+		now:       time.Now,
+		keys:      make(map[string]keyCacheEntry),
+		cuts:      make(map[string]cutCacheEntry),
+	}
+
+	for _, rr := range anchors {
+		zone := dnssec.CanonicalName(rr.Name)
+		switch data := rr.Data.(type) {
+		case records.DSData:
+			v.dsAnchors[zone] = append(v.dsAnchors[zone], data)
+		case records.DNSKEYData:
+			v.keyAnchor[zone] = append(v.keyAnchor[zone], data)
+		default:
+			return nil, fmt.Errorf("trust anchor for %s must be DS or DNSKEY", rr.Name)
+		}
+	}
+	if len(v.dsAnchors)+len(v.keyAnchor) == 0 {
+		return nil, errors.New("no trust anchors configured")
+	}
+	return v, nil
+}
+
+// ParseTrustAnchors reads DS or DNSKEY records in zone file presentation
+// format, one per line: "<owner> [ttl] [IN] DS|DNSKEY <rdata>"
+func ParseTrustAnchors(r io.Reader) ([]records.ResourceRecord, error) {
+	var anchors []records.ResourceRecord
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		rr := records.ResourceRecord{Name: dnssec.CanonicalName(fields[0]), Class: records.ClassIN}
+		fields = fields[1:]
+		if len(fields) > 0 {
+			if ttl, err := strconv.ParseUint(fields[0], 10, 32); err == nil {
+				rr.TTL = uint32(ttl)
+				fields = fields[1:]
+			}
+		}
+		if len(fields) > 0 && strings.EqualFold(fields[0], "IN") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing record type", line)
+		}
+
+		var err error
+		if rr.Type, err = records.TypeByName(fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if rr.Type != records.TypeDS && rr.Type != records.TypeDNSKEY {
+			return nil, fmt.Errorf("line %d: trust anchors must be DS or DNSKEY records", line)
+		}
+		handler, _ := records.GetHandler(rr.Type)
+		if rr.Data, err = handler.(records.ZoneDataParser).ParseZoneData(fields[1:], rr.Name); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		anchors = append(anchors, rr)
+	}
+	return anchors, scanner.Err()
+}
+
+// Validate queries domain/qtype and checks every RRset of the answer, and
+// the denial of what it lacks: NXDOMAIN and NODATA answers, and answers
+// expanded from a wildcard, need the NSEC/NSEC3 records that prove them.
+// It returns the response, signatures and upstream rcode included, and
+// whether the answer is secure; bogus answers fail with an error wrapping
+// ErrBogus. Rcodes other than NOERROR and NXDOMAIN come back as insecure.
+func (v *Validator) Validate(ctx context.Context, domain string, qtype uint16) (*UpstreamResponse, bool, error) {
+	resp, err := v.querier.QueryDNSSEC(ctx, domain, qtype)
+	if err != nil {
+		return nil, false, err
+	}
+	if resp.Rcode != 0 && resp.Rcode != rcodeNXDomain {
+		return resp, false, nil
+	}
+
+	rrsets, sigs := groupRRsets(resp.Answer)
+	secure := true
+	for _, key := range rrsetOrder(resp.Answer) {
+		rrset := rrsets[key]
+		sig, err := v.verifyRRset(ctx, rrset, sigs[key])
+		switch {
+		case errors.Is(err, errInsecure):
+			secure = false
+			continue
+		case err != nil:
+			return nil, false, fmt.Errorf("%w: %s %s: %v", ErrBogus, rrset[0].Name, records.TypeName(rrset[0].Type), err)
+		}
+		if sig.Labels < dnssec.LabelCount(key.name) {
+			proven, err := v.proveWildcard(ctx, key.name, sig, resp.Authority)
+			if err != nil {
+				return nil, false, err
+			}
+			secure = secure && proven
+		}
+	}
+
+	if name, found := answerTarget(resp.Answer, dnssec.CanonicalName(domain), qtype); !found {
+		proven, err := v.proveDenial(ctx, name, qtype, resp.Rcode == rcodeNXDomain, resp.Authority)
+		if err != nil {
+			return nil, false, err
+		}
+		secure = secure && proven
+	}
+	return resp, secure, nil
+}
+
+// answerTarget follows the CNAME chain of answer from name and returns the
+// name it ends at and whether an RRset of qtype was found there
+func answerTarget(answer []records.ResourceRecord, name string, qtype uint16) (string, bool) {
+	for range len(answer) + 1 {
+		var target string
+		for _, rr := range answer {
+			if dnssec.CanonicalName(rr.Name) != name || rr.Type == records.TypeRRSIG {
+				continue
+			}
+			if rr.Type == qtype || qtype == records.TypeANY {
+				return name, true
+			}
+			if cname, ok := rr.Data.(string); ok && rr.Type == records.TypeCNAME {
+				target = dnssec.CanonicalName(cname)
+			}
+		}
+		if target == "" {
+			return name, false
+		}
+		name = target
+	}
+	return name, false
+}
+
+// proveDenial checks that the authority section proves name has no RRset
+// of qtype, or does not exist at all when nxdomain is set. It reports
+// whether the denial is secure: names in unsigned zones, or in opt-out
+// spans, need no proof.
+func (v *Validator) proveDenial(ctx context.Context, name string, qtype uint16, nxdomain bool, authority []records.ResourceRecord) (bool, error) {
+	zone, keys, err := v.findZone(ctx, name)
+	if errors.Is(err, errInsecure) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	proof := v.denialProof(zone, keys, authority)
+	var proven, optOut bool
+	if nxdomain {
+		proven, optOut = proof.noName(name)
+	} else {
+		proven, optOut = proof.noData(name, qtype)
+	}
+	if !proven {
+		return false, fmt.Errorf("%w: no proof that %s %s does not exist", ErrBogus, name, records.TypeName(qtype))
+	}
+	return !optOut, nil
+}
+
+// proveWildcard checks that the authority section proves no name closer
+// to owner than the wildcard sig was made for exists, so the wildcard
+// rightly answered for it (RFC 4035 section 5.3.4, RFC 5155 section 8.8)
+func (v *Validator) proveWildcard(ctx context.Context, owner string, sig records.RRSIGData, authority []records.ResourceRecord) (bool, error) {
+	zone, keys, err := v.findZone(ctx, sig.SignerName)
+	if err != nil {
+		return false, err
+	}
+	labels := strings.Split(owner, ".")
+	closest := strings.Join(labels[len(labels)-int(sig.Labels):], ".")
+	if sig.Labels == 0 {
+		closest = "."
+	}
+
+	covered, optOut := v.denialProof(zone, keys, authority).covers(childToward(closest, owner))
+	if !covered {
+		return false, fmt.Errorf("%w: %s expanded from a wildcard without proof that no closer name exists", ErrBogus, owner)
+	}
+	return !optOut, nil
+}
+
+type rrsetKey struct {
+	name  string
+	rtype uint16
+}
+
+// groupRRsets splits a section into RRsets and the signatures covering them
+func groupRRsets(section []records.ResourceRecord) (map[rrsetKey][]records.ResourceRecord, map[rrsetKey][]records.RRSIGData) {
+	rrsets := make(map[rrsetKey][]records.ResourceRecord)
+	sigs := make(map[rrsetKey][]records.RRSIGData)
+	for _, rr := range section {
+		name := dnssec.CanonicalName(rr.Name)
+		if sig, ok := rr.Data.(records.RRSIGData); ok && rr.Type == records.TypeRRSIG {
+			key := rrsetKey{name, sig.TypeCovered}
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		key := rrsetKey{name, rr.Type}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	return rrsets, sigs
+}
+
+// rrsetOrder lists the RRsets of a section in the order they first appear
+func rrsetOrder(section []records.ResourceRecord) []rrsetKey {
+	seen := make(map[rrsetKey]bool)
+	var order []rrsetKey
+	for _, rr := range section {
+		key := rrsetKey{dnssec.CanonicalName(rr.Name), rr.Type}
+		if rr.Type == records.TypeRRSIG || seen[key] {
+			continue
+		}
+		seen[key] = true
+		order = append(order, key)
+	}
+	return order
+}
+
+// verifyRRset returns the signature that validates rrset, errInsecure when
+// rrset lies in an unsigned zone, and any other error when bogus.
+// Signatures count only from the zone the chain of trust finds above the
+// owner, so a forged signer cannot turn an answer insecure.
+func (v *Validator) verifyRRset(ctx context.Context, rrset []records.ResourceRecord, sigs []records.RRSIGData) (records.RRSIGData, error) {
+	owner := dnssec.CanonicalName(rrset[0].Name)
+	isDS := rrset[0].Type == records.TypeDS
+	if len(sigs) == 0 {
+		// A DS RRset belongs to the zone above the cut
+		above := owner
+		if isDS {
+			above = dnssec.Parent(owner)
+		}
+		zone, _, err := v.findZone(ctx, above)
+		if err != nil {
+			return records.RRSIGData{}, err
+		}
+		return records.RRSIGData{}, errors.New("missing signature in signed zone " + zone)
+	}
+
+	lastErr := errors.New("no usable signature")
+	for _, sig := range sigs {
+		signer := dnssec.CanonicalName(sig.SignerName)
+		if !dnssec.IsSubdomain(owner, signer) {
+			lastErr = fmt.Errorf("signer %s is not above %s", signer, owner)
+			continue
+		}
+		// A DS RRset is signed by the parent, which keeps the chain walk finite
+		if isDS && signer == owner {
+			lastErr = errors.New("DS signed by the child zone")
+			continue
+		}
+
+		zone, keys, err := v.findZone(ctx, signer)
+		if err != nil {
+			return records.RRSIGData{}, err
+		}
+		if zone != signer {
+			lastErr = fmt.Errorf("signer %s is not a zone apex", signer)
+			continue
+		}
+		if lastErr = verifyWithKeys(zone, keys, rrset, []records.RRSIGData{sig}, v.now()); lastErr == nil {
+			return sig, nil
+		}
+	}
+	return records.RRSIGData{}, lastErr
+}
+
+// verifyWithKeys checks that a signature of zone made with one of keys
+// validates rrset
+func verifyWithKeys(zone string, keys []records.DNSKEYData, rrset []records.ResourceRecord, sigs []records.RRSIGData, now time.Time) error {
+	lastErr := fmt.Errorf("no signature by %s", zone)
+	for _, sig := range sigs {
+		if dnssec.CanonicalName(sig.SignerName) != zone {
+			continue
+		}
+		for _, key := range keys {
+			if dnssec.KeyTag(key) != sig.KeyTag {
+				continue
+			}
+			if lastErr = dnssec.Verify(sig, key, rrset, now); lastErr == nil {
+				return nil
+			}
+		}
+	}
+	return lastErr
+}
+
+// cutKind is what the DS lookup of a name proves about it
+type cutKind int
+
+const (
+	cutNone     cutKind = iota // the name lies inside the zone above it
+	cutSecure                  // a signed zone starts at the name
+	cutInsecure                // an unsigned zone starts at the name
+	cutNoName                  // the name does not exist, nor anything below it
+)
+
+type cutCacheEntry struct {
+	kind    cutKind
+	ds      []records.DSData
+	expires time.Time
+}
+
+// findZone returns the apex and validated keys of the zone containing
+// name. Zone cuts come from validated data only: the walk starts at the
+// closest trust anchor and goes down one label at a time, each step
+// either a signed DS RRset or a signed NSEC/NSEC3 proof that there is
+// none. errInsecure is returned below a proven insecure delegation.
+func (v *Validator) findZone(ctx context.Context, name string) (string, []records.DNSKEYData, error) {
+	name = dnssec.CanonicalName(name)
+	zone := v.closestAnchor(name)
+	if zone == "" {
+		return "", nil, errInsecure
+	}
+	keys, err := v.zoneKeys(ctx, zone, v.dsAnchors[zone])
+	if err != nil {
+		return "", nil, err
+	}
+
+	for pos := zone; pos != name; {
+		pos = childToward(pos, name)
+		cut, err := v.delegation(ctx, pos, zone, keys)
+		if err != nil {
+			return "", nil, err
+		}
+		switch cut.kind {
+		case cutSecure:
+			if keys, err = v.zoneKeys(ctx, pos, cut.ds); err != nil {
+				return "", nil, err
+			}
+			zone = pos
+		case cutInsecure:
+			return "", nil, errInsecure
+		case cutNoName:
+			return zone, keys, nil
+		}
+	}
+	return zone, keys, nil
+}
+
+// childToward returns the name one label below ancestor on the way to name
+func childToward(ancestor, name string) string {
+	labels := strings.Split(name, ".")
+	depth := 0
+	if ancestor != "." {
+		depth = strings.Count(ancestor, ".") + 1
+	}
+	return strings.Join(labels[len(labels)-depth-1:], ".")
+}
+
+// closestAnchor returns the deepest trust anchor at or above name, or ""
+func (v *Validator) closestAnchor(name string) string {
+	closest := ""
+	consider := func(anchor string) {
+		if dnssec.IsSubdomain(name, anchor) && (closest == "" || dnssec.IsSubdomain(anchor, closest)) {
+			closest = anchor
+		}
+	}
+	for anchor := range v.dsAnchors {
+		consider(anchor)
+	}
+	for anchor := range v.keyAnchor {
+		consider(anchor)
+	}
+	return closest
+}
+
+// zoneKeys returns the DNSKEY set of zone, validated against ds or the
+// zone's key anchors
+func (v *Validator) zoneKeys(ctx context.Context, zone string, ds []records.DSData) ([]records.DNSKEYData, error) {
+	v.mu.Lock()
+	entry, ok := v.keys[zone]
+	v.mu.Unlock()
+	if ok && v.now().Before(entry.expires) {
+		return entry.keys, nil
+	}
+
+	keys, ttl, err := v.fetchZoneKeys(ctx, zone, ds)
+	if err != nil {
+		return nil, err
+	}
+	if ttl > maxKeyCacheTTL {
+		ttl = maxKeyCacheTTL
+	}
+	v.mu.Lock()
+	v.keys[zone] = keyCacheEntry{keys: keys, expires: v.now().Add(ttl)}
+	v.mu.Unlock()
+	return keys, nil
+}
+
+func (v *Validator) fetchZoneKeys(ctx context.Context, zone string, ds []records.DSData) ([]records.DNSKEYData, time.Duration, error) {
+	anchorKeys := v.keyAnchor[zone]
+	resp, err := v.querier.QueryDNSSEC(ctx, zone, records.TypeDNSKEY)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.Rcode != 0 {
+		return nil, 0, fmt.Errorf("DNSKEY query for %s returned rcode %d", zone, resp.Rcode)
+	}
+	rrsets, sigs := groupRRsets(resp.Answer)
+	key := rrsetKey{zone, records.TypeDNSKEY}
+	rrset := rrsets[key]
+	if len(rrset) == 0 {
+		return nil, 0, fmt.Errorf("%w: no DNSKEY records for signed zone %s", ErrBogus, zone)
+	}
+
+	// The DNSKEY RRset must be signed by a key the parent (or an anchor) vouches for
+	for _, sig := range sigs[key] {
+		for _, rr := range rrset {
+			entry, ok := rr.Data.(records.DNSKEYData)
+			if !ok || !trustedKey(zone, entry, anchorKeys, ds) || dnssec.KeyTag(entry) != sig.KeyTag {
+				continue
+			}
+			if dnssec.Verify(sig, entry, rrset, v.now()) == nil {
+				keys := make([]records.DNSKEYData, 0, len(rrset))
+				for _, rr := range rrset {
+					keys = append(keys, rr.Data.(records.DNSKEYData))
+				}
+				return keys, ttlOf(rrset), nil
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("%w: no trusted signature over the DNSKEY set of %s", ErrBogus, zone)
+}
+
+// delegation looks up the DS RRset of name in zone, whose keys are
+// validated, and returns what it proves
+func (v *Validator) delegation(ctx context.Context, name, zone string, keys []records.DNSKEYData) (cutCacheEntry, error) {
+	v.mu.Lock()
+	entry, ok := v.cuts[name]
+	v.mu.Unlock()
+	if ok && v.now().Before(entry.expires) {
+		return entry, nil
+	}
+
+	resp, err := v.querier.QueryDNSSEC(ctx, name, records.TypeDS)
+	if err != nil {
+		return cutCacheEntry{}, err
+	}
+	entry = cutCacheEntry{}
+	var ttl time.Duration
+	rrsets, sigs := groupRRsets(resp.Answer)
+	key := rrsetKey{name, records.TypeDS}
+	if rrset := rrsets[key]; resp.Rcode == 0 && len(rrset) > 0 {
+		if err := verifyWithKeys(zone, keys, rrset, sigs[key], v.now()); err != nil {
+			return cutCacheEntry{}, fmt.Errorf("%w: DS %s: %v", ErrBogus, name, err)
+		}
+		entry = cutCacheEntry{kind: cutSecure}
+		for _, rr := range rrset {
+			entry.ds = append(entry.ds, rr.Data.(records.DSData))
+		}
+		ttl = ttlOf(rrset)
+	} else if entry.kind, ttl, err = v.denial(name, zone, keys, resp.Authority); err != nil {
+		return cutCacheEntry{}, err
+	}
+
+	if ttl > maxKeyCacheTTL {
+		ttl = maxKeyCacheTTL
+	}
+	entry.expires = v.now().Add(ttl)
+	v.mu.Lock()
+	v.cuts[name] = entry
+	v.mu.Unlock()
+	return entry, nil
+}
+
+// denial reads the NSEC or NSEC3 records of zone in an answer without a
+// DS RRset for name (RFC 4035 section 5.2, RFC 5155 section 8). Only
+// records signed by zone count; without a proof the answer is bogus.
+func (v *Validator) denial(name, zone string, keys []records.DNSKEYData, authority []records.ResourceRecord) (cutKind, time.Duration, error) {
+	rrsets, sigs := groupRRsets(authority)
+	for _, key := range rrsetOrder(authority) {
+		rrset := rrsets[key]
+		if key.rtype != records.TypeNSEC && key.rtype != records.TypeNSEC3 {
+			continue
+		}
+		if verifyWithKeys(zone, keys, rrset, sigs[key], v.now()) != nil {
+			continue
+		}
+
+		var kind cutKind
+		var proven bool
+		switch data := rrset[0].Data.(type) {
+		case records.NSECData:
+			kind, proven = nsecDenial(name, key.name, data)
+		case records.NSEC3Data:
+			kind, proven = nsec3Denial(name, zone, key.name, data)
+		}
+		if proven {
+			return kind, ttlOf(rrset), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: no DS for %s and no proof of its absence", ErrBogus, name)
+}
+
+// nsecDenial reads an NSEC record owned by owner for a DS lookup of name
+func nsecDenial(name, owner string, nsec records.NSECData) (cutKind, bool) {
+	next := dnssec.CanonicalName(nsec.NextDomain)
+	if owner == name {
+		return cutAt(nsec.Types)
+	}
+	if !nameCovered(name, owner, next, dnssec.CompareNames) {
+		return 0, false
+	}
+	// A name covered by an NSEC whose next name lies below it is an empty
+	// non-terminal, which holds no cut
+	if dnssec.IsSubdomain(next, name) {
+		return cutNone, true
+	}
+	return cutNoName, true
+}
+
+// nsec3Denial reads an NSEC3 record owned by owner in zone for a DS
+// lookup of name
+func nsec3Denial(name, zone, owner string, nsec3 records.NSEC3Data) (cutKind, bool) {
+	label, rest, _ := strings.Cut(owner, ".")
+	if rest != zone {
+		return 0, false
+	}
+	ownerHash, err := records.Base32Hex.DecodeString(strings.ToUpper(label))
+	if err != nil {
+		return 0, false
+	}
+	hash, err := dnssec.HashName(name, nsec3.HashAlgorithm, nsec3.Iterations, nsec3.Salt)
+	if err != nil {
+		return 0, false
+	}
+	if bytes.Equal(hash, ownerHash) {
+		return cutAt(nsec3.Types)
+	}
+	if !nameCovered(string(hash), string(ownerHash), string(nsec3.NextHashed), strings.Compare) {
+		return 0, false
+	}
+	// An opt-out span may hold unsigned delegations (RFC 5155 section 6)
+	if nsec3.Flags&records.NSEC3FlagOptOut != 0 {
+		return cutInsecure, true
+	}
+	return cutNoName, true
+}
+
+// cutAt reads the types of an existing name: NS without SOA is a
+// delegation, and one without DS is insecure
+func cutAt(types []uint16) (cutKind, bool) {
+	switch {
+	case hasType(types, records.TypeDS):
+		// The answer had no DS RRset, yet the proof lists one
+		return 0, false
+	case isDelegation(types):
+		return cutInsecure, true
+	default:
+		return cutNone, true
+	}
+}
+
+func hasType(types []uint16, t uint16) bool {
+	for _, typ := range types {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+// isDelegation reports whether the types are those of the parent side of
+// a zone cut, where only the DS RRset is authoritative
+func isDelegation(types []uint16) bool {
+	return hasType(types, records.TypeNS) && !hasType(types, records.TypeSOA)
+}
+
+// denialProof holds the NSEC or NSEC3 records of a response signed by the
+// zone a name lies in, and proves which names and types it lacks
+type denialProof struct {
+	zone  string
+	nsec  map[string]records.NSECData
+	nsec3 []nsec3Record
+}
+
+type nsec3Record struct {
+	hash []byte
+	data records.NSEC3Data
+}
+
+// denialProof collects the NSEC and NSEC3 RRsets of section that keys of
+// zone validate
+func (v *Validator) denialProof(zone string, keys []records.DNSKEYData, section []records.ResourceRecord) *denialProof {
+	proof := &denialProof{zone: zone, nsec: make(map[string]records.NSECData)}
+	rrsets, sigs := groupRRsets(section)
+	for _, key := range rrsetOrder(section) {
+		rrset := rrsets[key]
+		if key.rtype != records.TypeNSEC && key.rtype != records.TypeNSEC3 || !dnssec.IsSubdomain(key.name, zone) {
+			continue
+		}
+		if verifyWithKeys(zone, keys, rrset, sigs[key], v.now()) != nil {
+			continue
+		}
+		switch data := rrset[0].Data.(type) {
+		case records.NSECData:
+			proof.nsec[key.name] = data
+		case records.NSEC3Data:
+			label, rest, _ := strings.Cut(key.name, ".")
+			hash, err := records.Base32Hex.DecodeString(strings.ToUpper(label))
+			if err == nil && rest == zone {
+				proof.nsec3 = append(proof.nsec3, nsec3Record{hash: hash, data: data})
+			}
+		}
+	}
+	return proof
+}
+
+// match returns the types of name when the proof holds its record
+func (p *denialProof) match(name string) ([]uint16, bool) {
+	if data, ok := p.nsec[name]; ok {
+		return data.Types, true
+	}
+	for _, rec := range p.nsec3 {
+		hash, err := dnssec.HashName(name, rec.data.HashAlgorithm, rec.data.Iterations, rec.data.Salt)
+		if err == nil && bytes.Equal(hash, rec.hash) {
+			return rec.data.Types, true
+		}
+	}
+	return nil, false
+}
+
+// covers reports whether the proof shows that name does not exist, and
+// whether that holds only for signed names, the span being opt-out
+func (p *denialProof) covers(name string) (covered, optOut bool) {
+	if !dnssec.IsSubdomain(name, p.zone) {
+		return false, false
+	}
+	for owner, data := range p.nsec {
+		if p.nsecCovers(name, owner, data) {
+			return true, false
+		}
+	}
+	for _, rec := range p.nsec3 {
+		hash, err := dnssec.HashName(name, rec.data.HashAlgorithm, rec.data.Iterations, rec.data.Salt)
+		if err == nil && nameCovered(string(hash), string(rec.hash), string(rec.data.NextHashed), strings.Compare) {
+			return true, rec.data.Flags&records.NSEC3FlagOptOut != 0
+		}
+	}
+	return false, false
+}
+
+// nsecCovers reports whether an NSEC record proves name does not exist:
+// it must fall in the record's span without being an empty non-terminal,
+// and not lie below a delegation the record's owner holds
+func (p *denialProof) nsecCovers(name, owner string, data records.NSECData) bool {
+	next := dnssec.CanonicalName(data.NextDomain)
+	if !nameCovered(name, owner, next, dnssec.CompareNames) || dnssec.IsSubdomain(next, name) {
+		return false
+	}
+	return !dnssec.IsSubdomain(name, owner) || !isDelegation(data.Types)
+}
+
+// closestEncloser returns the deepest existing ancestor of name once the
+// proof shows the name below it, toward name, does not exist
+// (RFC 4035 section 5.4, RFC 5155 section 8.3)
+func (p *denialProof) closestEncloser(name string) (closest string, optOut, ok bool) {
+	for owner, data := range p.nsec {
+		if p.nsecCovers(name, owner, data) {
+			// The owner and next name exist, so their deepest common
+			// ancestor with name is the closest encloser
+			closest = commonAncestor(name, owner)
+			if next := commonAncestor(name, dnssec.CanonicalName(data.NextDomain)); dnssec.IsSubdomain(next, closest) {
+				closest = next
+			}
+			return closest, false, true
+		}
+	}
+	if len(p.nsec3) == 0 {
+		return "", false, false
+	}
+	for closest = dnssec.Parent(name); dnssec.IsSubdomain(closest, p.zone); closest = dnssec.Parent(closest) {
+		if types, ok := p.match(closest); ok {
+			if isDelegation(types) {
+				return "", false, false
+			}
+			covered, optOut := p.covers(childToward(closest, name))
+			return closest, optOut, covered
+		}
+		if closest == p.zone {
+			break
+		}
+	}
+	return "", false, false
+}
+
+// noName proves an NXDOMAIN answer: neither name nor the wildcard that
+// would have matched it exists
+func (p *denialProof) noName(name string) (proven, optOut bool) {
+	closest, optOut, ok := p.closestEncloser(name)
+	if !ok {
+		return false, false
+	}
+	covered, wildcardOptOut := p.covers(wildcardAt(closest))
+	return covered, optOut || wildcardOptOut
+}
+
+// noData proves a NODATA answer: name, or the wildcard matching it,
+// exists without an RRset of qtype or a CNAME
+func (p *denialProof) noData(name string, qtype uint16) (proven, optOut bool) {
+	if types, ok := p.match(name); ok {
+		return lacksType(types, qtype), false
+	}
+	closest, optOut, ok := p.closestEncloser(name)
+	if !ok {
+		return false, false
+	}
+	// An opt-out span may hold the unsigned delegation a DS query asked
+	// about (RFC 5155 section 8.6)
+	if optOut && qtype == records.TypeDS {
+		return true, true
+	}
+	types, ok := p.match(wildcardAt(closest))
+	return ok && lacksType(types, qtype), optOut
+}
+
+// lacksType reports whether a name with the given types has no RRset of
+// qtype to answer with. The parent side of a delegation only speaks for DS.
+func lacksType(types []uint16, qtype uint16) bool {
+	if isDelegation(types) && qtype != records.TypeDS {
+		return false
+	}
+	return !hasType(types, qtype) && !hasType(types, records.TypeCNAME)
+}
+
+// commonAncestor returns the deepest name at or above both a and b
+func commonAncestor(a, b string) string {
+	for !dnssec.IsSubdomain(a, b) {
+		b = dnssec.Parent(b)
+	}
+	return b
+}
+
+// wildcardAt returns the wildcard name directly below closest
+func wildcardAt(closest string) string {
+	if closest == "." {
+		return "*"
+	}
+	return "*." + closest
+}
+
+// nameCovered reports whether name falls strictly between owner and next
+// in the order of compare, the last record of a chain wrapping around
+func nameCovered(name, owner, next string, compare func(a, b string) int) bool {
+	if compare(owner, next) < 0 {
+		return compare(owner, name) < 0 && compare(name, next) < 0
+	}
+	return compare(owner, name) < 0 || compare(name, next) < 0
+}
+
+func trustedKey(zone string, key records.DNSKEYData, anchorKeys []records.DNSKEYData, anchorDS []records.DSData) bool {
+	for _, anchor := range anchorKeys {
+		if anchor.Algorithm == key.Algorithm && string(anchor.PublicKey) == string(key.PublicKey) {
+			return true
+		}
+	}
+	for _, ds := range anchorDS {
+		if dnssec.MatchesDS(zone, key, ds) {
+			return true
+		}
+	}
+	return false
+}
+
+func ttlOf(rrset []records.ResourceRecord) time.Duration {
+	ttl := rrset[0].TTL
+	for _, rr := range rrset[1:] {
+		if rr.TTL < ttl {
+			ttl = rr.TTL
+		}
+	}
+	return time.Duration(ttl) * time.Second
+}
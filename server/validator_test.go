@@ -0,0 +1,464 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// fakeQuerier serves pre-built DNSSEC responses keyed by name and type
+type fakeQuerier struct {
+	responses map[rrsetKey]*UpstreamResponse
+}
+
+func (q *fakeQuerier) QueryDNSSEC(_ context.Context, domain string, qtype uint16) (*UpstreamResponse, error) {
+	key := rrsetKey{dnssec.CanonicalName(domain), qtype}
+	if resp, ok := q.responses[key]; ok {
+		return resp, nil
+	}
+	return &UpstreamResponse{Rcode: 3}, nil
+}
+
+// testZone is a locally signed zone with one KSK and one ZSK
+type testZone struct {
+	name     string
+	ksk, zsk *dnssec.SigningKey
+}
+
+func newTestZone(t *testing.T, name string, alg uint8) *testZone {
+	t.Helper()
+	ksk, err := dnssec.GenerateKey(alg, records.DNSKEYFlagZone|records.DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zsk, err := dnssec.GenerateKey(alg, records.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testZone{name: name, ksk: ksk, zsk: zsk}
+}
+
+// sign returns rrset followed by its RRSIG made with key
+func (z *testZone) sign(t *testing.T, key *dnssec.SigningKey, rrset []records.ResourceRecord, inception, expiration time.Time) []records.ResourceRecord {
+	t.Helper()
+	sig, err := dnssec.Sign(rrset, key, z.name, inception, expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := records.ResourceRecord{Name: rrset[0].Name, Type: records.TypeRRSIG, Class: records.ClassIN, TTL: rrset[0].TTL, Data: sig}
+	return append(append([]records.ResourceRecord(nil), rrset...), rr)
+}
+
+func rr(name string, rtype uint16, data interface{}) records.ResourceRecord {
+	return records.ResourceRecord{Name: name, Type: rtype, Class: records.ClassIN, TTL: 3600, Data: data}
+}
+
+type signedTree struct {
+	querier *fakeQuerier
+	anchors []records.ResourceRecord
+	zones   map[string]*testZone
+	now     time.Time
+}
+
+// newSignedTree builds "." (RSA) -> "test" (ECDSA) -> "zone.test" (Ed25519)
+// plus the unsigned delegation "plain.test"
+func newSignedTree(t *testing.T) *signedTree {
+	tree := &signedTree{
+		querier: &fakeQuerier{responses: make(map[rrsetKey]*UpstreamResponse)},
+		zones:   make(map[string]*testZone),
+		now:     time.Now(),
+	}
+	chain := []struct {
+		name string
+		alg  uint8
+	}{{".", dnssec.AlgRSASHA256}, {"test", dnssec.AlgECDSAP256SHA256}, {"zone.test", dnssec.AlgED25519}}
+
+	var parent *testZone
+	for _, c := range chain {
+		zone := newTestZone(t, c.name, c.alg)
+		tree.zones[c.name] = zone
+
+		keys := []records.ResourceRecord{rr(c.name, records.TypeDNSKEY, zone.ksk.DNSKEY), rr(c.name, records.TypeDNSKEY, zone.zsk.DNSKEY)}
+		tree.answer(rrsetKey{c.name, records.TypeDNSKEY}, zone.sign(t, zone.ksk, keys, tree.now.Add(-time.Hour), tree.now.Add(time.Hour)))
+
+		ds, err := dnssec.ComputeDS(c.name, zone.ksk.DNSKEY, dnssec.DigestSHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parent == nil {
+			tree.anchors = []records.ResourceRecord{rr(".", records.TypeDS, ds)}
+		} else {
+			tree.answer(rrsetKey{c.name, records.TypeDS}, parent.signRRset(t, tree, rr(c.name, records.TypeDS, ds)))
+		}
+		parent = zone
+	}
+	// "test" proves that plain.test is delegated without DS records
+	tree.deny(t, "plain.test", tree.zones["test"], rr("plain.test", records.TypeNSEC, records.NSECData{
+		NextDomain: "zone.test", Types: []uint16{records.TypeNS, records.TypeRRSIG, records.TypeNSEC},
+	}))
+	return tree
+}
+
+func (tree *signedTree) answer(key rrsetKey, answer []records.ResourceRecord) {
+	tree.querier.responses[key] = &UpstreamResponse{Answer: answer}
+}
+
+// deny answers the DS query for name with the signed denial records of zone
+func (tree *signedTree) deny(t *testing.T, name string, zone *testZone, proof ...records.ResourceRecord) {
+	t.Helper()
+	tree.querier.responses[rrsetKey{name, records.TypeDS}] = &UpstreamResponse{Authority: zone.signRRset(t, tree, proof...)}
+}
+
+func (z *testZone) signRRset(t *testing.T, tree *signedTree, rrs ...records.ResourceRecord) []records.ResourceRecord {
+	return z.sign(t, z.zsk, rrs, tree.now.Add(-time.Hour), tree.now.Add(time.Hour))
+}
+
+func (tree *signedTree) validator(t *testing.T) *Validator {
+	t.Helper()
+	v, err := NewValidator(tree.querier, tree.anchors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return tree.now }
+	return v
+}
+
+func TestValidator_SecureAnswer(t *testing.T) {
+	tree := newSignedTree(t)
+	zone := tree.zones["zone.test"]
+	tree.answer(rrsetKey{"www.zone.test", records.TypeA},
+		zone.signRRset(t, tree, rr("www.zone.test", records.TypeA, "192.0.2.1"), rr("www.zone.test", records.TypeA, "192.0.2.2")))
+
+	resp, secure, err := tree.validator(t).Validate(context.Background(), "WWW.zone.test", records.TypeA)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if !secure {
+		t.Error("expected a secure answer")
+	}
+	if data, _ := answersOfType(resp.Answer, records.TypeA); len(data.([]interface{})) != 2 {
+		t.Errorf("expected 2 addresses, got %v", data)
+	}
+}
+
+func TestValidator_CNAMEChainAcrossZones(t *testing.T) {
+	tree := newSignedTree(t)
+	answer := tree.zones["zone.test"].signRRset(t, tree, rr("alias.zone.test", records.TypeCNAME, "host.test"))
+	answer = append(answer, tree.zones["test"].signRRset(t, tree, rr("host.test", records.TypeA, "192.0.2.7"))...)
+	tree.answer(rrsetKey{"alias.zone.test", records.TypeA}, answer)
+
+	resp, secure, err := tree.validator(t).Validate(context.Background(), "alias.zone.test", records.TypeA)
+	if err != nil || !secure {
+		t.Fatalf("Validate: secure=%v err=%v", secure, err)
+	}
+	data, err := answersOfType(resp.Answer, records.TypeA)
+	if err != nil || data != "192.0.2.7" {
+		t.Errorf("answersOfType = %v, %v", data, err)
+	}
+}
+
+func TestValidator_Bogus(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, tree *signedTree) []records.ResourceRecord
+	}{
+		{"tampered", func(t *testing.T, tree *signedTree) []records.ResourceRecord {
+			answer := tree.zones["zone.test"].signRRset(t, tree, rr("www.zone.test", records.TypeA, "192.0.2.1"))
+			answer[0].Data = "203.0.113.66"
+			return answer
+		}},
+		{"stripped_signature", func(t *testing.T, tree *signedTree) []records.ResourceRecord {
+			return []records.ResourceRecord{rr("www.zone.test", records.TypeA, "192.0.2.1")}
+		}},
+		{"expired", func(t *testing.T, tree *signedTree) []records.ResourceRecord {
+			zone := tree.zones["zone.test"]
+			return zone.sign(t, zone.zsk, []records.ResourceRecord{rr("www.zone.test", records.TypeA, "192.0.2.1")}, tree.now.Add(-2*time.Hour), tree.now.Add(-time.Hour))
+		}},
+		{"untrusted_key", func(t *testing.T, tree *signedTree) []records.ResourceRecord {
+			rogue := newTestZone(t, "zone.test", dnssec.AlgED25519)
+			return rogue.signRRset(t, tree, rr("www.zone.test", records.TypeA, "192.0.2.1"))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newSignedTree(t)
+			tree.answer(rrsetKey{"www.zone.test", records.TypeA}, tt.setup(t, tree))
+
+			_, _, err := tree.validator(t).Validate(context.Background(), "www.zone.test", records.TypeA)
+			if !errors.Is(err, ErrBogus) {
+				t.Errorf("expected ErrBogus, got %v", err)
+			}
+		})
+	}
+}
+
+func TestValidator_NXDomain(t *testing.T) {
+	tests := []struct {
+		name   string
+		proof  bool
+		secure bool
+	}{
+		{"proven", true, true},
+		{"stripped_proof", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newSignedTree(t)
+			zone := tree.zones["zone.test"]
+			// The span from the apex to www covers both the name and *.zone.test
+			nsec := rr("zone.test", records.TypeNSEC, records.NSECData{
+				NextDomain: "www.zone.test", Types: []uint16{records.TypeSOA, records.TypeNS, records.TypeDNSKEY, records.TypeRRSIG, records.TypeNSEC},
+			})
+			tree.deny(t, "missing.zone.test", zone, nsec)
+			resp := &UpstreamResponse{Rcode: rcodeNXDomain}
+			if tt.proof {
+				resp.Authority = zone.signRRset(t, tree, nsec)
+			}
+			tree.querier.responses[rrsetKey{"missing.zone.test", records.TypeA}] = resp
+
+			got, secure, err := tree.validator(t).Validate(context.Background(), "missing.zone.test", records.TypeA)
+			if !tt.secure {
+				if !errors.Is(err, ErrBogus) {
+					t.Errorf("expected ErrBogus, got %v", err)
+				}
+				return
+			}
+			if err != nil || !secure || got.Rcode != rcodeNXDomain {
+				t.Fatalf("Validate: secure=%v err=%v, want a secure NXDOMAIN", secure, err)
+			}
+
+			resolver := NewDNSResolver("127.0.0.1:1")
+			resolver.validator = tree.validator(t)
+			reply := serve(t, context.Background(), ForwardHandler(resolver), queryMsg("missing.zone.test", records.TypeA))
+			if reply.Rcode != rcodeNXDomain || !reply.AuthenticatedData {
+				t.Errorf("reply rcode %d, AD %v; want NXDOMAIN with AD", reply.Rcode, reply.AuthenticatedData)
+			}
+		})
+	}
+}
+
+func TestValidator_NoDataNSEC3(t *testing.T) {
+	tree := newSignedTree(t)
+	zone := tree.zones["zone.test"]
+	hash, err := dnssec.HashName("www.zone.test", records.NSEC3HashSHA1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := append([]byte(nil), hash...)
+	next[len(next)-1]++
+	nsec3 := rr(records.Base32Hex.EncodeToString(hash)+".zone.test", records.TypeNSEC3, records.NSEC3Data{
+		HashAlgorithm: records.NSEC3HashSHA1, NextHashed: next, Types: []uint16{records.TypeA, records.TypeRRSIG},
+	})
+	tree.deny(t, "www.zone.test", zone, nsec3)
+	tree.querier.responses[rrsetKey{"www.zone.test", records.TypeTXT}] = &UpstreamResponse{Authority: zone.signRRset(t, tree, nsec3)}
+	tree.querier.responses[rrsetKey{"www.zone.test", records.TypeA}] = &UpstreamResponse{Authority: zone.signRRset(t, tree, nsec3)}
+	v := tree.validator(t)
+
+	if resp, secure, err := v.Validate(context.Background(), "www.zone.test", records.TypeTXT); err != nil || !secure || resp.Rcode != 0 {
+		t.Errorf("NODATA: secure=%v err=%v, want a secure empty answer", secure, err)
+	}
+	// The record lists A, so it cannot deny it
+	if _, _, err := v.Validate(context.Background(), "www.zone.test", records.TypeA); !errors.Is(err, ErrBogus) {
+		t.Errorf("denied A: expected ErrBogus, got %v", err)
+	}
+}
+
+func TestValidator_Wildcard(t *testing.T) {
+	tests := []struct {
+		name   string
+		proof  bool
+		secure bool
+	}{
+		{"proven", true, true},
+		{"no_closer_proof", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newSignedTree(t)
+			zone := tree.zones["zone.test"]
+			// Signed as *.zone.test, so its RRSIG has fewer labels than the owner
+			answer := zone.signRRset(t, tree, rr("*.zone.test", records.TypeA, "192.0.2.5"))
+			for i := range answer {
+				answer[i].Name = "host.zone.test"
+			}
+			resp := &UpstreamResponse{Answer: answer}
+			if tt.proof {
+				resp.Authority = zone.signRRset(t, tree, rr("*.zone.test", records.TypeNSEC, records.NSECData{
+					NextDomain: "www.zone.test", Types: []uint16{records.TypeA, records.TypeRRSIG, records.TypeNSEC},
+				}))
+			}
+			tree.querier.responses[rrsetKey{"host.zone.test", records.TypeA}] = resp
+
+			_, secure, err := tree.validator(t).Validate(context.Background(), "host.zone.test", records.TypeA)
+			if !tt.secure {
+				if !errors.Is(err, ErrBogus) {
+					t.Errorf("expected ErrBogus, got %v", err)
+				}
+				return
+			}
+			if err != nil || !secure {
+				t.Errorf("Validate: secure=%v err=%v", secure, err)
+			}
+		})
+	}
+}
+
+func TestValidator_BrokenChain(t *testing.T) {
+	tree := newSignedTree(t)
+	zone := tree.zones["zone.test"]
+	tree.answer(rrsetKey{"www.zone.test", records.TypeA}, zone.signRRset(t, tree, rr("www.zone.test", records.TypeA, "192.0.2.1")))
+
+	// Replace the parent's DS with one for a different key
+	other := newTestZone(t, "zone.test", dnssec.AlgED25519)
+	ds, _ := dnssec.ComputeDS("zone.test", other.ksk.DNSKEY, dnssec.DigestSHA256)
+	tree.answer(rrsetKey{"zone.test", records.TypeDS}, tree.zones["test"].signRRset(t, tree, rr("zone.test", records.TypeDS, ds)))
+
+	if _, _, err := tree.validator(t).Validate(context.Background(), "www.zone.test", records.TypeA); !errors.Is(err, ErrBogus) {
+		t.Errorf("expected ErrBogus, got %v", err)
+	}
+}
+
+func TestValidator_InsecureDelegation(t *testing.T) {
+	tree := newSignedTree(t)
+	tree.answer(rrsetKey{"www.plain.test", records.TypeA}, []records.ResourceRecord{rr("www.plain.test", records.TypeA, "192.0.2.9")})
+
+	resp, secure, err := tree.validator(t).Validate(context.Background(), "www.plain.test", records.TypeA)
+	if err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if secure || len(resp.Answer) != 1 {
+		t.Errorf("expected one insecure answer, got secure=%v answers=%v", secure, resp.Answer)
+	}
+}
+
+func TestValidator_InsecureDelegationNSEC3OptOut(t *testing.T) {
+	tree := newSignedTree(t)
+	parent := tree.zones["test"]
+	hash, err := dnssec.HashName("plain.test", records.NSEC3HashSHA1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An opt-out NSEC3 whose span covers the hash of plain.test
+	before, after := append([]byte(nil), hash...), append([]byte(nil), hash...)
+	before[len(before)-1]--
+	after[len(after)-1]++
+	owner := records.Base32Hex.EncodeToString(before) + ".test"
+	tree.deny(t, "plain.test", parent, rr(owner, records.TypeNSEC3, records.NSEC3Data{
+		HashAlgorithm: records.NSEC3HashSHA1, Flags: records.NSEC3FlagOptOut, NextHashed: after, Types: []uint16{records.TypeNS},
+	}))
+	tree.answer(rrsetKey{"www.plain.test", records.TypeA}, []records.ResourceRecord{rr("www.plain.test", records.TypeA, "192.0.2.9")})
+
+	if _, secure, err := tree.validator(t).Validate(context.Background(), "www.plain.test", records.TypeA); err != nil || secure {
+		t.Errorf("Validate: secure=%v err=%v, want an insecure answer", secure, err)
+	}
+}
+
+func TestValidator_StrippedDS(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, tree *signedTree)
+	}{
+		{"no_proof", func(t *testing.T, tree *signedTree) {
+			tree.querier.responses[rrsetKey{"zone.test", records.TypeDS}] = &UpstreamResponse{}
+		}},
+		{"nxdomain", func(t *testing.T, tree *signedTree) {
+			tree.querier.responses[rrsetKey{"zone.test", records.TypeDS}] = &UpstreamResponse{Rcode: 3}
+		}},
+		{"unsigned_proof", func(t *testing.T, tree *signedTree) {
+			tree.querier.responses[rrsetKey{"zone.test", records.TypeDS}] = &UpstreamResponse{Authority: []records.ResourceRecord{
+				rr("zone.test", records.TypeNSEC, records.NSECData{NextDomain: "test", Types: []uint16{records.TypeNS}}),
+			}}
+		}},
+		{"proof_signed_by_child", func(t *testing.T, tree *signedTree) {
+			tree.deny(t, "zone.test", tree.zones["zone.test"], rr("zone.test", records.TypeNSEC, records.NSECData{NextDomain: "test", Types: []uint16{records.TypeNS}}))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := newSignedTree(t)
+			tt.setup(t, tree)
+			// The attacker strips the RRSIGs along with the DS
+			tree.answer(rrsetKey{"www.zone.test", records.TypeA}, []records.ResourceRecord{rr("www.zone.test", records.TypeA, "203.0.113.66")})
+
+			if _, _, err := tree.validator(t).Validate(context.Background(), "www.zone.test", records.TypeA); !errors.Is(err, ErrBogus) {
+				t.Fatalf("expected ErrBogus, got %v", err)
+			}
+
+			resolver := NewDNSResolver("127.0.0.1:1")
+			resolver.validator = tree.validator(t)
+			resp := serve(t, context.Background(), ForwardHandler(resolver), queryMsg("www.zone.test", records.TypeA))
+			if resp.Rcode != rcodeServFail {
+				t.Errorf("rcode = %d, want SERVFAIL", resp.Rcode)
+			}
+		})
+	}
+}
+
+func TestValidator_SignerOutsideOwner(t *testing.T) {
+	tree := newSignedTree(t)
+	// A signature naming plain.test, which is insecure, says nothing
+	// about zone.test
+	answer := tree.zones["zone.test"].signRRset(t, tree, rr("www.zone.test", records.TypeA, "203.0.113.66"))
+	sig := answer[1].Data.(records.RRSIGData)
+	sig.SignerName = "plain.test"
+	answer[1].Data = sig
+	tree.answer(rrsetKey{"www.zone.test", records.TypeA}, answer)
+
+	if _, _, err := tree.validator(t).Validate(context.Background(), "www.zone.test", records.TypeA); !errors.Is(err, ErrBogus) {
+		t.Errorf("expected ErrBogus, got %v", err)
+	}
+}
+
+func TestValidator_CachesKeys(t *testing.T) {
+	tree := newSignedTree(t)
+	zone := tree.zones["zone.test"]
+	tree.answer(rrsetKey{"www.zone.test", records.TypeA}, zone.signRRset(t, tree, rr("www.zone.test", records.TypeA, "192.0.2.1")))
+	v := tree.validator(t)
+	if _, _, err := v.Validate(context.Background(), "www.zone.test", records.TypeA); err != nil {
+		t.Fatal(err)
+	}
+
+	// The key chain is cached, so the DNSKEY and DS answers are no longer needed
+	for key := range tree.querier.responses {
+		if key.rtype == records.TypeDNSKEY || key.rtype == records.TypeDS {
+			delete(tree.querier.responses, key)
+		}
+	}
+	if _, secure, err := v.Validate(context.Background(), "www.zone.test", records.TypeA); err != nil || !secure {
+		t.Errorf("cached validation: secure=%v err=%v", secure, err)
+	}
+}
+
+func TestParseTrustAnchors(t *testing.T) {
+	anchors, err := ParseTrustAnchors(strings.NewReader(DefaultTrustAnchors + `
+; comment line
+example.com. 3600 IN DNSKEY 257 3 13 GojIhhXUN/u4v54ZQqGSnyhWJwaubCvTmeexv7bR6edbkrSqQpF64cYbcB7wNcP+e+MAnLr+Wi9xMWyQLc8NAA==
+`))
+	if err != nil {
+		t.Fatalf("ParseTrustAnchors: %v", err)
+	}
+	if len(anchors) != 3 {
+		t.Fatalf("expected 3 anchors, got %d", len(anchors))
+	}
+	if ds := anchors[0].Data.(records.DSData); anchors[0].Name != "." || ds.KeyTag != 20326 || ds.Algorithm != 8 {
+		t.Errorf("unexpected root anchor %+v", anchors[0])
+	}
+	if anchors[2].Name != "example.com" || anchors[2].Type != records.TypeDNSKEY {
+		t.Errorf("unexpected key anchor %+v", anchors[2])
+	}
+
+	for _, bad := range []string{". IN A 192.0.2.1", ". IN", ". IN DS 1 2"} {
+		if _, err := ParseTrustAnchors(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
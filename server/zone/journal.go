@@ -0,0 +1,154 @@
+package zone
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// DefaultJournalSize is the number of deltas a journal keeps for IXFR
+const DefaultJournalSize = 100
+
+// Delta is the change between two versions of a zone (RFC 1995). The SOA
+// records are carried separately from the removed and added records.
+type Delta struct {
+	OldSOA  records.ResourceRecord
+	NewSOA  records.ResourceRecord
+	Removed []records.ResourceRecord
+	Added   []records.ResourceRecord
+}
+
+// Diff computes the delta turning old into new. A record whose TTL changed
+// is removed and added again.
+func Diff(old, new *Zone) (Delta, error) {
+	oldSOA, _, err := old.SOA()
+	if err != nil {
+		return Delta{}, err
+	}
+	newSOA, _, err := new.SOA()
+	if err != nil {
+		return Delta{}, err
+	}
+
+	before := recordSet(old)
+	after := recordSet(new)
+	d := Delta{OldSOA: oldSOA, NewSOA: newSOA}
+	for _, rr := range old.Records() {
+		if rr.Type != records.TypeSOA && !after[recordKey(rr)] {
+			d.Removed = append(d.Removed, rr)
+		}
+	}
+	for _, rr := range new.Records() {
+		if rr.Type != records.TypeSOA && !before[recordKey(rr)] {
+			d.Added = append(d.Added, rr)
+		}
+	}
+	return d, nil
+}
+
+// Empty reports whether the delta changes nothing, the SOA included
+func (d Delta) Empty() bool {
+	return len(d.Removed) == 0 && len(d.Added) == 0 && recordKey(d.OldSOA) == recordKey(d.NewSOA)
+}
+
+func recordSet(z *Zone) map[string]bool {
+	set := make(map[string]bool)
+	for _, rr := range z.Records() {
+		set[recordKey(rr)] = true
+	}
+	return set
+}
+
+// recordKey identifies a record by owner, type, TTL and wire RDATA
+func recordKey(rr records.ResourceRecord) string {
+	rdata := fmt.Sprint(rr.Data)
+	if handler, ok := records.HandlerFor(rr.Type); ok {
+		if wire, err := handler.BuildRecordData(rr.Data); err == nil {
+			rdata = string(wire)
+		}
+	}
+	return fmt.Sprintf("%s/%d/%d/%s", rr.Name, rr.Type, rr.TTL, rdata)
+}
+
+// Apply returns a copy of z with d applied. The SOA of z must match the
+// delta's old SOA serial.
+func (d Delta) Apply(z *Zone) (*Zone, error) {
+	oldSerial := d.OldSOA.Data.(records.SOAData).Serial
+	if z.Serial() != oldSerial {
+		return nil, fmt.Errorf("delta starts at serial %d, zone %s is at %d", oldSerial, z.Origin, z.Serial())
+	}
+
+	// Rebuilding rather than deleting in place drops nodes left empty
+	removed := make(map[string]bool, len(d.Removed))
+	for _, rr := range d.Removed {
+		removed[recordKey(rr)] = true
+	}
+	next := New(z.Origin)
+	for _, rr := range append([]records.ResourceRecord{d.NewSOA}, d.Added...) {
+		if err := next.Add(rr); err != nil {
+			return nil, err
+		}
+	}
+	for _, rr := range z.Records() {
+		if rr.Type == records.TypeSOA || removed[recordKey(rr)] {
+			continue
+		}
+		if err := next.Add(rr); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// Journal keeps the most recent deltas of a zone so secondaries can
+// catch up with IXFR instead of a full transfer
+type Journal struct {
+	mu     sync.Mutex
+	size   int
+	deltas []Delta
+}
+
+// NewJournal creates a journal holding up to size deltas
+func NewJournal(size int) *Journal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+	return &Journal{size: size}
+}
+
+// Append records a delta, dropping the oldest beyond the journal size
+func (j *Journal) Append(d Delta) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.deltas = append(j.deltas, d)
+	if len(j.deltas) > j.size {
+		j.deltas = append([]Delta(nil), j.deltas[len(j.deltas)-j.size:]...)
+	}
+}
+
+// Since returns the consecutive deltas leading from serial to the latest
+// version, or false when the journal no longer reaches back to serial
+func (j *Journal) Since(serial uint32) ([]Delta, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, d := range j.deltas {
+		if d.OldSOA.Data.(records.SOAData).Serial != serial {
+			continue
+		}
+		chain := j.deltas[i:]
+		for k := 1; k < len(chain); k++ {
+			if chain[k].OldSOA.Data.(records.SOAData).Serial != chain[k-1].NewSOA.Data.(records.SOAData).Serial {
+				return nil, false
+			}
+		}
+		return append([]Delta(nil), chain...), true
+	}
+	return nil, false
+}
+
+// SerialNewer reports whether serial a is newer than b in RFC 1982
+// sequence space arithmetic
+func SerialNewer(a, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
@@ -0,0 +1,100 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func nextVersion(t *testing.T, z *Zone, serial uint32, edit func(*Zone)) *Zone {
+	t.Helper()
+	next := z.Clone()
+	soa, data, err := next.SOA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Serial = serial
+	soa.Data = data
+	next.RemoveRRset(next.Origin, records.TypeSOA)
+	if err := next.Add(soa); err != nil {
+		t.Fatal(err)
+	}
+	edit(next)
+	return next
+}
+
+func TestDiffApply(t *testing.T) {
+	v1 := loadExample(t)
+	v2 := nextVersion(t, v1, 2024010102, func(z *Zone) {
+		z.RemoveRRset("a.b.c.example.com", records.TypeA)
+		z.Add(records.ResourceRecord{Name: "new.example.com", Type: records.TypeA, TTL: 60, Data: "192.0.2.7"})
+	})
+
+	d, err := Diff(v1, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Name != "a.b.c.example.com" {
+		t.Errorf("Unexpected removed records %+v", d.Removed)
+	}
+	if len(d.Added) != 1 || d.Added[0].Name != "new.example.com" {
+		t.Errorf("Unexpected added records %+v", d.Added)
+	}
+
+	applied, err := d.Apply(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied.Serial() != 2024010102 || len(applied.Records()) != len(v2.Records()) {
+		t.Errorf("Applied zone differs: serial %d, %d records", applied.Serial(), len(applied.Records()))
+	}
+	if applied.Exists("b.c.example.com") {
+		t.Error("Empty non-terminals of removed names must disappear")
+	}
+
+	if _, err := d.Apply(v2); err == nil || !strings.Contains(err.Error(), "serial") {
+		t.Errorf("Expected a serial mismatch error, got %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	v1 := loadExample(t)
+	v2 := nextVersion(t, v1, 2, func(*Zone) {})
+	v3 := nextVersion(t, v2, 3, func(*Zone) {})
+	v4 := nextVersion(t, v3, 4, func(*Zone) {})
+
+	j := NewJournal(2)
+	for _, pair := range [][2]*Zone{{v1, v2}, {v2, v3}, {v3, v4}} {
+		d, err := Diff(pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.Append(d)
+	}
+
+	if deltas, ok := j.Since(2); !ok || len(deltas) != 2 {
+		t.Errorf("Expected 2 deltas since serial 2, got %d (%v)", len(deltas), ok)
+	}
+	if _, ok := j.Since(v1.Serial()); ok {
+		t.Error("The oldest delta should have been dropped")
+	}
+}
+
+func TestSerialNewer(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{2, 1, true},
+		{1, 2, false},
+		{1, 1, false},
+		{0, 0xFFFFFFFF, true}, // wrap-around
+		{0xFFFFFFFF, 0, false},
+	}
+	for _, tt := range tests {
+		if got := SerialNewer(tt.a, tt.b); got != tt.want {
+			t.Errorf("SerialNewer(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package zone
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// token is one field of a zone file entry. raw keeps the escapes as
+// written, which $GENERATE needs to tell "\$" from "$".
+type token struct {
+	text   string
+	raw    string
+	quoted bool
+}
+
+// entry is one logical line of a zone file; parentheses join physical
+// lines into one entry
+type entry struct {
+	tokens     []token
+	blankOwner bool // the entry starts with blanks, inheriting the owner
+	line       int
+}
+
+// lexer splits master file text (RFC 1035 section 5.1) into entries
+type lexer struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newLexer(r io.Reader) *lexer {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return &lexer{scanner: scanner}
+}
+
+// next returns the next entry holding at least one token, or io.EOF
+func (l *lexer) next() (entry, error) {
+	var e entry
+	depth := 0
+	for l.scanner.Scan() {
+		l.line++
+		text := l.scanner.Text()
+		if len(e.tokens) == 0 && depth == 0 {
+			e.line = l.line
+			e.blankOwner = len(text) > 0 && (text[0] == ' ' || text[0] == '\t')
+		}
+		tokens, err := splitLine(text, &depth)
+		if err != nil {
+			return entry{}, fmt.Errorf("line %d: %w", l.line, err)
+		}
+		e.tokens = append(e.tokens, tokens...)
+		if depth == 0 && len(e.tokens) > 0 {
+			return e, nil
+		}
+	}
+	if err := l.scanner.Err(); err != nil {
+		return entry{}, err
+	}
+	if depth > 0 {
+		return entry{}, fmt.Errorf("line %d: unbalanced parentheses", e.line)
+	}
+	return entry{}, io.EOF
+}
+
+// splitLine tokenizes one physical line, tracking the parenthesis depth
+// carried over from previous lines. Comments run from ';' to the end of
+// the line.
+func splitLine(line string, depth *int) ([]token, error) {
+	var tokens []token
+	var raw strings.Builder
+	inField, quoted := false, false
+
+	flush := func() error {
+		if !inField {
+			return nil
+		}
+		text, err := unescape(raw.String(), quoted)
+		if err != nil {
+			return err
+		}
+		tokens = append(tokens, token{text: text, raw: raw.String(), quoted: quoted})
+		raw.Reset()
+		inField, quoted = false, false
+		return nil
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			raw.WriteByte(c)
+			raw.WriteByte(line[i+1])
+			i++
+			inField = true
+		case c == '"':
+			if quoted {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			quoted, inField = true, true
+		case quoted:
+			raw.WriteByte(c)
+		case c == ';':
+			i = len(line)
+		case c == '(' || c == ')':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			if c == '(' {
+				*depth++
+			} else if *depth--; *depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case c == ' ' || c == '\t' || c == '\r':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		default:
+			raw.WriteByte(c)
+			inField = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// unescape decodes \DDD decimal octets and \X literal characters. The
+// generic RDATA marker \# stays recognisable outside quotes.
+func unescape(raw string, quoted bool) (string, error) {
+	if !strings.Contains(raw, `\`) {
+		return raw, nil
+	}
+	if !quoted && raw == `\#` {
+		return raw, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c != '\\' || i+1 == len(raw) {
+			out.WriteByte(c)
+			continue
+		}
+		if i+3 < len(raw) && isDigits(raw[i+1:i+4]) {
+			v, _ := strconv.Atoi(raw[i+1 : i+4])
+			if v > 255 {
+				return "", fmt.Errorf("invalid escape \\%s", raw[i+1:i+4])
+			}
+			out.WriteByte(byte(v))
+			i += 3
+			continue
+		}
+		out.WriteByte(raw[i+1])
+		i++
+	}
+	return out.String(), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
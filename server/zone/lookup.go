@@ -0,0 +1,178 @@
+package zone
+
+import (
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Response codes produced by lookups
+const (
+	RcodeSuccess   = 0
+	RcodeNameError = 3 // NXDOMAIN
+)
+
+// TypeANY is the QTYPE asking for every RRset at a name
+const TypeANY = 255
+
+// maxCNAMEChain bounds CNAME chasing inside one zone
+const maxCNAMEChain = 8
+
+// Answer is the result of an authoritative lookup, section by section
+type Answer struct {
+	Rcode      uint16
+	Answer     []records.ResourceRecord
+	Authority  []records.ResourceRecord
+	Additional []records.ResourceRecord
+	// Referral is set when the lookup ended at a zone cut: Authority holds
+	// the delegation NS RRset and Additional its glue
+	Referral bool
+}
+
+// Lookup answers qname/qtype from the zone data. CNAMEs are followed while
+// their targets stay inside the zone. Names below a zone cut get a
+// referral, names that do not exist are synthesised from a wildcard at
+// their closest encloser (RFC 4592) and empty non-terminals get NODATA.
+// Negative answers carry the SOA in the authority section with the
+// negative caching TTL (RFC 2308).
+func (z *Zone) Lookup(qname string, qtype uint16) Answer {
+	var ans Answer
+	name := dnssec.CanonicalName(qname)
+
+	for hops := 0; ; hops++ {
+		// The parent side of a cut only answers DS queries for the cut itself
+		if cut, ok := z.Delegation(name); ok && (cut != name || qtype != records.TypeDS) {
+			ans.Referral = true
+			ans.Authority = z.RRset(cut, records.TypeNS)
+			ans.Additional = z.glue(ans.Authority)
+			return ans
+		}
+
+		source := name
+		if !z.Exists(name) {
+			source = "*." + closestEncloser(z, name)
+			if !z.Exists(source) {
+				// NXDOMAIN describes the last name of a CNAME chain (RFC 6604)
+				ans.Rcode = RcodeNameError
+				ans.Authority = z.negativeSOA()
+				break
+			}
+		}
+
+		if rrs := z.matching(source, qtype); len(rrs) > 0 {
+			ans.Answer = append(ans.Answer, withOwner(rrs, name)...)
+			break
+		}
+
+		cname := z.RRset(source, records.TypeCNAME)
+		if len(cname) == 0 || qtype == records.TypeCNAME || hops >= maxCNAMEChain {
+			if len(ans.Answer) == 0 {
+				ans.Authority = z.negativeSOA()
+			}
+			break
+		}
+		ans.Answer = append(ans.Answer, withOwner(cname, name)[0])
+		name = dnssec.CanonicalName(cname[0].Data.(string))
+		if !dnssec.IsSubdomain(name, z.Origin) {
+			break
+		}
+	}
+
+	ans.Additional = z.additional(ans.Answer)
+	return ans
+}
+
+// closestEncloser returns the longest existing ancestor of qname
+func closestEncloser(z *Zone, qname string) string {
+	name := qname
+	for !z.Exists(name) && name != z.Origin {
+		name = dnssec.Parent(name)
+	}
+	return name
+}
+
+// withOwner returns rrs with their owner replaced by name, which expands
+// records synthesised from a wildcard
+func withOwner(rrs []records.ResourceRecord, name string) []records.ResourceRecord {
+	if len(rrs) == 0 || rrs[0].Name == name {
+		return rrs
+	}
+	out := make([]records.ResourceRecord, len(rrs))
+	for i, rr := range rrs {
+		rr.Name = name
+		out[i] = rr
+	}
+	return out
+}
+
+// matching returns the RRset of qtype at name, or every RRset for ANY
+func (z *Zone) matching(name string, qtype uint16) []records.ResourceRecord {
+	if qtype != TypeANY {
+		return z.RRset(name, qtype)
+	}
+	var rrs []records.ResourceRecord
+	for _, rtype := range z.Types(name) {
+		rrs = append(rrs, z.RRset(name, rtype)...)
+	}
+	return rrs
+}
+
+// negativeSOA returns the apex SOA with its TTL lowered to the SOA minimum
+func (z *Zone) negativeSOA() []records.ResourceRecord {
+	rr, soa, err := z.SOA()
+	if err != nil {
+		return nil
+	}
+	if soa.Minimum < rr.TTL {
+		rr.TTL = soa.Minimum
+	}
+	return []records.ResourceRecord{rr}
+}
+
+// NegativeTTL is the TTL of negative answers and of denial records
+func (z *Zone) NegativeTTL() uint32 {
+	if soa := z.negativeSOA(); len(soa) > 0 {
+		return soa[0].TTL
+	}
+	return records.DefaultTTL
+}
+
+// additional collects in-zone addresses for names referenced by the answer
+func (z *Zone) additional(answer []records.ResourceRecord) []records.ResourceRecord {
+	var out []records.ResourceRecord
+	seen := make(map[string]bool)
+	for _, rr := range answer {
+		handler, _ := records.HandlerFor(rr.Type)
+		namer, ok := handler.(records.AdditionalNamer)
+		if !ok {
+			continue
+		}
+		for _, name := range namer.AdditionalNames(rr.Data) {
+			name = dnssec.CanonicalName(name)
+			if seen[name] || !dnssec.IsSubdomain(name, z.Origin) {
+				continue
+			}
+			seen[name] = true
+			out = append(out, z.RRset(name, records.TypeA)...)
+			out = append(out, z.RRset(name, records.TypeAAAA)...)
+		}
+	}
+	return out
+}
+
+// glue returns the in-zone addresses of the name servers of a delegation.
+// They are needed when the servers lie inside the delegated zone and are
+// otherwise unreachable.
+func (z *Zone) glue(ns []records.ResourceRecord) []records.ResourceRecord {
+	var out []records.ResourceRecord
+	seen := make(map[string]bool)
+	for _, rr := range ns {
+		host := dnssec.CanonicalName(rr.Data.(string))
+		if seen[host] || !dnssec.IsSubdomain(host, z.Origin) {
+			continue
+		}
+		seen[host] = true
+		out = append(out, z.RRset(host, records.TypeA)...)
+		out = append(out, z.RRset(host, records.TypeAAAA)...)
+	}
+	return out
+}
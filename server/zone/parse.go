@@ -0,0 +1,403 @@
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// maxIncludeDepth bounds nested $INCLUDE so a file including itself fails
+const maxIncludeDepth = 10
+
+// LoadFile reads and validates the zone file at path. Relative $INCLUDE
+// paths are resolved against the file's directory.
+func LoadFile(path, origin string) (*Zone, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	z := New(origin)
+	p := &parser{zone: z, origin: z.Origin, ttl: records.DefaultTTL, dir: filepath.Dir(path)}
+	if err := p.parse(f, path); err != nil {
+		return nil, err
+	}
+	return z, z.Validate()
+}
+
+// Parse reads a zone in master file format (RFC 1035 section 5): $ORIGIN,
+// $TTL, $INCLUDE and BIND's $GENERATE, "@", owners inherited from the
+// previous entry, parentheses spanning lines, quoted strings with escapes,
+// TTLs with units and comments. Relative $INCLUDE paths are resolved
+// against the working directory.
+func Parse(r io.Reader, origin string) (*Zone, error) {
+	z := New(origin)
+	p := &parser{zone: z, origin: z.Origin, ttl: records.DefaultTTL}
+	if err := p.parse(r, ""); err != nil {
+		return nil, err
+	}
+	return z, z.Validate()
+}
+
+type parser struct {
+	zone   *Zone
+	origin string
+	ttl    uint32
+	owner  string
+	dir    string
+	depth  int
+}
+
+// parse adds the records of one file to the zone. name prefixes errors.
+func (p *parser) parse(r io.Reader, name string) error {
+	lex := newLexer(r)
+	for {
+		e, err := lex.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return prefixError(name, err)
+		}
+		if err := p.parseEntry(e); err != nil {
+			return prefixError(name, fmt.Errorf("line %d: %w", e.line, err))
+		}
+	}
+}
+
+func prefixError(name string, err error) error {
+	if name == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
+
+// parseEntry handles a directive or a "[owner] [ttl] [class] type rdata"
+// record
+func (p *parser) parseEntry(e entry) error {
+	fields := e.tokens
+	if !e.blankOwner && !fields[0].quoted {
+		switch strings.ToUpper(fields[0].text) {
+		case "$ORIGIN":
+			if len(fields) != 2 {
+				return errors.New("$ORIGIN expects one name")
+			}
+			p.origin = absoluteName(fields[1].text, p.origin)
+			return nil
+		case "$TTL":
+			if len(fields) != 2 {
+				return errors.New("$TTL expects one value")
+			}
+			ttl, err := parseTTL(fields[1].text)
+			if err != nil {
+				return fmt.Errorf("invalid $TTL: %w", err)
+			}
+			p.ttl = ttl
+			return nil
+		case "$INCLUDE":
+			return p.include(fields[1:])
+		case "$GENERATE":
+			return p.generate(fields[1:])
+		}
+	}
+
+	if !e.blankOwner {
+		p.owner = absoluteName(fields[0].text, p.origin)
+		fields = fields[1:]
+	}
+	if p.owner == "" {
+		return errors.New("record without owner name")
+	}
+	rr, err := p.parseRecord(p.owner, fields)
+	if err != nil {
+		return err
+	}
+	return p.zone.Add(rr)
+}
+
+// parseRecord parses "[ttl] [class] type rdata" for owner; TTL and class
+// may come in either order
+func (p *parser) parseRecord(owner string, fields []token) (records.ResourceRecord, error) {
+	rr := records.ResourceRecord{Name: owner, Class: records.ClassIN, TTL: p.ttl}
+	for len(fields) > 0 && !fields[0].quoted {
+		if ttl, err := parseTTL(fields[0].text); err == nil {
+			rr.TTL = ttl
+		} else if !strings.EqualFold(fields[0].text, "IN") {
+			break
+		}
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return records.ResourceRecord{}, errors.New("missing record type")
+	}
+
+	rtype, err := records.TypeByName(fields[0].text)
+	if err != nil {
+		return records.ResourceRecord{}, err
+	}
+	rr.Type = rtype
+
+	rdata := make([]string, 0, len(fields)-1)
+	for _, f := range fields[1:] {
+		rdata = append(rdata, f.text)
+	}
+	if rtype == records.TypeSOA && len(rdata) == 7 {
+		// The SOA timers accept TTL units too
+		for i := 2; i < 7; i++ {
+			if v, err := parseTTL(rdata[i]); err == nil {
+				rdata[i] = strconv.FormatUint(uint64(v), 10)
+			}
+		}
+	}
+	if rr.Data, err = parseRData(rtype, rdata, p.origin); err != nil {
+		return records.ResourceRecord{}, fmt.Errorf("%s record at %s: %w", fields[0].text, rr.Name, err)
+	}
+	return rr, nil
+}
+
+// include handles "$INCLUDE file [origin]". The included file starts from
+// the given or current origin; directives in it do not affect this file.
+func (p *parser) include(args []token) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("$INCLUDE expects a file name and an optional origin")
+	}
+	if p.depth >= maxIncludeDepth {
+		return fmt.Errorf("$INCLUDE nested more than %d levels", maxIncludeDepth)
+	}
+
+	path := args[0].text
+	if !filepath.IsAbs(path) && p.dir != "" {
+		path = filepath.Join(p.dir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("$INCLUDE: %w", err)
+	}
+	defer f.Close()
+
+	child := &parser{zone: p.zone, origin: p.origin, ttl: p.ttl, dir: filepath.Dir(path), depth: p.depth + 1}
+	if len(args) == 2 {
+		child.origin = absoluteName(args[1].text, p.origin)
+	}
+	return child.parse(f, path)
+}
+
+// generate handles BIND's "$GENERATE start-stop[/step] owner [ttl] [class]
+// type rdata", creating one record per value of the range. "$" in the
+// owner and RDATA is replaced by the value, "${offset,width,base}" formats
+// it and "\$" is a literal dollar sign.
+func (p *parser) generate(args []token) error {
+	if len(args) < 3 {
+		return errors.New("$GENERATE expects a range, an owner, a type and RDATA")
+	}
+	start, stop, step, err := parseRange(args[0].text)
+	if err != nil {
+		return err
+	}
+
+	for i := start; i <= stop; i += step {
+		owner, err := substitute(args[1].raw, i)
+		if err != nil {
+			return err
+		}
+		fields := make([]token, 0, len(args)-2)
+		for _, arg := range args[2:] {
+			text, err := substitute(arg.raw, i)
+			if err != nil {
+				return err
+			}
+			fields = append(fields, token{text: text, raw: arg.raw, quoted: arg.quoted})
+		}
+
+		rr, err := p.parseRecord(absoluteName(owner, p.origin), fields)
+		if err != nil {
+			return err
+		}
+		if err := p.zone.Add(rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRange parses "start-stop[/step]"
+func parseRange(spec string) (start, stop, step int, err error) {
+	rangeSpec, stepSpec, hasStep := strings.Cut(spec, "/")
+	from, to, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("invalid $GENERATE range %q", spec)
+	}
+	step = 1
+	if start, err = strconv.Atoi(from); err == nil {
+		if stop, err = strconv.Atoi(to); err == nil && hasStep {
+			step, err = strconv.Atoi(stepSpec)
+		}
+	}
+	if err != nil || start < 0 || stop < start || step < 1 {
+		return 0, 0, 0, fmt.Errorf("invalid $GENERATE range %q", spec)
+	}
+	return start, stop, step, nil
+}
+
+// substitute expands the $ forms of a $GENERATE template for value and
+// decodes the remaining escapes
+func substitute(template string, value int) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '\\' && i+1 < len(template):
+			out.WriteByte(c)
+			out.WriteByte(template[i+1])
+			i++
+		case c == '$' && strings.HasPrefix(template[i+1:], "{"):
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", template)
+			}
+			formatted, err := formatGenerated(template[i+2:i+end], value)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(formatted)
+			i += end
+		case c == '$':
+			out.WriteString(strconv.Itoa(value))
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return unescape(out.String(), false)
+}
+
+// formatGenerated formats value per "offset[,width[,base]]", base being
+// d, o, x, X, n or N (nibbles in reverse order, as for ip6.arpa names)
+func formatGenerated(spec string, value int) (string, error) {
+	parts := strings.Split(spec, ",")
+	if len(parts) > 3 {
+		return "", fmt.Errorf("invalid $GENERATE modifier ${%s}", spec)
+	}
+	offset, width, base := 0, 0, "d"
+	var err error
+	if parts[0] != "" {
+		if offset, err = strconv.Atoi(parts[0]); err != nil {
+			return "", fmt.Errorf("invalid $GENERATE offset in ${%s}", spec)
+		}
+	}
+	if len(parts) > 1 {
+		if width, err = strconv.Atoi(parts[1]); err != nil || width < 0 {
+			return "", fmt.Errorf("invalid $GENERATE width in ${%s}", spec)
+		}
+	}
+	if len(parts) > 2 {
+		base = parts[2]
+	}
+
+	value += offset
+	if value < 0 {
+		return "", fmt.Errorf("$GENERATE value %d is negative", value)
+	}
+	switch base {
+	case "d":
+		return fmt.Sprintf("%0*d", width, value), nil
+	case "o":
+		return fmt.Sprintf("%0*o", width, value), nil
+	case "x":
+		return fmt.Sprintf("%0*x", width, value), nil
+	case "X":
+		return fmt.Sprintf("%0*X", width, value), nil
+	case "n", "N":
+		digits := fmt.Sprintf("%0*x", width, value)
+		if base == "N" {
+			digits = strings.ToUpper(digits)
+		}
+		nibbles := make([]string, 0, len(digits))
+		for i := len(digits) - 1; i >= 0; i-- {
+			nibbles = append(nibbles, digits[i:i+1])
+		}
+		return strings.Join(nibbles, "."), nil
+	}
+	return "", fmt.Errorf("invalid $GENERATE base %q", base)
+}
+
+// parseTTL parses a TTL in seconds or with BIND's s, m, h, d and w units,
+// e.g. "1h30m"
+func parseTTL(s string) (uint32, error) {
+	if v, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(v), nil
+	}
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+
+	var total, number uint64
+	digits := false
+	for _, c := range strings.ToLower(s) {
+		if c >= '0' && c <= '9' {
+			number = number*10 + uint64(c-'0')
+			digits = true
+			continue
+		}
+		unit, ok := ttlUnits[c]
+		if !ok || !digits {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+		total += number * unit
+		number, digits = 0, false
+		if total > 0xFFFFFFFF {
+			return 0, fmt.Errorf("TTL %q out of range", s)
+		}
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid TTL %q: number without unit", s)
+	}
+	return uint32(total), nil
+}
+
+var ttlUnits = map[rune]uint64{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+
+// parseRData uses the handler's presentation format, accepting the
+// generic RFC 3597 "\# <len> <hex>" form for every type
+func parseRData(rtype uint16, fields []string, origin string) (interface{}, error) {
+	handler, ok := records.HandlerFor(rtype)
+	if !ok {
+		return nil, fmt.Errorf("type %s cannot appear in a zone", records.TypeName(rtype))
+	}
+
+	if len(fields) > 0 && fields[0] == `\#` {
+		raw, err := records.NewRawRecord(rtype).ParseZoneData(fields, origin)
+		if err != nil {
+			return nil, err
+		}
+		wire := raw.(records.RawData)
+		return handler.ParseRecordData(wire, 0, len(wire))
+	}
+
+	parser, ok := handler.(records.ZoneDataParser)
+	if !ok {
+		return nil, fmt.Errorf("no presentation format for type %s", records.TypeName(rtype))
+	}
+	return parser.ParseZoneData(fields, origin)
+}
+
+// absoluteName qualifies a zone file name against origin
+func absoluteName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return dnssec.CanonicalName(name)
+	case origin == ".":
+		return dnssec.CanonicalName(name)
+	default:
+		return dnssec.CanonicalName(name + "." + origin)
+	}
+}
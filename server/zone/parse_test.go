@@ -0,0 +1,166 @@
+package zone
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func TestParse_Syntax(t *testing.T) {
+	z, err := Parse(strings.NewReader(`
+$TTL 1h
+@ IN SOA ns1 hostmaster (
+        2024010101 ; serial
+        2h 30m 2w 5m )
+  NS ns1
+ns1 A 192.0.2.53
+txt IN 1d TXT "quote \" and \\ and \059 \065" unquoted\ word
+sub 90 ( A
+         192.0.2.1 )
+`), "example.com")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	_, soa, _ := z.SOA()
+	if soa.Refresh != 7200 || soa.Retry != 1800 || soa.Expire != 1209600 || soa.Minimum != 300 {
+		t.Errorf("SOA timers with units not converted: %+v", soa)
+	}
+	if ns := z.RRset("example.com", records.TypeNS); len(ns) != 1 || ns[0].TTL != 3600 {
+		t.Errorf("Expected the NS to inherit the apex owner and $TTL, got %+v", ns)
+	}
+	txt := z.RRset("txt.example.com", records.TypeTXT)
+	if len(txt) != 1 || txt[0].TTL != 86400 || !reflect.DeepEqual(txt[0].Data, []string{`quote " and \ and ; A`, "unquoted word"}) {
+		t.Errorf("Unexpected TXT: %+v", txt)
+	}
+	if a := z.RRset("sub.example.com", records.TypeA); len(a) != 1 || a[0].TTL != 90 {
+		t.Errorf("Expected a record spanning lines, got %+v", a)
+	}
+
+	for name, text := range map[string]string{
+		"unbalanced":   "@ SOA ns hm ( 1 2 3 4 5",
+		"extra_paren":  "@ SOA ns hm 1 2 3 4 5 )",
+		"bad_ttl":      "$TTL 1x\n@ SOA ns hm 1 2 3 4 5",
+		"bad_escape":   "@ SOA ns hm 1 2 3 4 5\nwww TXT \"\\300\"",
+		"missing_file": "@ SOA ns hm 1 2 3 4 5\n$INCLUDE does-not-exist.zone",
+	} {
+		if _, err := Parse(strings.NewReader(text), "example.com"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadFile_Include(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("example.zone", `$TTL 300
+@ SOA ns1 hostmaster 1 7200 3600 1209600 300
+$INCLUDE hosts.zone hosts
+www A 192.0.2.80
+`)
+	write("hosts.zone", "$TTL 60\na A 192.0.2.1\n$ORIGIN other.example.com.\nb A 192.0.2.2\n")
+
+	z, err := LoadFile(filepath.Join(dir, "example.zone"), "example.com")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if a := z.RRset("a.hosts.example.com", records.TypeA); len(a) != 1 || a[0].TTL != 60 {
+		t.Errorf("Expected the included record under the given origin, got %+v", a)
+	}
+	if b := z.RRset("b.other.example.com", records.TypeA); len(b) != 1 {
+		t.Errorf("Expected $ORIGIN to apply inside the included file, got %+v", b)
+	}
+	// The parent's origin and TTL are restored after the include
+	if www := z.RRset("www.example.com", records.TypeA); len(www) != 1 || www[0].TTL != 300 {
+		t.Errorf("Expected www under the parent origin, got %+v", www)
+	}
+
+	write("loop.zone", "@ SOA ns1 hostmaster 1 2 3 4 5\n$INCLUDE loop.zone\n")
+	if _, err := LoadFile(filepath.Join(dir, "loop.zone"), "example.com"); err == nil {
+		t.Error("Expected a self-including file to fail")
+	}
+}
+
+func TestParse_Generate(t *testing.T) {
+	z, err := Parse(strings.NewReader(`@ SOA ns1 hostmaster 1 2 3 4 5
+$GENERATE 1-3 host-$ A 192.0.2.$
+$GENERATE 0-4/2 ${10,3,d} 60 IN CNAME host-${1}
+$GENERATE 10-11 ${0,4,x} TXT "cost \$$"
+$GENERATE 255-255 ${0,4,n}.ip6 A 192.0.2.255
+`), "example.com")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	for i, name := range []string{"host-1", "host-2", "host-3"} {
+		a := z.RRset(name+".example.com", records.TypeA)
+		if want := "192.0.2." + string(rune('1'+i)); len(a) != 1 || a[0].Data != want {
+			t.Errorf("%s: expected %s, got %+v", name, want, a)
+		}
+	}
+	if cname := z.RRset("012.example.com", records.TypeCNAME); len(cname) != 1 || cname[0].TTL != 60 || cname[0].Data != "host-3.example.com" {
+		t.Errorf("Unexpected generated CNAME: %+v", cname)
+	}
+	if z.Exists("011.example.com") {
+		t.Error("Expected the step to skip 1")
+	}
+	if txt := z.RRset("000a.example.com", records.TypeTXT); len(txt) != 1 || !reflect.DeepEqual(txt[0].Data, []string{"cost $10"}) {
+		t.Errorf("Unexpected generated TXT: %+v", txt)
+	}
+	if nibbles := z.RRset("f.f.0.0.ip6.example.com", records.TypeA); len(nibbles) != 1 {
+		t.Errorf("Expected a nibble-formatted owner, got %v", z.Names())
+	}
+
+	for name, text := range map[string]string{
+		"bad_range": "$GENERATE 5-1 h$ A 192.0.2.1",
+		"bad_base":  "$GENERATE 1-2 ${0,0,q} A 192.0.2.1",
+		"open_mod":  "$GENERATE 1-2 ${0 A 192.0.2.1",
+	} {
+		if _, err := Parse(strings.NewReader("@ SOA ns hm 1 2 3 4 5\n"+text), "example.com"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	z, err := Parse(strings.NewReader(exampleZone+`
+quoted  IN TXT "a \"quoted\" \\ string" "tab\009"
+caa     IN CAA 0 issue "ca.example.net"
+tlsa    IN TLSA 3 1 1 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+ds      IN DS 12345 13 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+key     IN DNSKEY 257 3 13 dGVzdCBrZXkgZGF0YQ==
+svc     IN HTTPS 1 . alpn=h2 port=8443
+`), "example.com")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, z); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "$ORIGIN example.com.\nexample.com.\t3600\tIN\tSOA\tns1.example.com. hostmaster.example.com. 2024010101 ") {
+		t.Errorf("Unexpected output start:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "quoted.example.com.\t3600\tIN\tTXT\t\"a \\\"quoted\\\" \\\\ string\" \"tab\\009\"\n") {
+		t.Errorf("TXT not escaped:\n%s", buf.String())
+	}
+
+	// Every name was written absolute, so the output reads back unchanged
+	again, err := Parse(bytes.NewReader(buf.Bytes()), "example.com")
+	if err != nil {
+		t.Fatalf("Parsing the written zone failed: %v\n%s", err, buf.String())
+	}
+	if got, want := again.Records(), z.Records(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Round trip changed the zone:\n got %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,604 @@
+package zone
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// DenialMode selects how the signer proves that names or types do not exist
+type DenialMode int
+
+const (
+	// DenialNSEC publishes a precomputed NSEC chain (RFC 4034)
+	DenialNSEC DenialMode = iota
+	// DenialNSEC3 publishes a hashed NSEC3 chain with no salt and no
+	// extra iterations, as RFC 9276 recommends
+	DenialNSEC3
+	// DenialCompact synthesises minimally covering NSEC records per query
+	// ("black lies"): NXDOMAIN is answered as NODATA, so zones cannot be
+	// walked and no chain has to be maintained
+	DenialCompact
+)
+
+// ParseDenialMode maps "nsec", "nsec3" or "compact" to a DenialMode
+func ParseDenialMode(name string) (DenialMode, error) {
+	switch strings.ToLower(name) {
+	case "nsec":
+		return DenialNSEC, nil
+	case "nsec3":
+		return DenialNSEC3, nil
+	case "compact":
+		return DenialCompact, nil
+	}
+	return 0, fmt.Errorf("unknown denial mode %q", name)
+}
+
+const (
+	defaultValidity = 14 * 24 * time.Hour
+	// Inception is backdated to tolerate validators with slow clocks
+	inceptionSkew = time.Hour
+)
+
+// Signer signs the answers of one zone on the fly with a KSK and a ZSK.
+// Signatures are cached until a quarter of their validity remains.
+type Signer struct {
+	KSK      *dnssec.SigningKey
+	ZSK      *dnssec.SigningKey
+	Denial   DenialMode
+	Validity time.Duration
+
+	now   func() time.Time
+	mu    sync.Mutex
+	cache map[string]records.RRSIGData
+}
+
+// NewSigner creates a signer using ksk for the DNSKEY RRset and zsk for
+// everything else
+func NewSigner(ksk, zsk *dnssec.SigningKey, denial DenialMode) *Signer {
+	return &Signer{
+		KSK:      ksk,
+		ZSK:      zsk,
+		Denial:   denial,
+		Validity: defaultValidity,
+		now:      time.Now,
+		cache:    make(map[string]records.RRSIGData),
+	}
+}
+
+// Prepare returns a copy of z with the DNSSEC records the signer publishes:
+// DNSKEY, CDS and CDNSKEY at the apex and, unless denial is compact, the
+// NSEC or NSEC3 chain. It must be called again whenever z changes.
+func (s *Signer) Prepare(z *Zone) (*Zone, error) {
+	soa, _, err := z.SOA()
+	if err != nil {
+		return nil, err
+	}
+	signed := z.Clone()
+	for _, rtype := range []uint16{records.TypeDNSKEY, records.TypeCDS, records.TypeCDNSKEY, records.TypeNSEC3PARAM} {
+		signed.RemoveRRset(signed.Origin, rtype)
+	}
+
+	ds, err := dnssec.ComputeDS(z.Origin, s.KSK.DNSKEY, dnssec.DigestSHA256)
+	if err != nil {
+		return nil, err
+	}
+	apex := []records.ResourceRecord{
+		{Name: z.Origin, Type: records.TypeDNSKEY, TTL: soa.TTL, Data: s.KSK.DNSKEY},
+		{Name: z.Origin, Type: records.TypeDNSKEY, TTL: soa.TTL, Data: s.ZSK.DNSKEY},
+		{Name: z.Origin, Type: records.TypeCDNSKEY, TTL: soa.TTL, Data: s.KSK.DNSKEY},
+		{Name: z.Origin, Type: records.TypeCDS, TTL: soa.TTL, Data: ds},
+	}
+	if s.Denial == DenialNSEC3 {
+		apex = append(apex, records.ResourceRecord{Name: z.Origin, Type: records.TypeNSEC3PARAM, Data: nsec3Param()})
+	}
+	for _, rr := range apex {
+		if err := signed.Add(rr); err != nil {
+			return nil, err
+		}
+	}
+
+	switch s.Denial {
+	case DenialNSEC:
+		err = addNSECChain(signed)
+	case DenialNSEC3:
+		err = addNSEC3Chain(signed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// SignAnswer adds denial of existence records and RRSIGs to an answer
+// produced by z.Lookup, where z was returned by Prepare
+func (s *Signer) SignAnswer(z *Zone, qname string, qtype uint16, ans Answer) (Answer, error) {
+	qname = dnssec.CanonicalName(qname)
+	switch {
+	case ans.Referral:
+		proof, err := s.delegationProof(z, ans.Authority[0].Name)
+		if err != nil {
+			return Answer{}, err
+		}
+		ans.Authority = append(ans.Authority, proof...)
+	case len(ans.Answer) == 0 || ans.Rcode == RcodeNameError:
+		denial, rcode, err := s.denial(z, lastName(qname, ans.Answer), ans.Rcode)
+		if err != nil {
+			return Answer{}, err
+		}
+		ans.Authority = append(ans.Authority, denial...)
+		ans.Rcode = rcode
+	}
+	proof, err := s.wildcardProof(z, ans.Answer)
+	if err != nil {
+		return Answer{}, err
+	}
+	for _, rr := range proof {
+		if !containsOwner(ans.Authority, rr.Name) {
+			ans.Authority = append(ans.Authority, rr)
+		}
+	}
+
+	if ans.Answer, err = s.signSection(z, ans.Answer); err != nil {
+		return Answer{}, err
+	}
+	if ans.Authority, err = s.signSection(z, ans.Authority); err != nil {
+		return Answer{}, err
+	}
+	if ans.Additional, err = s.signSection(z, ans.Additional); err != nil {
+		return Answer{}, err
+	}
+	return ans, nil
+}
+
+// lastName is the name a negative answer is about: the end of the CNAME chain
+func lastName(qname string, answer []records.ResourceRecord) string {
+	if n := len(answer); n > 0 && answer[n-1].Type == records.TypeCNAME {
+		return dnssec.CanonicalName(answer[n-1].Data.(string))
+	}
+	return qname
+}
+
+// signSection appends an RRSIG after every RRset of section that the zone
+// is authoritative for
+func (s *Signer) signSection(z *Zone, section []records.ResourceRecord) ([]records.ResourceRecord, error) {
+	var out []records.ResourceRecord
+	for _, rrset := range splitRRsets(section) {
+		out = append(out, rrset...)
+		owner := rrset[0].Name
+		if rrset[0].Type == records.TypeRRSIG || !dnssec.IsSubdomain(owner, z.Origin) {
+			continue
+		}
+		// Delegation NS records and glue belong to the child zone; the
+		// parent only signs the DS and NSEC at the cut
+		rtype := rrset[0].Type
+		if cut, ok := z.Delegation(owner); ok && (owner != cut || rtype != records.TypeDS && rtype != records.TypeNSEC) {
+			continue
+		}
+
+		// Wildcard expansions carry the wildcard's signature, whose labels
+		// field lets validators reconstruct the signed owner (RFC 4035
+		// section 5.3.4). Compact denial signs the expansion as it is.
+		signed := rrset
+		if source, ok := wildcardSource(z, owner); ok && s.Denial != DenialCompact {
+			signed = withOwner(rrset, source)
+		}
+		sig, err := s.sign(z.Origin, signed)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, records.ResourceRecord{
+			Name: owner, Type: records.TypeRRSIG, Class: records.ClassIN, TTL: rrset[0].TTL, Data: sig,
+		})
+	}
+	return out, nil
+}
+
+// sign returns a cached signature for rrset or creates a new one
+func (s *Signer) sign(origin string, rrset []records.ResourceRecord) (records.RRSIGData, error) {
+	key := s.ZSK
+	if rrset[0].Type == records.TypeDNSKEY {
+		key = s.KSK
+	}
+	cacheKey, err := rrsetCacheKey(rrset, key)
+	if err != nil {
+		return records.RRSIGData{}, err
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	sig, ok := s.cache[cacheKey]
+	s.mu.Unlock()
+	if ok && int64(sig.Expiration)-now.Unix() > int64(s.Validity/4/time.Second) {
+		return sig, nil
+	}
+
+	sig, err = dnssec.Sign(rrset, key, origin, now.Add(-inceptionSkew), now.Add(s.Validity))
+	if err != nil {
+		return records.RRSIGData{}, err
+	}
+	s.mu.Lock()
+	s.cache[cacheKey] = sig
+	s.mu.Unlock()
+	return sig, nil
+}
+
+// rrsetCacheKey identifies an RRset by owner, type, TTL, RDATA and signing key
+func rrsetCacheKey(rrset []records.ResourceRecord, key *dnssec.SigningKey) (string, error) {
+	handler, ok := records.HandlerFor(rrset[0].Type)
+	if !ok {
+		return "", fmt.Errorf("cannot encode type %d", rrset[0].Type)
+	}
+	rdatas := make([]string, 0, len(rrset))
+	for _, rr := range rrset {
+		rdata, err := handler.BuildRecordData(rr.Data)
+		if err != nil {
+			return "", err
+		}
+		rdatas = append(rdatas, string(rdata))
+	}
+	sort.Strings(rdatas)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s/%d/%d/%d/", rrset[0].Name, rrset[0].Type, rrset[0].TTL, dnssec.KeyTag(key.DNSKEY))
+	for _, rdata := range rdatas {
+		fmt.Fprintf(h, "%d:%s", len(rdata), rdata)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// splitRRsets groups consecutive records with the same owner and type
+func splitRRsets(section []records.ResourceRecord) [][]records.ResourceRecord {
+	var out [][]records.ResourceRecord
+	for _, rr := range section {
+		if n := len(out); n > 0 && out[n-1][0].Type == rr.Type && strings.EqualFold(out[n-1][0].Name, rr.Name) {
+			out[n-1] = append(out[n-1], rr)
+			continue
+		}
+		out = append(out, []records.ResourceRecord{rr})
+	}
+	return out
+}
+
+// denial returns the records proving qname (or its type) does not exist
+func (s *Signer) denial(z *Zone, qname string, rcode uint16) ([]records.ResourceRecord, uint16, error) {
+	if !dnssec.IsSubdomain(qname, z.Origin) {
+		return nil, rcode, nil
+	}
+	switch s.Denial {
+	case DenialCompact:
+		return compactDenial(z, qname), RcodeSuccess, nil
+	case DenialNSEC3:
+		proof, err := nsec3Denial(z, qname, rcode == RcodeNameError)
+		return proof, rcode, err
+	default:
+		return nsecDenial(z, qname, rcode == RcodeNameError), rcode, nil
+	}
+}
+
+// delegationProof returns the DS RRset of a referral's zone cut, or the
+// records proving the child zone is unsigned
+func (s *Signer) delegationProof(z *Zone, cut string) ([]records.ResourceRecord, error) {
+	if ds := z.RRset(cut, records.TypeDS); len(ds) > 0 {
+		return ds, nil
+	}
+	proof, _, err := s.denial(z, cut, RcodeSuccess)
+	return proof, err
+}
+
+// wildcardProof returns the records proving that the owners of answers
+// synthesised from a wildcard do not exist, so no closer match was
+// possible (RFC 4035 section 3.1.3.3, RFC 5155 section 7.2.6)
+func (s *Signer) wildcardProof(z *Zone, answer []records.ResourceRecord) ([]records.ResourceRecord, error) {
+	if s.Denial == DenialCompact {
+		return nil, nil
+	}
+	var proof []records.ResourceRecord
+	for _, rrset := range splitRRsets(answer) {
+		owner := rrset[0].Name
+		if _, ok := wildcardSource(z, owner); !ok {
+			continue
+		}
+		covering := coveringNSEC(z, owner)
+		if s.Denial == DenialNSEC3 {
+			var err error
+			if covering, err = coveringNSEC3(z, nextCloser(owner, closestEncloser(z, owner))); err != nil {
+				return nil, err
+			}
+		}
+		for _, rr := range covering {
+			if !containsOwner(proof, rr.Name) {
+				proof = append(proof, rr)
+			}
+		}
+	}
+	return proof, nil
+}
+
+// wildcardSource returns the wildcard an answer for name is synthesised
+// from, if name does not exist in the zone
+func wildcardSource(z *Zone, name string) (string, bool) {
+	if !dnssec.IsSubdomain(name, z.Origin) || z.Exists(name) {
+		return "", false
+	}
+	source := "*." + closestEncloser(z, name)
+	return source, z.Exists(source)
+}
+
+// nextCloser returns the ancestor of qname one label below encloser
+func nextCloser(qname, encloser string) string {
+	name := qname
+	for dnssec.Parent(name) != encloser {
+		name = dnssec.Parent(name)
+	}
+	return name
+}
+
+// compactDenial answers every negative query as NODATA with an NSEC whose
+// next name is the immediate successor of qname (RFC 4470 "white lies"
+// shrunk to the minimal covering range)
+func compactDenial(z *Zone, qname string) []records.ResourceRecord {
+	types := []uint16{records.TypeRRSIG, records.TypeNSEC}
+	for _, rtype := range z.Types(qname) {
+		if rtype != records.TypeRRSIG && rtype != records.TypeNSEC {
+			types = append(types, rtype)
+		}
+	}
+	return []records.ResourceRecord{{
+		Name:  qname,
+		Type:  records.TypeNSEC,
+		Class: records.ClassIN,
+		TTL:   z.NegativeTTL(),
+		Data:  records.NSECData{NextDomain: "\x00." + qname, Types: types},
+	}}
+}
+
+// chainNames lists the owners of the NSEC chain: nodes with data that are
+// not occluded by a delegation
+func chainNames(z *Zone) []string {
+	var names []string
+	for _, name := range z.Names() {
+		if cut, ok := z.Delegation(name); ok && cut != name {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func addNSECChain(z *Zone) error {
+	names := chainNames(z)
+	ttl := z.NegativeTTL()
+	for i, name := range names {
+		types := append(z.Types(name), records.TypeNSEC, records.TypeRRSIG)
+		if cut, ok := z.Delegation(name); ok && cut == name {
+			// Only NS and DS are authoritative at a delegation point
+			types = []uint16{records.TypeNS, records.TypeNSEC, records.TypeRRSIG}
+			if len(z.RRset(name, records.TypeDS)) > 0 {
+				types = append(types, records.TypeDS)
+			}
+		}
+		next := names[(i+1)%len(names)]
+		if err := z.Add(records.ResourceRecord{
+			Name: name, Type: records.TypeNSEC, TTL: ttl,
+			Data: records.NSECData{NextDomain: next, Types: types},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nsecDenial proves NODATA with the NSEC at qname, or NXDOMAIN with the
+// NSECs covering qname and the wildcard at its closest encloser. NODATA
+// from a wildcard needs the NSEC covering qname and the one at the
+// wildcard.
+func nsecDenial(z *Zone, qname string, nxdomain bool) []records.ResourceRecord {
+	if source, ok := wildcardSource(z, qname); ok && !nxdomain {
+		proof := coveringNSEC(z, qname)
+		if nsec := z.RRset(source, records.TypeNSEC); len(nsec) > 0 && !containsOwner(proof, source) {
+			proof = append(proof, nsec...)
+		}
+		return proof
+	}
+	if !nxdomain {
+		if nsec := z.RRset(qname, records.TypeNSEC); len(nsec) > 0 {
+			return nsec
+		}
+		// Empty non-terminals have no NSEC; the covering one proves them empty
+		return coveringNSEC(z, qname)
+	}
+
+	proof := coveringNSEC(z, qname)
+	wildcard := coveringNSEC(z, "*."+closestEncloser(z, qname))
+	if len(wildcard) > 0 && (len(proof) == 0 || wildcard[0].Name != proof[0].Name) {
+		proof = append(proof, wildcard...)
+	}
+	return proof
+}
+
+// coveringNSEC returns the NSEC whose owner sorts last before name; the
+// last NSEC of the chain wraps around to cover names after it
+func coveringNSEC(z *Zone, name string) []records.ResourceRecord {
+	var owners []string
+	for _, n := range z.Names() {
+		if len(z.RRset(n, records.TypeNSEC)) > 0 {
+			owners = append(owners, n)
+		}
+	}
+	if len(owners) == 0 {
+		return nil
+	}
+
+	owner := owners[len(owners)-1]
+	for _, n := range owners {
+		if dnssec.CompareNames(n, name) >= 0 {
+			break
+		}
+		owner = n
+	}
+	return z.RRset(owner, records.TypeNSEC)
+}
+
+func nsec3Param() records.NSEC3PARAMData {
+	return records.NSEC3PARAMData{HashAlgorithm: records.NSEC3HashSHA1, Salt: []byte{}}
+}
+
+// nsec3Owner returns the hashed owner name of name in zone origin
+func nsec3Owner(name, origin string) (string, []byte, error) {
+	param := nsec3Param()
+	hash, err := dnssec.HashName(name, param.HashAlgorithm, param.Iterations, param.Salt)
+	if err != nil {
+		return "", nil, err
+	}
+	label := strings.ToLower(records.Base32Hex.EncodeToString(hash))
+	if origin == "." {
+		return label, hash, nil
+	}
+	return label + "." + origin, hash, nil
+}
+
+func addNSEC3Chain(z *Zone) error {
+	type hashed struct {
+		name  string
+		owner string
+		hash  []byte
+	}
+
+	var chain []hashed
+	for _, name := range z.Nodes() {
+		if cut, ok := z.Delegation(name); ok && cut != name {
+			continue
+		}
+		owner, hash, err := nsec3Owner(name, z.Origin)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, hashed{name, owner, hash})
+	}
+	sort.Slice(chain, func(i, j int) bool { return bytes.Compare(chain[i].hash, chain[j].hash) < 0 })
+
+	param := nsec3Param()
+	ttl := z.NegativeTTL()
+	for i, h := range chain {
+		types := z.Types(h.name)
+		if len(types) > 0 {
+			types = append(types, records.TypeRRSIG)
+		}
+		if cut, ok := z.Delegation(h.name); ok && cut == h.name {
+			types = []uint16{records.TypeNS}
+			if len(z.RRset(h.name, records.TypeDS)) > 0 {
+				types = append(types, records.TypeDS, records.TypeRRSIG)
+			}
+		}
+		if err := z.Add(records.ResourceRecord{
+			Name: h.owner, Type: records.TypeNSEC3, TTL: ttl,
+			Data: records.NSEC3Data{
+				HashAlgorithm: param.HashAlgorithm,
+				Iterations:    param.Iterations,
+				Salt:          param.Salt,
+				NextHashed:    chain[(i+1)%len(chain)].hash,
+				Types:         types,
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nsec3Denial proves NODATA with the NSEC3 matching qname, or NXDOMAIN
+// with the closest encloser proof and the NSEC3 covering the wildcard
+// (RFC 5155 section 7.2). NODATA from a wildcard replaces the covering
+// NSEC3 of the wildcard with the one matching it.
+func nsec3Denial(z *Zone, qname string, nxdomain bool) ([]records.ResourceRecord, error) {
+	source, wildcard := wildcardSource(z, qname)
+	if !nxdomain && !wildcard {
+		return matchingNSEC3(z, qname)
+	}
+
+	encloser := closestEncloser(z, qname)
+	proof, err := matchingNSEC3(z, encloser)
+	if err != nil {
+		return nil, err
+	}
+	if wildcard && !nxdomain {
+		matching, err := matchingNSEC3(z, source)
+		if err != nil {
+			return nil, err
+		}
+		proof = append(proof, matching...)
+	}
+
+	for _, name := range []string{nextCloser(qname, encloser), "*." + encloser} {
+		if wildcard && !nxdomain && name == source {
+			continue
+		}
+		covering, err := coveringNSEC3(z, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, rr := range covering {
+			if !containsOwner(proof, rr.Name) {
+				proof = append(proof, rr)
+			}
+		}
+	}
+	return proof, nil
+}
+
+func matchingNSEC3(z *Zone, name string) ([]records.ResourceRecord, error) {
+	owner, _, err := nsec3Owner(name, z.Origin)
+	if err != nil {
+		return nil, err
+	}
+	return z.RRset(owner, records.TypeNSEC3), nil
+}
+
+// coveringNSEC3 returns the NSEC3 whose hash range contains the hash of name
+func coveringNSEC3(z *Zone, name string) ([]records.ResourceRecord, error) {
+	_, target, err := nsec3Owner(name, z.Origin)
+	if err != nil {
+		return nil, err
+	}
+	for _, owner := range z.Names() {
+		for _, rr := range z.RRset(owner, records.TypeNSEC3) {
+			label, _, _ := strings.Cut(owner, ".")
+			hash, err := records.Base32Hex.DecodeString(strings.ToUpper(label))
+			if err != nil {
+				continue
+			}
+			next := rr.Data.(records.NSEC3Data).NextHashed
+			if hashCovers(hash, next, target) {
+				return []records.ResourceRecord{rr}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// hashCovers reports whether target lies strictly between owner and next,
+// wrapping around at the end of the chain
+func hashCovers(owner, next, target []byte) bool {
+	if bytes.Compare(owner, next) < 0 {
+		return bytes.Compare(owner, target) < 0 && bytes.Compare(target, next) < 0
+	}
+	return bytes.Compare(owner, target) < 0 || bytes.Compare(target, next) < 0
+}
+
+func containsOwner(rrs []records.ResourceRecord, name string) bool {
+	for _, rr := range rrs {
+		if strings.EqualFold(rr.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,274 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func newTestSigner(t *testing.T, denial DenialMode) *Signer {
+	t.Helper()
+	ksk, err := dnssec.GenerateKey(dnssec.AlgECDSAP256SHA256, records.DNSKEYFlagZone|records.DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zsk, err := dnssec.GenerateKey(dnssec.AlgECDSAP256SHA256, records.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(ksk, zsk, denial)
+}
+
+// verifySections checks that every RRset is followed by a valid RRSIG,
+// except delegation NS records and glue, which the parent does not sign
+func verifySections(t *testing.T, s *Signer, z *Zone, sections ...[]records.ResourceRecord) {
+	t.Helper()
+	for _, section := range sections {
+		rrsets := splitRRsets(section)
+		for i, rrset := range rrsets {
+			if rrset[0].Type == records.TypeRRSIG {
+				continue
+			}
+			if cut, ok := z.Delegation(rrset[0].Name); ok && (cut != rrset[0].Name || rrset[0].Type == records.TypeNS) {
+				continue
+			}
+			if i+1 >= len(rrsets) || rrsets[i+1][0].Type != records.TypeRRSIG {
+				t.Errorf("%s %s is not signed", rrset[0].Name, records.TypeName(rrset[0].Type))
+				continue
+			}
+			sig := rrsets[i+1][0].Data.(records.RRSIGData)
+			key := s.ZSK.DNSKEY
+			if rrset[0].Type == records.TypeDNSKEY {
+				key = s.KSK.DNSKEY
+			}
+			if err := dnssec.Verify(sig, key, rrset, s.now()); err != nil {
+				t.Errorf("%s %s: %v", rrset[0].Name, records.TypeName(rrset[0].Type), err)
+			}
+		}
+	}
+}
+
+func countType(rrs []records.ResourceRecord, rtype uint16) int {
+	n := 0
+	for _, rr := range rrs {
+		if rr.Type == rtype {
+			n++
+		}
+	}
+	return n
+}
+
+func signedLookup(t *testing.T, s *Signer, z *Zone, qname string, qtype uint16) Answer {
+	t.Helper()
+	ans, err := s.SignAnswer(z, qname, qtype, z.Lookup(qname, qtype))
+	if err != nil {
+		t.Fatalf("SignAnswer(%s): %v", qname, err)
+	}
+	verifySections(t, s, z, ans.Answer, ans.Authority, ans.Additional)
+	return ans
+}
+
+func TestSigner_PublishesKeys(t *testing.T) {
+	s := newTestSigner(t, DenialNSEC)
+	z, err := s.Prepare(loadExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ans := signedLookup(t, s, z, "example.com", records.TypeDNSKEY)
+	if countType(ans.Answer, records.TypeDNSKEY) != 2 || countType(ans.Answer, records.TypeRRSIG) != 1 {
+		t.Errorf("Unexpected DNSKEY answer %+v", ans.Answer)
+	}
+
+	cds := z.RRset("example.com", records.TypeCDS)
+	if len(cds) != 1 || !dnssec.MatchesDS("example.com", s.KSK.DNSKEY, cds[0].Data.(records.DSData)) {
+		t.Errorf("CDS does not match the KSK: %+v", cds)
+	}
+	if len(z.RRset("example.com", records.TypeCDNSKEY)) != 1 {
+		t.Error("Missing CDNSKEY")
+	}
+}
+
+func TestSigner_NSEC(t *testing.T) {
+	s := newTestSigner(t, DenialNSEC)
+	z, err := s.Prepare(loadExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The chain is closed and skips empty non-terminals
+	names := chainNames(z)
+	last := z.RRset(names[len(names)-1], records.TypeNSEC)[0].Data.(records.NSECData)
+	if last.NextDomain != "example.com" {
+		t.Errorf("Chain does not wrap to the apex: %q", last.NextDomain)
+	}
+	if len(z.RRset("c.example.com", records.TypeNSEC)) != 0 {
+		t.Error("Empty non-terminal must not own an NSEC")
+	}
+
+	signedLookup(t, s, z, "www.example.com", records.TypeA)
+
+	nodata := signedLookup(t, s, z, "web.example.com", records.TypeAAAA)
+	if nsec := nodata.Authority; countType(nsec, records.TypeNSEC) != 1 || nsec[2].Name != "web.example.com" {
+		t.Errorf("NODATA should carry the NSEC of the name: %+v", nsec)
+	}
+
+	nx := signedLookup(t, s, z, "nope.example.com", records.TypeA)
+	if nx.Rcode != RcodeNameError || countType(nx.Authority, records.TypeNSEC) == 0 {
+		t.Fatalf("Unexpected NXDOMAIN answer %+v", nx)
+	}
+	for _, rr := range nx.Authority {
+		if nsec, ok := rr.Data.(records.NSECData); ok {
+			if dnssec.CompareNames(rr.Name, "nope.example.com") >= 0 && dnssec.CompareNames(nsec.NextDomain, "nope.example.com") <= 0 {
+				t.Errorf("NSEC %s -> %s does not cover the query", rr.Name, nsec.NextDomain)
+			}
+		}
+	}
+}
+
+func TestSigner_NSEC3(t *testing.T) {
+	s := newTestSigner(t, DenialNSEC3)
+	z, err := s.Prepare(loadExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(z.RRset("example.com", records.TypeNSEC3PARAM)) != 1 {
+		t.Fatal("Missing NSEC3PARAM")
+	}
+
+	// Empty non-terminals get an NSEC3 with an empty type bitmap
+	ent, err := matchingNSEC3(z, "c.example.com")
+	if err != nil || len(ent) != 1 || len(ent[0].Data.(records.NSEC3Data).Types) != 0 {
+		t.Errorf("Unexpected NSEC3 for empty non-terminal: %+v %v", ent, err)
+	}
+
+	nodata := signedLookup(t, s, z, "web.example.com", records.TypeAAAA)
+	if countType(nodata.Authority, records.TypeNSEC3) != 1 {
+		t.Errorf("NODATA should carry the matching NSEC3: %+v", nodata.Authority)
+	}
+
+	nx := signedLookup(t, s, z, "x.y.example.com", records.TypeA)
+	if nx.Rcode != RcodeNameError {
+		t.Errorf("Rcode = %d, want NXDOMAIN", nx.Rcode)
+	}
+	// Closest encloser, next closer and wildcard; some may coincide
+	if n := countType(nx.Authority, records.TypeNSEC3); n < 2 || n > 3 {
+		t.Errorf("Expected 2-3 NSEC3 records in the closest encloser proof, got %d", n)
+	}
+	_, nextCloser, _ := nsec3Owner("y.example.com", "example.com")
+	covered := false
+	for _, rr := range nx.Authority {
+		if data, ok := rr.Data.(records.NSEC3Data); ok {
+			label, _, _ := strings.Cut(rr.Name, ".")
+			owner, _ := records.Base32Hex.DecodeString(strings.ToUpper(label))
+			covered = covered || hashCovers(owner, data.NextHashed, nextCloser)
+		}
+	}
+	if !covered {
+		t.Error("No NSEC3 covers the next closer name")
+	}
+}
+
+func TestSigner_CompactDenial(t *testing.T) {
+	s := newTestSigner(t, DenialCompact)
+	z, err := s.Prepare(loadExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(z.RRset("example.com", records.TypeNSEC)) != 0 {
+		t.Error("Compact denial must not publish an NSEC chain")
+	}
+
+	nx := signedLookup(t, s, z, "nope.example.com", records.TypeA)
+	if nx.Rcode != RcodeSuccess {
+		t.Errorf("Compact denial answers NXDOMAIN as NODATA, got rcode %d", nx.Rcode)
+	}
+	var nsec records.NSECData
+	for _, rr := range nx.Authority {
+		if rr.Type == records.TypeNSEC {
+			nsec = rr.Data.(records.NSECData)
+		}
+	}
+	if nsec.NextDomain != "\x00.nope.example.com" || len(nsec.Types) != 2 {
+		t.Errorf("Unexpected compact NSEC %+v", nsec)
+	}
+
+	nodata := signedLookup(t, s, z, "web.example.com", records.TypeAAAA)
+	for _, rr := range nodata.Authority {
+		if data, ok := rr.Data.(records.NSECData); ok && len(data.Types) != 3 {
+			t.Errorf("NODATA NSEC should list A, RRSIG and NSEC: %v", data.Types)
+		}
+	}
+}
+
+func TestSigner_CachesSignatures(t *testing.T) {
+	s := newTestSigner(t, DenialCompact)
+	z, err := s.Prepare(loadExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	sigOf := func() records.RRSIGData {
+		ans := signedLookup(t, s, z, "web.example.com", records.TypeA)
+		return ans.Answer[1].Data.(records.RRSIGData)
+	}
+	first := sigOf()
+	if again := sigOf(); string(again.Signature) != string(first.Signature) {
+		t.Error("Expected the cached signature to be reused")
+	}
+
+	// Close to expiry the RRset is signed again
+	now = now.Add(s.Validity - s.Validity/8)
+	if renewed := sigOf(); renewed.Expiration <= first.Expiration {
+		t.Error("Expected a fresh signature near expiry")
+	}
+}
+
+func TestSigner_WildcardAndReferral(t *testing.T) {
+	for _, denial := range []DenialMode{DenialNSEC, DenialNSEC3, DenialCompact} {
+		s := newTestSigner(t, denial)
+		unsigned, err := Parse(strings.NewReader(delegatedZone), "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := s.Prepare(unsigned)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The expansion verifies with the wildcard's signature
+		ans := signedLookup(t, s, z, "anything.example.com", records.TypeA)
+		sig := ans.Answer[1].Data.(records.RRSIGData)
+		if denial != DenialCompact && sig.Labels != 2 {
+			t.Errorf("%v: expected the wildcard's label count, got %d", denial, sig.Labels)
+		}
+		proof := countType(ans.Authority, records.TypeNSEC) + countType(ans.Authority, records.TypeNSEC3)
+		if want := map[DenialMode]int{DenialNSEC: 1, DenialNSEC3: 1}[denial]; proof != want {
+			t.Errorf("%v: expected %d records proving no closer match, got %d", denial, want, proof)
+		}
+
+		nodata := signedLookup(t, s, z, "anything.example.com", records.TypeMX)
+		if denial == DenialNSEC3 && countType(nodata.Authority, records.TypeNSEC3) < 2 {
+			t.Errorf("Expected the closest encloser proof and the wildcard's NSEC3, got %+v", nodata.Authority)
+		}
+		// Here the NSEC covering the query name is the wildcard's own
+		if denial == DenialNSEC && (countType(nodata.Authority, records.TypeNSEC) != 1 || !containsOwner(nodata.Authority, "*.example.com")) {
+			t.Errorf("Expected the wildcard's NSEC, got %+v", nodata.Authority)
+		}
+
+		// Referrals carry the signed DS; the NS and glue stay unsigned
+		ref := signedLookup(t, s, z, "www.child.example.com", records.TypeA)
+		if countType(ref.Authority, records.TypeDS) != 1 || countType(ref.Authority, records.TypeRRSIG) != 1 || countType(ref.Additional, records.TypeRRSIG) != 0 {
+			t.Errorf("%v: unexpected referral %+v", denial, ref)
+		}
+		insecure := signedLookup(t, s, z, "insecure.example.com", records.TypeA)
+		if countType(insecure.Authority, records.TypeDS) != 0 || countType(insecure.Authority, records.TypeNSEC)+countType(insecure.Authority, records.TypeNSEC3) != 1 {
+			t.Errorf("%v: expected a signed proof that the child has no DS, got %+v", denial, insecure.Authority)
+		}
+	}
+}
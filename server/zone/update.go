@@ -0,0 +1,265 @@
+package zone
+
+import (
+	"fmt"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Response codes of dynamic updates (RFC 2136 section 2.2)
+const (
+	RcodeFormatError = 1
+	RcodeYXDomain    = 6 // name exists when it should not
+	RcodeYXRRSet     = 7 // RRset exists when it should not
+	RcodeNXRRSet     = 8 // RRset does not exist when it should
+	RcodeNotZone     = 10
+)
+
+// UpdateError rejects a dynamic update with the rcode to answer
+type UpdateError struct {
+	Rcode uint16
+	Msg   string
+}
+
+func (e *UpdateError) Error() string {
+	return e.Msg
+}
+
+func updateError(rcode uint16, format string, args ...interface{}) error {
+	return &UpdateError{Rcode: rcode, Msg: fmt.Sprintf(format, args...)}
+}
+
+// CheckPrerequisites evaluates the prerequisite section of an update
+// (RFC 2136 section 3.2) against z
+func CheckPrerequisites(z *Zone, prereqs []records.ResourceRecord) error {
+	// Records of the zone class must match whole RRsets, so they are
+	// collected first and compared per RRset
+	required := New(z.Origin)
+	for _, rr := range prereqs {
+		name := dnssec.CanonicalName(rr.Name)
+		if !dnssec.IsSubdomain(name, z.Origin) {
+			return updateError(RcodeNotZone, "prerequisite %s is outside zone %s", name, z.Origin)
+		}
+		if rr.TTL != 0 {
+			return updateError(RcodeFormatError, "prerequisite %s has a non-zero TTL", name)
+		}
+
+		switch rr.Class {
+		case records.ClassANY:
+			if rr.Data != nil {
+				return updateError(RcodeFormatError, "prerequisite %s of class ANY has RDATA", name)
+			}
+			if rr.Type == records.TypeANY {
+				if !z.inUse(name) {
+					return updateError(RcodeNameError, "name %s is not in use", name)
+				}
+			} else if len(z.RRset(name, rr.Type)) == 0 {
+				return updateError(RcodeNXRRSet, "no %s RRset at %s", records.TypeName(rr.Type), name)
+			}
+		case records.ClassNONE:
+			if rr.Data != nil {
+				return updateError(RcodeFormatError, "prerequisite %s of class NONE has RDATA", name)
+			}
+			if rr.Type == records.TypeANY {
+				if z.inUse(name) {
+					return updateError(RcodeYXDomain, "name %s is in use", name)
+				}
+			} else if len(z.RRset(name, rr.Type)) > 0 {
+				return updateError(RcodeYXRRSet, "%s RRset exists at %s", records.TypeName(rr.Type), name)
+			}
+		case records.ClassIN:
+			if !records.IsDataType(rr.Type) {
+				return updateError(RcodeFormatError, "prerequisite %s has meta type %s", name, records.TypeName(rr.Type))
+			}
+			if err := required.Add(rr); err != nil {
+				return updateError(RcodeFormatError, "%v", err)
+			}
+		default:
+			return updateError(RcodeFormatError, "prerequisite %s has class %d", name, rr.Class)
+		}
+	}
+
+	for _, name := range required.Names() {
+		for _, rtype := range required.Types(name) {
+			if !sameRRset(required.RRset(name, rtype), z.RRset(name, rtype)) {
+				return updateError(RcodeNXRRSet, "%s RRset at %s does not match", records.TypeName(rtype), name)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyUpdate applies the update section of an update (RFC 2136 section
+// 3.4) to z in order and reports whether the zone changed. A changed zone
+// gets a new serial unless the update itself set a newer SOA. On error z
+// is left partially updated and must be discarded.
+func ApplyUpdate(z *Zone, updates []records.ResourceRecord) (bool, error) {
+	serial := z.Serial()
+	changed := false
+	for _, rr := range updates {
+		rr.Name = dnssec.CanonicalName(rr.Name)
+		if !dnssec.IsSubdomain(rr.Name, z.Origin) {
+			return false, updateError(RcodeNotZone, "update of %s is outside zone %s", rr.Name, z.Origin)
+		}
+
+		var applied bool
+		var err error
+		switch rr.Class {
+		case records.ClassIN:
+			applied, err = z.updateAdd(rr)
+		case records.ClassANY:
+			applied, err = z.updateDeleteRRsets(rr)
+		case records.ClassNONE:
+			applied, err = z.updateDeleteRecord(rr)
+		default:
+			err = updateError(RcodeFormatError, "update of %s has class %d", rr.Name, rr.Class)
+		}
+		if err != nil {
+			return false, err
+		}
+		changed = changed || applied
+	}
+
+	if changed && !SerialNewer(z.Serial(), serial) {
+		soa, data, err := z.SOA()
+		if err != nil {
+			return false, err
+		}
+		data.Serial = serial + 1
+		soa.Data = data
+		z.RemoveRRset(z.Origin, records.TypeSOA)
+		if err := z.Add(soa); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// updateAdd adds rr to its RRset, replacing the TTL of an identical record
+func (z *Zone) updateAdd(rr records.ResourceRecord) (bool, error) {
+	if !records.IsDataType(rr.Type) {
+		return false, updateError(RcodeFormatError, "cannot add %s record at %s", records.TypeName(rr.Type), rr.Name)
+	}
+	if handler, ok := records.HandlerFor(rr.Type); ok {
+		if err := handler.ValidateData(rr.Data); err != nil {
+			return false, updateError(RcodeFormatError, "invalid %s record at %s: %v", records.TypeName(rr.Type), rr.Name, err)
+		}
+	}
+
+	switch rr.Type {
+	case records.TypeSOA:
+		// Only a newer SOA at the apex replaces the current one
+		soa, ok := rr.Data.(records.SOAData)
+		if rr.Name != z.Origin || !ok || !SerialNewer(soa.Serial, z.Serial()) {
+			return false, nil
+		}
+		z.RemoveRRset(z.Origin, records.TypeSOA)
+		return true, z.Add(rr)
+	case records.TypeCNAME:
+		if z.hasNonCNAMEData(rr.Name) {
+			return false, nil
+		}
+		// A CNAME replaces the previous one rather than joining it
+		if existing := z.RRset(rr.Name, records.TypeCNAME); len(existing) > 0 && !sameData(existing[0], rr) {
+			z.RemoveRRset(rr.Name, records.TypeCNAME)
+		}
+	default:
+		if !isDNSSECType(rr.Type) && len(z.RRset(rr.Name, records.TypeCNAME)) > 0 {
+			return false, nil
+		}
+	}
+
+	for _, existing := range z.RRset(rr.Name, rr.Type) {
+		if sameData(existing, rr) {
+			if existing.TTL == rr.TTL {
+				return false, nil
+			}
+			z.Remove(existing)
+			break
+		}
+	}
+	return true, z.Add(rr)
+}
+
+// updateDeleteRRsets deletes the RRset of rr's type, or every RRset at the
+// name for type ANY. The apex SOA and NS RRsets are never deleted.
+func (z *Zone) updateDeleteRRsets(rr records.ResourceRecord) (bool, error) {
+	if rr.TTL != 0 || rr.Data != nil {
+		return false, updateError(RcodeFormatError, "RRset deletion at %s has a TTL or RDATA", rr.Name)
+	}
+	if rr.Type != records.TypeANY && !records.IsDataType(rr.Type) {
+		return false, updateError(RcodeFormatError, "cannot delete %s records at %s", records.TypeName(rr.Type), rr.Name)
+	}
+
+	types := []uint16{rr.Type}
+	if rr.Type == records.TypeANY {
+		types = z.Types(rr.Name)
+	}
+	changed := false
+	for _, rtype := range types {
+		if rr.Name == z.Origin && (rtype == records.TypeSOA || rtype == records.TypeNS) {
+			continue
+		}
+		if len(z.RRset(rr.Name, rtype)) > 0 {
+			z.RemoveRRset(rr.Name, rtype)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// updateDeleteRecord deletes the record matching rr. The SOA and the last
+// apex NS record are never deleted.
+func (z *Zone) updateDeleteRecord(rr records.ResourceRecord) (bool, error) {
+	if rr.TTL != 0 || !records.IsDataType(rr.Type) || rr.Data == nil {
+		return false, updateError(RcodeFormatError, "record deletion at %s is malformed", rr.Name)
+	}
+	if rr.Type == records.TypeSOA {
+		return false, nil
+	}
+	if rr.Name == z.Origin && rr.Type == records.TypeNS && len(z.RRset(rr.Name, records.TypeNS)) == 1 {
+		return false, nil
+	}
+	return z.Remove(rr), nil
+}
+
+// inUse reports whether name owns at least one record
+func (z *Zone) inUse(name string) bool {
+	return len(z.Types(name)) > 0
+}
+
+// hasNonCNAMEData reports whether name owns records that cannot coexist
+// with a CNAME
+func (z *Zone) hasNonCNAMEData(name string) bool {
+	for _, rtype := range z.Types(name) {
+		if rtype != records.TypeCNAME && !isDNSSECType(rtype) {
+			return true
+		}
+	}
+	return false
+}
+
+func isDNSSECType(rtype uint16) bool {
+	return rtype == records.TypeRRSIG || rtype == records.TypeNSEC || rtype == records.TypeNSEC3
+}
+
+// sameRRset compares two RRsets by RDATA, ignoring order and TTL
+func sameRRset(a, b []records.ResourceRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, rr := range a {
+		found := false
+		for _, other := range b {
+			if sameData(rr, other) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
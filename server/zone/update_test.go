@@ -0,0 +1,108 @@
+package zone
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+func rcodeOf(err error) uint16 {
+	var updateErr *UpdateError
+	if errors.As(err, &updateErr) {
+		return updateErr.Rcode
+	}
+	return 0
+}
+
+func TestCheckPrerequisites(t *testing.T) {
+	z := loadExample(t)
+	a := func(name, addr string) records.ResourceRecord {
+		return records.ResourceRecord{Name: name, Type: records.TypeA, Class: records.ClassIN, Data: addr}
+	}
+
+	tests := []struct {
+		name    string
+		prereqs []records.ResourceRecord
+		rcode   uint16
+	}{
+		{"name in use", []records.ResourceRecord{{Name: "web.example.com", Type: records.TypeANY, Class: records.ClassANY}}, 0},
+		{"empty non-terminal not in use", []records.ResourceRecord{{Name: "b.c.example.com", Type: records.TypeANY, Class: records.ClassANY}}, RcodeNameError},
+		{"RRset exists", []records.ResourceRecord{{Name: "web.example.com", Type: records.TypeA, Class: records.ClassANY}}, 0},
+		{"RRset missing", []records.ResourceRecord{{Name: "web.example.com", Type: records.TypeAAAA, Class: records.ClassANY}}, RcodeNXRRSet},
+		{"name not in use", []records.ResourceRecord{{Name: "new.example.com", Type: records.TypeANY, Class: records.ClassNONE}}, 0},
+		{"name unexpectedly in use", []records.ResourceRecord{{Name: "web.example.com", Type: records.TypeANY, Class: records.ClassNONE}}, RcodeYXDomain},
+		{"RRset unexpectedly exists", []records.ResourceRecord{{Name: "web.example.com", Type: records.TypeA, Class: records.ClassNONE}}, RcodeYXRRSet},
+		{"RRset matches", []records.ResourceRecord{a("web.example.com", "192.0.2.80")}, 0},
+		{"RRset differs", []records.ResourceRecord{a("web.example.com", "192.0.2.81")}, RcodeNXRRSet},
+		{"RRset is a subset", []records.ResourceRecord{a("web.example.com", "192.0.2.80"), a("web.example.com", "192.0.2.81")}, RcodeNXRRSet},
+		{"outside zone", []records.ResourceRecord{{Name: "example.org", Type: records.TypeANY, Class: records.ClassANY}}, RcodeNotZone},
+		{"non-zero TTL", []records.ResourceRecord{{Name: "web.example.com", Type: records.TypeA, Class: records.ClassANY, TTL: 60}}, RcodeFormatError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rcodeOf(CheckPrerequisites(z, tt.prereqs)); got != tt.rcode {
+				t.Errorf("Expected rcode %d, got %d", tt.rcode, got)
+			}
+		})
+	}
+}
+
+func TestApplyUpdate(t *testing.T) {
+	z := loadExample(t)
+	changed, err := ApplyUpdate(z, []records.ResourceRecord{
+		{Name: "host.example.com", Type: records.TypeA, Class: records.ClassIN, TTL: 60, Data: "192.0.2.10"},
+		{Name: "web.example.com", Type: records.TypeA, Class: records.ClassANY},
+		{Name: "mail.example.com", Type: records.TypeAAAA, Class: records.ClassNONE, Data: "2001:db8::25"},
+		{Name: "a.b.c.example.com", Type: records.TypeANY, Class: records.ClassANY},
+		// Ignored: the apex NS and SOA cannot be deleted, a CNAME cannot
+		// join other data
+		{Name: "example.com", Type: records.TypeANY, Class: records.ClassANY},
+		{Name: "example.com", Type: records.TypeNS, Class: records.ClassNONE, Data: "ns1.example.com"},
+		{Name: "mail.example.com", Type: records.TypeCNAME, Class: records.ClassIN, TTL: 60, Data: "web.example.com"},
+	})
+	if err != nil || !changed {
+		t.Fatalf("Update failed: changed=%v err=%v", changed, err)
+	}
+
+	if got := z.RRset("host.example.com", records.TypeA); len(got) != 1 || got[0].TTL != 60 {
+		t.Errorf("Added record missing: %+v", got)
+	}
+	if z.Exists("web.example.com") || len(z.RRset("mail.example.com", records.TypeAAAA)) != 0 {
+		t.Error("Deleted records are still present")
+	}
+	if z.Exists("b.c.example.com") {
+		t.Error("Empty non-terminals of deleted names must disappear")
+	}
+	if len(z.RRset("example.com", records.TypeNS)) != 1 || len(z.RRset("example.com", records.TypeMX)) != 0 {
+		t.Error("Apex deletion must keep only the SOA and NS records")
+	}
+	if len(z.RRset("mail.example.com", records.TypeCNAME)) != 0 {
+		t.Error("CNAME added next to other data")
+	}
+	if z.Serial() != 2024010102 {
+		t.Errorf("Expected the serial to be bumped, got %d", z.Serial())
+	}
+
+	// No-op updates leave the serial alone
+	changed, err = ApplyUpdate(z, []records.ResourceRecord{
+		{Name: "host.example.com", Type: records.TypeA, Class: records.ClassIN, TTL: 60, Data: "192.0.2.10"},
+		{Name: "missing.example.com", Type: records.TypeA, Class: records.ClassANY},
+	})
+	if err != nil || changed || z.Serial() != 2024010102 {
+		t.Errorf("Expected no change, got changed=%v serial=%d err=%v", changed, z.Serial(), err)
+	}
+
+	// A newer SOA from the update is kept rather than bumped again
+	soa, data, _ := z.SOA()
+	data.Serial = 2024020100
+	soa.Data = data
+	if _, err := ApplyUpdate(z, []records.ResourceRecord{soa}); err != nil || z.Serial() != 2024020100 {
+		t.Errorf("Expected the updated serial, got %d (%v)", z.Serial(), err)
+	}
+
+	_, err = ApplyUpdate(z, []records.ResourceRecord{{Name: "x.example.com", Type: records.TypeAXFR, Class: records.ClassIN}})
+	if rcodeOf(err) != RcodeFormatError {
+		t.Errorf("Expected FORMERR for a meta type, got %v", err)
+	}
+}
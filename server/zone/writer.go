@@ -0,0 +1,40 @@
+package zone
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Write writes z in canonical master file form: an $ORIGIN line, then one
+// "owner TTL IN type rdata" line per record with the SOA first and the
+// rest in canonical order. Every name is fully qualified, so the output
+// parses back to the same zone whatever origin it is loaded with.
+func Write(w io.Writer, z *Zone) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", fqdn(z.Origin))
+	for _, rr := range z.Records() {
+		rdata, err := records.FormatRData(rr.Type, rr.Data)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", rr.Name, records.TypeName(rr.Type), err)
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%s\t%s\n", fqdn(rr.Name), rr.TTL, className(rr.Class), records.TypeName(rr.Type), rdata)
+	}
+	return bw.Flush()
+}
+
+func fqdn(name string) string {
+	if name == "." {
+		return name
+	}
+	return name + "."
+}
+
+func className(class uint16) string {
+	if class == records.ClassIN {
+		return "IN"
+	}
+	return fmt.Sprintf("CLASS%d", class)
+}
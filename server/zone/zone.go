@@ -0,0 +1,249 @@
+// Package zone holds authoritative zone data in memory: loading it from
+// zone files, answering queries from it and signing it with DNSSEC.
+package zone
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+// Zone is the data of one zone keyed by canonical owner name and type.
+// A Zone is not safe for concurrent modification; publish changes by
+// building a new Zone (see Clone) and swapping it in.
+type Zone struct {
+	Origin string
+	nodes  map[string]map[uint16][]records.ResourceRecord
+}
+
+// New creates an empty zone for origin
+func New(origin string) *Zone {
+	return &Zone{
+		Origin: dnssec.CanonicalName(origin),
+		nodes:  make(map[string]map[uint16][]records.ResourceRecord),
+	}
+}
+
+// Add inserts rr, ignoring exact duplicates. Every ancestor between the
+// owner and the origin becomes a node, so empty non-terminals exist.
+func (z *Zone) Add(rr records.ResourceRecord) error {
+	rr.Name = dnssec.CanonicalName(rr.Name)
+	if !dnssec.IsSubdomain(rr.Name, z.Origin) {
+		return fmt.Errorf("%s is outside zone %s", rr.Name, z.Origin)
+	}
+	if rr.Class == 0 {
+		rr.Class = records.ClassIN
+	}
+	if handler, ok := records.HandlerFor(rr.Type); ok {
+		if err := handler.ValidateData(rr.Data); err != nil {
+			return fmt.Errorf("invalid %s record at %s: %w", records.TypeName(rr.Type), rr.Name, err)
+		}
+	}
+
+	for name := rr.Name; ; name = dnssec.Parent(name) {
+		if z.nodes[name] == nil {
+			z.nodes[name] = make(map[uint16][]records.ResourceRecord)
+		}
+		if name == z.Origin {
+			break
+		}
+	}
+
+	node := z.nodes[rr.Name]
+	for _, existing := range node[rr.Type] {
+		if sameData(existing, rr) {
+			return nil
+		}
+	}
+	node[rr.Type] = append(node[rr.Type], rr)
+	return nil
+}
+
+// RemoveRRset deletes every record of rtype at name
+func (z *Zone) RemoveRRset(name string, rtype uint16) {
+	name = dnssec.CanonicalName(name)
+	if node := z.nodes[name]; node != nil {
+		delete(node, rtype)
+		z.prune(name)
+	}
+}
+
+// Remove deletes the record with rr's owner, type and RDATA, reporting
+// whether it was present
+func (z *Zone) Remove(rr records.ResourceRecord) bool {
+	name := dnssec.CanonicalName(rr.Name)
+	rrs := z.nodes[name][rr.Type]
+	for i, existing := range rrs {
+		if !sameData(existing, rr) {
+			continue
+		}
+		if rest := append(rrs[:i:i], rrs[i+1:]...); len(rest) > 0 {
+			z.nodes[name][rr.Type] = rest
+		} else {
+			delete(z.nodes[name], rr.Type)
+		}
+		z.prune(name)
+		return true
+	}
+	return false
+}
+
+// prune drops name and its ancestors below the origin once they hold no
+// records and have no descendants, so removed names stop existing
+func (z *Zone) prune(name string) {
+	for ; name != z.Origin && dnssec.IsSubdomain(name, z.Origin); name = dnssec.Parent(name) {
+		if len(z.Types(name)) > 0 || z.hasChildren(name) {
+			return
+		}
+		delete(z.nodes, name)
+	}
+}
+
+func (z *Zone) hasChildren(name string) bool {
+	for other := range z.nodes {
+		if other != name && dnssec.IsSubdomain(other, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the zone has exactly one SOA, at its origin
+func (z *Zone) Validate() error {
+	soa := z.RRset(z.Origin, records.TypeSOA)
+	if len(soa) != 1 {
+		return fmt.Errorf("zone %s must have exactly one SOA record at its apex, found %d", z.Origin, len(soa))
+	}
+	for name, node := range z.nodes {
+		if _, ok := node[records.TypeSOA]; ok && name != z.Origin {
+			return fmt.Errorf("SOA record at %s is not at the apex of zone %s", name, z.Origin)
+		}
+	}
+	return nil
+}
+
+// SOA returns the apex SOA record
+func (z *Zone) SOA() (records.ResourceRecord, records.SOAData, error) {
+	soa := z.RRset(z.Origin, records.TypeSOA)
+	if len(soa) == 0 {
+		return records.ResourceRecord{}, records.SOAData{}, errors.New("zone " + z.Origin + " has no SOA record")
+	}
+	data, ok := soa[0].Data.(records.SOAData)
+	if !ok {
+		return records.ResourceRecord{}, records.SOAData{}, errors.New("malformed SOA record in zone " + z.Origin)
+	}
+	return soa[0], data, nil
+}
+
+// Serial returns the SOA serial, or 0 for a zone without SOA
+func (z *Zone) Serial() uint32 {
+	_, soa, _ := z.SOA()
+	return soa.Serial
+}
+
+// RRset returns a copy of the records of rtype at name
+func (z *Zone) RRset(name string, rtype uint16) []records.ResourceRecord {
+	rrs := z.nodes[dnssec.CanonicalName(name)][rtype]
+	return append([]records.ResourceRecord(nil), rrs...)
+}
+
+// Exists reports whether name is a node of the zone, including empty
+// non-terminals
+func (z *Zone) Exists(name string) bool {
+	_, ok := z.nodes[dnssec.CanonicalName(name)]
+	return ok
+}
+
+// Types returns the record types present at name in ascending order
+func (z *Zone) Types(name string) []uint16 {
+	node := z.nodes[dnssec.CanonicalName(name)]
+	types := make([]uint16, 0, len(node))
+	for rtype, rrs := range node {
+		if len(rrs) > 0 {
+			types = append(types, rtype)
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
+
+// Names returns every node holding records, in canonical order
+func (z *Zone) Names() []string {
+	var names []string
+	for name := range z.nodes {
+		if len(z.Types(name)) > 0 {
+			names = append(names, name)
+		}
+	}
+	sortNames(names)
+	return names
+}
+
+// Nodes returns every node, empty non-terminals included, in canonical order
+func (z *Zone) Nodes() []string {
+	names := make([]string, 0, len(z.nodes))
+	for name := range z.nodes {
+		names = append(names, name)
+	}
+	sortNames(names)
+	return names
+}
+
+// Records returns every record with the SOA first and the rest in
+// canonical order, the order used for zone transfers
+func (z *Zone) Records() []records.ResourceRecord {
+	out := z.RRset(z.Origin, records.TypeSOA)
+	for _, name := range z.Names() {
+		for _, rtype := range z.Types(name) {
+			if name == z.Origin && rtype == records.TypeSOA {
+				continue
+			}
+			out = append(out, z.nodes[name][rtype]...)
+		}
+	}
+	return out
+}
+
+// Delegation returns the zone cut at or above name, if name lies in a
+// delegated child zone. The apex itself is never a delegation.
+func (z *Zone) Delegation(name string) (string, bool) {
+	name = dnssec.CanonicalName(name)
+	var cut string
+	for n := name; n != z.Origin && dnssec.IsSubdomain(n, z.Origin); n = dnssec.Parent(n) {
+		if len(z.nodes[n][records.TypeNS]) > 0 {
+			cut = n
+		}
+	}
+	return cut, cut != ""
+}
+
+// Clone returns a copy that can be modified without affecting z
+func (z *Zone) Clone() *Zone {
+	c := New(z.Origin)
+	for name, node := range z.nodes {
+		copied := make(map[uint16][]records.ResourceRecord, len(node))
+		for rtype, rrs := range node {
+			copied[rtype] = append([]records.ResourceRecord(nil), rrs...)
+		}
+		c.nodes[name] = copied
+	}
+	return c
+}
+
+func sortNames(names []string) {
+	sort.Slice(names, func(i, j int) bool { return dnssec.CompareNames(names[i], names[j]) < 0 })
+}
+
+// sameData compares two records of the same type by their wire RDATA
+func sameData(a, b records.ResourceRecord) bool {
+	handler, ok := records.HandlerFor(a.Type)
+	if !ok {
+		return false
+	}
+	da, errA := handler.BuildRecordData(a.Data)
+	db, errB := handler.BuildRecordData(b.Data)
+	return errA == nil && errB == nil && string(da) == string(db)
+}
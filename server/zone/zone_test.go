@@ -0,0 +1,203 @@
+package zone
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+)
+
+const exampleZone = `
+$ORIGIN example.com.
+$TTL 3600
+@       IN SOA ns1 hostmaster 2024010101 7200 3600 1209600 300
+        IN NS  ns1
+        IN MX  10 mail
+ns1     IN A   192.0.2.53
+mail    300 IN A 192.0.2.25
+        IN AAAA 2001:db8::25
+www     IN CNAME web.example.com.
+web     IN A   192.0.2.80
+txt     IN TXT "v=spf1 -all" "second; not a comment"
+alias   IN CNAME missing
+a.b.c   IN A   192.0.2.99 ; creates empty non-terminals b.c and c
+_sip._tcp IN SRV 10 60 5060 mail
+opaque  IN TYPE65534 \# 3 abcdef
+`
+
+func loadExample(t *testing.T) *Zone {
+	t.Helper()
+	z, err := Parse(strings.NewReader(exampleZone), "example.com")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	return z
+}
+
+func TestParse(t *testing.T) {
+	z := loadExample(t)
+
+	if z.Serial() != 2024010101 {
+		t.Errorf("Serial = %d", z.Serial())
+	}
+	mail := z.RRset("MAIL.example.com", records.TypeA)
+	if len(mail) != 1 || mail[0].TTL != 300 || mail[0].Data != "192.0.2.25" {
+		t.Errorf("Unexpected mail A: %+v", mail)
+	}
+	if aaaa := z.RRset("mail.example.com", records.TypeAAAA); len(aaaa) != 1 || aaaa[0].TTL != 3600 {
+		t.Errorf("Owner and default TTL not inherited: %+v", aaaa)
+	}
+	if txt := z.RRset("txt.example.com", records.TypeTXT); len(txt) != 1 || !reflect.DeepEqual(txt[0].Data, []string{"v=spf1 -all", "second; not a comment"}) {
+		t.Errorf("Unexpected TXT: %+v", txt)
+	}
+	if raw := z.RRset("opaque.example.com", 65534); len(raw) != 1 || string(raw[0].Data.(records.RawData)) != "\xab\xcd\xef" {
+		t.Errorf("Unexpected generic record: %+v", raw)
+	}
+	if !z.Exists("b.c.example.com") || len(z.Types("b.c.example.com")) != 0 {
+		t.Error("Expected an empty non-terminal at b.c.example.com")
+	}
+	if got := z.Records()[0].Type; got != records.TypeSOA {
+		t.Errorf("Records should start with the SOA, got type %d", got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for name, text := range map[string]string{
+		"no_soa":       "www 300 IN A 192.0.2.1",
+		"outside_zone": "@ SOA ns hm 1 2 3 4 5\nwww.example.org. A 192.0.2.1",
+		"bad_rdata":    "@ SOA ns hm 1 2 3 4 5\nwww A 2001:db8::1",
+		"unknown_type": "@ SOA ns hm 1 2 3 4 5\nwww BOGUS data",
+		"open_quote":   "@ SOA ns hm 1 2 3 4 5\nwww TXT \"unterminated",
+	} {
+		if _, err := Parse(strings.NewReader(text), "example.com"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	z := loadExample(t)
+
+	tests := []struct {
+		name       string
+		qname      string
+		qtype      uint16
+		rcode      uint16
+		answer     []uint16
+		authority  int
+		additional int
+	}{
+		{"exact", "web.example.com", records.TypeA, RcodeSuccess, []uint16{records.TypeA}, 0, 0},
+		{"cname_chain", "www.example.com", records.TypeA, RcodeSuccess, []uint16{records.TypeCNAME, records.TypeA}, 0, 0},
+		{"cname_query", "www.example.com", records.TypeCNAME, RcodeSuccess, []uint16{records.TypeCNAME}, 0, 0},
+		{"cname_to_missing", "alias.example.com", records.TypeA, RcodeNameError, []uint16{records.TypeCNAME}, 1, 0},
+		{"nodata", "web.example.com", records.TypeAAAA, RcodeSuccess, nil, 1, 0},
+		{"nxdomain", "nope.example.com", records.TypeA, RcodeNameError, nil, 1, 0},
+		{"empty_non_terminal", "c.example.com", records.TypeA, RcodeSuccess, nil, 1, 0},
+		{"srv_additional", "_sip._tcp.example.com", records.TypeSRV, RcodeSuccess, []uint16{records.TypeSRV}, 0, 2},
+		{"any", "mail.example.com", TypeANY, RcodeSuccess, []uint16{records.TypeA, records.TypeAAAA}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ans := z.Lookup(tt.qname, tt.qtype)
+			if ans.Rcode != tt.rcode {
+				t.Errorf("Rcode = %d, want %d", ans.Rcode, tt.rcode)
+			}
+			var types []uint16
+			for _, rr := range ans.Answer {
+				types = append(types, rr.Type)
+			}
+			if !reflect.DeepEqual(types, tt.answer) {
+				t.Errorf("Answer types = %v, want %v", types, tt.answer)
+			}
+			if len(ans.Authority) != tt.authority || len(ans.Additional) != tt.additional {
+				t.Errorf("Authority/additional = %d/%d, want %d/%d", len(ans.Authority), len(ans.Additional), tt.authority, tt.additional)
+			}
+		})
+	}
+
+	// Negative answers use the SOA minimum as TTL
+	if soa := z.Lookup("nope.example.com", records.TypeA).Authority[0]; soa.TTL != 300 {
+		t.Errorf("Negative SOA TTL = %d, want 300", soa.TTL)
+	}
+}
+
+const delegatedZone = `
+$ORIGIN example.com.
+$TTL 3600
+@         IN SOA ns1 hostmaster 1 7200 3600 1209600 300
+          IN NS  ns1
+ns1       IN A   192.0.2.53
+*         IN A   192.0.2.1
+          IN TXT "wildcard"
+*.wild    IN CNAME web
+web       IN A   192.0.2.80
+deep.a.b  IN A   192.0.2.2
+child     IN NS  ns.child
+          IN NS  ns.example.net.
+          IN DS  12345 13 2 0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+ns.child  IN A   192.0.2.54
+insecure  IN NS  ns.example.net.
+`
+
+func TestLookup_WildcardAndDelegation(t *testing.T) {
+	z, err := Parse(strings.NewReader(delegatedZone), "example.com")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	// Synthesised records take the query name as owner
+	ans := z.Lookup("anything.example.com", records.TypeA)
+	if len(ans.Answer) != 1 || ans.Answer[0].Name != "anything.example.com" || ans.Answer[0].Data != "192.0.2.1" {
+		t.Errorf("Expected a wildcard answer, got %+v", ans.Answer)
+	}
+	if ans := z.Lookup("x.y.example.com", records.TypeTXT); len(ans.Answer) != 1 {
+		t.Errorf("Expected the wildcard to match several labels, got %+v", ans)
+	}
+	if ans := z.Lookup("anything.example.com", records.TypeMX); ans.Rcode != RcodeSuccess || len(ans.Answer) != 0 || len(ans.Authority) != 1 {
+		t.Errorf("Expected NODATA from the wildcard, got %+v", ans)
+	}
+	ans = z.Lookup("host.wild.example.com", records.TypeA)
+	if len(ans.Answer) != 2 || ans.Answer[0].Name != "host.wild.example.com" || ans.Answer[0].Type != records.TypeCNAME {
+		t.Errorf("Expected a synthesised CNAME followed to its target, got %+v", ans.Answer)
+	}
+
+	// Existing names, empty non-terminals included, block the wildcard
+	if ans := z.Lookup("web.example.com", records.TypeTXT); len(ans.Answer) != 0 {
+		t.Errorf("Wildcard must not apply to an existing name, got %+v", ans.Answer)
+	}
+	if ans := z.Lookup("b.example.com", records.TypeA); ans.Rcode != RcodeSuccess || len(ans.Answer) != 0 {
+		t.Errorf("Expected NODATA at the empty non-terminal, got %+v", ans)
+	}
+	if ans := z.Lookup("x.b.example.com", records.TypeA); ans.Rcode != RcodeNameError {
+		t.Errorf("Expected NXDOMAIN below an empty non-terminal without wildcard, got %+v", ans)
+	}
+
+	// Names at and below the cut get a referral with glue
+	for _, qname := range []string{"child.example.com", "www.child.example.com", "ns.child.example.com"} {
+		ans := z.Lookup(qname, records.TypeA)
+		if !ans.Referral || len(ans.Answer) != 0 || countType(ans.Authority, records.TypeNS) != 2 || len(ans.Authority) != 2 {
+			t.Errorf("%s: expected a referral, got %+v", qname, ans)
+		}
+		if len(ans.Additional) != 1 || ans.Additional[0].Name != "ns.child.example.com" {
+			t.Errorf("%s: expected in-zone glue only, got %+v", qname, ans.Additional)
+		}
+	}
+	// The parent answers DS queries for the cut itself
+	if ans := z.Lookup("child.example.com", records.TypeDS); ans.Referral || len(ans.Answer) != 1 {
+		t.Errorf("Expected the DS from the parent, got %+v", ans)
+	}
+}
+
+func TestClone(t *testing.T) {
+	z := loadExample(t)
+	c := z.Clone()
+	if err := c.Add(records.ResourceRecord{Name: "new.example.com", Type: records.TypeA, TTL: 60, Data: "192.0.2.7"}); err != nil {
+		t.Fatal(err)
+	}
+	if z.Exists("new.example.com") {
+		t.Error("Changes to a clone leaked into the original")
+	}
+}
@@ -0,0 +1,238 @@
+// server/zones.go
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+// ZoneAnswer is an authoritative answer from a local zone. It travels
+// through DNSHandler like any other result and is written with all its
+// sections and the AA flag.
+type ZoneAnswer struct {
+	zone.Answer
+}
+
+// ZoneStore holds the zones served authoritatively. Zones are replaced as
+// a whole, so readers always see a complete zone.
+type ZoneStore struct {
+	mu       sync.RWMutex
+	zones    map[string]*servedZone
+	onChange []func(soa records.ResourceRecord)
+	updateMu sync.Mutex // serializes Update and ReplaceZones
+}
+
+type servedZone struct {
+	source  *zone.Zone // as loaded, used for transfers
+	data    *zone.Zone // prepared by signer when signed
+	signer  *zone.Signer
+	journal *zone.Journal
+}
+
+// NewZoneStore creates an empty zone store
+func NewZoneStore() *ZoneStore {
+	return &ZoneStore{zones: make(map[string]*servedZone)}
+}
+
+// ZoneSource is a zone to serve together with its signer, nil when the
+// zone is served unsigned
+type ZoneSource struct {
+	Zone   *zone.Zone
+	Signer *zone.Signer
+}
+
+// AddZone serves z, replacing any zone with the same origin. With a signer
+// the zone is published with its DNSSEC records and answers are signed
+// for clients that set the DO bit. Replacing a zone with a new serial
+// journals the difference for IXFR.
+func (s *ZoneStore) AddZone(z *zone.Zone, signer *zone.Signer) error {
+	return s.ReplaceZones([]ZoneSource{{Zone: z, Signer: signer}}, nil)
+}
+
+// ReplaceZones serves every zone of zones and stops serving the origins in
+// remove that zones does not contain. All zones are validated and signed
+// before any is swapped in, so on error the store is left unchanged. The
+// swap waits for a running Update, which would otherwise put back the zone
+// it started from.
+func (s *ZoneStore) ReplaceZones(zones []ZoneSource, remove []string) error {
+	prepared := make([]*servedZone, 0, len(zones))
+	for _, source := range zones {
+		served, err := prepareZone(source)
+		if err != nil {
+			return err
+		}
+		prepared = append(prepared, served)
+	}
+
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	return s.swap(prepared, remove)
+}
+
+// swap serves the prepared zones and stops serving the origins in remove
+// that are not among them. The caller holds updateMu.
+func (s *ZoneStore) swap(prepared []*servedZone, remove []string) error {
+	keep := make(map[string]bool, len(prepared))
+	for _, served := range prepared {
+		keep[served.source.Origin] = true
+	}
+
+	s.mu.Lock()
+	var changed []records.ResourceRecord
+	for _, served := range prepared {
+		z := served.source
+		served.journal = zone.NewJournal(zone.DefaultJournalSize)
+		previous, replaced := s.zones[z.Origin]
+		if replaced {
+			served.journal = previous.journal
+		}
+		if replaced && previous.source.Serial() != z.Serial() {
+			delta, err := zone.Diff(previous.source, z)
+			if err != nil {
+				s.mu.Unlock()
+				return err
+			}
+			served.journal.Append(delta)
+			soa, _, _ := z.SOA()
+			changed = append(changed, soa)
+		}
+	}
+	for _, served := range prepared {
+		s.zones[served.source.Origin] = served
+	}
+	var removed []string
+	for _, origin := range remove {
+		origin = dnssec.CanonicalName(origin)
+		if _, ok := s.zones[origin]; ok && !keep[origin] {
+			delete(s.zones, origin)
+			removed = append(removed, origin)
+		}
+	}
+	hooks := s.onChange
+	s.mu.Unlock()
+
+	for _, served := range prepared {
+		log.Printf("Serving zone %s (serial %d, signed: %v)", served.source.Origin, served.source.Serial(), served.signer != nil)
+	}
+	for _, origin := range removed {
+		log.Printf("Stopped serving zone %s", origin)
+	}
+	for _, soa := range changed {
+		for _, hook := range hooks {
+			hook(soa)
+		}
+	}
+	return nil
+}
+
+// prepareZone validates a zone and signs it when it has a signer
+func prepareZone(source ZoneSource) (*servedZone, error) {
+	z := source.Zone
+	if err := z.Validate(); err != nil {
+		return nil, err
+	}
+	served := &servedZone{source: z, data: z, signer: source.Signer}
+	if source.Signer != nil {
+		prepared, err := source.Signer.Prepare(z)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign zone %s: %w", z.Origin, err)
+		}
+		served.data = prepared
+	}
+	return served, nil
+}
+
+// OnSerialChange registers fn to be called with the new SOA whenever a
+// served zone is replaced by one with a different serial
+func (s *ZoneStore) OnSerialChange(fn func(soa records.ResourceRecord)) {
+	s.mu.Lock()
+	s.onChange = append(s.onChange, fn)
+	s.mu.Unlock()
+}
+
+// Update calls fn with a copy of the zone at origin and, when fn reports a
+// change, serves the copy in its place with the same signer. Updates and
+// zone replacements run one at a time so each sees the result of the
+// previous one.
+func (s *ZoneStore) Update(origin string, fn func(z *zone.Zone) (bool, error)) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	served, ok := s.zone(origin)
+	if !ok {
+		return fmt.Errorf("%w %s", errNotAuthoritative, origin)
+	}
+	next := served.source.Clone()
+	changed, err := fn(next)
+	if err != nil || !changed {
+		return err
+	}
+	updated, err := prepareZone(ZoneSource{Zone: next, Signer: served.signer})
+	if err != nil {
+		return err
+	}
+	return s.swap([]*servedZone{updated}, nil)
+}
+
+// RemoveZone stops serving the zone at origin
+func (s *ZoneStore) RemoveZone(origin string) {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	s.mu.Lock()
+	delete(s.zones, dnssec.CanonicalName(origin))
+	s.mu.Unlock()
+}
+
+// zone returns the zone whose origin is exactly name
+func (s *ZoneStore) zone(name string) (*servedZone, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	served, ok := s.zones[dnssec.CanonicalName(name)]
+	return served, ok
+}
+
+// find returns the zone with the longest origin containing qname
+func (s *ZoneStore) find(qname string) (*servedZone, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for name := dnssec.CanonicalName(qname); ; name = dnssec.Parent(name) {
+		if served, ok := s.zones[name]; ok {
+			return served, true
+		}
+		if name == "." {
+			return nil, false
+		}
+	}
+}
+
+// Lookup answers qname/qtype when it falls inside a served zone
+func (s *ZoneStore) Lookup(ctx context.Context, qname string, qtype uint16) (*ZoneAnswer, bool, error) {
+	served, ok := s.find(qname)
+	if !ok {
+		return nil, false, nil
+	}
+
+	ans := served.data.Lookup(qname, qtype)
+	if served.signer != nil && dnssecOKFromContext(ctx) {
+		signed, err := served.signer.SignAnswer(served.data, qname, qtype, ans)
+		if err != nil {
+			return nil, true, err
+		}
+		ans = signed
+	}
+	return &ZoneAnswer{Answer: ans}, true, nil
+}
+
+func zoneRecordHandler(rr records.ResourceRecord) (records.RecordHandler, error) {
+	handler, ok := records.HandlerFor(rr.Type)
+	if !ok {
+		return nil, fmt.Errorf("no handler for %s record %s", records.TypeName(rr.Type), rr.Name)
+	}
+	return handler, nil
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/dnssec"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/records"
+	"github.com/Puneet-Pal-Singh/dns-server-go/server/zone"
+)
+
+const testZoneFile = `
+$TTL 300
+@     IN SOA ns1 hostmaster 1 7200 3600 1209600 300
+@     IN NS  ns1
+ns1   IN A   192.0.2.53
+www   IN A   192.0.2.80
+alias IN CNAME www
+`
+
+func newTestStore(t *testing.T, signer *zone.Signer) *ZoneStore {
+	t.Helper()
+	z, err := zone.Parse(strings.NewReader(testZoneFile), "example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewZoneStore()
+	if err := store.AddZone(z, signer); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// storeQuerier answers validator queries from a zone store over the wire
+// format, as a client of this server would see them
+type storeQuerier struct {
+	store *ZoneStore
+}
+
+func (q storeQuerier) QueryDNSSEC(ctx context.Context, domain string, qtype uint16) (*UpstreamResponse, error) {
+	ctx = context.WithValue(ctx, dnssecOKKey, true)
+	answer, ok, err := q.store.Lookup(ctx, domain, qtype)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("not authoritative")
+	}
+	resp := &Msg{
+		ID:                 1,
+		Response:           true,
+		Authoritative:      true,
+		RecursionDesired:   true,
+		RecursionAvailable: true,
+		Rcode:              answer.Rcode,
+		Question:           []Question{{Name: domain, Type: qtype, Class: records.ClassIN}},
+		Answer:             answer.Answer.Answer,
+		Authority:          answer.Authority,
+		Additional:         answer.Additional,
+		EDNS:               &EDNS{UDPSize: ednsPayloadSize, DO: true},
+	}
+	msg, err := resp.Pack()
+	if err != nil {
+		return nil, err
+	}
+	return parseResponse(msg)
+}
+
+func TestZoneStore_Lookup(t *testing.T) {
+	store := newTestStore(t, nil)
+
+	answer, ok, err := store.Lookup(context.Background(), "WWW.example.test", records.TypeA)
+	if err != nil || !ok {
+		t.Fatalf("Lookup failed: ok=%v err=%v", ok, err)
+	}
+	if len(answer.Answer.Answer) != 1 || answer.Answer.Answer[0].Data != "192.0.2.80" {
+		t.Errorf("Unexpected answer: %+v", answer.Answer.Answer)
+	}
+
+	answer, _, _ = store.Lookup(context.Background(), "missing.example.test", records.TypeA)
+	if answer.Rcode != zone.RcodeNameError || len(answer.Authority) != 1 {
+		t.Errorf("Expected NXDOMAIN with SOA, got rcode %d authority %+v", answer.Rcode, answer.Authority)
+	}
+
+	if _, ok, _ := store.Lookup(context.Background(), "example.com", records.TypeA); ok {
+		t.Error("Names outside the served zones must not be answered")
+	}
+}
+
+func TestZoneStore_SignsOnlyForDO(t *testing.T) {
+	ksk, err := dnssec.GenerateKey(dnssec.AlgECDSAP256SHA256, records.DNSKEYFlagZone|records.DNSKEYFlagSEP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zsk, err := dnssec.GenerateKey(dnssec.AlgECDSAP256SHA256, records.DNSKEYFlagZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newTestStore(t, zone.NewSigner(ksk, zsk, zone.DenialNSEC))
+
+	plain, _, _ := store.Lookup(context.Background(), "www.example.test", records.TypeA)
+	for _, rr := range plain.Answer.Answer {
+		if rr.Type == records.TypeRRSIG {
+			t.Error("Answer signed without the DO bit")
+		}
+	}
+
+	// A validator anchored at the zone's KSK accepts the served answers
+	ds, err := dnssec.ComputeDS("example.test", ksk.DNSKEY, dnssec.DigestSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor := records.ResourceRecord{Name: "example.test", Type: records.TypeDS, Class: records.ClassIN, TTL: 3600, Data: ds}
+	v, err := NewValidator(storeQuerier{store}, []records.ResourceRecord{anchor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, secure, err := v.Validate(context.Background(), "alias.example.test", records.TypeA)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if _, err := answersOfType(resp.Answer, records.TypeCNAME); err != nil || !secure {
+		t.Errorf("Expected a secure CNAME, got secure=%v answers=%+v", secure, resp.Answer)
+	}
+	if _, err := answersOfType(resp.Answer, records.TypeA); err != nil {
+		t.Errorf("Expected the CNAME target's address, got %+v", resp.Answer)
+	}
+}
+
+func TestWriteZoneAnswer_FlagsAndOPT(t *testing.T) {
+	store := newTestStore(t, nil)
+	answer, _, _ := store.Lookup(context.Background(), "nope.example.test", records.TypeA)
+
+	req := queryMsg("nope.example.test", records.TypeA)
+	req.ID = 7
+	req.EDNS = &EDNS{UDPSize: 1232}
+	w := &recordingWriter{}
+	writeZoneAnswer(w, req, answer)
+	msg := w.msgs[0]
+
+	got := binary.BigEndian.Uint16(msg[2:4])
+	if got&flagAA == 0 || got&0x000F != zone.RcodeNameError {
+		t.Errorf("Unexpected flags %#04x", got)
+	}
+	if ns, ar := binary.BigEndian.Uint16(msg[8:10]), binary.BigEndian.Uint16(msg[10:12]); ns != 1 || ar != 1 {
+		t.Errorf("Expected 1 authority and 1 OPT record, got %d and %d", ns, ar)
+	}
+	if resp, err := UnpackMsg(msg); err != nil || resp.EDNS == nil || resp.udpSize() != ednsPayloadSize || resp.DNSSECOK() {
+		t.Errorf("OPT record not echoed correctly: %+v, %v", resp, err)
+	}
+}
+
+func TestWriteZoneAnswer_Referral(t *testing.T) {
+	z, err := zone.Parse(strings.NewReader(testZoneFile+"sub IN NS ns.sub\nns.sub IN A 192.0.2.54\n"), "example.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewZoneStore()
+	if err := store.AddZone(z, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, _, _ := store.Lookup(context.Background(), "www.sub.example.test", records.TypeA)
+	w := &recordingWriter{}
+	writeZoneAnswer(w, queryMsg("www.sub.example.test", records.TypeA), answer)
+	msg := w.msgs[0]
+	if flags := binary.BigEndian.Uint16(msg[2:4]); flags&flagAA != 0 || flags&0x000F != 0 {
+		t.Errorf("Referrals must not be authoritative: flags %#04x", flags)
+	}
+	an, ns, ar := binary.BigEndian.Uint16(msg[6:8]), binary.BigEndian.Uint16(msg[8:10]), binary.BigEndian.Uint16(msg[10:12])
+	if an != 0 || ns != 1 || ar != 1 {
+		t.Errorf("Expected NS in authority and glue in additional, got %d/%d/%d", an, ns, ar)
+	}
+}
+
+func TestMsg_EDNS(t *testing.T) {
+	query, err := buildDNSSECQuery(42, "example.test", records.TypeA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := UnpackMsg(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.DNSSECOK() || req.udpSize() != ednsPayloadSize {
+		t.Errorf("Unexpected EDNS options: %+v", req.EDNS)
+	}
+
+	for _, tt := range []struct {
+		edns *EDNS
+		want int
+	}{
+		{nil, minUDPSize},
+		{&EDNS{UDPSize: 100}, minUDPSize},
+		{&EDNS{UDPSize: 0xFFFF}, maxUDPSize},
+	} {
+		req.EDNS = tt.edns
+		if got := req.udpSize(); got != tt.want {
+			t.Errorf("EDNS %+v: UDP size %d, want %d", tt.edns, got, tt.want)
+		}
+	}
+}
+
+func TestZoneStore_ReplaceDuringUpdate(t *testing.T) {
+	store := newTestStore(t, nil)
+	reloaded, err := zone.Parse(strings.NewReader(strings.NewReplacer("hostmaster 1 ", "hostmaster 5 ", "192.0.2.80", "192.0.2.81").Replace(testZoneFile)), "example.test.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The reload runs while the update is between reading the zone and
+	// serving its copy; the update must not put back the zone it read
+	done := make(chan error, 1)
+	err = store.Update("example.test", func(z *zone.Zone) (bool, error) {
+		go func() { done <- store.ReplaceZones([]ZoneSource{{Zone: reloaded}}, nil) }()
+		select {
+		case err := <-done:
+			done <- err
+		case <-time.After(50 * time.Millisecond):
+		}
+		return true, z.Add(records.ResourceRecord{Name: "new.example.test", Type: records.TypeA, Class: records.ClassIN, TTL: 60, Data: "192.0.2.9"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := lookupA(t, store, "www.example.test"); got != "192.0.2.81" {
+		t.Errorf("www = %v, want the reloaded 192.0.2.81", got)
+	}
+	if served, _ := store.zone("example.test"); served.source.Serial() != 5 {
+		t.Errorf("serial %d, want 5", served.source.Serial())
+	}
+}